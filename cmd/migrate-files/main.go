@@ -0,0 +1,69 @@
+package main
+
+// migrate-files moves stored files (blobs and legacy files) between storage backends and updates File.FilePath.
+//
+// Usage:
+//
+//	migrate-files -from local -to s3 [-dry-run] [-delete-source] [-batch 100]
+//
+// Backend được cấu hình bằng cùng biến môi trường với server (FILE_STORAGE_DIR, S3_*).
+// Sau khi chạy xong, đặt FILE_STORAGE_BACKEND=<to> để file mới được ghi vào backend đích.
+
+import (
+	"flag"
+	"log"
+
+	"github.com/joho/godotenv"
+	"github.com/onegreenvn/green-provider-services-backend/internal/database"
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services/storage"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	from := flag.String("from", storage.BackendLocal, "Source backend (local, s3)")
+	to := flag.String("to", storage.BackendS3, "Destination backend (local, s3)")
+	dryRun := flag.Bool("dry-run", false, "List files that would be migrated without copying them")
+	deleteSource := flag.Bool("delete-source", false, "Delete files from the source backend after migration")
+	batchSize := flag.Int("batch", 100, "Number of file records loaded per query")
+	flag.Parse()
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+	logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+
+	source, err := storage.NewBlobStore(*from)
+	if err != nil {
+		logrus.Fatalf("Invalid source backend: %v", err)
+	}
+	destination, err := storage.NewBlobStore(*to)
+	if err != nil {
+		logrus.Fatalf("Invalid destination backend: %v", err)
+	}
+
+	// Initialize database connection
+	db, err := database.InitDB()
+	if err != nil {
+		logrus.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	logrus.Infof("Migrating files from %s to %s (dry run: %v, delete source: %v)", source.Name(), destination.Name(), *dryRun, *deleteSource)
+	stats, err := services.MigrateFileStorage(repository.NewFileRepository(db), repository.NewFileBlobRepository(db), source, destination, services.FileStorageMigrationOptions{
+		BatchSize:    *batchSize,
+		DryRun:       *dryRun,
+		DeleteSource: *deleteSource,
+	})
+	if stats != nil {
+		logrus.Infof("File migration finished: scanned %d blobs/files, migrated %d (%d bytes), skipped %d, failed %d",
+			stats.Scanned, stats.Migrated, stats.Bytes, stats.Skipped, stats.Failed)
+	}
+	if err != nil {
+		logrus.Fatalf("File migration aborted: %v", err)
+	}
+	if stats.Failed > 0 {
+		logrus.Fatalf("%d files failed to migrate, re-run the command to retry", stats.Failed)
+	}
+}
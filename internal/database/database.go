@@ -94,8 +94,19 @@ func InitDB() (*gorm.DB, error) {
 		&models.ProcessLog{},
 		&models.APIKey{},
 		&models.File{},
+		&models.FileBlob{}, // Content-addressed file contents (dedup)
+		&models.StorageQuota{},
+		&models.UploadStaging{}, // File upload chờ gắn vào prompt / gem
+		&models.UploadSession{}, // Resumable (chunked) upload
+		&models.DownloadToken{}, // Signed download URL / share link (revoke, giới hạn lượt tải)
+		&models.RevokedDownloadToken{}, // Revocation list của signed download URL
+		&models.FileText{},      // Text trích xuất từ file (preview, đếm ký tự / token)
+		&models.Permission{}, // Permission gán cho role (role_permissions)
 		&models.Role{},
 		&models.GeminiAccount{}, // New: Gemini accounts table
+		&models.QuarantinedProcessLog{},
+		&models.LogArchive{},
+		&models.TopicRemoval{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
@@ -439,8 +450,9 @@ func InitDB() (*gorm.DB, error) {
 		name        string
 		description string
 	}{
-		{"topic_creator", "Can create topics"},
-		{"topic_user", "Can access and use topics"},
+		{models.RoleTopicCreator, "Can create topics"},
+		{models.RoleTopicUser, "Can access and use topics"},
+		{models.RoleAdmin, "All permissions"},
 	}
 
 	for _, roleData := range defaultRoles {
@@ -470,6 +482,32 @@ func InitDB() (*gorm.DB, error) {
 		}
 	}
 
+	// Migration: Seed permissions; permission mới tạo được gán cho các role mặc định của nó.
+	// Permission đã tồn tại không gán lại (giữ thay đổi của admin trên role).
+	for _, definition := range models.DefaultPermissions {
+		permission := models.Permission{Name: definition.Name}
+		result := db.Where("name = ?", definition.Name).
+			Attrs(models.Permission{Description: definition.Description}).
+			FirstOrCreate(&permission)
+		if result.Error != nil {
+			logrus.Warnf("Failed to create %s permission: %v", definition.Name, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		logrus.Infof("Created permission '%s'", definition.Name)
+		for _, roleName := range definition.DefaultRoles {
+			if err := db.Exec(`
+				INSERT INTO role_permissions (role_id, permission_id)
+				SELECT id, ? FROM roles WHERE name = ?
+				ON CONFLICT DO NOTHING
+			`, permission.ID, roleName).Error; err != nil {
+				logrus.Warnf("Failed to grant %s permission to %s role: %v", definition.Name, roleName, err)
+			}
+		}
+	}
+
 	// Migration: Add unique constraint on scripts (topic_id, user_id) for 1-1 relationship
 	var scriptsUniqueIndexExists bool
 	err = db.Raw(`
@@ -686,6 +724,49 @@ func InitDB() (*gorm.DB, error) {
 		}
 	}
 
+	// Migration: Add input_file_refs column to script_prompts (tham chiếu input theo file_id thay vì original_name)
+	err = db.Exec("ALTER TABLE script_prompts ADD COLUMN IF NOT EXISTS input_file_refs JSONB").Error
+	if err != nil {
+		logrus.Warnf("Failed to add input_file_refs column to script_prompts: %v", err)
+	} else {
+		// Resolve input_files (tên) của prompt cũ thành refs:
+		// tên trùng filename của prompt / project trong cùng script (có hoặc bỏ extension) → output của execution,
+		// tên trùng file của owner script → ghim file mới nhất cùng tên, còn lại → output
+		result := db.Exec(`
+			UPDATE script_prompts p
+			SET input_file_refs = COALESCE((
+				SELECT jsonb_agg(
+					CASE
+						WHEN EXISTS (
+							SELECT 1 FROM script_prompts o
+							WHERE o.script_id = p.script_id AND o.filename <> ''
+							AND o.filename IN (t.name, regexp_replace(t.name, '\.[^.]*$', ''))
+						) OR EXISTS (
+							SELECT 1 FROM script_projects sp
+							WHERE sp.script_id = p.script_id AND sp.filename <> ''
+							AND sp.filename IN (t.name, regexp_replace(t.name, '\.[^.]*$', ''))
+						) THEN jsonb_build_object('name', t.name, 'mode', 'output')
+						WHEN f.id IS NOT NULL THEN jsonb_build_object('name', t.name, 'file_id', f.id::text, 'mode', 'file')
+						ELSE jsonb_build_object('name', t.name, 'mode', 'output')
+					END ORDER BY t.ord)
+				FROM jsonb_array_elements_text(CASE WHEN jsonb_typeof(p.input_files) = 'array' THEN p.input_files ELSE '[]'::jsonb END) WITH ORDINALITY AS t(name, ord)
+				JOIN scripts s ON s.id = p.script_id
+				LEFT JOIN LATERAL (
+					SELECT files.id FROM files
+					WHERE files.user_id = s.user_id AND files.original_name = t.name
+					ORDER BY files.created_at DESC
+					LIMIT 1
+				) f ON TRUE
+			), '[]'::jsonb)
+			WHERE p.input_file_refs IS NULL
+		`)
+		if result.Error != nil {
+			logrus.Warnf("Failed to resolve input_files of script_prompts to input_file_refs: %v", result.Error)
+		} else if result.RowsAffected > 0 {
+			logrus.Infof("Resolved input files of %d script prompts to input_file_refs", result.RowsAffected)
+		}
+	}
+
 	// Migration: Add project_id and temp_prompt_id columns to files table if they don't exist
 	var filesProjectIDColumnExists bool
 	err = db.Raw(`
@@ -746,6 +827,53 @@ func InitDB() (*gorm.DB, error) {
 		}
 	}
 
+	// Migration: Add box_id column to script_executions table (machine được dispatch, dùng để verify log ingest)
+	var scriptExecutionsBoxIDColumnExists bool
+	err = db.Raw(`
+		SELECT EXISTS (
+			SELECT 1
+			FROM information_schema.columns
+			WHERE table_schema = 'public'
+			AND table_name = 'script_executions'
+			AND column_name = 'box_id'
+		)
+	`).Scan(&scriptExecutionsBoxIDColumnExists).Error
+	if err != nil {
+		logrus.Warnf("Failed to check if box_id column exists on script_executions: %v", err)
+	} else if !scriptExecutionsBoxIDColumnExists {
+		logrus.Info("Adding box_id column to script_executions table...")
+		err = db.Exec("ALTER TABLE script_executions ADD COLUMN IF NOT EXISTS box_id UUID").Error
+		if err != nil {
+			logrus.Warnf("Failed to add box_id column to script_executions: %v", err)
+		} else {
+			logrus.Info("Successfully added box_id column to script_executions")
+			err = db.Exec("CREATE INDEX IF NOT EXISTS idx_script_executions_box_id ON script_executions(box_id)").Error
+			if err != nil {
+				logrus.Warnf("Failed to create index on script_executions.box_id: %v", err)
+			}
+		}
+	}
+
+	// Migration: Indexes for process log search (GET /process-logs/search)
+	processLogIndexes := []struct {
+		name string
+		sql  string
+	}{
+		{"idx_process_logs_created_at", "CREATE INDEX IF NOT EXISTS idx_process_logs_created_at ON process_logs(created_at)"},
+		{"idx_process_logs_machine_created", "CREATE INDEX IF NOT EXISTS idx_process_logs_machine_created ON process_logs(machine_id, created_at)"},
+		{"idx_process_logs_status_created", "CREATE INDEX IF NOT EXISTS idx_process_logs_status_created ON process_logs(status, created_at)"},
+		{"idx_process_logs_entity_seq", "CREATE INDEX IF NOT EXISTS idx_process_logs_entity_seq ON process_logs(entity_type, entity_id, seq)"},
+		// Full-text trên message: config 'simple' (không stemming) để dùng được với tiếng Việt
+		{"idx_process_logs_message_fts", "CREATE INDEX IF NOT EXISTS idx_process_logs_message_fts ON process_logs USING GIN (to_tsvector('simple', message))"},
+		// JSONB containment (metadata @> ...)
+		{"idx_process_logs_metadata_gin", "CREATE INDEX IF NOT EXISTS idx_process_logs_metadata_gin ON process_logs USING GIN (metadata jsonb_path_ops)"},
+	}
+	for _, index := range processLogIndexes {
+		if err := db.Exec(index.sql).Error; err != nil {
+			logrus.Warnf("Failed to create index %s: %v", index.name, err)
+		}
+	}
+
 	// Set global DB instance
 	DB = db
 
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 
@@ -76,6 +77,16 @@ func (r *BoxRepository) GetByMachineID(machineID string) (*models.Box, error) {
 	return &box, nil
 }
 
+// UpdateSecret updates the machine secret hash of a box
+func (r *BoxRepository) UpdateSecret(boxID, secretHash string, issuedAt time.Time) error {
+	return r.db.Model(&models.Box{}).
+		Where("id = ?", boxID).
+		Updates(map[string]interface{}{
+			"secret_hash":      secretHash,
+			"secret_issued_at": issuedAt,
+		}).Error
+}
+
 // GetByUserIDAndID retrieves a box by user ID and box ID
 func (r *BoxRepository) GetByUserIDAndID(userID, boxID string) (*models.Box, error) {
 	var box models.Box
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DownloadTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewDownloadTokenRepository(db *gorm.DB) *DownloadTokenRepository {
+	return &DownloadTokenRepository{db: db}
+}
+
+// Create creates a download token
+func (r *DownloadTokenRepository) Create(token *models.DownloadToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetByID retrieves a download token by ID (jti)
+func (r *DownloadTokenRepository) GetByID(id string) (*models.DownloadToken, error) {
+	var token models.DownloadToken
+	err := r.db.First(&token, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetByFileID retrieves the tokens of a file with a purpose, newest first
+func (r *DownloadTokenRepository) GetByFileID(fileID, purpose string) ([]*models.DownloadToken, error) {
+	var tokens []*models.DownloadToken
+	err := r.db.Where("file_id = ? AND purpose = ?", fileID, purpose).
+		Order("created_at DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// Consume atomically counts a download if the token is still usable
+// (chưa revoke, chưa hết hạn, chưa hết lượt tải). Trả về gorm.ErrRecordNotFound nếu không còn dùng được.
+func (r *DownloadTokenRepository) Consume(id string, now time.Time) (*models.DownloadToken, error) {
+	var tokens []*models.DownloadToken
+	err := r.db.Raw(`
+		UPDATE download_tokens
+		SET download_count = download_count + 1, last_used_at = ?, updated_at = ?
+		WHERE id = ? AND revoked_at IS NULL AND expires_at > ?
+			AND (max_downloads IS NULL OR download_count < max_downloads)
+		RETURNING *
+	`, now, now, id, now).Scan(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return tokens[0], nil
+}
+
+// Revoke marks a token of a file as revoked
+func (r *DownloadTokenRepository) Revoke(id, fileID string) error {
+	result := r.db.Model(&models.DownloadToken{}).
+		Where("id = ? AND file_id = ? AND revoked_at IS NULL", id, fileID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddRevocation adds a signed token (jti) to the revocation list, đã có thì bỏ qua
+func (r *DownloadTokenRepository) AddRevocation(revocation *models.RevokedDownloadToken) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(revocation).Error
+}
+
+// IsRevoked reports whether a signed token (jti) is on the revocation list
+func (r *DownloadTokenRepository) IsRevoked(tokenID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.RevokedDownloadToken{}).Where("token_id = ?", tokenID).Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteExpiredBefore deletes tokens and revocation entries expired before a time (kể cả đã revoke)
+func (r *DownloadTokenRepository) DeleteExpiredBefore(before time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ?", before).Delete(&models.DownloadToken{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	revocations := r.db.Where("expires_at < ?", before).Delete(&models.RevokedDownloadToken{})
+	return result.RowsAffected + revocations.RowsAffected, revocations.Error
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FileBlobRepository struct {
+	db *gorm.DB
+}
+
+func NewFileBlobRepository(db *gorm.DB) *FileBlobRepository {
+	return &FileBlobRepository{db: db}
+}
+
+// GetByHash retrieves a blob by its SHA-256 hash
+func (r *FileBlobRepository) GetByHash(hash string) (*models.FileBlob, error) {
+	var blob models.FileBlob
+	err := r.db.First(&blob, "hash = ?", hash).Error
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// GetBatchAfterHash retrieves blobs ordered by hash after afterHash (keyset pagination cho job quét toàn bộ blobs)
+func (r *FileBlobRepository) GetBatchAfterHash(afterHash string, limit int) ([]*models.FileBlob, error) {
+	var blobs []*models.FileBlob
+	query := r.db.Order("hash ASC").Limit(limit)
+	if afterHash != "" {
+		query = query.Where("hash > ?", afterHash)
+	}
+	err := query.Find(&blobs).Error
+	return blobs, err
+}
+
+// UpdateLocation moves a blob to a new storage location, cập nhật FilePath của mọi file trỏ tới blob
+func (r *FileBlobRepository) UpdateLocation(hash, location string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.FileBlob{}).Where("hash = ?", hash).Update("location", location).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.File{}).Where("blob_hash = ?", hash).Update("file_path", location).Error
+	})
+}
+
+// ReleaseOrphan records a blob whose upload failed after being stored (ref_count = 0) so GC removes it.
+// Blob đã có record (upload khác đã commit) thì giữ nguyên.
+func (r *FileBlobRepository) ReleaseOrphan(blob *models.FileBlob) error {
+	orphan := *blob
+	orphan.RefCount = 0
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&orphan).Error
+}
+
+// SyncRefCounts recomputes ref_count from the files table (file bị xóa theo cascade không giảm ref_count)
+func (r *FileBlobRepository) SyncRefCounts() (int64, error) {
+	result := r.db.Exec(`
+		UPDATE file_blobs b
+		SET ref_count = c.count, updated_at = ?
+		FROM (
+			SELECT b2.hash, COUNT(f.id) AS count
+			FROM file_blobs b2
+			LEFT JOIN files f ON f.blob_hash = b2.hash
+			GROUP BY b2.hash
+		) c
+		WHERE b.hash = c.hash AND b.ref_count <> c.count
+	`, time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// GetUnreferenced retrieves blobs not referenced by any file and unchanged since before
+func (r *FileBlobRepository) GetUnreferenced(before time.Time, limit int) ([]*models.FileBlob, error) {
+	var blobs []*models.FileBlob
+	err := r.db.Where("updated_at < ? AND NOT EXISTS (SELECT 1 FROM files f WHERE f.blob_hash = file_blobs.hash)", before).
+		Order("updated_at ASC").
+		Limit(limit).
+		Find(&blobs).Error
+	return blobs, err
+}
+
+// DeleteUnreferenced deletes an unreferenced blob record, deleteContent xóa nội dung trong storage trước khi commit.
+// Row bị lock trong lúc xóa nên upload cùng nội dung sẽ chờ và lưu lại blob mới.
+// Returns false nếu blob đã được tham chiếu lại (không xóa).
+func (r *FileBlobRepository) DeleteUnreferenced(hash string, before time.Time, deleteContent func(blob *models.FileBlob) error) (bool, error) {
+	deleted := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var blob models.FileBlob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("hash = ? AND updated_at < ? AND NOT EXISTS (SELECT 1 FROM files f WHERE f.blob_hash = file_blobs.hash)", hash, before).
+			First(&blob).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := deleteContent(&blob); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.FileBlob{}, "hash = ?", hash).Error; err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	return deleted, err
+}
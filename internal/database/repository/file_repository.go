@@ -1,8 +1,13 @@
 package repository
 
 import (
+	"encoding/json"
+	"errors"
+	"strings"
+
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FileRepository struct {
@@ -18,6 +23,56 @@ func (r *FileRepository) Create(file *models.File) error {
 	return r.db.Create(file).Error
 }
 
+// ErrBlobNotStored is returned by CreateWithBlob when the blob has no record and its content was not uploaded
+// (vd: blob có sẵn lúc kiểm tra nhưng bị GC xóa trước khi tạo file): caller upload nội dung rồi gọi lại.
+var ErrBlobNotStored = errors.New("blob content not stored")
+
+// CreateWithBlob creates a file record pointing to a content-addressed blob and increments its ref_count in one short transaction.
+// Nội dung phải được upload trước (stored = true) khi blob chưa có record, transaction không giữ lock trong lúc upload.
+// Returns reused = true nếu nội dung đã có sẵn.
+func (r *FileRepository) CreateWithBlob(file *models.File, blob *models.FileBlob, stored bool) (reused bool, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock theo hash: GC (DeleteUnreferenced) lock cùng row nên blob không bị xóa giữa lúc kiểm tra và tạo file
+		var existing models.FileBlob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&existing, "hash = ?", blob.Hash).Error
+		switch {
+		case err == nil:
+			// Update cả updated_at để GC tính lại grace period
+			err = tx.Model(&existing).Update("ref_count", gorm.Expr("ref_count + 1")).Error
+			if err != nil {
+				return err
+			}
+			*blob = existing
+			reused = true
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !stored {
+				return ErrBlobNotStored
+			}
+			// Upload song song cùng nội dung: record tạo sau chỉ tăng ref_count
+			blob.RefCount = 1
+			err = tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "hash"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"ref_count":  gorm.Expr("file_blobs.ref_count + 1"),
+					"updated_at": gorm.Expr("EXCLUDED.updated_at"),
+				}),
+			}).Create(blob).Error
+			if err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		hash := blob.Hash
+		file.BlobHash = &hash
+		file.FilePath = blob.Location
+		file.FileSize = blob.Size
+		return tx.Create(file).Error
+	})
+	return reused, err
+}
+
 // GetByID retrieves a file by ID
 func (r *FileRepository) GetByID(id string) (*models.File, error) {
 	var file models.File
@@ -35,6 +90,176 @@ func (r *FileRepository) GetByUserID(userID string) ([]*models.File, error) {
 	return files, err
 }
 
+// GetByUserIDWithFilter retrieves files of a user matching folder/tag/search filters (mới nhất trước)
+func (r *FileRepository) GetByUserIDWithFilter(userID string, filter models.FileListFilter) ([]*models.File, error) {
+	query := r.db.Where("user_id = ?", userID)
+	if filter.Folder != nil {
+		if filter.Recursive && *filter.Folder != "" {
+			query = query.Where("(folder = ? OR folder LIKE ? ESCAPE '\\')", *filter.Folder, escapeLike(*filter.Folder)+"/%")
+		} else if !filter.Recursive {
+			query = query.Where("folder = ?", *filter.Folder)
+		}
+	}
+	if filter.Tag != "" {
+		tagJSON, _ := json.Marshal([]string{filter.Tag})
+		query = query.Where("tags @> ?::jsonb", string(tagJSON))
+	}
+	if filter.Search != "" {
+		query = query.Where("original_name ILIKE ? ESCAPE '\\'", "%"+escapeLike(filter.Search)+"%")
+	}
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if filter.MimeType != "" {
+		if prefix, ok := strings.CutSuffix(filter.MimeType, "/*"); ok {
+			query = query.Where("mime_type LIKE ? ESCAPE '\\'", escapeLike(prefix)+"/%")
+		} else {
+			query = query.Where("mime_type = ?", filter.MimeType)
+		}
+	}
+
+	var files []*models.File
+	err := query.Order("created_at DESC").Find(&files).Error
+	return files, err
+}
+
+// GetLatestByUserIDAndOriginalName retrieves the newest file of a user with an original name
+// (file mà input_files của prompt resolve tới khi tham chiếu theo tên)
+func (r *FileRepository) GetLatestByUserIDAndOriginalName(userID, originalName string) (*models.File, error) {
+	var file models.File
+	err := r.db.Where("user_id = ? AND original_name = ?", userID, originalName).
+		Order("created_at DESC").
+		First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetVersionsByUserIDAndOriginalName retrieves all files of a user with the same original name (cũ nhất trước)
+func (r *FileRepository) GetVersionsByUserIDAndOriginalName(userID, originalName string) ([]*models.File, error) {
+	var files []*models.File
+	err := r.db.Where("user_id = ? AND original_name = ?", userID, originalName).
+		Order("created_at ASC").
+		Find(&files).Error
+	return files, err
+}
+
+// FileRename describes how renaming a file propagates to script prompts
+type FileRename struct {
+	OldName string
+	NewName string
+	// Prompt tham chiếu theo tên (mode latest / prompt cũ) cần đổi sang tên mới.
+	// Prompt ghim theo file_id luôn được đổi tên hiển thị.
+	PromptIDs []string
+}
+
+// UpdateMetadata updates name/folder/tags of a file.
+// rename khác nil: cập nhật input_file_refs / input_files của các prompt liên quan (cùng transaction).
+func (r *FileRepository) UpdateMetadata(id string, updates map[string]interface{}, rename *FileRename) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.File{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+		if rename == nil {
+			return nil
+		}
+
+		pinnedJSON, err := json.Marshal([]map[string]string{{"file_id": id}})
+		if err != nil {
+			return err
+		}
+		promptIDs := rename.PromptIDs
+		if len(promptIDs) == 0 {
+			promptIDs = []string{}
+		}
+
+		// Giữ thứ tự phần tử trong mảng jsonb; input_files luôn đồng bộ với tên trong input_file_refs
+		if err := tx.Exec(`
+			UPDATE script_prompts
+			SET input_file_refs = (
+				SELECT jsonb_agg(CASE
+					WHEN t.ref->>'file_id' = ? OR (script_prompts.id::text IN ? AND t.ref->>'mode' = ? AND t.ref->>'name' = ?)
+					THEN jsonb_set(t.ref, '{name}', to_jsonb(?::text))
+					ELSE t.ref END ORDER BY t.ord)
+				FROM jsonb_array_elements(script_prompts.input_file_refs) WITH ORDINALITY AS t(ref, ord)
+			), updated_at = NOW()
+			WHERE jsonb_typeof(input_file_refs) = 'array' AND jsonb_array_length(input_file_refs) > 0
+				AND (input_file_refs @> ?::jsonb OR id::text IN ?)
+		`, id, promptIDs, models.PromptInputFileModeLatest, rename.OldName, rename.NewName, string(pinnedJSON), promptIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`
+			UPDATE script_prompts
+			SET input_files = (
+				SELECT COALESCE(jsonb_agg(t.ref->'name' ORDER BY t.ord), '[]'::jsonb)
+				FROM jsonb_array_elements(script_prompts.input_file_refs) WITH ORDINALITY AS t(ref, ord)
+			)
+			WHERE jsonb_typeof(input_file_refs) = 'array' AND (input_file_refs @> ?::jsonb OR id::text IN ?)
+		`, string(pinnedJSON), promptIDs).Error; err != nil {
+			return err
+		}
+
+		if len(rename.PromptIDs) == 0 {
+			return nil
+		}
+		// Prompt cũ chưa có input_file_refs: đổi tên trong input_files
+		return tx.Exec(`
+			UPDATE script_prompts
+			SET input_files = (
+				SELECT COALESCE(jsonb_agg(CASE WHEN t.name = ? THEN to_jsonb(?::text) ELSE to_jsonb(t.name) END ORDER BY t.ord), '[]'::jsonb)
+				FROM jsonb_array_elements_text(script_prompts.input_files) WITH ORDINALITY AS t(name, ord)
+			), updated_at = NOW()
+			WHERE id IN ? AND input_file_refs IS NULL
+		`, rename.OldName, rename.NewName, rename.PromptIDs).Error
+	})
+}
+
+// GetFoldersByUserID retrieves the virtual folders of a user with file count and size
+func (r *FileRepository) GetFoldersByUserID(userID string) ([]*models.FileFolderResponse, error) {
+	var folders []*models.FileFolderResponse
+	err := r.db.Model(&models.File{}).
+		Select("folder, COUNT(*) AS file_count, COALESCE(SUM(file_size), 0) AS total_size").
+		Where("user_id = ?", userID).
+		Group("folder").
+		Order("folder ASC").
+		Scan(&folders).Error
+	return folders, err
+}
+
+// GetTagsByUserID retrieves the tags used by a user's files with file count
+func (r *FileRepository) GetTagsByUserID(userID string) ([]*models.FileTagResponse, error) {
+	var tags []*models.FileTagResponse
+	err := r.db.Raw(`
+		SELECT tag, COUNT(*) AS file_count
+		FROM files, jsonb_array_elements_text(files.tags) AS tag
+		WHERE files.user_id = ?
+		GROUP BY tag
+		ORDER BY tag ASC
+	`, userID).Scan(&tags).Error
+	return tags, err
+}
+
+// GetUsageByUserID returns the total size and number of files of a user (file trùng nội dung vẫn tính riêng cho từng record)
+func (r *FileRepository) GetUsageByUserID(userID string) (int64, int64, error) {
+	var usage struct {
+		TotalSize int64
+		FileCount int64
+	}
+	err := r.db.Model(&models.File{}).
+		Select("COALESCE(SUM(file_size), 0) AS total_size, COUNT(*) AS file_count").
+		Where("user_id = ?", userID).
+		Scan(&usage).Error
+	return usage.TotalSize, usage.FileCount, err
+}
+
+// GetByExecutionID retrieves the output files of a script execution (thứ tự upload)
+func (r *FileRepository) GetByExecutionID(executionID string) ([]*models.File, error) {
+	var files []*models.File
+	err := r.db.Where("execution_id = ?", executionID).Order("created_at ASC").Find(&files).Error
+	return files, err
+}
+
 // GetByProjectIDAndTempPromptID retrieves files for a specific prompt (before saving script)
 func (r *FileRepository) GetByProjectIDAndTempPromptID(userID, projectID, tempPromptID string) ([]*models.File, error) {
 	var files []*models.File
@@ -64,7 +289,42 @@ func (r *FileRepository) ClearProjectIDAndTempPromptID(userID, projectID, tempPr
 		}).Error
 }
 
-// Delete deletes a file record
+// GetBatchAfterID retrieves files ordered by ID after afterID (keyset pagination cho job quét toàn bộ files)
+func (r *FileRepository) GetBatchAfterID(afterID string, limit int) ([]*models.File, error) {
+	var files []*models.File
+	query := r.db.Order("id ASC").Limit(limit)
+	if afterID != "" {
+		query = query.Where("id > ?", afterID)
+	}
+	err := query.Find(&files).Error
+	return files, err
+}
+
+// UpdateFilePath updates the storage location of a file
+func (r *FileRepository) UpdateFilePath(id, filePath string) error {
+	return r.db.Model(&models.File{}).Where("id = ?", id).Update("file_path", filePath).Error
+}
+
+// Delete deletes a file record and releases its blob (ref_count - 1, blob không còn ref sẽ được GC xóa)
 func (r *FileRepository) Delete(id string) error {
-	return r.db.Delete(&models.File{}, "id = ?", id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var file models.File
+		if err := tx.First(&file, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.File{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if file.BlobHash == nil {
+			return nil
+		}
+		return tx.Model(&models.FileBlob{}).
+			Where("hash = ? AND ref_count > 0", *file.BlobHash).
+			Update("ref_count", gorm.Expr("ref_count - 1")).Error
+	})
+}
+
+// escapeLike escapes LIKE wildcards (dùng với ESCAPE '\\')
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
 }
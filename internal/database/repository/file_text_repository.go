@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FileTextRepository struct {
+	db *gorm.DB
+}
+
+func NewFileTextRepository(db *gorm.DB) *FileTextRepository {
+	return &FileTextRepository{db: db}
+}
+
+// Upsert creates or replaces the extracted text of a file
+func (r *FileTextRepository) Upsert(text *models.FileText) error {
+	return r.db.Omit("File").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}},
+		UpdateAll: true,
+	}).Create(text).Error
+}
+
+// GetByFileID retrieves the extracted text of a file
+func (r *FileTextRepository) GetByFileID(fileID string) (*models.FileText, error) {
+	var text models.FileText
+	err := r.db.First(&text, "file_id = ?", fileID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &text, nil
+}
@@ -157,10 +157,16 @@ func (r *GeminiAccountRepository) UpdateLastUsedAt(id string) error {
 		Update("last_used_at", now).Error
 }
 
-// GetTopicsByAccountID retrieves all topics for a specific Gemini account
+// GetTopicsByAccountID retrieves all topics having projects (gems) created with a specific Gemini account
+// topics không còn cột gemini_account_id, account được gắn trên script_projects
 func (r *GeminiAccountRepository) GetTopicsByAccountID(accountID string) ([]*models.Topic, error) {
 	var topics []*models.Topic
-	err := r.db.Where("gemini_account_id = ?", accountID).Find(&topics).Error
+	err := r.db.Where("id IN (?)",
+		r.db.Table("scripts").
+			Select("scripts.topic_id").
+			Joins("JOIN script_projects ON script_projects.script_id = scripts.id").
+			Where("script_projects.gemini_account_id = ?", accountID)).
+		Find(&topics).Error
 	return topics, err
 }
 
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type LogArchiveRepository struct {
+	db *gorm.DB
+}
+
+func NewLogArchiveRepository(db *gorm.DB) *LogArchiveRepository {
+	return &LogArchiveRepository{db: db}
+}
+
+// Create creates a new archive record
+func (r *LogArchiveRepository) Create(archive *models.LogArchive) error {
+	return r.db.Create(archive).Error
+}
+
+// GetByID retrieves an archive by ID
+func (r *LogArchiveRepository) GetByID(id string) (*models.LogArchive, error) {
+	var archive models.LogArchive
+	err := r.db.First(&archive, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// GetPaginated retrieves archives, newest first
+func (r *LogArchiveRepository) GetPaginated(page, pageSize int) ([]*models.LogArchive, int64, error) {
+	var archives []*models.LogArchive
+	var total int64
+
+	if err := r.db.Model(&models.LogArchive{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := r.db.Order("created_at DESC").Limit(pageSize).Offset(offset).Find(&archives).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return archives, total, nil
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
@@ -15,9 +17,71 @@ func NewProcessLogRepository(db *gorm.DB) *ProcessLogRepository {
 	return &ProcessLogRepository{db: db}
 }
 
+// processLogInsertLockKey is the advisory lock serializing log inserts.
+// Seq được cấp sau khi lấy lock và lock giữ tới commit → thứ tự seq = thứ tự commit:
+// log seq N đã thấy được thì mọi log seq < N cũng đã commit (SSE backfill seq > Last-Event-ID không bỏ sót log commit muộn).
+const processLogInsertLockKey = 7401260
+
+// lockLogInserts takes the log insert lock for the rest of the transaction
+func lockLogInserts(tx *gorm.DB) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", processLogInsertLockKey).Error
+}
+
 // Create creates a new process log
 func (r *ProcessLogRepository) Create(log *models.ProcessLog) error {
-	return r.db.Create(log).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockLogInserts(tx); err != nil {
+			return err
+		}
+		return tx.Create(log).Error
+	})
+}
+
+// CreateBatch inserts logs with multi-row INSERTs in one transaction (ID and seq are filled via RETURNING)
+func (r *ProcessLogRepository) CreateBatch(logs []*models.ProcessLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockLogInserts(tx); err != nil {
+			return err
+		}
+		return tx.CreateInBatches(logs, 500).Error
+	})
+}
+
+// CreateEach inserts logs one by one in one transaction, each behind a savepoint:
+// log lỗi (dữ liệu không hợp lệ) được rollback về savepoint và bỏ qua, các log còn lại vẫn được lưu.
+// rowErrs[i] là lỗi của log i (nil nếu đã lưu). err != nil khi transaction không hoàn tất
+// (mất kết nối, DB down...): khi đó không log nào được lưu.
+func (r *ProcessLogRepository) CreateEach(logs []*models.ProcessLog) (rowErrs []error, err error) {
+	rowErrs = make([]error, len(logs))
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockLogInserts(tx); err != nil {
+			return err
+		}
+		for i, log := range logs {
+			if err := tx.SavePoint("process_log").Error; err != nil {
+				return err
+			}
+			if err := tx.Create(log).Error; err != nil {
+				// Rollback savepoint lỗi nghĩa là transaction đã hỏng (không phải lỗi của riêng log này)
+				if rbErr := tx.RollbackTo("process_log").Error; rbErr != nil {
+					return rbErr
+				}
+				rowErrs[i] = err
+			}
+		}
+		return nil
+	})
+	return rowErrs, err
+}
+
+// GetLatestSeq returns the highest committed log seq (0 if there is no log)
+func (r *ProcessLogRepository) GetLatestSeq() (int64, error) {
+	var seq int64
+	err := r.db.Model(&models.ProcessLog{}).Select("COALESCE(MAX(seq), 0)").Scan(&seq).Error
+	return seq, err
 }
 
 // GetByEntity retrieves logs for a specific entity
@@ -31,6 +95,16 @@ func (r *ProcessLogRepository) GetByEntity(entityType, entityID string, limit, o
 	return logs, err
 }
 
+// GetByEntityAfterSeq retrieves logs for a specific entity with seq > afterSeq, oldest first
+func (r *ProcessLogRepository) GetByEntityAfterSeq(entityType, entityID string, afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+	var logs []*models.ProcessLog
+	err := r.db.Where("entity_type = ? AND entity_id = ? AND seq > ?", entityType, entityID, afterSeq).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
+
 // GetByUserID retrieves logs for a specific user
 func (r *ProcessLogRepository) GetByUserID(userID string, limit, offset int) ([]*models.ProcessLog, error) {
 	var logs []*models.ProcessLog
@@ -42,6 +116,38 @@ func (r *ProcessLogRepository) GetByUserID(userID string, limit, offset int) ([]
 	return logs, err
 }
 
+// GetByUserIDAfterSeq retrieves logs for a specific user with seq > afterSeq, oldest first
+func (r *ProcessLogRepository) GetByUserIDAfterSeq(userID string, afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+	var logs []*models.ProcessLog
+	err := r.db.Where("user_id = ? AND seq > ?", userID, afterSeq).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
+
+// GetAfterSeq retrieves logs matching filter with seq > afterSeq, oldest first
+func (r *ProcessLogRepository) GetAfterSeq(filter *models.ProcessLogFilter, afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+	var logs []*models.ProcessLog
+	query := r.db.Where("seq > ?", afterSeq)
+	if filter != nil {
+		if filter.EntityType != "" {
+			query = query.Where("entity_type = ?", filter.EntityType)
+		}
+		if filter.MachineID != "" {
+			query = query.Where("machine_id = ?", filter.MachineID)
+		}
+		if filter.Status != "" {
+			query = query.Where("status = ?", filter.Status)
+		}
+		if filter.Stage != "" {
+			query = query.Where("stage = ?", filter.Stage)
+		}
+	}
+	err := query.Order("seq ASC").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
 // GetLatestByEntity retrieves the latest log for a specific entity
 func (r *ProcessLogRepository) GetLatestByEntity(entityType, entityID string) (*models.ProcessLog, error) {
 	var log models.ProcessLog
@@ -63,9 +169,173 @@ func (r *ProcessLogRepository) CountByEntity(entityType, entityID string) (int64
 	return count, err
 }
 
-// DeleteOldLogs deletes logs older than specified days
-func (r *ProcessLogRepository) DeleteOldLogs(days int) (int64, error) {
-	cutoffDate := time.Now().AddDate(0, 0, -days)
-	result := r.db.Where("created_at < ?", cutoffDate).Delete(&models.ProcessLog{})
+// GetExpiredLogs retrieves logs past their retention (oldest first).
+// Mỗi log dùng rule cụ thể nhất khớp với entity_type/status (rules đã sort theo độ cụ thể giảm dần).
+// Log gắn với ScriptExecution còn tồn tại (entity_id hoặc metadata.execution_id) được giữ lại cùng execution.
+func (r *ProcessLogRepository) GetExpiredLogs(rules []models.LogRetentionRule, now time.Time, limit int) ([]*models.ProcessLog, error) {
+	var logs []*models.ProcessLog
+
+	// CASE WHEN ... THEN days ... END: số ngày giữ lại của từng log
+	caseSQL := "CASE"
+	var args []interface{}
+	for _, rule := range rules {
+		var conds []string
+		if rule.EntityType != "*" {
+			conds = append(conds, "entity_type = ?")
+			args = append(args, rule.EntityType)
+		}
+		if rule.Status != "*" {
+			conds = append(conds, "status = ?")
+			args = append(args, rule.Status)
+		}
+		cond := "TRUE"
+		if len(conds) > 0 {
+			cond = strings.Join(conds, " AND ")
+		}
+		caseSQL += " WHEN " + cond + " THEN ?"
+		args = append(args, rule.Days)
+	}
+	caseSQL += " ELSE NULL END"
+
+	args = append([]interface{}{now}, args...)
+	err := r.db.
+		Where("created_at < ?::timestamptz - make_interval(days => ("+caseSQL+")::int)", args...).
+		Where(`NOT (entity_type = 'script_execution' AND EXISTS (
+			SELECT 1 FROM script_executions se
+			WHERE se.id = process_logs.entity_id OR se.id::text = process_logs.metadata->>'execution_id'
+		))`).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
+
+// DeleteByIDs deletes logs by IDs
+func (r *ProcessLogRepository) DeleteByIDs(ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := r.db.Where("id IN ?", ids).Delete(&models.ProcessLog{})
 	return result.RowsAffected, result.Error
 }
+
+// Search retrieves logs matching the search filter, newest first, using seq as cursor (seq < beforeSeq).
+// scope giới hạn phạm vi cho user thường (nil scope = admin, không giới hạn).
+func (r *ProcessLogRepository) Search(filter *models.ProcessLogSearchFilter, scope *ProcessLogAccessScope, beforeSeq int64, limit int) ([]*models.ProcessLog, error) {
+	var logs []*models.ProcessLog
+	query := r.searchQuery(filter, scope)
+
+	if beforeSeq > 0 {
+		query = query.Where("seq < ?", beforeSeq)
+	}
+
+	err := query.Order("seq DESC").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// SearchAfterSeq retrieves logs matching a search filter with seq greater than afterSeq (ascending, used for export)
+func (r *ProcessLogRepository) SearchAfterSeq(filter *models.ProcessLogSearchFilter, scope *ProcessLogAccessScope, afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+	var logs []*models.ProcessLog
+	err := r.searchQuery(filter, scope).
+		Where("seq > ?", afterSeq).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
+
+// ListSearchEntities lists the distinct entities of logs matching a search filter, with timings (used for XLSX export)
+func (r *ProcessLogRepository) ListSearchEntities(filter *models.ProcessLogSearchFilter, scope *ProcessLogAccessScope) ([]*models.ProcessLogEntitySummary, error) {
+	var summaries []*models.ProcessLogEntitySummary
+	err := r.searchQuery(filter, scope).
+		Select("entity_type, entity_id, COUNT(*) AS log_count, " +
+			"COUNT(*) FILTER (WHERE status = 'error') AS error_count, " +
+			"MIN(created_at) AS first_log_at, MAX(created_at) AS last_log_at").
+		Group("entity_type, entity_id").
+		Order("MIN(seq) ASC").
+		Scan(&summaries).Error
+	return summaries, err
+}
+
+// searchQuery builds the filtered query shared by Search, SearchAfterSeq and ListSearchEntities
+func (r *ProcessLogRepository) searchQuery(filter *models.ProcessLogSearchFilter, scope *ProcessLogAccessScope) *gorm.DB {
+	query := r.db.Model(&models.ProcessLog{})
+
+	if scope != nil {
+		// Log của chính user, hoặc log của entity gắn với topic user có quyền (owner/assigned)
+		scopeCond := r.db.Where("user_id = ?", scope.UserID)
+		if len(scope.TopicIDs) > 0 {
+			scopeCond = scopeCond.
+				Or("entity_type IN ? AND entity_id IN ?", []string{"topic", "gemini", "script_execution"}, scope.TopicIDs).
+				Or("entity_type = ? AND entity_id IN (?)", "script_execution",
+					r.db.Model(&models.ScriptExecution{}).Select("id").Where("topic_id IN ?", scope.TopicIDs))
+		}
+		query = query.Where(scopeCond)
+	}
+
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.MachineID != "" {
+		query = query.Where("machine_id = ?", filter.MachineID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Stage != "" {
+		query = query.Where("stage = ?", filter.Stage)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.Query != "" {
+		// Dùng config 'simple' (không stemming) để hoạt động với tiếng Việt, khớp index idx_process_logs_message_fts
+		query = query.Where("to_tsvector('simple', message) @@ plainto_tsquery('simple', ?)", filter.Query)
+	}
+	for _, mf := range filter.Metadata {
+		// Containment (@>) để dùng được GIN index idx_process_logs_metadata_gin
+		// Thử cả giá trị string và giá trị JSON (number/bool) vì automation backend gửi cả 2 kiểu
+		stringDoc, _ := json.Marshal(buildMetadataDoc(mf.Path, mf.Value))
+		if typed, ok := typedMetadataValue(mf.Value); ok {
+			typedDoc, _ := json.Marshal(buildMetadataDoc(mf.Path, typed))
+			query = query.Where("(metadata @> ?::jsonb OR metadata @> ?::jsonb)", string(stringDoc), string(typedDoc))
+		} else {
+			query = query.Where("metadata @> ?::jsonb", string(stringDoc))
+		}
+	}
+
+	return query
+}
+
+// ProcessLogAccessScope limits log queries to what a non-admin user can see
+type ProcessLogAccessScope struct {
+	UserID   string
+	TopicIDs []string // Topic user sở hữu hoặc được assign
+}
+
+// buildMetadataDoc builds {"a": {"b": value}} from path [a, b]
+func buildMetadataDoc(path []string, value interface{}) map[string]interface{} {
+	doc := map[string]interface{}{path[len(path)-1]: value}
+	for i := len(path) - 2; i >= 0; i-- {
+		doc = map[string]interface{}{path[i]: doc}
+	}
+	return doc
+}
+
+// typedMetadataValue parses number/bool values so they can match non-string JSON values
+func typedMetadataValue(value string) (interface{}, bool) {
+	if value == "true" || value == "false" {
+		return value == "true", true
+	}
+	var number json.Number
+	if err := json.Unmarshal([]byte(value), &number); err == nil {
+		return number, true
+	}
+	return nil, false
+}
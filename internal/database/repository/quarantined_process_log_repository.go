@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrQuarantinedLogReleased is returned when a quarantined log was already released (vd: 2 admin release song song)
+var ErrQuarantinedLogReleased = errors.New("quarantined log already released")
+
+type QuarantinedProcessLogRepository struct {
+	db *gorm.DB
+}
+
+func NewQuarantinedProcessLogRepository(db *gorm.DB) *QuarantinedProcessLogRepository {
+	return &QuarantinedProcessLogRepository{db: db}
+}
+
+// Create creates a new quarantined log
+func (r *QuarantinedProcessLogRepository) Create(log *models.QuarantinedProcessLog) error {
+	return r.db.Create(log).Error
+}
+
+// GetByID retrieves a quarantined log by ID
+func (r *QuarantinedProcessLogRepository) GetByID(id string) (*models.QuarantinedProcessLog, error) {
+	var log models.QuarantinedProcessLog
+	err := r.db.First(&log, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// GetPaginated retrieves quarantined logs (newest first), optionally only the ones not released yet
+func (r *QuarantinedProcessLogRepository) GetPaginated(page, pageSize int, pendingOnly bool) ([]*models.QuarantinedProcessLog, int64, error) {
+	var logs []*models.QuarantinedProcessLog
+	var total int64
+
+	query := r.db.Model(&models.QuarantinedProcessLog{})
+	if pendingOnly {
+		query = query.Where("released_at IS NULL")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("created_at DESC").Limit(pageSize).Offset(offset).Find(&logs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return logs, total, nil
+}
+
+// Release claims a quarantined log and inserts the released log in one transaction.
+// Claim bằng UPDATE ... WHERE released_at IS NULL: chỉ một request release thành công, request còn lại nhận
+// ErrQuarantinedLogReleased và không tạo log trùng.
+func (r *QuarantinedProcessLogRepository) Release(id, releasedBy string, log *models.ProcessLog) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.QuarantinedProcessLog{}).
+			Where("id = ? AND released_at IS NULL", id).
+			Updates(map[string]interface{}{
+				"released_at": time.Now(),
+				"released_by": releasedBy,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrQuarantinedLogReleased
+		}
+
+		// Cùng lock với ProcessLogRepository.Create để seq giữ thứ tự commit
+		if err := lockLogInserts(tx); err != nil {
+			return err
+		}
+		if err := tx.Create(log).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.QuarantinedProcessLog{}).
+			Where("id = ?", id).
+			Update("released_log_id", log.ID).Error
+	})
+}
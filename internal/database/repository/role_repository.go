@@ -13,15 +13,15 @@ func NewRoleRepository(db *gorm.DB) *RoleRepository {
 	return &RoleRepository{db: db}
 }
 
-// Create creates a new role
+// Create creates a new role with its permissions
 func (r *RoleRepository) Create(role *models.Role) error {
-	return r.db.Create(role).Error
+	return r.db.Omit("Permissions.*").Create(role).Error
 }
 
 // GetByID retrieves a role by ID
 func (r *RoleRepository) GetByID(id string) (*models.Role, error) {
 	var role models.Role
-	err := r.db.First(&role, "id = ?", id).Error
+	err := r.db.Preload("Permissions").First(&role, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -41,21 +41,73 @@ func (r *RoleRepository) GetByName(name string) (*models.Role, error) {
 // GetAll returns all roles
 func (r *RoleRepository) GetAll() ([]models.Role, error) {
 	var roles []models.Role
-	err := r.db.Find(&roles).Error
+	err := r.db.Preload("Permissions").Order("name ASC").Find(&roles).Error
 	if err != nil {
 		return nil, err
 	}
 	return roles, nil
 }
 
-// Update updates a role
-func (r *RoleRepository) Update(role *models.Role) error {
-	return r.db.Save(role).Error
+// Update updates a role and, if permissions is not nil, replaces its permission set
+func (r *RoleRepository) Update(role *models.Role, permissions []models.Permission) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Users", "Permissions").Save(role).Error; err != nil {
+			return err
+		}
+		if permissions == nil {
+			return nil
+		}
+		if err := tx.Model(role).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+		role.Permissions = permissions
+		return nil
+	})
 }
 
-// Delete deletes a role
+// Delete deletes a role with its user assignments, permissions and storage quota override
 func (r *RoleRepository) Delete(id string) error {
-	return r.db.Delete(&models.Role{}, "id = ?", id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subject_type = ? AND subject_id = ?", models.StorageQuotaSubjectRole, id).Delete(&models.StorageQuota{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Role{}, "id = ?", id).Error
+	})
+}
+
+// GetAllPermissions returns all permissions
+func (r *RoleRepository) GetAllPermissions() ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := r.db.Order("name ASC").Find(&permissions).Error
+	return permissions, err
+}
+
+// GetPermissionsByNames retrieves permissions by name
+func (r *RoleRepository) GetPermissionsByNames(names []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	err := r.db.Where("name IN ?", names).Find(&permissions).Error
+	return permissions, err
+}
+
+// GetUserPermissionNames returns the names of all permissions granted to a user through their roles
+func (r *RoleRepository) GetUserPermissionNames(userID string) ([]string, error) {
+	var names []string
+	err := r.db.Table("user_roles").
+		Joins("JOIN role_permissions ON role_permissions.role_id = user_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("user_roles.user_id = ?", userID).
+		Distinct().
+		Pluck("permissions.name", &names).Error
+	return names, err
 }
 
 // CheckNameExists checks if a role name already exists
@@ -1,6 +1,10 @@
 package repository
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"gorm.io/gorm"
 )
@@ -167,6 +171,77 @@ func (r *ScriptRepository) UpdatePrompt(prompt *models.ScriptPrompt) error {
 	return r.db.Save(prompt).Error
 }
 
+// GetInputFileReferences retrieves prompts of a user's scripts using a file as input:
+// ghim theo fileID, mode latest theo inputName, hoặc prompt cũ (chưa có input_file_refs) có inputName trong input_files
+func (r *ScriptRepository) GetInputFileReferences(userID, fileID, inputName string) ([]*models.FileReference, error) {
+	pinnedJSON, err := json.Marshal([]map[string]string{{"file_id": fileID}})
+	if err != nil {
+		return nil, err
+	}
+	latestJSON, err := json.Marshal([]map[string]string{{"name": inputName, "mode": models.PromptInputFileModeLatest}})
+	if err != nil {
+		return nil, err
+	}
+	nameJSON, err := json.Marshal([]string{inputName})
+	if err != nil {
+		return nil, err
+	}
+
+	var references []*models.FileReference
+	err = r.db.Table("script_prompts").
+		Select(`scripts.id AS script_id, scripts.topic_id, script_prompts.project_id, script_prompts.id AS prompt_id, script_prompts.prompt_order,
+			CASE WHEN script_prompts.input_file_refs @> ?::jsonb THEN ? WHEN script_prompts.input_file_refs IS NULL THEN ? ELSE ? END AS mode`,
+			string(pinnedJSON), models.PromptInputFileModeFile, models.FileReferenceModeLegacy, models.PromptInputFileModeLatest).
+		Joins("JOIN scripts ON scripts.id = script_prompts.script_id").
+		Where(`scripts.user_id = ? AND (script_prompts.input_file_refs @> ?::jsonb OR script_prompts.input_file_refs @> ?::jsonb
+			OR (script_prompts.input_file_refs IS NULL AND script_prompts.input_files @> ?::jsonb))`,
+			userID, string(pinnedJSON), string(latestJSON), string(nameJSON)).
+		Order("scripts.topic_id, script_prompts.project_id, script_prompts.prompt_order").
+		Scan(&references).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, reference := range references {
+		reference.InputName = inputName
+	}
+	return references, nil
+}
+
+// SavePrompts deletes, creates and updates the prompts of a script in one transaction,
+// đồng thời đánh dấu consumed các upload đang stage được gắn vào prompt (stagingIDs).
+// Returns ErrUploadStagingConsumed nếu upload đã bị request khác consume (rollback toàn bộ).
+func (r *ScriptRepository) SavePrompts(toDelete []string, toCreate, toUpdate []*models.ScriptPrompt, stagingIDs []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if len(stagingIDs) > 0 {
+			result := tx.Model(&models.UploadStaging{}).
+				Where("id IN ? AND consumed_at IS NULL", stagingIDs).
+				Update("consumed_at", time.Now())
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != int64(len(stagingIDs)) {
+				return ErrUploadStagingConsumed
+			}
+		}
+		if len(toDelete) > 0 {
+			if err := tx.Where("id IN ?", toDelete).Delete(&models.ScriptPrompt{}).Error; err != nil {
+				return fmt.Errorf("failed to delete prompts: %w", err)
+			}
+		}
+		if len(toCreate) > 0 {
+			if err := tx.CreateInBatches(toCreate, 100).Error; err != nil {
+				return fmt.Errorf("failed to create prompts: %w", err)
+			}
+		}
+		for _, prompt := range toUpdate {
+			if err := tx.Save(prompt).Error; err != nil {
+				return fmt.Errorf("failed to update prompt %s: %w", prompt.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
 // DeletePromptsByIDs deletes prompts by list of IDs
 func (r *ScriptRepository) DeletePromptsByIDs(promptIDs []string) error {
 	if len(promptIDs) == 0 {
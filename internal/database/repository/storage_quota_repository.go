@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StorageQuotaRepository struct {
+	db *gorm.DB
+}
+
+func NewStorageQuotaRepository(db *gorm.DB) *StorageQuotaRepository {
+	return &StorageQuotaRepository{db: db}
+}
+
+// Upsert creates or replaces the quota override of a subject
+func (r *StorageQuotaRepository) Upsert(quota *models.StorageQuota) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subject_type"}, {Name: "subject_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_storage_bytes", "max_file_size_bytes", "allowed_mime_types", "note", "updated_by", "updated_at"}),
+	}).Create(quota).Error
+}
+
+// GetBySubject retrieves the quota override of a user or role
+func (r *StorageQuotaRepository) GetBySubject(subjectType, subjectID string) (*models.StorageQuota, error) {
+	var quota models.StorageQuota
+	err := r.db.First(&quota, "subject_type = ? AND subject_id = ?", subjectType, subjectID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// GetBySubjects retrieves the quota overrides of several subjects of one type (vd: các role của user)
+func (r *StorageQuotaRepository) GetBySubjects(subjectType string, subjectIDs []string) ([]*models.StorageQuota, error) {
+	var quotas []*models.StorageQuota
+	if len(subjectIDs) == 0 {
+		return quotas, nil
+	}
+	err := r.db.Where("subject_type = ? AND subject_id IN ?", subjectType, subjectIDs).Find(&quotas).Error
+	return quotas, err
+}
+
+// GetAll retrieves all quota overrides, optionally filtered by subject type
+func (r *StorageQuotaRepository) GetAll(subjectType string) ([]*models.StorageQuota, error) {
+	var quotas []*models.StorageQuota
+	query := r.db.Order("subject_type ASC, updated_at DESC")
+	if subjectType != "" {
+		query = query.Where("subject_type = ?", subjectType)
+	}
+	err := query.Find(&quotas).Error
+	return quotas, err
+}
+
+// DeleteBySubject removes the quota override of a subject
+func (r *StorageQuotaRepository) DeleteBySubject(subjectType, subjectID string) error {
+	result := r.db.Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).Delete(&models.StorageQuota{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type TopicRemovalRepository struct {
+	db *gorm.DB
+}
+
+func NewTopicRemovalRepository(db *gorm.DB) *TopicRemovalRepository {
+	return &TopicRemovalRepository{db: db}
+}
+
+// RemoveTopic soft-deletes a topic (kept until PurgeAfter) and records the removal audit in one transaction
+func (r *TopicRemovalRepository) RemoveTopic(removal *models.TopicRemoval, syncError string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"removal_state": removal.State,
+			"purge_after":   removal.PurgeAfter,
+			"deleted_at":    removal.RemovedAt,
+		}
+		if removal.State == models.TopicRemovalStateFailed {
+			updates["sync_status"] = "failed"
+			updates["sync_error"] = syncError
+		}
+		result := tx.Model(&models.Topic{}).Where("id = ?", removal.TopicID).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(removal).Error
+	})
+}
+
+// RestoreTopic clears the removal of a topic and closes its open audit records
+func (r *TopicRemovalRepository) RestoreTopic(topicID, restoredBy string, restoredAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&models.Topic{}).
+			Where("id = ? AND deleted_at IS NOT NULL", topicID).
+			Updates(map[string]interface{}{
+				"removal_state": "",
+				"purge_after":   nil,
+				"deleted_at":    nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		// Project bị đánh dấu lỗi cùng đợt được giữ lại cùng topic
+		err := tx.Model(&models.ScriptProject{}).
+			Where("failed_at IS NOT NULL AND script_id IN (?)", tx.Model(&models.Script{}).Select("id").Where("topic_id = ?", topicID)).
+			Updates(map[string]interface{}{
+				"failed_at":   nil,
+				"purge_after": nil,
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.TopicRemoval{}).
+			Where("topic_id = ? AND restored_at IS NULL AND purged_at IS NULL", topicID).
+			Updates(map[string]interface{}{
+				"restored_at": restoredAt,
+				"restored_by": restoredBy,
+			}).Error
+	})
+}
+
+// MarkProjectFailed marks a project as failed (purged after removal.PurgeAfter) and records the removal audit in one transaction
+func (r *TopicRemovalRepository) MarkProjectFailed(removal *models.TopicRemoval) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ScriptProject{}).
+			Where("script_id = ? AND project_id = ? AND failed_at IS NULL", removal.ScriptID, removal.ProjectID).
+			Updates(map[string]interface{}{
+				"failed_at":   removal.RemovedAt,
+				"purge_after": removal.PurgeAfter,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(removal).Error
+	})
+}
+
+// RestoreProject clears the failure mark of a project of a topic and closes its open audit records
+func (r *TopicRemovalRepository) RestoreProject(topicID, projectID, restoredBy string, restoredAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ScriptProject{}).
+			Where("project_id = ? AND failed_at IS NOT NULL AND script_id IN (?)", projectID, tx.Model(&models.Script{}).Select("id").Where("topic_id = ?", topicID)).
+			Updates(map[string]interface{}{
+				"failed_at":   nil,
+				"purge_after": nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.TopicRemoval{}).
+			Where("topic_id = ? AND project_id = ? AND restored_at IS NULL AND purged_at IS NULL", topicID, projectID).
+			Updates(map[string]interface{}{
+				"restored_at": restoredAt,
+				"restored_by": restoredBy,
+			}).Error
+	})
+}
+
+// PurgeFailedProjects permanently deletes failed projects whose grace period has ended (cascade prompts) and closes their audit records.
+// Project của topic đang bị gỡ được giữ lại để restore topic lấy lại đủ project (purge topic sẽ xóa chúng).
+func (r *TopicRemovalRepository) PurgeFailedProjects(now time.Time) (int64, error) {
+	var purged int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		activeScripts := tx.Model(&models.Script{}).
+			Select("scripts.id").
+			Joins("JOIN topics ON topics.id = scripts.topic_id AND topics.deleted_at IS NULL")
+		expired := tx.Model(&models.ScriptProject{}).
+			Select("script_id, project_id").
+			Where("purge_after <= ? AND script_id IN (?)", now, activeScripts)
+
+		err := tx.Model(&models.TopicRemoval{}).
+			Where("restored_at IS NULL AND purged_at IS NULL AND (script_id, project_id) IN (?)", expired).
+			Update("purged_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("purge_after <= ? AND script_id IN (?)", now, activeScripts).
+			Delete(&models.ScriptProject{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// PurgeTopic permanently deletes a removed topic (cascade scripts, assignments) and closes its audit records.
+// Audit record được giữ lại sau khi purge.
+func (r *TopicRemovalRepository) PurgeTopic(topicID string, purgedAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.TopicRemoval{}).
+			Where("topic_id = ? AND restored_at IS NULL AND purged_at IS NULL", topicID).
+			Update("purged_at", purgedAt).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", topicID).Delete(&models.Topic{}).Error
+	})
+}
+
+// GetByTopicID retrieves the removal history of a topic, newest first
+func (r *TopicRemovalRepository) GetByTopicID(topicID string) ([]*models.TopicRemoval, error) {
+	var removals []*models.TopicRemoval
+	err := r.db.Where("topic_id = ?", topicID).Order("removed_at DESC").Find(&removals).Error
+	return removals, err
+}
+
+// GetOpenByTopicIDs retrieves the current (not restored/purged) removal of each topic (không tính bản ghi gỡ project)
+func (r *TopicRemovalRepository) GetOpenByTopicIDs(topicIDs []string) (map[string]*models.TopicRemoval, error) {
+	result := make(map[string]*models.TopicRemoval)
+	if len(topicIDs) == 0 {
+		return result, nil
+	}
+
+	var removals []*models.TopicRemoval
+	err := r.db.Where("topic_id IN ? AND project_id IS NULL AND restored_at IS NULL AND purged_at IS NULL", topicIDs).
+		Order("removed_at ASC").
+		Find(&removals).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, removal := range removals {
+		result[removal.TopicID] = removal // removed_at ASC → giữ bản ghi mới nhất
+	}
+	return result, nil
+}
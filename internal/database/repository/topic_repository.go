@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"gorm.io/gorm"
 )
@@ -93,16 +95,17 @@ func (r *TopicRepository) GetByUserIDIncludingAssigned(userID string, assignedTo
 // GetByUserIDIncludingAssignedPaginated retrieves all topics for a user (owned + assigned) with pagination
 func (r *TopicRepository) GetByUserIDIncludingAssignedPaginated(userID string, assignedTopicIDs []string, page, pageSize int) ([]*models.Topic, int64, error) {
 	// Build query for owned topics
+	// Table() không tự lọc soft delete → loại topic đã bị gỡ (deleted_at) thủ công
 	ownedQuery := r.db.Table("topics").
 		Joins("JOIN user_profiles ON topics.user_profile_id = user_profiles.id").
-		Where("user_profiles.user_id = ?", userID)
+		Where("user_profiles.user_id = ? AND topics.deleted_at IS NULL", userID)
 
 	// Build query for assigned topics
 	var combinedQuery *gorm.DB
 	if len(assignedTopicIDs) > 0 {
 		// Union owned and assigned topics
 		combinedQuery = r.db.Table("topics").
-			Where("topics.user_profile_id IN (SELECT id FROM user_profiles WHERE user_id = ?) OR topics.id IN ?", userID, assignedTopicIDs)
+			Where("(topics.user_profile_id IN (SELECT id FROM user_profiles WHERE user_id = ?) OR topics.id IN ?) AND topics.deleted_at IS NULL", userID, assignedTopicIDs)
 	} else {
 		// Only owned topics
 		combinedQuery = ownedQuery
@@ -150,9 +153,60 @@ func (r *TopicRepository) Update(topic *models.Topic) error {
 	return r.db.Save(topic).Error
 }
 
-// Delete deletes a topic
+// Delete permanently deletes a topic (cascade scripts, assignments)
+// Topic bị gỡ tự động dùng SoftRemove để có thể restore
 func (r *TopicRepository) Delete(id string) error {
-	return r.db.Delete(&models.Topic{}, "id = ?", id).Error
+	return r.db.Unscoped().Delete(&models.Topic{}, "id = ?", id).Error
+}
+
+// GetRemovedByID retrieves a removed (soft-deleted) topic by ID
+func (r *TopicRepository) GetRemovedByID(id string) (*models.Topic, error) {
+	var topic models.Topic
+	err := r.db.Unscoped().Preload("UserProfile").Preload("UserProfile.User").
+		Where("deleted_at IS NOT NULL").
+		First(&topic, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &topic, nil
+}
+
+// GetRemovedPaginated retrieves removed topics, most recently removed first
+// userID: chỉ lấy topic do user tạo ("" = tất cả, admin)
+func (r *TopicRepository) GetRemovedPaginated(userID string, page, pageSize int) ([]*models.Topic, int64, error) {
+	query := r.db.Unscoped().Model(&models.Topic{}).Where("topics.deleted_at IS NOT NULL")
+	if userID != "" {
+		query = query.Where("topics.user_profile_id IN (SELECT id FROM user_profiles WHERE user_id = ?)", userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var topics []*models.Topic
+	offset := (page - 1) * pageSize
+	err := query.Preload("UserProfile").Preload("UserProfile.User").
+		Order("topics.deleted_at DESC").
+		Offset(offset).
+		Limit(pageSize).
+		Find(&topics).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return topics, total, nil
+}
+
+// GetExpiredRemoved retrieves removed topics whose grace period has ended
+func (r *TopicRepository) GetExpiredRemoved(now time.Time, limit int) ([]*models.Topic, error) {
+	var topics []*models.Topic
+	err := r.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND purge_after IS NOT NULL AND purge_after <= ?", now).
+		Order("purge_after ASC").
+		Limit(limit).
+		Find(&topics).Error
+	return topics, err
 }
 
 // GetAll retrieves all topics (admin only)
@@ -171,7 +225,8 @@ func (r *TopicRepository) GetAllPaginated(page, pageSize int, search, creatorID,
 	// Build base query - use Table() instead of Model() to avoid GORM confusion with JOINs
 	query := r.db.Table("topics").
 		Joins("LEFT JOIN user_profiles ON topics.user_profile_id = user_profiles.id").
-		Joins("LEFT JOIN users ON user_profiles.user_id = users.id")
+		Joins("LEFT JOIN users ON user_profiles.user_id = users.id").
+		Where("topics.deleted_at IS NULL") // Table() không tự lọc soft delete
 
 	// Apply search filter
 	if search != "" {
@@ -67,6 +67,20 @@ func (r *TopicUserRepository) Update(topicUser *models.TopicUser) error {
 	return r.db.Save(topicUser).Error
 }
 
+// UpdatePermission changes the permission type of a topic-user assignment (gorm.ErrRecordNotFound nếu chưa assign)
+func (r *TopicUserRepository) UpdatePermission(topicID, userID, permissionType string) (*models.TopicUser, error) {
+	result := r.db.Model(&models.TopicUser{}).
+		Where("topic_id = ? AND user_id = ?", topicID, userID).
+		Update("permission_type", permissionType)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.GetByTopicAndUser(topicID, userID)
+}
+
 // Delete removes a topic-user assignment
 func (r *TopicUserRepository) Delete(topicID, userID string) error {
 	return r.db.Where("topic_id = ? AND user_id = ?", topicID, userID).Delete(&models.TopicUser{}).Error
@@ -86,6 +100,15 @@ func (r *TopicUserRepository) GetTopicIDsAssignedToUser(userID string) ([]string
 	return topicIDs, err
 }
 
+// GetTopicIDsAssignedToUserWithPermission returns topic IDs assigned to a user with one of the given permission types
+func (r *TopicUserRepository) GetTopicIDsAssignedToUserWithPermission(userID string, permissionTypes []string) ([]string, error) {
+	var topicIDs []string
+	err := r.db.Model(&models.TopicUser{}).
+		Where("user_id = ? AND permission_type IN ?", userID, permissionTypes).
+		Pluck("topic_id", &topicIDs).Error
+	return topicIDs, err
+}
+
 // GetByTopicIDs retrieves all users assigned to multiple topics (batch load)
 // Returns a map where key is topicID and value is list of TopicUser assignments
 func (r *TopicUserRepository) GetByTopicIDs(topicIDs []string) (map[string][]*models.TopicUser, error) {
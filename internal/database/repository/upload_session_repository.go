@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UploadSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadSessionRepository(db *gorm.DB) *UploadSessionRepository {
+	return &UploadSessionRepository{db: db}
+}
+
+// Create creates an upload session
+func (r *UploadSessionRepository) Create(session *models.UploadSession) error {
+	return r.db.Create(session).Error
+}
+
+// GetByID retrieves an upload session by ID
+func (r *UploadSessionRepository) GetByID(id string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := r.db.First(&session, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// AppendChunk locks the session row, calls write (ghi chunk vào file tạm) và tăng offset theo số byte đã ghi.
+// Lock giữ tới khi ghi xong nên 2 request cùng offset không ghi đè lên nhau.
+func (r *UploadSessionRepository) AppendChunk(id string, expiresAt time.Time, write func(session *models.UploadSession) (int64, error)) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		written, err := write(&session)
+		if err != nil {
+			return err
+		}
+
+		session.Offset += written
+		session.ExpiresAt = expiresAt
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"upload_offset": session.Offset,
+			"expires_at":    session.ExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Claim locks the session row, calls check và chuyển session sang "completing" trong 1 transaction ngắn.
+// Nội dung file được lưu sau khi commit (không giữ lock khi hash / copy file lớn), rồi gọi Finalize hoặc ReleaseClaim.
+func (r *UploadSessionRepository) Claim(id string, expiresAt time.Time, check func(session *models.UploadSession) error) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		if err := check(&session); err != nil {
+			return err
+		}
+
+		session.Status = models.UploadSessionStatusCompleting
+		session.ExpiresAt = expiresAt
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"status":     session.Status,
+			"expires_at": session.ExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Finalize marks a claimed session completed with the created file
+func (r *UploadSessionRepository) Finalize(id, fileID string, expiresAt time.Time) error {
+	result := r.db.Model(&models.UploadSession{}).
+		Where("id = ? AND status = ?", id, models.UploadSessionStatusCompleting).
+		Updates(map[string]interface{}{
+			"status":     models.UploadSessionStatusCompleted,
+			"file_id":    fileID,
+			"expires_at": expiresAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ReleaseClaim returns a claimed session to "uploading" when storing the file failed (client complete lại được)
+func (r *UploadSessionRepository) ReleaseClaim(id string) error {
+	return r.db.Model(&models.UploadSession{}).
+		Where("id = ? AND status = ?", id, models.UploadSessionStatusCompleting).
+		Update("status", models.UploadSessionStatusUploading).Error
+}
+
+// GetExpired retrieves sessions expired before a time (chưa complete = bỏ dở)
+func (r *UploadSessionRepository) GetExpired(before time.Time, limit int) ([]*models.UploadSession, error) {
+	var sessions []*models.UploadSession
+	err := r.db.Where("expires_at < ?", before).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Delete removes an upload session
+func (r *UploadSessionRepository) Delete(id string) error {
+	return r.db.Delete(&models.UploadSession{}, "id = ?", id).Error
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrUploadStagingConsumed is returned when staged uploads were consumed by another request (vd: 2 lần save song song)
+var ErrUploadStagingConsumed = errors.New("staged uploads already consumed")
+
+type UploadStagingRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadStagingRepository(db *gorm.DB) *UploadStagingRepository {
+	return &UploadStagingRepository{db: db}
+}
+
+// CreateBatch stages uploaded files
+func (r *UploadStagingRepository) CreateBatch(stagings []*models.UploadStaging) error {
+	if len(stagings) == 0 {
+		return nil
+	}
+	return r.db.Create(&stagings).Error
+}
+
+// GetPending retrieves the staged uploads chưa consume và chưa hết hạn (theo thứ tự upload)
+func (r *UploadStagingRepository) GetPending(userID, kind, projectID, tempPromptID string) ([]*models.UploadStaging, error) {
+	var stagings []*models.UploadStaging
+	err := r.db.Where("user_id = ? AND kind = ? AND project_id = ? AND temp_prompt_id = ? AND consumed_at IS NULL AND expires_at > ?",
+		userID, kind, projectID, tempPromptID, time.Now()).
+		Order("created_at ASC").
+		Find(&stagings).Error
+	return stagings, err
+}
+
+// ConsumePending atomically marks the pending staged uploads of a key as consumed and returns them
+func (r *UploadStagingRepository) ConsumePending(userID, kind, projectID, tempPromptID string) ([]*models.UploadStaging, error) {
+	var stagings []*models.UploadStaging
+	err := r.db.Raw(`
+		UPDATE upload_stagings
+		SET consumed_at = NOW()
+		WHERE user_id = ? AND kind = ? AND project_id = ? AND temp_prompt_id = ? AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING *
+	`, userID, kind, projectID, tempPromptID).Scan(&stagings).Error
+	return stagings, err
+}
+
+// GetAbandoned retrieves staged uploads hết hạn mà chưa được consume
+func (r *UploadStagingRepository) GetAbandoned(before time.Time, limit int) ([]*models.UploadStaging, error) {
+	var stagings []*models.UploadStaging
+	err := r.db.Where("consumed_at IS NULL AND expires_at < ?", before).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&stagings).Error
+	return stagings, err
+}
+
+// CountPendingByFileID counts the other pending staged uploads of a file (file có thể được stage lại)
+func (r *UploadStagingRepository) CountPendingByFileID(fileID, excludeID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.UploadStaging{}).
+		Where("file_id = ? AND id <> ? AND consumed_at IS NULL AND expires_at > ?", fileID, excludeID, time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+// Delete removes a staged upload
+func (r *UploadStagingRepository) Delete(id string) error {
+	return r.db.Delete(&models.UploadStaging{}, "id = ?", id).Error
+}
+
+// DeleteConsumedBefore removes staged uploads consumed before a time
+func (r *UploadStagingRepository) DeleteConsumedBefore(before time.Time) (int64, error) {
+	result := r.db.Where("consumed_at IS NOT NULL AND consumed_at < ?", before).Delete(&models.UploadStaging{})
+	return result.RowsAffected, result.Error
+}
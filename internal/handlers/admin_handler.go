@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/middleware"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services/auth"
@@ -58,8 +60,8 @@ func NewAdminHandler(authService *auth.AuthService, db *gorm.DB, topicService *s
 }
 
 // Register godoc
-// @Summary Register a new user (Admin only)
-// @Description Register a new user account with username and password (Admin privileges required). Role can be specified via role_id field. If not provided, defaults to "topic_user".
+// @Summary Register a new user (requires user.manage permission)
+// @Description Register a new user account with username and password (requires user.manage permission). Role can be specified via role_id field. If not provided, defaults to "topic_user".
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -73,10 +75,8 @@ func NewAdminHandler(authService *auth.AuthService, db *gorm.DB, topicService *s
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/register [post]
 func (h *AdminHandler) Register(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionUserManage) {
 		return
 	}
 
@@ -100,8 +100,8 @@ func (h *AdminHandler) Register(c *gin.Context) {
 }
 
 // GetAllUsers godoc
-// @Summary Get all users (Admin only)
-// @Description Get list of all users in the system with pagination and search (Admin privileges required)
+// @Summary Get all users (requires user.manage permission)
+// @Description Get list of all users in the system with pagination and search (requires user.manage permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -116,10 +116,8 @@ func (h *AdminHandler) Register(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/users [get]
 func (h *AdminHandler) GetAllUsers(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionUserManage) {
 		return
 	}
 
@@ -180,8 +178,8 @@ func (h *AdminHandler) GetAllUsers(c *gin.Context) {
 }
 
 // SetUserStatus godoc
-// @Summary Set user active status (Admin only)
-// @Description Set the active status of a user account (Admin privileges required)
+// @Summary Set user active status (requires user.manage permission)
+// @Description Set the active status of a user account (requires user.manage permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -196,10 +194,8 @@ func (h *AdminHandler) GetAllUsers(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/users/{id}/status [put]
 func (h *AdminHandler) SetUserStatus(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionUserManage) {
 		return
 	}
 
@@ -230,8 +226,8 @@ func (h *AdminHandler) SetUserStatus(c *gin.Context) {
 }
 
 // AdminGetAllBoxes godoc
-// @Summary Get all boxes (Admin only)
-// @Description Get all boxes in the system (Admin privileges required)
+// @Summary Get all boxes (requires box.view permission)
+// @Description Get all boxes in the system (requires box.view permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -242,10 +238,8 @@ func (h *AdminHandler) SetUserStatus(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/boxes [get]
 func (h *AdminHandler) AdminGetAllBoxes(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionBoxView) {
 		return
 	}
 
@@ -259,8 +253,8 @@ func (h *AdminHandler) AdminGetAllBoxes(c *gin.Context) {
 }
 
 // AdminGetAllApps godoc
-// @Summary Get all apps (Admin only)
-// @Description Get all apps in the system (Admin privileges required)
+// @Summary Get all apps (requires box.view permission)
+// @Description Get all apps in the system (requires box.view permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -271,10 +265,8 @@ func (h *AdminHandler) AdminGetAllBoxes(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/apps [get]
 func (h *AdminHandler) AdminGetAllApps(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionBoxView) {
 		return
 	}
 
@@ -288,8 +280,8 @@ func (h *AdminHandler) AdminGetAllApps(c *gin.Context) {
 }
 
 // AdminGetAllBoxesWithStatus godoc
-// @Summary Get all boxes with online/offline status (Admin only)
-// @Description Get all boxes in the system with their online/offline status checked via health check (Admin privileges required)
+// @Summary Get all boxes with online/offline status (requires box.view permission)
+// @Description Get all boxes in the system with their online/offline status checked via health check (requires box.view permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -300,10 +292,8 @@ func (h *AdminHandler) AdminGetAllApps(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/boxes/status [get]
 func (h *AdminHandler) AdminGetAllBoxesWithStatus(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionBoxView) {
 		return
 	}
 
@@ -317,8 +307,8 @@ func (h *AdminHandler) AdminGetAllBoxesWithStatus(c *gin.Context) {
 }
 
 // ResetPassword godoc
-// @Summary Reset user password (Admin only)
-// @Description Reset a user's password to a new password specified by admin (Admin privileges required)
+// @Summary Reset user password (requires user.manage permission)
+// @Description Reset a user's password to a new password specified by admin (requires user.manage permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -333,6 +323,11 @@ func (h *AdminHandler) AdminGetAllBoxesWithStatus(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/users/{id}/reset-password [post]
 func (h *AdminHandler) ResetPassword(c *gin.Context) {
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionUserManage) {
+		return
+	}
+
 	userID := c.Param("id")
 	if userID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is required"})
@@ -360,8 +355,8 @@ func (h *AdminHandler) ResetPassword(c *gin.Context) {
 }
 
 // GetAllRoles godoc
-// @Summary Get all roles (Admin only)
-// @Description Get list of all roles in the system (Admin privileges required)
+// @Summary Get all roles (requires role.manage permission)
+// @Description Get list of all roles in the system (requires role.manage permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -372,10 +367,8 @@ func (h *AdminHandler) ResetPassword(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/roles [get]
 func (h *AdminHandler) GetAllRoles(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionRoleManage) {
 		return
 	}
 
@@ -389,8 +382,8 @@ func (h *AdminHandler) GetAllRoles(c *gin.Context) {
 }
 
 // GetUserRoles godoc
-// @Summary Get user roles (Admin only)
-// @Description Get all roles assigned to a specific user (Admin privileges required)
+// @Summary Get user roles (requires role.manage permission)
+// @Description Get all roles assigned to a specific user (requires role.manage permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -403,10 +396,8 @@ func (h *AdminHandler) GetAllRoles(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/users/{id}/roles [get]
 func (h *AdminHandler) GetUserRoles(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionRoleManage) {
 		return
 	}
 
@@ -430,8 +421,8 @@ func (h *AdminHandler) GetUserRoles(c *gin.Context) {
 }
 
 // AssignRoleToUser godoc
-// @Summary Assign role to user (Admin only)
-// @Description Assign a role to a user (Admin privileges required)
+// @Summary Assign role to user (requires role.manage permission)
+// @Description Assign a role to a user (requires role.manage permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -446,10 +437,8 @@ func (h *AdminHandler) GetUserRoles(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/users/{id}/roles [post]
 func (h *AdminHandler) AssignRoleToUser(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionRoleManage) {
 		return
 	}
 
@@ -487,8 +476,8 @@ func (h *AdminHandler) AssignRoleToUser(c *gin.Context) {
 }
 
 // RemoveRoleFromUser godoc
-// @Summary Remove role from user (Admin only)
-// @Description Remove a role from a user (Admin privileges required)
+// @Summary Remove role from user (requires role.manage permission)
+// @Description Remove a role from a user (requires role.manage permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -503,10 +492,8 @@ func (h *AdminHandler) AssignRoleToUser(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/users/{id}/roles [delete]
 func (h *AdminHandler) RemoveRoleFromUser(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionRoleManage) {
 		return
 	}
 
@@ -544,8 +531,8 @@ func (h *AdminHandler) RemoveRoleFromUser(c *gin.Context) {
 }
 
 // GetAllTopics godoc
-// @Summary Get all topics (Admin only)
-// @Description Get all topics in the system with pagination, search, and filters (Admin privileges required)
+// @Summary Get all topics (requires topic.manage permission)
+// @Description Get all topics in the system with pagination, search, and filters (requires topic.manage permission)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -562,10 +549,8 @@ func (h *AdminHandler) RemoveRoleFromUser(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/topics [get]
 func (h *AdminHandler) GetAllTopics(c *gin.Context) {
-	// Check if user is admin
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionTopicManage) {
 		return
 	}
 
@@ -675,8 +660,8 @@ func (h *AdminHandler) GetAllTopics(c *gin.Context) {
 }
 
 // AssignTopicToUser godoc
-// @Summary Assign topic to user (Admin only)
-// @Description Assign a topic to a user so they can access it (Admin privileges required)
+// @Summary Assign topic to user (Admin or full permission)
+// @Description Assign a topic to a user so they can access it with read, write or full permission (Admin privileges or full permission on the topic required)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -691,19 +676,20 @@ func (h *AdminHandler) GetAllTopics(c *gin.Context) {
 // @Failure 409 {object} map[string]interface{} "Conflict: User already assigned to this topic"
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/topics/{id}/assign [post]
+// @Router /api/v1/topics/{id}/users [post]
 func (h *AdminHandler) AssignTopicToUser(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
-		return
-	}
-
 	topicID := c.Param("id")
 	if topicID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Topic ID is required"})
 		return
 	}
 
+	// topic.manage (admin) hoặc user có quyền full trên topic
+	if !authorizeTopicAccess(c, h.topicService, topicID, canManageAllTopics(c), models.TopicPermissionFull) {
+		return
+	}
+
 	var req models.AssignTopicRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
@@ -713,9 +699,9 @@ func (h *AdminHandler) AssignTopicToUser(c *gin.Context) {
 	// Validate permission_type
 	permissionType := req.PermissionType
 	if permissionType == "" {
-		permissionType = "read" // Default
+		permissionType = models.TopicPermissionRead // Default
 	}
-	if permissionType != "read" && permissionType != "write" && permissionType != "full" {
+	if !models.IsValidTopicPermission(permissionType) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission_type. Must be 'read', 'write', or 'full'"})
 		return
 	}
@@ -782,8 +768,8 @@ func (h *AdminHandler) AssignTopicToUser(c *gin.Context) {
 }
 
 // GetTopicAssignedUsers godoc
-// @Summary Get users assigned to a topic (Admin only)
-// @Description Get list of all users assigned to a specific topic (Admin privileges required)
+// @Summary Get users assigned to a topic (Admin or full permission)
+// @Description Get list of all users assigned to a specific topic with their permission (Admin privileges or full permission on the topic required)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -795,19 +781,19 @@ func (h *AdminHandler) AssignTopicToUser(c *gin.Context) {
 // @Failure 404 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/admin/topics/{id}/users [get]
+// @Router /api/v1/topics/{id}/users [get]
 func (h *AdminHandler) GetTopicAssignedUsers(c *gin.Context) {
-	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
-		return
-	}
-
 	topicID := c.Param("id")
 	if topicID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Topic ID is required"})
 		return
 	}
 
+	// topic.manage (admin) hoặc user có quyền full trên topic
+	if !authorizeTopicAccess(c, h.topicService, topicID, canManageAllTopics(c), models.TopicPermissionFull) {
+		return
+	}
+
 	// Check if topic exists
 	_, err := h.topicService.GetTopicByID(topicID)
 	if err != nil {
@@ -850,28 +836,80 @@ func (h *AdminHandler) GetTopicAssignedUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, responses)
 }
 
-// RemoveTopicAssignment godoc
-// @Summary Remove topic assignment from user (Admin only)
-// @Description Remove a topic assignment from a user (Admin privileges required)
+// UpdateTopicAssignmentPermission godoc
+// @Summary Change the permission of a topic assignment (Admin or full permission)
+// @Description Change the permission (read, write, full) of a user already assigned to a topic (Admin privileges or full permission on the topic required)
 // @Tags admin
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Topic ID"
 // @Param user_id path string true "User ID"
+// @Param request body models.UpdateTopicPermissionRequest true "New permission"
 // @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
 // @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
-// @Router /api/v1/admin/topics/{id}/users/{user_id} [delete]
-func (h *AdminHandler) RemoveTopicAssignment(c *gin.Context) {
+// @Router /api/v1/admin/topics/{id}/users/{user_id} [put]
+// @Router /api/v1/topics/{id}/users/{user_id} [put]
+func (h *AdminHandler) UpdateTopicAssignmentPermission(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
-	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	topicID := c.Param("id")
+	userID := c.Param("user_id")
+	if topicID == "" || userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Topic ID and User ID are required"})
 		return
 	}
 
+	// topic.manage (admin) hoặc user có quyền full trên topic
+	if !authorizeTopicAccess(c, h.topicService, topicID, canManageAllTopics(c), models.TopicPermissionFull) {
+		return
+	}
+
+	var req models.UpdateTopicPermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data. permission_type must be 'read', 'write', or 'full'", "details": err.Error()})
+		return
+	}
+
+	topicUser, err := h.topicUserRepo.UpdatePermission(topicID, userID, req.PermissionType)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User is not assigned to this topic"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permission", "details": err.Error()})
+		return
+	}
+
+	logrus.Infof("User %s changed permission of user %s on topic %s to %s", user.ID, userID, topicID, topicUser.PermissionType)
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Topic permission updated successfully",
+		"topic_id":        topicID,
+		"user_id":         userID,
+		"permission_type": topicUser.PermissionType,
+	})
+}
+
+// RemoveTopicAssignment godoc
+// @Summary Remove topic assignment from user (Admin or full permission)
+// @Description Remove a topic assignment from a user (Admin privileges or full permission on the topic required)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Topic ID"
+// @Param user_id path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/topics/{id}/users/{user_id} [delete]
+// @Router /api/v1/topics/{id}/users/{user_id} [delete]
+func (h *AdminHandler) RemoveTopicAssignment(c *gin.Context) {
 	topicID := c.Param("id")
 	userID := c.Param("user_id")
 	if topicID == "" || userID == "" {
@@ -879,6 +917,11 @@ func (h *AdminHandler) RemoveTopicAssignment(c *gin.Context) {
 		return
 	}
 
+	// topic.manage (admin) hoặc user có quyền full trên topic
+	if !authorizeTopicAccess(c, h.topicService, topicID, canManageAllTopics(c), models.TopicPermissionFull) {
+		return
+	}
+
 	// Check if topic exists
 	_, err := h.topicService.GetTopicByID(topicID)
 	if err != nil {
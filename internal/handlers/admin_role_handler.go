@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onegreenvn/green-provider-services-backend/internal/middleware"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services"
+)
+
+// roleErrorStatus maps role service errors to HTTP status codes
+func roleErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		return http.StatusNotFound, "Role not found"
+	case errors.Is(err, services.ErrRoleNameExists):
+		return http.StatusConflict, "Role name already exists"
+	case errors.Is(err, services.ErrDefaultRole):
+		return http.StatusBadRequest, "Default roles can not be deleted or renamed"
+	case errors.Is(err, services.ErrUnknownPermission):
+		return http.StatusBadRequest, "Unknown permission"
+	}
+	return http.StatusInternalServerError, "Failed to manage role"
+}
+
+// GetAllPermissions godoc
+// @Summary Get all permissions
+// @Description Get all permissions that can be granted to roles (requires role.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Permission
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/permissions [get]
+func (h *AdminHandler) GetAllPermissions(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionRoleManage) {
+		return
+	}
+
+	permissions, err := h.roleService.GetAllPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get permissions", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// GetRole godoc
+// @Summary Get a role
+// @Description Get a role with its permissions (requires role.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role ID"
+// @Success 200 {object} models.Role
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/roles/{id} [get]
+func (h *AdminHandler) GetRole(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionRoleManage) {
+		return
+	}
+
+	role, err := h.roleService.GetRoleByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole godoc
+// @Summary Create a role
+// @Description Create a role with a set of permissions, e.g. ["topic.manage", "process_log.manage"] (requires role.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateRoleRequest true "Role"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/roles [post]
+func (h *AdminHandler) CreateRole(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionRoleManage) {
+		return
+	}
+
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	role, err := h.roleService.CreateRoleWithPermissions(&req)
+	if err != nil {
+		status, message := roleErrorStatus(err)
+		c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole godoc
+// @Summary Update a role
+// @Description Update the name, description and/or permission set of a role. permissions replaces the whole set; default roles (topic_creator, topic_user, admin) can not be renamed (requires role.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role ID"
+// @Param request body models.UpdateRoleRequest true "Role changes"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/roles/{id} [put]
+func (h *AdminHandler) UpdateRole(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionRoleManage) {
+		return
+	}
+
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	role, err := h.roleService.UpdateRole(c.Param("id"), &req)
+	if err != nil {
+		status, message := roleErrorStatus(err)
+		c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole godoc
+// @Summary Delete a role
+// @Description Delete a role; it is removed from all users. Default roles (topic_creator, topic_user, admin) can not be deleted (requires role.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/roles/{id} [delete]
+func (h *AdminHandler) DeleteRole(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionRoleManage) {
+		return
+	}
+
+	roleID := c.Param("id")
+	if err := h.roleService.DeleteRole(roleID); err != nil {
+		status, message := roleErrorStatus(err)
+		c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully", "role_id": roleID})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"sort"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -120,7 +121,7 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 
 // GetProfile godoc
 // @Summary Get user profile
-// @Description Get current user profile information with roles
+// @Description Get current user profile information with roles and permissions
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -146,6 +147,18 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		roleNames[i] = role.Name
 	}
 
+	// Get user permissions
+	permissions, err := h.roleService.GetUserPermissions(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user permissions", "details": err.Error()})
+		return
+	}
+	permissionNames := make([]string, 0, len(permissions))
+	for name := range permissions {
+		permissionNames = append(permissionNames, name)
+	}
+	sort.Strings(permissionNames)
+
 	// Create response with roles
 	response := models.UserWithRolesResponse{
 		ID:          user.ID,
@@ -158,6 +171,7 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		UpdatedAt:   user.UpdatedAt,
 		LastLoginAt: user.LastLoginAt,
 		Roles:       roleNames,
+		Permissions: permissionNames,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services"
+	"github.com/sirupsen/logrus"
+)
+
+// ExecutionHandler exposes the artifacts (output files) of script executions
+type ExecutionHandler struct {
+	outputService     *services.ExecutionOutputService
+	processLogService *services.ProcessLogService // Quyền truy cập execution (CanUserAccessEntity) và log của execution
+}
+
+func NewExecutionHandler(outputService *services.ExecutionOutputService, processLogService *services.ProcessLogService) *ExecutionHandler {
+	return &ExecutionHandler{
+		outputService:     outputService,
+		processLogService: processLogService,
+	}
+}
+
+// GetArtifacts godoc
+// @Summary List execution artifacts
+// @Description List every output file produced by a script execution, grouped by project (execution order) then prompt, with size, mime type, producing prompt and a signed download URL (valid 1 hour).
+// @Description Access: user running the execution, users with access to its topic, users with process_log.manage or topic.manage permission.
+// @Tags executions
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Execution ID"
+// @Success 200 {object} models.ExecutionArtifactsResponse
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/executions/{id}/artifacts [get]
+func (h *ExecutionHandler) GetArtifacts(c *gin.Context) {
+	execution, ok := h.getAuthorizedExecution(c)
+	if !ok {
+		return
+	}
+
+	artifacts, err := h.outputService.GetExecutionArtifacts(execution)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get artifacts", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, artifacts)
+}
+
+// DownloadArtifactsZip godoc
+// @Summary Download execution artifacts as ZIP
+// @Description Stream a ZIP bundle of all artifacts of a script execution ({project}/{prompt_order}_{file}), with manifest.json (artifact listing with signed URLs) and logs/execution.ndjson (execution logs).
+// @Tags executions
+// @Produce application/zip
+// @Security BearerAuth
+// @Param id path string true "Execution ID"
+// @Success 200 {file} file
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/executions/{id}/artifacts.zip [get]
+func (h *ExecutionHandler) DownloadArtifactsZip(c *gin.Context) {
+	execution, ok := h.getAuthorizedExecution(c)
+	if !ok {
+		return
+	}
+
+	artifacts, err := h.outputService.GetExecutionArtifacts(execution)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get artifacts", "details": err.Error()})
+		return
+	}
+
+	fileName := fmt.Sprintf("execution_%s_artifacts.zip", execution.ID)
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Header("X-Accel-Buffering", "no") // Disable buffering for nginx
+	c.Status(http.StatusOK)
+
+	err = h.outputService.WriteArtifactsZip(c.Writer, artifacts, func(w io.Writer) error {
+		return h.processLogService.ExportExecutionLogs(w, execution)
+	})
+	if err != nil {
+		// Lỗi sau khi đã gửi dữ liệu: client nhận file ZIP bị cắt
+		logrus.Errorf("Failed to stream artifacts of execution %s: %v", execution.ID, err)
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download artifacts", "details": err.Error()})
+		}
+	}
+}
+
+// getAuthorizedExecution loads the execution and checks the user can access it (404 if not, không lộ execution tồn tại)
+func (h *ExecutionHandler) getAuthorizedExecution(c *gin.Context) (*models.ScriptExecution, bool) {
+	userID := c.MustGet("user_id").(string)
+	executionID := c.Param("id")
+
+	allowed, err := h.processLogService.CanUserAccessEntity(userID, "script_execution", executionID, canReadAllEntityLogs(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access", "details": err.Error()})
+		return nil, false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Execution not found"})
+		return nil, false
+	}
+
+	execution, err := h.outputService.GetExecution(executionID)
+	if err != nil {
+		if errors.Is(err, services.ErrExecutionOutputTargetNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Execution not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get execution", "details": err.Error()})
+		}
+		return nil, false
+	}
+
+	return execution, true
+}
@@ -1,31 +1,62 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/middleware"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services"
+	"github.com/onegreenvn/green-provider-services-backend/internal/utils"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
 type FileHandler struct {
 	fileService   *services.FileService
-	scriptService *services.ScriptService // Để cache file IDs sau khi upload (cho project)
+	scriptService *services.ScriptService // Để stage file IDs sau khi upload (cho prompt / gem)
+	outputService *services.ExecutionOutputService
+	quotaService  *services.StorageQuotaService
+	manageService *services.FileManagementService
+	uploadService *services.ResumableUploadService
+	machineSvc    *services.MachineService // Xác thực machine khi download token bind machine ID
 }
 
-func NewFileHandler(db *gorm.DB, baseURL string, scriptService *services.ScriptService) *FileHandler {
-	fileRepo := repository.NewFileRepository(db)
-	fileService := services.NewFileService(fileRepo, baseURL)
-
+func NewFileHandler(db *gorm.DB, fileService *services.FileService, quotaService *services.StorageQuotaService, uploadService *services.ResumableUploadService, manageService *services.FileManagementService, outputService *services.ExecutionOutputService, scriptService *services.ScriptService) *FileHandler {
 	return &FileHandler{
 		fileService:   fileService,
 		scriptService: scriptService,
+		outputService: outputService,
+		quotaService:  quotaService,
+		manageService: manageService,
+		uploadService: uploadService,
+		machineSvc:    services.NewMachineService(repository.NewBoxRepository(db), repository.NewAppRepository(db), repository.NewUserRepository(db)),
+	}
+}
+
+// uploadErrorStatus maps upload errors to HTTP status (quota → 413, mime type → 415)
+func uploadErrorStatus(err error) (int, string) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, services.ErrStorageQuotaExceeded), errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, "Storage quota exceeded"
+	case errors.Is(err, services.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge, "File too large"
+	case errors.Is(err, services.ErrMimeTypeNotAllowed):
+		return http.StatusUnsupportedMediaType, "File type not allowed"
+	case errors.Is(err, services.ErrInvalidFileMetadata):
+		return http.StatusBadRequest, "Invalid file metadata"
+	default:
+		return http.StatusInternalServerError, "Failed to upload file"
 	}
 }
 
@@ -33,25 +64,48 @@ func NewFileHandler(db *gorm.DB, baseURL string, scriptService *services.ScriptS
 // @Summary Upload file(s)
 // @Description Upload one or multiple files to the server. Returns file IDs that can be used in knowledge_files when creating topics/projects or input_files for prompts.
 // @Description Supports both single file (form field: "file") and multiple files (form field: "files[]")
-// @Description Optional: project_id and prompt_id to cache files for specific prompt
+// @Description Optional: project_id and prompt_id to stage files for a specific prompt (attached when the script is saved)
 // @Tags files
 // @Accept multipart/form-data
 // @Produce json
 // @Security BearerAuth
 // @Param file formData file false "Single file to upload"
 // @Param files formData file false "Multiple files to upload (files[])"
-// @Param project_id formData string false "Project ID to cache files for project (for knowledge_files)"
-// @Param prompt_id formData string false "Prompt ID to cache files for specific prompt (for input_files)"
+// @Param project_id formData string false "Project ID to stage files for a prompt"
+// @Param prompt_id formData string false "Prompt ID to stage files for a specific prompt (for input_files); without it files are staged as knowledge for the next gem"
+// @Param folder formData string false "Virtual folder (e.g. reports/2025)"
+// @Param tags formData string false "Comma separated tags"
 // @Success 201 {object} map[string]interface{} "Single file: {file: FileResponse}, Multiple files: {files: []FileResponse}"
 // @Failure 400 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{} "Storage quota exceeded or file too large"
+// @Failure 415 {object} map[string]interface{} "File type not allowed"
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/files/upload [post]
 func (h *FileHandler) UploadFile(c *gin.Context) {
 	userID := c.MustGet("user_id").(string)
 
+	// Quota: từ chối sớm request lớn hơn dung lượng còn lại (trước khi đọc multipart body)
+	bodyLimit, err := h.quotaService.UploadBodyLimit(userID)
+	if err != nil {
+		status, message := uploadErrorStatus(err)
+		c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		return
+	}
+	if bodyLimit > 0 {
+		if c.Request.ContentLength > bodyLimit {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Storage quota exceeded", "details": fmt.Sprintf("request body of %d bytes exceeds remaining quota", c.Request.ContentLength)})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, bodyLimit)
+	}
+
 	// Parse multipart form first to get all form data including project_id and prompt_id
 	form, err := c.MultipartForm()
 	if err != nil {
+		if status, message := uploadErrorStatus(err); status == http.StatusRequestEntityTooLarge {
+			c.JSON(status, gin.H{"error": message, "details": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form", "details": err.Error()})
 		return
 	}
@@ -67,6 +121,12 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	if promptIDs := form.Value["prompt_id"]; len(promptIDs) > 0 && promptIDs[0] != "" {
 		req.PromptID = promptIDs[0]
 	}
+	if folders := form.Value["folder"]; len(folders) > 0 && folders[0] != "" {
+		req.Folder = folders[0]
+	}
+	for _, tags := range form.Value["tags"] {
+		req.Tags = append(req.Tags, strings.Split(tags, ",")...)
+	}
 
 	// Try to get files with different possible keys
 	var files []*multipart.FileHeader
@@ -111,20 +171,13 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		// Single file upload
 		file, err := h.fileService.UploadFile(userID, fileHeader, &req)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file", "details": err.Error()})
+			status, message := uploadErrorStatus(err)
+			c.JSON(status, gin.H{"error": message, "details": err.Error()})
 			return
 		}
 
-		// Cache file ID để dùng khi tạo project hoặc prompt
-		if h.scriptService != nil {
-			if req.PromptID != "" && req.ProjectID != "" {
-				// Cache cho prompt cụ thể
-				h.scriptService.AddUploadedFilesForPrompt(userID, req.ProjectID, req.PromptID, []string{file.ID})
-			} else {
-				// Cache cho project (logic cũ)
-				h.scriptService.AddUploadedFiles(userID, []string{file.ID})
-			}
-		}
+		// Stage file ID để dùng khi lưu prompt hoặc tạo gem
+		h.stageUploadedFiles(userID, req.ProjectID, req.PromptID, []string{file.ID})
 
 		response := h.fileService.FileToResponse(file)
 		c.JSON(http.StatusCreated, gin.H{"file": response})
@@ -133,13 +186,15 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 
 	// Multiple files upload
 	uploadedFiles := make([]models.FileResponse, 0, len(files))
-	uploadedFileIDs := make([]string, 0, len(files)) // Lưu file IDs để cache
+	uploadedFileIDs := make([]string, 0, len(files)) // Lưu file IDs để stage
 	var uploadErrors []string
+	var lastErr error
 
 	for _, fileHeader := range files {
 		file, err := h.fileService.UploadFile(userID, fileHeader, &req)
 		if err != nil {
 			uploadErrors = append(uploadErrors, fmt.Sprintf("%s: %v", fileHeader.Filename, err))
+			lastErr = err
 			continue
 		}
 
@@ -149,23 +204,16 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	}
 
 	if len(uploadedFiles) == 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		status, _ := uploadErrorStatus(lastErr)
+		c.JSON(status, gin.H{
 			"error":   "Failed to upload all files",
 			"details": uploadErrors,
 		})
 		return
 	}
 
-	// Cache file IDs để dùng khi tạo project hoặc prompt
-	if h.scriptService != nil && len(uploadedFileIDs) > 0 {
-		if req.PromptID != "" && req.ProjectID != "" {
-			// Cache cho prompt cụ thể
-			h.scriptService.AddUploadedFilesForPrompt(userID, req.ProjectID, req.PromptID, uploadedFileIDs)
-		} else {
-			// Cache cho project (logic cũ)
-			h.scriptService.AddUploadedFiles(userID, uploadedFileIDs)
-		}
-	}
+	// Stage file IDs để dùng khi lưu prompt hoặc tạo gem
+	h.stageUploadedFiles(userID, req.ProjectID, req.PromptID, uploadedFileIDs)
 
 	// Return results - include errors if some files failed
 	result := gin.H{
@@ -182,60 +230,273 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	}
 }
 
+// stageUploadedFiles stages uploaded files cho prompt (có project_id + prompt_id) hoặc làm knowledge cho gem
+func (h *FileHandler) stageUploadedFiles(userID, projectID, promptID string, fileIDs []string) {
+	if h.scriptService == nil || len(fileIDs) == 0 {
+		return
+	}
+	if promptID != "" && projectID != "" {
+		// Stage cho prompt cụ thể
+		h.scriptService.AddUploadedFilesForPrompt(userID, projectID, promptID, fileIDs)
+	} else {
+		// Stage làm knowledge cho gem (logic cũ)
+		h.scriptService.AddUploadedFiles(userID, fileIDs)
+	}
+}
+
 // DownloadFile godoc
 // @Summary Download a file
 // @Description Download a file by ID. Supports two methods:
 // @Description 1. Authenticated: Requires Bearer token (owner only)
-// @Description 2. Token-based: Use ?token=xxx query param (for automation backend)
+// @Description 2. Token-based: Use ?token=xxx query param (signed URL cho automation backend hoặc share link). Mọi token revoke được (POST /files/{id}/download-tokens/revoke);
+// @Description share link có thể giới hạn lượt tải hoặc bind machine ID (khi đó gửi kèm X-Machine-ID / X-Machine-Secret). Mỗi GET trả nội dung (kể cả Range, redirect S3) tính 1 lượt tải; chỉ HEAD và 304 không tính.
+// @Description Supports Range / If-Range (resume, seek trong media), ETag + If-None-Match và Last-Modified + If-Modified-Since (304).
+// @Description Content-Disposition có filename* (UTF-8) cho tên file tiếng Việt. File trên S3: HEAD và 304 trả trực tiếp từ API, GET được redirect tới presigned URL (S3 tự hỗ trợ Range).
 // @Tags files
 // @Produce application/octet-stream
 // @Security BearerAuth
 // @Param id path string true "File ID"
-// @Param token query string false "Signed download token (for automation backend)"
+// @Param token query string false "Signed download token / share link token"
+// @Param X-Machine-ID header string false "Machine ID (token bind machine)"
+// @Param X-Machine-Secret header string false "Machine secret (token bind machine)"
+// @Param Range header string false "Byte range, vd: bytes=0-1048575"
+// @Param If-Range header string false "ETag hoặc Last-Modified; không khớp thì trả toàn bộ file"
+// @Param If-None-Match header string false "ETag đã có; khớp thì trả 304"
 // @Success 200 {file} file
+// @Success 206 {file} file "Partial content"
+// @Success 304 "Not modified"
+// @Failure 401 {object} map[string]interface{} "Missing or invalid token"
+// @Failure 403 {object} map[string]interface{} "Token revoked, expired, used up or bound to another machine"
 // @Failure 404 {object} map[string]interface{}
-// @Failure 403 {object} map[string]interface{}
+// @Failure 416 "Range not satisfiable"
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/files/{id}/download [get]
 func (h *FileHandler) DownloadFile(c *gin.Context) {
 	fileID := c.Param("id")
 
-	// Public download - no authentication required
-	// Just get file by ID and download
-	file, f, err := h.fileService.DownloadFileByToken(fileID)
+	file, err := h.fileService.GetFileByID(fileID)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
 		return
 	}
-	defer f.Close()
 
-	// Set headers for download
-	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.OriginalName))
-	c.Header("Content-Type", file.MimeType)
-	c.Header("Content-Length", fmt.Sprintf("%d", file.FileSize))
+	token, ok := h.authorizeDownload(c, file)
+	if !ok {
+		return
+	}
+	// Mọi request trả nội dung (kể cả Range, redirect tới presigned URL của cả object) đều tính lượt tải,
+	// chỉ HEAD và 304 không chuyển nội dung nên không tính
+	if token != nil && transfersFileContent(c.Request, file) {
+		if _, err := h.fileService.ConsumeDownloadToken(token); err != nil {
+			writeDownloadTokenError(c, file, err)
+			return
+		}
+	}
+
+	// File trên S3: redirect tới presigned URL ngắn hạn (client tải trực tiếp từ storage).
+	// Conditional GET và HEAD được trả lời tại API (ETag của API khác ETag của object S3, URL ký cho GET không dùng được cho HEAD)
+	if presignedURL, ok := h.fileService.PresignedDownloadURL(file); ok {
+		setFileHeaders(c, file)
+		c.Header("Last-Modified", file.CreatedAt.UTC().Format(http.TimeFormat))
+		if fileNotModified(c.Request, file) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		if c.Request.Method == http.MethodHead {
+			c.Header("Accept-Ranges", "bytes")
+			c.Header("Content-Length", strconv.FormatInt(file.FileSize, 10))
+			c.Status(http.StatusOK)
+			return
+		}
+		c.Redirect(http.StatusFound, presignedURL)
+		return
+	}
+
+	f, err := h.fileService.OpenFileContent(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	serveFileContent(c, file, f)
+}
+
+// authorizeDownload allows the owner (Bearer / API key) or a valid download token, writes the error response otherwise.
+// Returns the download token nếu request được cho phép nhờ token (chưa tính lượt tải).
+func (h *FileHandler) authorizeDownload(c *gin.Context, file *models.File) (*models.DownloadToken, bool) {
+	userID, authenticated := c.Get("user_id")
+	if authenticated && userID.(string) == file.UserID {
+		return nil, true
+	}
+
+	tokenString := c.Query("token")
+	if tokenString == "" {
+		if h.fileService.AllowsUnsignedDownload() {
+			return nil, true
+		}
+		if authenticated {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		} else {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Download token or authorization required"})
+		}
+		return nil, false
+	}
+
+	// Token bind machine: machine xác thực bằng X-Machine-ID / X-Machine-Secret
+	machineID := ""
+	if c.GetHeader("X-Machine-ID") != "" {
+		box, err := h.machineSvc.AuthenticateMachine(c.GetHeader("X-Machine-ID"), c.GetHeader("X-Machine-Secret"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid machine credentials", "details": err.Error()})
+			return nil, false
+		}
+		machineID = box.MachineID
+	}
+
+	token, err := h.fileService.AuthorizeDownloadToken(tokenString, file.ID, machineID)
+	if err != nil {
+		writeDownloadTokenError(c, file, err)
+		return nil, false
+	}
+	return token, true
+}
+
+// writeDownloadTokenError writes the response of a rejected download token
+func writeDownloadTokenError(c *gin.Context, file *models.File, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidDownloadToken):
+		if _, authenticated := c.Get("user_id"); authenticated {
+			// ?token= là access token của user khác chủ file
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		} else {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid download token"})
+		}
+	case errors.Is(err, services.ErrDownloadTokenRevoked),
+		errors.Is(err, services.ErrDownloadTokenExpired),
+		errors.Is(err, services.ErrDownloadLimitReached),
+		errors.Is(err, services.ErrDownloadTokenMachine):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Download token rejected", "details": err.Error()})
+	default:
+		logrus.Errorf("Failed to authorize download of file %s: %v", file.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authorize download", "details": err.Error()})
+	}
+}
+
+// transfersFileContent reports whether a request gets file content: GET không phải 304 (Range hay toàn bộ file)
+func transfersFileContent(r *http.Request, file *models.File) bool {
+	return r.Method == http.MethodGet && !fileNotModified(r, file)
+}
+
+// serveFileContent streams a file with Range / conditional GET support and closes content
+func serveFileContent(c *gin.Context, file *models.File, content io.ReadCloser) {
+	defer content.Close()
+
+	setFileHeaders(c, file)
+
+	// Backend trên disk: ServeContent xử lý Range, If-Range, If-None-Match, If-Modified-Since và HEAD
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, file.OriginalName, file.CreatedAt, seeker)
+		return
+	}
+
+	// Không seek được: chỉ hỗ trợ conditional GET, luôn trả toàn bộ file
+	c.Header("Last-Modified", file.CreatedAt.UTC().Format(http.TimeFormat))
+	c.Header("Accept-Ranges", "none")
+	if fileNotModified(c.Request, file) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Length", strconv.FormatInt(file.FileSize, 10))
+		c.Status(http.StatusOK)
+		return
+	}
+	c.DataFromReader(http.StatusOK, file.FileSize, file.MimeType, content, nil)
+}
+
+// setFileHeaders sets the headers shared by full, partial, HEAD and 304 responses of a file
+func setFileHeaders(c *gin.Context, file *models.File) {
+	c.Header("Content-Disposition", utils.ContentDisposition("attachment", file.OriginalName))
+	if file.MimeType != "" {
+		c.Header("Content-Type", file.MimeType)
+	}
+	// Nội dung của 1 file không đổi sau khi tạo (bản mới = file mới) → ETag mạnh, dùng được cho If-Range
+	c.Header("ETag", fileETag(file))
+	c.Header("Cache-Control", "private, no-cache")
+}
+
+// fileETag returns the ETag of a file: SHA-256 của blob, file cũ (chưa dedup) dùng ID + size
+func fileETag(file *models.File) string {
+	if file.BlobHash != nil && *file.BlobHash != "" {
+		return `"` + *file.BlobHash + `"`
+	}
+	return fmt.Sprintf(`"%s-%d"`, file.ID, file.FileSize)
+}
 
-	// Stream file to response
-	c.DataFromReader(http.StatusOK, file.FileSize, file.MimeType, f, nil)
+// fileNotModified evaluates If-None-Match (ưu tiên) và If-Modified-Since
+func fileNotModified(r *http.Request, file *models.File) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		etag := fileETag(file)
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !file.CreatedAt.Truncate(time.Second).After(since)
 }
 
 // GetMyFiles godoc
 // @Summary Get user's files
-// @Description Get all files uploaded by the current user
+// @Description Get all files uploaded by the current user, optionally filtered by folder, tag, name, source or mime type
 // @Tags files
 // @Produce json
 // @Security BearerAuth
+// @Param folder query string false "Virtual folder (empty = root). Omit to list all folders"
+// @Param recursive query bool false "Include subfolders of folder"
+// @Param tag query string false "Tag"
+// @Param search query string false "Search in original name"
+// @Param source query string false "File source (upload, automation)"
+// @Param mime_type query string false "Mime type (e.g. application/pdf or image/*)"
 // @Success 200 {array} models.FileResponse
+// @Failure 400 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/files [get]
 func (h *FileHandler) GetMyFiles(c *gin.Context) {
 	userID := c.MustGet("user_id").(string)
 
-	files, err := h.fileService.GetUserFiles(userID)
+	filter := models.FileListFilter{
+		Tag:      c.Query("tag"),
+		Search:   c.Query("search"),
+		Source:   c.Query("source"),
+		MimeType: c.Query("mime_type"),
+	}
+	if folder, ok := c.GetQuery("folder"); ok {
+		filter.Folder = &folder
+		filter.Recursive, _ = strconv.ParseBool(c.Query("recursive"))
+	}
+
+	files, err := h.manageService.ListFiles(userID, filter)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidFileMetadata) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get files", "details": err.Error()})
 		return
 	}
@@ -248,9 +509,233 @@ func (h *FileHandler) GetMyFiles(c *gin.Context) {
 	c.JSON(http.StatusOK, responses)
 }
 
+// GetFileFolders godoc
+// @Summary Get user's file folders
+// @Description Get the virtual folders of the current user's files with file count and total size
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.FileFolderResponse
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/folders [get]
+func (h *FileHandler) GetFileFolders(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	folders, err := h.manageService.ListFolders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get folders", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, folders)
+}
+
+// GetFileTags godoc
+// @Summary Get user's file tags
+// @Description Get the tags used by the current user's files with file count
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.FileTagResponse
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/tags [get]
+func (h *FileHandler) GetFileTags(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	tags, err := h.manageService.ListTags(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tags", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// GetFileReferences godoc
+// @Summary Get script prompts using a file
+// @Description Get the script prompts using this file as input: pinned by file_id, or by name (mode latest / legacy prompts) when this is the newest file with its original name
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Success 200 {array} models.FileReference
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/{id}/references [get]
+func (h *FileHandler) GetFileReferences(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	file, err := h.fileService.GetFile(c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	references, err := h.manageService.GetReferences(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file references", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, references)
+}
+
+// GetFileVersions godoc
+// @Summary Get the version history of a file
+// @Description Get all files of the owner with the same original name (logical file), oldest first. The last version is used by prompts referencing the name with mode latest.
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Success 200 {array} models.FileVersionResponse
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/{id}/versions [get]
+func (h *FileHandler) GetFileVersions(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	file, err := h.fileService.GetFile(c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	versions, err := h.fileService.GetFileVersions(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file versions", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetFilePreview godoc
+// @Summary Preview the text of a file
+// @Description Get the first max_kb KB of the text extracted from a document (txt, md, csv, json, docx, xlsx, pdf) with character, word and estimated token counts of the whole text,
+// @Description để biết file có vừa prompt không. Text được trích xuất khi upload (status pending trong lúc trích xuất); file upload trước đó được trích xuất khi xem preview lần đầu.
+// @Description PDF: best effort, PDF scan hoặc font encoding riêng trả về status unsupported.
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Param max_kb query int false "Preview size in KB (default 16, tối đa FILE_TEXT_MAX_KB)"
+// @Success 200 {object} models.FilePreviewResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/{id}/preview [get]
+func (h *FileHandler) GetFilePreview(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	maxKB := services.DefaultFilePreviewKB
+	if value := c.Query("max_kb"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_kb must be a positive integer"})
+			return
+		}
+		maxKB = parsed
+	}
+	if limit := h.fileService.MaxPreviewKB(); maxKB > limit {
+		maxKB = limit
+	}
+
+	file, err := h.fileService.GetFile(c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	preview, err := h.fileService.GetFilePreview(file, maxKB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview file", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// UpdateFile godoc
+// @Summary Rename, move or tag a file
+// @Description Update the original name, virtual folder and/or tags of a file. Prompts pinning the file by ID keep using it. Prompts using the latest file by name: when renaming, set update_references to rename them, otherwise warnings are returned.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Param request body models.UpdateFileRequest true "Fields to update"
+// @Success 200 {object} models.UpdateFileResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/{id} [patch]
+func (h *FileHandler) UpdateFile(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	var req models.UpdateFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	file, result, err := h.manageService.UpdateFile(userID, c.Param("id"), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidFileMetadata):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file metadata", "details": err.Error()})
+		case strings.Contains(err.Error(), "file not found"), strings.Contains(err.Error(), "access denied"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update file", "details": err.Error()})
+		}
+		return
+	}
+
+	result.File = h.fileService.FileToResponse(file)
+	c.JSON(http.StatusOK, result)
+}
+
+// DeleteFile godoc
+// @Summary Delete a file
+// @Description Delete a file of the current user. Files used as input by script prompts (by name) are not deleted unless force=true; the references are returned with 409.
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Param force query bool false "Delete even if prompts reference the file"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "File is referenced by script prompts"
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/{id} [delete]
+func (h *FileHandler) DeleteFile(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+	force, _ := strconv.ParseBool(c.Query("force"))
+
+	references, err := h.manageService.DeleteFile(userID, c.Param("id"), force)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrFileReferenced):
+			c.JSON(http.StatusConflict, gin.H{"error": "File is referenced by script prompts", "details": err.Error(), "references": references})
+		case strings.Contains(err.Error(), "file not found"), strings.Contains(err.Error(), "access denied"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file", "details": err.Error()})
+		}
+		return
+	}
+
+	response := gin.H{"message": "File deleted successfully"}
+	if len(references) > 0 {
+		response["references"] = references
+		response["warning"] = "Prompts still reference this file name as input"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // GetPromptFiles godoc
 // @Summary Get files uploaded for a specific prompt
-// @Description Get list of files that have been uploaded for a specific prompt (from cache)
+// @Description Get list of files uploaded for a specific prompt: staged uploads not yet attached by saving the script, otherwise the files attached to it before
 // @Tags files
 // @Produce json
 // @Security BearerAuth
@@ -270,7 +755,7 @@ func (h *FileHandler) GetPromptFiles(c *gin.Context) {
 		return
 	}
 
-	// Lấy file IDs từ cache (không xóa)
+	// Lấy file IDs đang stage (không consume)
 	if h.scriptService == nil {
 		c.JSON(http.StatusOK, []models.FileResponse{})
 		return
@@ -296,3 +781,259 @@ func (h *FileHandler) GetPromptFiles(c *gin.Context) {
 
 	c.JSON(http.StatusOK, files)
 }
+
+// UploadMachineOutput godoc
+// @Summary Upload an execution output (machine)
+// @Description Upload an output file produced by the automation backend for a prompt (prompt_id) or the merged output of a project (no prompt_id) during a script execution.
+// @Description Requires machine credentials (X-Machine-ID / X-Machine-Secret); the machine must be the one the execution was dispatched to. The file belongs to the user running the execution.
+// @Tags files
+// @Accept multipart/form-data
+// @Produce json
+// @Param X-Machine-ID header string true "Machine ID"
+// @Param X-Machine-Secret header string true "Machine secret"
+// @Param file formData file true "Output file"
+// @Param execution_id formData string true "Script execution ID"
+// @Param project_id formData string true "Project ID (frontend timestamp)"
+// @Param prompt_id formData string false "Prompt ID (ScriptPrompt.ID sent to automation), empty for project merge output"
+// @Param output_name formData string false "Declared output name (defaults to prompt/project filename)"
+// @Success 201 {object} models.FileResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{} "Storage quota of the execution owner exceeded or file too large"
+// @Failure 415 {object} map[string]interface{} "File type not allowed"
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/machines/outputs [post]
+func (h *FileHandler) UploadMachineOutput(c *gin.Context) {
+	box := c.MustGet("box").(*models.Box)
+
+	var req models.MachineOutputUploadRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided. Use 'file' form field.", "details": err.Error()})
+		return
+	}
+
+	file, err := h.outputService.UploadMachineOutput(box, fileHeader, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrExecutionOutputTargetNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Execution, project or prompt not found", "details": err.Error()})
+		case errors.Is(err, services.ErrMachineNotDispatched):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Machine is not dispatched for this execution"})
+		case errors.Is(err, services.ErrStorageQuotaExceeded), errors.Is(err, services.ErrFileTooLarge), errors.Is(err, services.ErrMimeTypeNotAllowed):
+			status, message := uploadErrorStatus(err)
+			c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload output", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, h.fileService.FileToResponse(file))
+}
+
+// GetStorageUsage godoc
+// @Summary Get my storage usage
+// @Description Get the total size of the current user's files and the effective quota (user override → role → default). 0 = unlimited.
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.StorageUsageResponse
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/usage [get]
+func (h *FileHandler) GetStorageUsage(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	usage, err := h.quotaService.GetUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get storage usage", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// AdminGetUserStorageUsage godoc
+// @Summary Get storage usage of a user (requires storage_quota.manage permission)
+// @Description Get the storage usage and effective quota of a user (requires storage_quota.manage permission)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.StorageUsageResponse
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/users/{id}/storage-usage [get]
+func (h *FileHandler) AdminGetUserStorageUsage(c *gin.Context) {
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionStorageQuotaManage) {
+		return
+	}
+
+	usage, err := h.quotaService.GetUsage(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get storage usage", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// AdminListStorageQuotas godoc
+// @Summary List storage quota overrides (requires storage_quota.manage permission)
+// @Description List the storage quota overrides of users and roles (requires storage_quota.manage permission)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param subject_type query string false "Filter by subject type (user, role)"
+// @Success 200 {array} models.StorageQuota
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/storage-quotas [get]
+func (h *FileHandler) AdminListStorageQuotas(c *gin.Context) {
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionStorageQuotaManage) {
+		return
+	}
+
+	subjectType := c.Query("subject_type")
+	if subjectType != "" && subjectType != models.StorageQuotaSubjectUser && subjectType != models.StorageQuotaSubjectRole {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "subject_type must be user or role"})
+		return
+	}
+
+	quotas, err := h.quotaService.ListQuotas(subjectType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get storage quotas", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, quotas)
+}
+
+// AdminSetUserStorageQuota godoc
+// @Summary Set storage quota of a user (requires storage_quota.manage permission)
+// @Description Override storage limits of a user. Omitted fields inherit from the user's roles or the defaults, 0 = unlimited, allowed_mime_types [] = any type (requires storage_quota.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.StorageQuotaRequest true "Quota override"
+// @Success 200 {object} models.StorageQuota
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/users/{id}/storage-quota [put]
+func (h *FileHandler) AdminSetUserStorageQuota(c *gin.Context) {
+	h.setStorageQuota(c, models.StorageQuotaSubjectUser)
+}
+
+// AdminDeleteUserStorageQuota godoc
+// @Summary Remove storage quota override of a user (requires storage_quota.manage permission)
+// @Description Remove the quota override of a user, limits are inherited from roles or defaults again (requires storage_quota.manage permission)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/users/{id}/storage-quota [delete]
+func (h *FileHandler) AdminDeleteUserStorageQuota(c *gin.Context) {
+	h.deleteStorageQuota(c, models.StorageQuotaSubjectUser)
+}
+
+// AdminSetRoleStorageQuota godoc
+// @Summary Set storage quota of a role (requires storage_quota.manage permission)
+// @Description Override storage limits for users having a role (the most permissive role applies). Omitted fields inherit the defaults, 0 = unlimited, allowed_mime_types [] = any type (requires storage_quota.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role ID"
+// @Param request body models.StorageQuotaRequest true "Quota override"
+// @Success 200 {object} models.StorageQuota
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/roles/{id}/storage-quota [put]
+func (h *FileHandler) AdminSetRoleStorageQuota(c *gin.Context) {
+	h.setStorageQuota(c, models.StorageQuotaSubjectRole)
+}
+
+// AdminDeleteRoleStorageQuota godoc
+// @Summary Remove storage quota override of a role (requires storage_quota.manage permission)
+// @Description Remove the quota override of a role (requires storage_quota.manage permission)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/roles/{id}/storage-quota [delete]
+func (h *FileHandler) AdminDeleteRoleStorageQuota(c *gin.Context) {
+	h.deleteStorageQuota(c, models.StorageQuotaSubjectRole)
+}
+
+// setStorageQuota upserts the quota override of a user/role (admin only)
+func (h *FileHandler) setStorageQuota(c *gin.Context, subjectType string) {
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionStorageQuotaManage) {
+		return
+	}
+	user := c.MustGet("user").(*models.User)
+
+	var req models.StorageQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	quota, err := h.quotaService.SetQuota(subjectType, c.Param("id"), &req, user.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrStorageQuotaSubjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User or role not found", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to set storage quota", "details": err.Error()})
+		return
+	}
+
+	logrus.Infof("Admin %s set storage quota of %s %s", user.ID, subjectType, c.Param("id"))
+	c.JSON(http.StatusOK, quota)
+}
+
+// deleteStorageQuota removes the quota override of a user/role (admin only)
+func (h *FileHandler) deleteStorageQuota(c *gin.Context, subjectType string) {
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionStorageQuotaManage) {
+		return
+	}
+	user := c.MustGet("user").(*models.User)
+
+	if err := h.quotaService.DeleteQuota(subjectType, c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrStorageQuotaNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Storage quota override not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete storage quota", "details": err.Error()})
+		return
+	}
+
+	logrus.Infof("Admin %s removed storage quota of %s %s", user.ID, subjectType, c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Storage quota override removed"})
+}
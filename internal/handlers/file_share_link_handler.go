@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services"
+)
+
+// CreateShareLink godoc
+// @Summary Create a share link for a file
+// @Description Create a download link (signed token) for a file of the current user. The link expires after expires_in_hours, can be limited to max_downloads (single_use = 1)
+// @Description or bound to a machine ID, and can be revoked. The URL is only returned once.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Param request body models.CreateShareLinkRequest false "Share link options"
+// @Success 201 {object} models.ShareLinkResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/{id}/share-links [post]
+func (h *FileHandler) CreateShareLink(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	var req models.CreateShareLinkRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+			return
+		}
+	}
+
+	file, err := h.fileService.GetFile(c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	link, err := h.fileService.CreateShareLink(file, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidShareLink) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share link", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, link)
+}
+
+// GetShareLinks godoc
+// @Summary List share links of a file
+// @Description List the share links of a file of the current user, newest first (URL is not returned)
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Success 200 {array} models.ShareLinkResponse
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/{id}/share-links [get]
+func (h *FileHandler) GetShareLinks(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	file, err := h.fileService.GetFile(c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	links, err := h.fileService.ListShareLinks(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get share links", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// RevokeShareLink godoc
+// @Summary Revoke a share link
+// @Description Revoke a share link of a file of the current user; downloads with its token are rejected immediately
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Param link_id path string true "Share link ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/{id}/share-links/{link_id} [delete]
+func (h *FileHandler) RevokeShareLink(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	file, err := h.fileService.GetFile(c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if err := h.fileService.RevokeShareLink(file, c.Param("link_id")); err != nil {
+		if errors.Is(err, services.ErrShareLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share link revoked"})
+}
+
+// RevokeDownloadToken godoc
+// @Summary Revoke a download token
+// @Description Revoke a download token (signed URL or share link) of a file of the current user by its token value; downloads with it are rejected immediately
+// @Tags files
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Param request body models.RevokeDownloadTokenRequest true "Token to revoke"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/{id}/download-tokens/revoke [post]
+func (h *FileHandler) RevokeDownloadToken(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	var req models.RevokeDownloadTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	file, err := h.fileService.GetFile(c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if err := h.fileService.RevokeDownloadToken(file, req.Token, userID); err != nil {
+		if errors.Is(err, services.ErrInvalidDownloadToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke download token", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Download token revoked"})
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/onegreenvn/green-provider-services-backend/internal/middleware"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services"
 )
@@ -24,8 +25,8 @@ func NewGeminiAccountHandler(geminiAccountService *services.GeminiAccountService
 }
 
 // SetupGeminiAccount sets up a Gemini account on a specific machine
-// @Summary Setup Gemini account (Admin only)
-// @Description Setup a Gemini account (Gmail) on a specific machine for creating Gemini Gems (Admin privileges required)
+// @Summary Setup Gemini account (requires gemini_account.manage permission)
+// @Description Setup a Gemini account (Gmail) on a specific machine for creating Gemini Gems (requires gemini_account.manage permission)
 // @Tags gemini-accounts
 // @Accept json
 // @Produce json
@@ -33,20 +34,13 @@ func NewGeminiAccountHandler(geminiAccountService *services.GeminiAccountService
 // @Param request body models.SetupGeminiAccountRequest true "Setup Gemini Account Request"
 // @Success 201 {object} models.GeminiAccountResponse
 // @Failure 400 {object} map[string]interface{} "Invalid request"
-// @Failure 403 {object} map[string]interface{} "Admin privileges required"
+// @Failure 403 {object} map[string]interface{} "gemini_account.manage permission required"
 // @Failure 404 {object} map[string]interface{} "Machine not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/v1/gemini/accounts/setup [post]
 func (h *GeminiAccountHandler) SetupGeminiAccount(c *gin.Context) {
-	// Check if user is admin
-	user, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
-	userModel, ok := user.(*models.User)
-	if !ok || !userModel.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionGeminiAccountManage) {
 		return
 	}
 
@@ -163,31 +157,24 @@ func (h *GeminiAccountHandler) GetAccountsByMachineID(c *gin.Context) {
 	c.JSON(http.StatusOK, responses)
 }
 
-// LockAccount locks a Gemini account and deletes all topics created with it
-// @Summary Lock Gemini account (Admin only)
-// @Description Lock a Gemini account and delete all topics created with it (Admin privileges required)
+// LockAccount locks a Gemini account and removes all topics created with it (restorable until purged)
+// @Summary Lock Gemini account (requires gemini_account.manage permission)
+// @Description Lock a Gemini account and remove all topics created with it; removed topics can be restored via POST /topics/{id}/restore until purged (requires gemini_account.manage permission)
 // @Tags gemini-accounts
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Account ID"
 // @Param request body models.LockGeminiAccountRequest false "Lock reason (optional)"
-// @Success 200 {object} map[string]interface{} "{\"message\": \"Account locked successfully\", \"topics_deleted\": 5}"
-// @Failure 403 {object} map[string]interface{} "Admin privileges required"
+// @Success 200 {object} map[string]interface{} "{\"message\": \"Account locked successfully\", \"topics_removed\": 5}"
+// @Failure 403 {object} map[string]interface{} "gemini_account.manage permission required"
 // @Failure 404 {object} map[string]interface{} "Account not found"
 // @Failure 400 {object} map[string]interface{} "Account already locked"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/v1/gemini/accounts/{id}/lock [put]
 func (h *GeminiAccountHandler) LockAccount(c *gin.Context) {
-	// Check if user is admin
-	user, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
-	userModel, ok := user.(*models.User)
-	if !ok || !userModel.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionGeminiAccountManage) {
 		return
 	}
 
@@ -199,7 +186,7 @@ func (h *GeminiAccountHandler) LockAccount(c *gin.Context) {
 		req.Reason = ""
 	}
 
-	topicsDeleted, err := h.geminiAccountService.LockAccount(accountID, req.Reason)
+	topicsRemoved, err := h.geminiAccountService.LockAccount(accountID, req.Reason)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -213,33 +200,26 @@ func (h *GeminiAccountHandler) LockAccount(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":        "Account locked successfully",
-		"topics_deleted": topicsDeleted,
+		"topics_removed": topicsRemoved,
 	})
 }
 
 // UnlockAccount unlocks a Gemini account
-// @Summary Unlock Gemini account (Admin only)
-// @Description Unlock a previously locked Gemini account (Admin privileges required)
+// @Summary Unlock Gemini account (requires gemini_account.manage permission)
+// @Description Unlock a previously locked Gemini account (requires gemini_account.manage permission)
 // @Tags gemini-accounts
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Account ID"
 // @Success 200 {object} map[string]interface{} "{\"message\": \"Account unlocked successfully\"}"
-// @Failure 403 {object} map[string]interface{} "Admin privileges required"
+// @Failure 403 {object} map[string]interface{} "gemini_account.manage permission required"
 // @Failure 404 {object} map[string]interface{} "Account not found"
 // @Failure 400 {object} map[string]interface{} "Account not locked"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/v1/gemini/accounts/{id}/unlock [put]
 func (h *GeminiAccountHandler) UnlockAccount(c *gin.Context) {
-	// Check if user is admin
-	user, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
-	userModel, ok := user.(*models.User)
-	if !ok || !userModel.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+	// Check permission
+	if !middleware.CheckPermission(c, models.PermissionGeminiAccountManage) {
 		return
 	}
 
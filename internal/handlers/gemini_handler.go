@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -30,6 +31,8 @@ func NewGeminiHandler(geminiService *services.GeminiService) *GeminiHandler {
 // @Param request body models.GenerateOutlineRequest true "Generate outline request"
 // @Success 200 {object} models.GenerateOutlineResponse
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{} "Write permission on the topic required"
+// @Failure 404 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/gemini/topics/{topic_id}/generate-outline-and-upload [post]
 func (h *GeminiHandler) GenerateOutlineAndUpload(c *gin.Context) {
@@ -44,6 +47,14 @@ func (h *GeminiHandler) GenerateOutlineAndUpload(c *gin.Context) {
 
 	response, err := h.geminiService.GenerateOutlineAndUpload(userID, topicID, &req)
 	if err != nil {
+		if errors.Is(err, services.ErrTopicAccessDenied) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+			return
+		}
+		if errors.Is(err, services.ErrTopicPermissionDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'write' permission on this topic", "details": err.Error()})
+			return
+		}
 		logrus.Errorf("Failed to generate outline for user %s, topic %s: %v", userID, topicID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate outline", "details": err.Error()})
 		return
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/middleware"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services"
 	"gorm.io/gorm"
@@ -27,7 +28,7 @@ func NewMachineHandler(db *gorm.DB) *MachineHandler {
 
 // RegisterMachine godoc
 // @Summary Register a machine
-// @Description Register a new machine or return existing machine info. This is a public endpoint for machines to self-register.
+// @Description Register a new machine or return existing machine info. This is a public endpoint for machines to self-register. A machine secret is returned once for a new machine and must be sent as X-Machine-Secret when reporting logs. Existing machines never get a secret here: the box owner (POST /api/v1/boxes/{id}/machine-secret) or an admin (POST /api/v1/admin/machines/{machine_id}/secret) issues it.
 // @Tags machines
 // @Accept json
 // @Produce json
@@ -63,6 +64,66 @@ func (h *MachineHandler) RegisterMachine(c *gin.Context) {
 	c.JSON(statusCode, response)
 }
 
+// RotateMachineSecret godoc
+// @Summary Rotate machine secret (requires machine.manage permission)
+// @Description Issue a new secret for a machine. The old secret stops working immediately (requires machine.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param machine_id path string true "Machine ID"
+// @Success 200 {object} models.MachineSecretResponse
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/machines/{machine_id}/secret [post]
+func (h *MachineHandler) RotateMachineSecret(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionMachineManage) {
+		return
+	}
+
+	response, err := h.machineService.RotateMachineSecret(c.Param("machine_id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Machine not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate machine secret", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// IssueMyMachineSecret godoc
+// @Summary Issue machine secret for my box
+// @Description Issue a new secret for the machine of a box owned by the current user (e.g. a machine registered before machine credentials existed). The old secret stops working immediately.
+// @Tags boxes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Box ID"
+// @Success 200 {object} models.MachineSecretResponse
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/boxes/{id}/machine-secret [post]
+func (h *MachineHandler) IssueMyMachineSecret(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	response, err := h.machineService.IssueMachineSecretForOwner(userID, c.Param("id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Box not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue machine secret", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // GetFrpConfigByMachineID godoc
 // @Summary Get FRP configuration for a machine
 // @Description Get FRP configuration and subdomain for a specific machine by machine_id
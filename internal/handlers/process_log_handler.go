@@ -1,15 +1,22 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/middleware"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services"
+	"github.com/onegreenvn/green-provider-services-backend/internal/utils"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -19,9 +26,10 @@ type ProcessLogHandler struct {
 	sseHub            *services.SSEHub
 }
 
-func NewProcessLogHandler(db *gorm.DB, sseHub *services.SSEHub, rabbitMQ *services.RabbitMQService) *ProcessLogHandler {
+func NewProcessLogHandler(db *gorm.DB, sseHub *services.SSEHub, rabbitMQ *services.RabbitMQService, topicService *services.TopicService) *ProcessLogHandler {
 	logRepo := repository.NewProcessLogRepository(db)
 	processLogService := services.NewProcessLogService(logRepo, sseHub, rabbitMQ, db)
+	processLogService.SetTopicService(topicService)
 
 	return &ProcessLogHandler{
 		processLogService: processLogService,
@@ -31,36 +39,245 @@ func NewProcessLogHandler(db *gorm.DB, sseHub *services.SSEHub, rabbitMQ *servic
 
 // CreateLog godoc
 // @Summary Create a process log (for automation backend)
-// @Description Create a process log entry. Can be called by automation backend via HTTP or RabbitMQ
+// @Description Create a process log entry reported by a machine. Requires machine credentials issued at registration (X-Machine-ID / X-Machine-Secret). The log is verified: machine_id must match the authenticated machine, the machine must be the one the entity was dispatched to, and user_id must be related to the entity. Logs failing verification are quarantined (202) without side effects.
 // @Tags process-logs
 // @Accept json
 // @Produce json
+// @Param X-Machine-ID header string true "Machine ID"
+// @Param X-Machine-Secret header string true "Machine secret issued at registration"
 // @Param request body models.ProcessLogRequest true "Process log request"
 // @Success 201 {object} models.ProcessLogResponse
+// @Success 202 {object} map[string]interface{} "Log quarantined"
 // @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/process-logs [post]
 func (h *ProcessLogHandler) CreateLog(c *gin.Context) {
+	box := c.MustGet("box").(*models.Box)
+
 	var req models.ProcessLogRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
 		return
 	}
 
-	log, err := h.processLogService.CreateLog(&req)
+	log, quarantined, err := h.processLogService.IngestMachineLog(box, &req)
 	if err != nil {
+		if errors.Is(err, services.ErrMachineMismatch) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		logrus.Errorf("Failed to create log: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create log", "details": err.Error()})
 		return
 	}
 
+	if quarantined != nil {
+		c.JSON(http.StatusAccepted, gin.H{
+			"quarantined": true,
+			"id":          quarantined.ID,
+			"reason":      quarantined.Reason,
+		})
+		return
+	}
+
 	response := h.logToResponse(log)
 	c.JSON(http.StatusCreated, response)
 }
 
+// GetQuarantinedLogs godoc
+// @Summary Get quarantined process logs (requires process_log.manage permission)
+// @Description Get logs reported by machines that failed verification (requires process_log.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default: 1)" minimum(1)
+// @Param limit query int false "Number of items per page (default: 20, max: 100)" minimum(1) maximum(100)
+// @Param pending query bool false "Only logs not released yet (default: true)" default(true)
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/process-logs/quarantine [get]
+func (h *ProcessLogHandler) GetQuarantinedLogs(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionProcessLogManage) {
+		return
+	}
+
+	page, pageSize := utils.ParsePaginationFromQuery(c.Query("page"), c.Query("limit"))
+	pendingOnly := c.DefaultQuery("pending", "true") == "true"
+
+	logs, total, err := h.processLogService.GetQuarantinedLogs(page, pageSize, pendingOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get quarantined logs", "details": err.Error()})
+		return
+	}
+
+	paginationInfo := utils.CalculatePaginationInfo(int(total), page, pageSize)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":         logs,
+		"total":        total,
+		"page":         paginationInfo.Page,
+		"limit":        paginationInfo.PageSize,
+		"total_pages":  paginationInfo.TotalPages,
+		"has_next":     paginationInfo.HasNext,
+		"has_previous": paginationInfo.HasPrevious,
+	})
+}
+
+// ReleaseQuarantinedLog godoc
+// @Summary Release a quarantined process log (requires process_log.manage permission)
+// @Description Ingest a quarantined log after review. The log is created and its side effects (topic/execution updates) are applied (requires process_log.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Quarantined log ID"
+// @Success 201 {object} models.ProcessLogResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/process-logs/quarantine/{id}/release [post]
+func (h *ProcessLogHandler) ReleaseQuarantinedLog(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionProcessLogManage) {
+		return
+	}
+	user := c.MustGet("user").(*models.User)
+
+	log, err := h.processLogService.ReleaseQuarantinedLog(c.Param("id"), user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, repository.ErrQuarantinedLogReleased) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release log", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, h.logToResponse(log))
+}
+
+// GetIngestionStats godoc
+// @Summary Get process log ingestion metrics (requires process_log.manage permission)
+// @Description Batching metrics of the RabbitMQ log consumer on this instance: batch sizes, ingestion lag (publish to DB), failed/dropped logs and pending side effects (requires process_log.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.LogIngestionStats
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/v1/admin/process-logs/ingestion-stats [get]
+func (h *ProcessLogHandler) GetIngestionStats(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionProcessLogManage) {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.processLogService.GetIngestionStats())
+}
+
+// GetLogStages godoc
+// @Summary Get process log stage handlers (requires process_log.manage permission)
+// @Description List handlers subscribed to (entity_type, stage, status) patterns and the stages received on this instance without any handler (requires process_log.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.LogStagesResponse
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/v1/admin/process-logs/stages [get]
+func (h *ProcessLogHandler) GetLogStages(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionProcessLogManage) {
+		return
+	}
+
+	registry := h.processLogService.StageRegistry()
+	c.JSON(http.StatusOK, models.LogStagesResponse{
+		Handlers:      registry.Handlers(),
+		UnknownStages: registry.UnknownStages(),
+	})
+}
+
+// GetLogArchives godoc
+// @Summary List process log archives (requires process_log.manage permission)
+// @Description Get paginated archives of expired process logs written by the retention job (requires process_log.manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Page size" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/admin/process-logs/archives [get]
+func (h *ProcessLogHandler) GetLogArchives(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionProcessLogManage) {
+		return
+	}
+
+	page, pageSize := utils.ParsePaginationFromQuery(c.Query("page"), c.Query("limit"))
+
+	archives, total, err := h.processLogService.GetLogArchives(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get log archives", "details": err.Error()})
+		return
+	}
+
+	paginationInfo := utils.CalculatePaginationInfo(int(total), page, pageSize)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":         archives,
+		"total":        total,
+		"page":         paginationInfo.Page,
+		"limit":        paginationInfo.PageSize,
+		"total_pages":  paginationInfo.TotalPages,
+		"has_next":     paginationInfo.HasNext,
+		"has_previous": paginationInfo.HasPrevious,
+	})
+}
+
+// DownloadLogArchive godoc
+// @Summary Download a process log archive (requires process_log.manage permission)
+// @Description Download an archive as gzip-compressed NDJSON (one process log JSON object per line) (requires process_log.manage permission)
+// @Tags admin
+// @Produce application/gzip
+// @Security BearerAuth
+// @Param id path string true "Archive ID"
+// @Success 200 {file} file
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/admin/process-logs/archives/{id}/download [get]
+func (h *ProcessLogHandler) DownloadLogArchive(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionProcessLogManage) {
+		return
+	}
+
+	archive, f, err := h.processLogService.OpenLogArchive(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archive not found", "details": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	// Stream file, không load cả archive vào memory
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archive.FileName))
+	size := int64(-1)
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	c.DataFromReader(http.StatusOK, size, "application/gzip", f, nil)
+}
+
 // GetLogsByEntity godoc
 // @Summary Get logs for a specific entity
-// @Description Get paginated logs for a specific entity (e.g., topic)
+// @Description Get paginated logs for a specific entity (e.g., topic). Only users with process_log.manage or topic.manage permission, the topic creator, assigned users and the user who ran the execution can read them.
 // @Tags process-logs
 // @Accept json
 // @Produce json
@@ -71,12 +288,17 @@ func (h *ProcessLogHandler) CreateLog(c *gin.Context) {
 // @Param offset query int false "Offset" default(0)
 // @Success 200 {array} models.ProcessLogResponse
 // @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Entity not found or no access"
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/process-logs/{entity_type}/{entity_id} [get]
 func (h *ProcessLogHandler) GetLogsByEntity(c *gin.Context) {
 	entityType := c.Param("entity_type")
 	entityID := c.Param("entity_id")
 
+	if !h.authorizeEntity(c, entityType, entityID) {
+		return
+	}
+
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
@@ -98,9 +320,235 @@ func (h *ProcessLogHandler) GetLogsByEntity(c *gin.Context) {
 	c.JSON(http.StatusOK, responses)
 }
 
+// SearchLogs godoc
+// @Summary Search process logs
+// @Description Search logs with structured filters, full-text on message and JSONB metadata path filters (metadata.<path>=value, nested paths with dots, e.g. metadata.execution_id=... or metadata.error.code=42). Results are newest first with cursor pagination: pass next_cursor as cursor to get the next page. Users without process_log.manage permission only see their own logs and logs of topics they own or are assigned to.
+// @Tags process-logs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param entity_type query string false "Filter by entity type" example:"topic"
+// @Param entity_id query string false "Filter by entity ID"
+// @Param machine_id query string false "Filter by machine ID" example:"PC-014"
+// @Param status query string false "Filter by status" example:"error"
+// @Param stage query string false "Filter by stage" example:"failed"
+// @Param from query string false "Created at >= (RFC3339 or YYYY-MM-DD)" example:"2025-01-20"
+// @Param to query string false "Created at < (RFC3339 or YYYY-MM-DD)" example:"2025-01-21"
+// @Param q query string false "Full-text search on message"
+// @Param cursor query string false "Cursor from previous page (next_cursor)"
+// @Param limit query int false "Limit (default: 100, max: 1000)" default(100)
+// @Success 200 {object} models.ProcessLogSearchResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/process-logs/search [get]
+func (h *ProcessLogHandler) SearchLogs(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+	readAll := canReadAllLogs(c)
+
+	filter, err := parseLogSearchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search filter", "details": err.Error()})
+		return
+	}
+
+	var cursor int64
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		cursor, err = strconv.ParseInt(cursorStr, 10, 64)
+		if err != nil || cursor <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	logs, nextCursor, hasMore, err := h.processLogService.SearchLogs(userID, readAll, filter, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search logs", "details": err.Error()})
+		return
+	}
+
+	response := models.ProcessLogSearchResponse{
+		Data:    make([]models.ProcessLogResponse, len(logs)),
+		HasMore: hasMore,
+	}
+	for i, log := range logs {
+		response.Data[i] = h.logToResponse(log)
+	}
+	if hasMore {
+		response.NextCursor = strconv.FormatInt(nextCursor, 10)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportLogs godoc
+// @Summary Export process logs
+// @Description Stream logs matching the search filters (same params as /process-logs/search, without cursor/limit) as CSV, NDJSON or an XLSX workbook (summary sheet with timings + one sheet per execution/topic). Logs are exported oldest first. Users without process_log.manage permission only export logs they can see.
+// @Tags process-logs
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Security BearerAuth
+// @Param format query string false "Export format: csv, ndjson, xlsx" default(csv)
+// @Param entity_type query string false "Filter by entity type" example:"topic"
+// @Param entity_id query string false "Filter by entity ID"
+// @Param machine_id query string false "Filter by machine ID" example:"PC-014"
+// @Param status query string false "Filter by status" example:"error"
+// @Param stage query string false "Filter by stage" example:"failed"
+// @Param from query string false "Created at >= (RFC3339 or YYYY-MM-DD)" example:"2025-01-20"
+// @Param to query string false "Created at < (RFC3339 or YYYY-MM-DD)" example:"2025-01-21"
+// @Param q query string false "Full-text search on message"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/process-logs/export [get]
+func (h *ProcessLogHandler) ExportLogs(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+	readAll := canReadAllLogs(c)
+
+	format, err := services.ParseLogExportFormat(c.DefaultQuery("format", "csv"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format", "details": err.Error()})
+		return
+	}
+
+	filter, err := parseLogSearchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search filter", "details": err.Error()})
+		return
+	}
+
+	fileName := fmt.Sprintf("process_logs_%s.%s", time.Now().Format("20060102_150405"), format)
+	writeLogExport(c, format, fileName, func(w io.Writer) error {
+		return h.processLogService.ExportLogs(w, format, userID, readAll, filter)
+	})
+}
+
+// ExportEntityLogs godoc
+// @Summary Export logs of an entity
+// @Description Stream all logs of an entity (e.g. one script execution) as CSV, NDJSON or XLSX, oldest first. Same access rules as GET /process-logs/{entity_type}/{entity_id}.
+// @Tags process-logs
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Security BearerAuth
+// @Param entity_type path string true "Entity type" example:"script_execution"
+// @Param entity_id path string true "Entity ID" example:"550e8400-e29b-41d4-a716-446655440000"
+// @Param format query string false "Export format: csv, ndjson, xlsx" default(csv)
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/process-logs/{entity_type}/{entity_id}/export [get]
+func (h *ProcessLogHandler) ExportEntityLogs(c *gin.Context) {
+	entityType := c.Param("entity_type")
+	entityID := c.Param("entity_id")
+
+	format, err := services.ParseLogExportFormat(c.DefaultQuery("format", "csv"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format", "details": err.Error()})
+		return
+	}
+
+	if !h.authorizeEntity(c, entityType, entityID) {
+		return
+	}
+
+	fileName := fmt.Sprintf("%s_%s_logs.%s", entityType, entityID, format)
+	writeLogExport(c, format, fileName, func(w io.Writer) error {
+		return h.processLogService.ExportEntityLogs(w, format, entityType, entityID)
+	})
+}
+
+// writeLogExport streams an export to the response.
+// Lỗi xảy ra sau khi đã gửi dữ liệu thì không trả JSON được nữa, chỉ log lại (client nhận file bị cắt).
+func writeLogExport(c *gin.Context, format services.LogExportFormat, fileName string, export func(w io.Writer) error) {
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Header("X-Accel-Buffering", "no") // Disable buffering for nginx
+	c.Status(http.StatusOK)
+
+	if err := export(c.Writer); err != nil {
+		logrus.Errorf("Failed to export logs (%s): %v", fileName, err)
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export logs", "details": err.Error()})
+		}
+	}
+}
+
+// metadataPathSegmentPattern restricts metadata path segments (chỉ cho phép key đơn giản)
+var metadataPathSegmentPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// parseLogSearchFilter parses search query params into a filter
+func parseLogSearchFilter(c *gin.Context) (*models.ProcessLogSearchFilter, error) {
+	filter := &models.ProcessLogSearchFilter{
+		ProcessLogFilter: models.ProcessLogFilter{
+			EntityType: c.Query("entity_type"),
+			MachineID:  c.Query("machine_id"),
+			Status:     c.Query("status"),
+			Stage:      c.Query("stage"),
+		},
+		EntityID: c.Query("entity_id"),
+		Query:    strings.TrimSpace(c.Query("q")),
+	}
+
+	if filter.EntityID != "" {
+		if _, err := uuid.Parse(filter.EntityID); err != nil {
+			return nil, fmt.Errorf("entity_id must be a UUID")
+		}
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseSearchTime(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+		filter.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseSearchTime(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to: %w", err)
+		}
+		filter.To = &t
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		if !strings.HasPrefix(key, "metadata.") || len(values) == 0 {
+			continue
+		}
+		path := strings.Split(strings.TrimPrefix(key, "metadata."), ".")
+		for _, segment := range path {
+			if !metadataPathSegmentPattern.MatchString(segment) {
+				return nil, fmt.Errorf("invalid metadata path %q", key)
+			}
+		}
+		filter.Metadata = append(filter.Metadata, models.MetadataPathFilter{Path: path, Value: values[0]})
+	}
+
+	return filter, nil
+}
+
+// parseSearchTime accepts RFC3339 or a plain date (YYYY-MM-DD, local time)
+func parseSearchTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
 // StreamLogsSSE godoc
 // @Summary Stream logs via Server-Sent Events (SSE)
-// @Description Stream real-time logs for a specific entity via SSE. By default, only new logs from connection time are sent. Set history=true to receive all existing logs.
+// @Description Stream real-time logs for a specific entity via SSE. Each log event carries its seq as SSE id. By default, only new logs from connection time are sent. Set history=true to receive recent existing logs. On reconnect, the Last-Event-ID header (or last_event_id query) sends exactly the logs with seq greater than that id, in seq order and without duplicates. If the client falls behind, a "lagging" event is sent and the stream is closed so the client reconnects and resyncs.
 // @Tags process-logs
 // @Accept json
 // @Produce text/event-stream
@@ -108,72 +556,367 @@ func (h *ProcessLogHandler) GetLogsByEntity(c *gin.Context) {
 // @Param entity_type path string true "Entity type" example:"topic"
 // @Param entity_id path string true "Entity ID" example:"550e8400-e29b-41d4-a716-446655440000"
 // @Param history query bool false "Include existing logs from database (default: false)" default(false)
+// @Param Last-Event-ID header int false "Seq of the last log received, backfills logs after it"
+// @Param last_event_id query int false "Same as Last-Event-ID header (for clients that cannot set headers)"
 // @Success 200 "SSE stream"
+// @Failure 404 {object} map[string]interface{} "Entity not found or no access"
 // @Router /api/v1/process-logs/{entity_type}/{entity_id}/stream [get]
 func (h *ProcessLogHandler) StreamLogsSSE(c *gin.Context) {
 	entityType := c.Param("entity_type")
 	entityID := c.Param("entity_id")
 
+	// Check quyền trước khi chuyển sang SSE (sau khi set headers thì không trả 404 được nữa)
+	if !h.authorizeEntity(c, entityType, entityID) {
+		return
+	}
+
 	// Get history parameter (default: false)
 	includeHistory := c.DefaultQuery("history", "false") == "true"
 
-	// Set headers for SSE
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no") // Disable buffering for nginx
+	// Last-Event-ID: browser EventSource tự gửi header này khi reconnect
+	lastEventID, hasLastEventID := parseLastEventID(c)
 
-	// Register client
+	fetch := func(afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+		return h.processLogService.GetLogsByEntityAfterSeq(entityType, entityID, afterSeq, limit)
+	}
+
+	// Register client before reading the cursor so no log is lost between backfill and live stream
 	clientChan := h.sseHub.RegisterClient(entityType, entityID)
 	defer h.sseHub.UnregisterClient(entityType, entityID, clientChan)
 
+	cursor, ok := h.initialSSECursor(c, lastEventID, hasLastEventID)
+	if !ok {
+		return
+	}
+
+	setSSEHeaders(c)
+
 	// Send initial connection message
 	c.SSEvent("connected", gin.H{
 		"entity_type":     entityType,
 		"entity_id":       entityID,
 		"message":         "Connected to log stream",
 		"include_history": includeHistory,
+		"last_event_id":   lastEventID,
 	})
 	c.Writer.Flush()
 
-	// Send existing logs from database only if history=true
-	if includeHistory {
+	if hasLastEventID {
+		// Backfill đúng các log bị lỡ: seq > Last-Event-ID
+		if !sendLogsAfterSSE(c, &cursor, nil, fetch) {
+			return
+		}
+	} else if includeHistory {
+		// Send existing logs from database only if history=true
 		existingLogs, err := h.processLogService.GetLogsByEntity(entityType, entityID, 100, 0)
 		if err == nil {
-			for _, log := range existingLogs {
-				// Format log as SSE message with event type
-				logJSON, err := json.Marshal(log)
-				if err != nil {
-					continue
-				}
-				message := fmt.Sprintf("event: log\ndata: %s\n\n", string(logJSON))
-				if _, err := c.Writer.Write([]byte(message)); err != nil {
+			// GetLogsByEntity trả về mới nhất trước, gửi theo thứ tự cũ → mới để id tăng dần
+			for i := len(existingLogs) - 1; i >= 0; i-- {
+				if !writeLogSSE(c, existingLogs[i]) {
 					return
 				}
-				c.Writer.Flush()
+				if existingLogs[i].Seq > cursor {
+					cursor = existingLogs[i].Seq
+				}
 			}
 		}
 	}
 
 	// Send logs as they arrive (new logs)
+	streamLiveLogsSSE(c, fmt.Sprintf("%s/%s", entityType, entityID), clientChan, &cursor, nil, fetch)
+}
+
+// StreamMyLogsSSE godoc
+// @Summary Stream current user's logs via Server-Sent Events (SSE)
+// @Description Stream real-time logs of the current user across all entities. Logs of entities the user can no longer access are skipped. Supports Last-Event-ID backfill and the "lagging" event like the entity stream.
+// @Tags process-logs
+// @Accept json
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param Last-Event-ID header int false "Seq of the last log received, backfills logs after it"
+// @Param last_event_id query int false "Same as Last-Event-ID header (for clients that cannot set headers)"
+// @Success 200 "SSE stream"
+// @Router /api/v1/process-logs/stream [get]
+func (h *ProcessLogHandler) StreamMyLogsSSE(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+	readAll := canReadAllLogs(c)
+
+	lastEventID, hasLastEventID := parseLastEventID(c)
+	canAccess := h.newLogAccessChecker(userID, readAll)
+	fetch := func(afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+		return h.processLogService.GetLogsByUserIDAfterSeq(userID, afterSeq, limit)
+	}
+
+	// BroadcastLog đã gửi tới key "user:<id>"
+	clientChan := h.sseHub.RegisterClient("user", userID)
+	defer h.sseHub.UnregisterClient("user", userID, clientChan)
+
+	cursor, ok := h.initialSSECursor(c, lastEventID, hasLastEventID)
+	if !ok {
+		return
+	}
+
+	setSSEHeaders(c)
+
+	c.SSEvent("connected", gin.H{
+		"user_id":       userID,
+		"message":       "Connected to user log stream",
+		"last_event_id": lastEventID,
+	})
+	c.Writer.Flush()
+
+	if hasLastEventID && !sendLogsAfterSSE(c, &cursor, canAccess, fetch) {
+		return
+	}
+
+	streamLiveLogsSSE(c, "user/"+userID, clientChan, &cursor, canAccess, fetch)
+}
+
+// StreamAllLogsSSE godoc
+// @Summary Stream all logs via Server-Sent Events (requires process_log.manage permission)
+// @Description Global live feed of all process logs with server-side filters (requires process_log.manage permission). Supports Last-Event-ID backfill and the "lagging" event like the entity stream.
+// @Tags admin
+// @Accept json
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param entity_type query string false "Filter by entity type" example:"topic"
+// @Param machine_id query string false "Filter by machine ID" example:"PC-001"
+// @Param status query string false "Filter by status" example:"error"
+// @Param stage query string false "Filter by stage" example:"failed"
+// @Param Last-Event-ID header int false "Seq of the last log received, backfills logs after it"
+// @Param last_event_id query int false "Same as Last-Event-ID header (for clients that cannot set headers)"
+// @Success 200 "SSE stream"
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/v1/admin/process-logs/stream [get]
+func (h *ProcessLogHandler) StreamAllLogsSSE(c *gin.Context) {
+	if !middleware.CheckPermission(c, models.PermissionProcessLogManage) {
+		return
+	}
+
+	var filter models.ProcessLogFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		return
+	}
+
+	lastEventID, hasLastEventID := parseLastEventID(c)
+	fetch := func(afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+		return h.processLogService.GetLogsAfterSeq(&filter, afterSeq, limit)
+	}
+
+	// Lọc ngay trong hub để log không khớp không chiếm buffer của client
+	clientChan := h.sseHub.RegisterFilteredClient(services.SSEGlobalEntityType, services.SSEGlobalEntityID, filter.Matches)
+	defer h.sseHub.UnregisterClient(services.SSEGlobalEntityType, services.SSEGlobalEntityID, clientChan)
+
+	cursor, ok := h.initialSSECursor(c, lastEventID, hasLastEventID)
+	if !ok {
+		return
+	}
+
+	setSSEHeaders(c)
+
+	c.SSEvent("connected", gin.H{
+		"message":       "Connected to global log stream",
+		"filter":        filter,
+		"last_event_id": lastEventID,
+	})
+	c.Writer.Flush()
+
+	if hasLastEventID && !sendLogsAfterSSE(c, &cursor, nil, fetch) {
+		return
+	}
+
+	streamLiveLogsSSE(c, "admin/global", clientChan, &cursor, nil, fetch)
+}
+
+// logAccessCacheTTL is how long a per-connection entity access decision is reused
+const logAccessCacheTTL = time.Minute
+
+type logAccessDecision struct {
+	allowed   bool
+	checkedAt time.Time
+}
+
+// canReadAllLogs checks the process_log.manage permission (đọc log của mọi user / entity)
+func canReadAllLogs(c *gin.Context) bool {
+	allowed, err := middleware.HasPermission(c, models.PermissionProcessLogManage)
+	if err != nil {
+		logrus.Warnf("Failed to check %s permission: %v", models.PermissionProcessLogManage, err)
+		return false
+	}
+	return allowed
+}
+
+// canReadAllEntityLogs allows reading logs of any topic / execution: process_log.manage hoặc topic.manage
+func canReadAllEntityLogs(c *gin.Context) bool {
+	return canReadAllLogs(c) || canManageAllTopics(c)
+}
+
+// authorizeEntity checks entity-aware access for log reads (history, SSE, export).
+// Trả 404 (không tiết lộ entity có tồn tại hay không) nếu user không có quyền.
+func (h *ProcessLogHandler) authorizeEntity(c *gin.Context, entityType, entityID string) bool {
+	userID := c.MustGet("user_id").(string)
+
+	allowed, err := h.processLogService.CanUserAccessEntity(userID, entityType, entityID, canReadAllEntityLogs(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access", "details": err.Error()})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entity not found"})
+		return false
+	}
+	return true
+}
+
+// newLogAccessChecker returns a per-connection checker applying entity access rules (CanUserAccessEntity) to logs.
+// Kết quả được cache theo entity trong logAccessCacheTTL để không query DB cho mỗi log.
+func (h *ProcessLogHandler) newLogAccessChecker(userID string, readAll bool) func(*models.ProcessLog) bool {
+	cache := make(map[string]logAccessDecision)
+	return func(log *models.ProcessLog) bool {
+		if readAll {
+			return true
+		}
+		if !services.IsAuthorizableEntityType(log.EntityType) {
+			// Entity không resolve được owner: chỉ cho xem log của chính user
+			return log.UserID == userID
+		}
+		key := log.EntityType + ":" + log.EntityID
+		if decision, ok := cache[key]; ok && time.Since(decision.checkedAt) < logAccessCacheTTL {
+			return decision.allowed
+		}
+		allowed, err := h.processLogService.CanUserAccessEntity(userID, log.EntityType, log.EntityID, false)
+		if err != nil {
+			logrus.Warnf("Failed to check log access for %s: %v", key, err)
+			allowed = false
+		}
+		cache[key] = logAccessDecision{allowed: allowed, checkedAt: time.Now()}
+		return allowed
+	}
+}
+
+// sseBackfillBatchSize is the page size used when backfilling missed logs
+const sseBackfillBatchSize = 500
+
+// sseLogFetcher returns up to limit logs with seq > afterSeq, oldest first
+type sseLogFetcher func(afterSeq int64, limit int) ([]*models.ProcessLog, error)
+
+// setSSEHeaders sets headers for SSE
+func setSSEHeaders(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable buffering for nginx
+}
+
+// parseLastEventID reads the Last-Event-ID header, falling back to the last_event_id query param
+func parseLastEventID(c *gin.Context) (int64, bool) {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("last_event_id")
+	}
+	if raw == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// initialSSECursor returns the seq a stream starts after: Last-Event-ID khi reconnect, ngược lại seq mới nhất hiện tại
+// (gọi sau RegisterClient để log commit trong lúc kết nối vẫn được gửi qua live stream).
+// Writes a 500 and returns false if the latest seq cannot be read.
+func (h *ProcessLogHandler) initialSSECursor(c *gin.Context, lastEventID int64, hasLastEventID bool) (int64, bool) {
+	if hasLastEventID {
+		return lastEventID, true
+	}
+	latestSeq, err := h.processLogService.GetLatestLogSeq()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start log stream", "details": err.Error()})
+		return 0, false
+	}
+	return latestSeq, true
+}
+
+// sendLogsAfterSSE sends the logs with seq > *cursor (paged, oldest first) and advances the cursor.
+// Seq được cấp dưới advisory lock giữ tới commit (ProcessLogRepository.CreateBatch) nên thứ tự seq = thứ tự commit:
+// khi đã thấy log seq N thì mọi log seq < N đã commit, cursor không bao giờ bỏ sót hay gửi trùng log.
+// Returns false if the client disconnected.
+func sendLogsAfterSSE(c *gin.Context, cursor *int64, canAccess func(*models.ProcessLog) bool, fetch sseLogFetcher) bool {
+	for {
+		logs, err := fetch(*cursor, sseBackfillBatchSize)
+		if err != nil {
+			// Giữ nguyên cursor, lần sau (log live tiếp theo) đọc lại từ DB
+			logrus.Errorf("Failed to read SSE logs after %d: %v", *cursor, err)
+			return true
+		}
+		for _, log := range logs {
+			*cursor = log.Seq
+			if canAccess != nil && !canAccess(log) {
+				continue
+			}
+			if !writeLogSSE(c, log) {
+				return false
+			}
+		}
+		if len(logs) < sseBackfillBatchSize {
+			return true
+		}
+	}
+}
+
+// streamLiveLogsSSE streams logs after *cursor until the client disconnects or lags.
+// Message log từ hub chỉ là tín hiệu có log mới: nội dung được đọc từ DB sau cursor để giữ đúng thứ tự seq,
+// message có seq <= cursor (đã gửi) được bỏ qua. Message khác (lagging, ...) được ghi nguyên.
+func streamLiveLogsSSE(c *gin.Context, label string, clientChan chan []byte, cursor *int64, canAccess func(*models.ProcessLog) bool, fetch sseLogFetcher) {
 	for {
 		select {
 		case <-c.Request.Context().Done():
-			logrus.Infof("SSE client disconnected: %s/%s", entityType, entityID)
+			logrus.Infof("SSE client disconnected: %s", label)
 			return
 		case message, ok := <-clientChan:
 			if !ok {
 				return
 			}
+			if seq, isLog := services.ParseSSEEventID(message); isLog {
+				if seq <= *cursor {
+					continue
+				}
+				if !sendLogsAfterSSE(c, cursor, canAccess, fetch) {
+					logrus.Infof("SSE client disconnected: %s", label)
+					return
+				}
+				continue
+			}
 			if _, err := c.Writer.Write(message); err != nil {
 				logrus.Errorf("Failed to write SSE message: %v", err)
 				return
 			}
 			c.Writer.Flush()
+			if services.IsLaggingSSEMessage(message) {
+				// Đóng stream để client reconnect với Last-Event-ID và backfill từ DB
+				logrus.Warnf("SSE client lagging, closing stream: %s", label)
+				return
+			}
 		}
 	}
 }
 
+// writeLogSSE writes a single log as an SSE message, returns false if the client is gone
+func writeLogSSE(c *gin.Context, log *models.ProcessLog) bool {
+	message, err := services.FormatLogSSEMessage(log)
+	if err != nil {
+		return true
+	}
+	if _, err := c.Writer.Write(message); err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
+
 // GetLogsByUser godoc
 // @Summary Get logs for the current user
 // @Description Get paginated logs for all entities belonging to the current user
@@ -215,6 +958,7 @@ func (h *ProcessLogHandler) GetLogsByUser(c *gin.Context) {
 func (h *ProcessLogHandler) logToResponse(log *models.ProcessLog) models.ProcessLogResponse {
 	return models.ProcessLogResponse{
 		ID:         log.ID,
+		Seq:        log.Seq,
 		EntityType: log.EntityType,
 		EntityID:   log.EntityID,
 		UserID:     log.UserID,
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services"
+	"github.com/sirupsen/logrus"
+)
+
+// statusChecksumMismatch is the tus status code for a chunk whose checksum does not match
+const statusChecksumMismatch = 460
+
+// resumableUploadErrorStatus maps resumable upload errors to HTTP status
+func resumableUploadErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrUploadSessionNotFound):
+		return http.StatusNotFound, "Upload session not found"
+	case errors.Is(err, services.ErrUploadOffsetMismatch):
+		return http.StatusConflict, "Upload offset mismatch"
+	case errors.Is(err, services.ErrUploadIncomplete):
+		return http.StatusConflict, "Upload incomplete"
+	case errors.Is(err, services.ErrUploadCompleting):
+		return http.StatusConflict, "Upload is being completed"
+	case errors.Is(err, services.ErrUploadSessionClosed):
+		return http.StatusGone, "Upload session closed"
+	case errors.Is(err, services.ErrUploadChecksumMismatch):
+		return statusChecksumMismatch, "Checksum mismatch"
+	case errors.Is(err, services.ErrInvalidUploadChecksum):
+		return http.StatusBadRequest, "Invalid checksum"
+	case errors.Is(err, services.ErrUploadChunkTooLarge):
+		return http.StatusRequestEntityTooLarge, "Chunk too large"
+	default:
+		return uploadErrorStatus(err)
+	}
+}
+
+func (h *FileHandler) uploadSessionResponse(c *gin.Context, session *models.UploadSession) models.UploadSessionResponse {
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.TotalSize, 10))
+	c.Header("Cache-Control", "no-store")
+	return models.UploadSessionResponse{
+		UploadSession: *session,
+		UploadURL:     "/api/v1/files/uploads/" + session.ID,
+		MaxChunkSize:  h.uploadService.MaxChunkSize(),
+	}
+}
+
+// CreateUploadSession godoc
+// @Summary Start a resumable upload
+// @Description Create a resumable (chunked) upload session for a large file. Quota (storage, max file size, file type) is checked against total_size.
+// @Description Then send chunks with PATCH /files/uploads/{id} (header Upload-Offset), query progress with HEAD/GET after a lost connection, and finish with POST /files/uploads/{id}/complete.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateUploadSessionRequest true "File info"
+// @Success 201 {object} models.UploadSessionResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{} "Storage quota exceeded or file too large"
+// @Failure 415 {object} map[string]interface{} "File type not allowed"
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/uploads [post]
+func (h *FileHandler) CreateUploadSession(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	var req models.CreateUploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	session, err := h.uploadService.CreateSession(userID, &req)
+	if err != nil {
+		status, message := resumableUploadErrorStatus(err)
+		c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		return
+	}
+
+	response := h.uploadSessionResponse(c, session)
+	c.Header("Location", response.UploadURL)
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetUploadSession godoc
+// @Summary Get resumable upload progress
+// @Description Get the state of an upload session. The Upload-Offset header (also returned by HEAD) is the offset to resume from.
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Upload session ID"
+// @Success 200 {object} models.UploadSessionResponse
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/files/uploads/{id} [get]
+func (h *FileHandler) GetUploadSession(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	session, err := h.uploadService.GetSession(userID, c.Param("id"))
+	if err != nil {
+		status, message := resumableUploadErrorStatus(err)
+		c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		return
+	}
+
+	response := h.uploadSessionResponse(c, session)
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UploadChunk godoc
+// @Summary Upload a chunk of a resumable upload
+// @Description Append the request body at Upload-Offset (must equal the current offset of the session, otherwise 409 with the current offset).
+// @Description Optional Upload-Checksum header "sha256 <base64 digest>": on mismatch the chunk is discarded (460). A chunk interrupted midway is discarded; resend it from the returned offset.
+// @Tags files
+// @Accept application/offset+octet-stream
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Upload session ID"
+// @Param Upload-Offset header int true "Offset of this chunk"
+// @Param Upload-Checksum header string false "sha256 <base64 digest of the chunk>"
+// @Success 200 {object} models.UploadSessionResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "Offset mismatch"
+// @Failure 410 {object} map[string]interface{} "Session completed or expired"
+// @Failure 413 {object} map[string]interface{} "Chunk larger than max_chunk_size or remaining size"
+// @Failure 460 {object} map[string]interface{} "Checksum mismatch"
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/uploads/{id} [patch]
+func (h *FileHandler) UploadChunk(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+	sessionID := c.Param("id")
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header is required"})
+		return
+	}
+	if c.Request.ContentLength > h.uploadService.MaxChunkSize() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk too large", "max_chunk_size": h.uploadService.MaxChunkSize()})
+		return
+	}
+
+	session, err := h.uploadService.AppendChunk(userID, sessionID, offset, c.Request.Body, c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		status, message := resumableUploadErrorStatus(err)
+		if current, getErr := h.uploadService.GetSession(userID, sessionID); getErr == nil {
+			c.Header("Upload-Offset", strconv.FormatInt(current.Offset, 10))
+		}
+		if status == http.StatusInternalServerError {
+			logrus.Errorf("Failed to upload chunk of session %s: %v", sessionID, err)
+		}
+		c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.uploadSessionResponse(c, session))
+}
+
+// CompleteUploadSession godoc
+// @Summary Complete a resumable upload
+// @Description Create the file from the received chunks once all total_size bytes were received; checksum_sha256 of the session is verified.
+// @Description Completing an already completed session returns the same file.
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Upload session ID"
+// @Success 201 {object} map[string]interface{} "{file: FileResponse}"
+// @Success 200 {object} map[string]interface{} "{file: FileResponse} (already completed)"
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "Upload incomplete or being completed by another request"
+// @Failure 413 {object} map[string]interface{} "Storage quota exceeded or file too large"
+// @Failure 460 {object} map[string]interface{} "Checksum mismatch"
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/uploads/{id}/complete [post]
+func (h *FileHandler) CompleteUploadSession(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	file, created, err := h.uploadService.CompleteUpload(userID, c.Param("id"))
+	if err != nil {
+		status, message := resumableUploadErrorStatus(err)
+		c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		return
+	}
+
+	response := h.fileService.FileToResponse(file)
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"file": response})
+		return
+	}
+
+	// Stage file ID để dùng khi lưu prompt hoặc tạo gem (như /files/upload)
+	projectID, promptID := "", ""
+	if file.ProjectID != nil {
+		projectID = *file.ProjectID
+	}
+	if file.TempPromptID != nil {
+		promptID = *file.TempPromptID
+	}
+	h.stageUploadedFiles(userID, projectID, promptID, []string{file.ID})
+
+	c.JSON(http.StatusCreated, gin.H{"file": response})
+}
+
+// AbortUploadSession godoc
+// @Summary Abort a resumable upload
+// @Description Cancel an upload session and delete the received chunks
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Upload session ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "Upload is being completed"
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/files/uploads/{id} [delete]
+func (h *FileHandler) AbortUploadSession(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	if err := h.uploadService.AbortSession(userID, c.Param("id")); err != nil {
+		status, message := resumableUploadErrorStatus(err)
+		c.JSON(status, gin.H{"error": message, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upload session aborted"})
+}
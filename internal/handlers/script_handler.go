@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -34,23 +35,17 @@ func NewScriptHandler(scriptService *services.ScriptService, scriptExecutionServ
 // @Param request body models.SaveScriptRequest true "Script data"
 // @Success 200 {object} models.ScriptResponse
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "Staged uploads consumed by a concurrent save"
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/topics/{id}/scripts [post]
 func (h *ScriptHandler) SaveScript(c *gin.Context) {
 	userID := c.MustGet("user_id").(string)
 	topicID := c.Param("id")
 
-	// Check if user has permission to access this topic
-	canAccess, _, err := h.topicService.CanUserAccessTopic(userID, topicID, false)
-	if err != nil {
-		logrus.Errorf("Failed to check topic access for user %s, topic %s: %v", userID, topicID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check topic access", "details": err.Error()})
-		return
-	}
-	if !canAccess {
-		logrus.Errorf("User %s does not have permission to access topic %s", userID, topicID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+	// Check if user has write permission on this topic
+	if !authorizeTopicAccess(c, h.topicService, topicID, canManageAllTopics(c), models.TopicPermissionWrite) {
 		return
 	}
 
@@ -62,6 +57,14 @@ func (h *ScriptHandler) SaveScript(c *gin.Context) {
 
 	response, err := h.scriptService.SaveScript(topicID, userID, &req)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidPromptInputFile) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prompt input file", "details": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrUploadStagingConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Uploaded files were attached by another save", "details": err.Error()})
+			return
+		}
 		logrus.Errorf("Failed to save script for user %s, topic %s: %v", userID, topicID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save script", "details": err.Error()})
 		return
@@ -79,6 +82,7 @@ func (h *ScriptHandler) SaveScript(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "Topic ID"
 // @Success 200 {object} models.ScriptResponse
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/topics/{id}/scripts [get]
@@ -86,16 +90,8 @@ func (h *ScriptHandler) GetScript(c *gin.Context) {
 	userID := c.MustGet("user_id").(string)
 	topicID := c.Param("id")
 
-	// Check if user has permission to access this topic
-	canAccess, _, err := h.topicService.CanUserAccessTopic(userID, topicID, false)
-	if err != nil {
-		logrus.Errorf("Failed to check topic access for user %s, topic %s: %v", userID, topicID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check topic access", "details": err.Error()})
-		return
-	}
-	if !canAccess {
-		logrus.Errorf("User %s does not have permission to access topic %s", userID, topicID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+	// Check if user has read permission on this topic
+	if !authorizeTopicAccess(c, h.topicService, topicID, canManageAllTopics(c), models.TopicPermissionRead) {
 		return
 	}
 
@@ -118,6 +114,7 @@ func (h *ScriptHandler) GetScript(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "Topic ID"
 // @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/topics/{id}/scripts [delete]
@@ -125,16 +122,8 @@ func (h *ScriptHandler) DeleteScript(c *gin.Context) {
 	userID := c.MustGet("user_id").(string)
 	topicID := c.Param("id")
 
-	// Check if user has permission to access this topic
-	canAccess, _, err := h.topicService.CanUserAccessTopic(userID, topicID, false)
-	if err != nil {
-		logrus.Errorf("Failed to check topic access for user %s, topic %s: %v", userID, topicID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check topic access", "details": err.Error()})
-		return
-	}
-	if !canAccess {
-		logrus.Errorf("User %s does not have permission to access topic %s", userID, topicID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+	// Check if user has write permission on this topic
+	if !authorizeTopicAccess(c, h.topicService, topicID, canManageAllTopics(c), models.TopicPermissionWrite) {
 		return
 	}
 
@@ -157,6 +146,7 @@ func (h *ScriptHandler) DeleteScript(c *gin.Context) {
 // @Param id path string true "Topic ID"
 // @Success 202 {object} models.ExecuteScriptResponse
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/topics/{id}/scripts/execute [post]
@@ -164,16 +154,8 @@ func (h *ScriptHandler) ExecuteScript(c *gin.Context) {
 	userID := c.MustGet("user_id").(string)
 	topicID := c.Param("id")
 
-	// Check if user has permission to access this topic
-	canAccess, _, err := h.topicService.CanUserAccessTopic(userID, topicID, false)
-	if err != nil {
-		logrus.Errorf("Failed to check topic access for user %s, topic %s: %v", userID, topicID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check topic access", "details": err.Error()})
-		return
-	}
-	if !canAccess {
-		logrus.Errorf("User %s does not have permission to access topic %s", userID, topicID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+	// Check if user has write permission on this topic
+	if !authorizeTopicAccess(c, h.topicService, topicID, canManageAllTopics(c), models.TopicPermissionWrite) {
 		return
 	}
 
@@ -198,6 +180,7 @@ func (h *ScriptHandler) ExecuteScript(c *gin.Context) {
 // @Param request body models.CreateProjectRequest true "Project creation request"
 // @Success 201 {object} models.CreateProjectResponse
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/topics/{id}/projects [post]
@@ -205,16 +188,8 @@ func (h *ScriptHandler) CreateProject(c *gin.Context) {
 	userID := c.MustGet("user_id").(string)
 	topicID := c.Param("id")
 
-	// Check if user has permission to access this topic
-	canAccess, _, err := h.topicService.CanUserAccessTopic(userID, topicID, false)
-	if err != nil {
-		logrus.Errorf("Failed to check topic access for user %s, topic %s: %v", userID, topicID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check topic access", "details": err.Error()})
-		return
-	}
-	if !canAccess {
-		logrus.Errorf("User %s does not have permission to access topic %s", userID, topicID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+	// Check if user has write permission on this topic
+	if !authorizeTopicAccess(c, h.topicService, topicID, canManageAllTopics(c), models.TopicPermissionWrite) {
 		return
 	}
 
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/onegreenvn/green-provider-services-backend/internal/middleware"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services"
 	"github.com/onegreenvn/green-provider-services-backend/internal/utils"
@@ -11,53 +13,52 @@ import (
 )
 
 type TopicHandler struct {
-	topicService *services.TopicService
-	roleService  *services.RoleService
+	topicService        *services.TopicService
+	topicRemovalService *services.TopicRemovalService
 }
 
-func NewTopicHandler(topicService *services.TopicService, roleService *services.RoleService) *TopicHandler {
+func NewTopicHandler(topicService *services.TopicService, topicRemovalService *services.TopicRemovalService) *TopicHandler {
 	return &TopicHandler{
-		topicService: topicService,
-		roleService:  roleService,
+		topicService:        topicService,
+		topicRemovalService: topicRemovalService,
 	}
 }
 
-// checkTopicPermission checks if user has permission to access topics (topic_user or topic_creator role)
-func (h *TopicHandler) checkTopicPermission(userID string) (bool, error) {
-	hasTopicUser, err := h.roleService.UserHasRole(userID, "topic_user")
-	if err != nil {
-		return false, err
-	}
-	hasTopicCreator, err := h.roleService.UserHasRole(userID, "topic_creator")
+// checkTopicPermission checks if user has permission to access topics (topic.access, mặc định role topic_user / topic_creator)
+func (h *TopicHandler) checkTopicPermission(c *gin.Context) (bool, error) {
+	return middleware.HasPermission(c, models.PermissionTopicAccess)
+}
+
+// canManageAllTopics checks if the request user can access every topic (topic.manage, mặc định role admin)
+func canManageAllTopics(c *gin.Context) bool {
+	allowed, err := middleware.HasPermission(c, models.PermissionTopicManage)
 	if err != nil {
-		return false, err
+		logrus.Warnf("Failed to check %s permission: %v", models.PermissionTopicManage, err)
+		return false
 	}
-	return hasTopicUser || hasTopicCreator, nil
+	return allowed
 }
 
-// checkTopicOwnership checks if user owns the topic, is assigned, or is admin
-func (h *TopicHandler) checkTopicOwnership(c *gin.Context, topic *models.Topic) bool {
+// authorizeTopicAccess checks that the current user has at least the required permission on a topic.
+// Không truy cập được topic → 404, quyền không đủ → 403; response đã được ghi khi trả về false.
+func authorizeTopicAccess(c *gin.Context, topicService *services.TopicService, topicID string, isAdmin bool, required string) bool {
 	userID := c.MustGet("user_id").(string)
-	isAdmin, _ := c.Get("is_admin")
 
-	// Admin can access all topics
-	if isAdmin != nil && isAdmin.(bool) {
+	_, err := topicService.AuthorizeTopic(userID, topicID, isAdmin, required)
+	switch {
+	case err == nil:
 		return true
-	}
-
-	// Check if user owns the topic (creator)
-	if topic.UserProfile.ID != "" && topic.UserProfile.UserID == userID {
-		return true
-	}
-
-	// Check if user is assigned to the topic
-	canAccess, _, err := h.topicService.CanUserAccessTopic(userID, topic.ID, false)
-	if err != nil {
-		logrus.Warnf("Failed to check topic access for user %s, topic %s: %v", userID, topic.ID, err)
-		return false
-	}
-
-	return canAccess
+	case errors.Is(err, services.ErrTopicAccessDenied):
+		logrus.Errorf("User %s does not have permission to access topic %s", userID, topicID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+	case errors.Is(err, services.ErrTopicPermissionDenied):
+		logrus.Warnf("User %s denied on topic %s: %v", userID, topicID, err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need '" + required + "' permission on this topic", "details": err.Error()})
+	default:
+		logrus.Errorf("Failed to check topic access for user %s, topic %s: %v", userID, topicID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check topic access", "details": err.Error()})
+	}
+	return false
 }
 
 // CreateTopic godoc
@@ -75,14 +76,8 @@ func (h *TopicHandler) checkTopicOwnership(c *gin.Context, topic *models.Topic)
 func (h *TopicHandler) CreateTopic(c *gin.Context) {
 	userID := c.MustGet("user_id").(string)
 
-	// Check if user has "topic_creator" role
-	hasRole, err := h.roleService.UserHasRole(userID, "topic_creator")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
-		return
-	}
-	if !hasRole {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic_creator' role to create topics"})
+	// Check if user has "topic.create" permission (mặc định role topic_creator)
+	if !middleware.CheckPermission(c, models.PermissionTopicCreate) {
 		return
 	}
 
@@ -105,7 +100,7 @@ func (h *TopicHandler) CreateTopic(c *gin.Context) {
 
 // GetAllTopics godoc
 // @Summary Get all topics for the current user
-// @Description Get all topics belonging to the authenticated user with pagination (requires topic_user or topic_creator role)
+// @Description Get all topics belonging to the authenticated user with pagination (requires topic.access permission)
 // @Tags topics
 // @Accept json
 // @Produce json
@@ -120,13 +115,13 @@ func (h *TopicHandler) GetAllTopics(c *gin.Context) {
 	userID := c.MustGet("user_id").(string)
 
 	// Check if user has permission to access topics
-	hasPermission, err := h.checkTopicPermission(userID)
+	hasPermission, err := h.checkTopicPermission(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
 	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic_user' or 'topic_creator' role to access topics"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic.access' permission to access topics"})
 		return
 	}
 
@@ -163,7 +158,7 @@ func (h *TopicHandler) GetAllTopics(c *gin.Context) {
 
 // GetTopicByID godoc
 // @Summary Get a topic by ID
-// @Description Get a specific topic by its ID (requires topic_user or topic_creator role and ownership)
+// @Description Get a specific topic by its ID (requires topic.access permission and read permission on the topic)
 // @Tags topics
 // @Accept json
 // @Produce json
@@ -175,17 +170,16 @@ func (h *TopicHandler) GetAllTopics(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/topics/{id} [get]
 func (h *TopicHandler) GetTopicByID(c *gin.Context) {
-	userID := c.MustGet("user_id").(string)
 	id := c.Param("id")
 
 	// Check if user has permission to access topics
-	hasPermission, err := h.checkTopicPermission(userID)
+	hasPermission, err := h.checkTopicPermission(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
 	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic_user' or 'topic_creator' role to access topics"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic.access' permission to access topics"})
 		return
 	}
 
@@ -195,9 +189,8 @@ func (h *TopicHandler) GetTopicByID(c *gin.Context) {
 		return
 	}
 
-	// Check ownership
-	if !h.checkTopicOwnership(c, topic) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You can only access your own topics"})
+	// Check topic permission (read)
+	if !authorizeTopicAccess(c, h.topicService, topic.ID, canManageAllTopics(c), models.TopicPermissionRead) {
 		return
 	}
 
@@ -207,7 +200,7 @@ func (h *TopicHandler) GetTopicByID(c *gin.Context) {
 
 // UpdateTopic godoc
 // @Summary Update a topic
-// @Description Update a topic's information (requires topic_user or topic_creator role and ownership)
+// @Description Update a topic's information (requires topic.access permission and write permission on the topic)
 // @Tags topics
 // @Accept json
 // @Produce json
@@ -221,28 +214,26 @@ func (h *TopicHandler) GetTopicByID(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/topics/{id} [put]
 func (h *TopicHandler) UpdateTopic(c *gin.Context) {
-	userID := c.MustGet("user_id").(string)
 	id := c.Param("id")
 
 	// Check if user has permission to access topics
-	hasPermission, err := h.checkTopicPermission(userID)
+	hasPermission, err := h.checkTopicPermission(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
 	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic_user' or 'topic_creator' role to update topics"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic.access' permission to update topics"})
 		return
 	}
 
-	// Check ownership before updating
+	// Check topic permission (write) before updating
 	topic, err := h.topicService.GetTopicByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
 		return
 	}
-	if !h.checkTopicOwnership(c, topic) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You can only update your own topics"})
+	if !authorizeTopicAccess(c, h.topicService, topic.ID, canManageAllTopics(c), models.TopicPermissionWrite) {
 		return
 	}
 
@@ -264,7 +255,7 @@ func (h *TopicHandler) UpdateTopic(c *gin.Context) {
 
 // DeleteTopic godoc
 // @Summary Delete a topic
-// @Description Delete a topic by its ID (requires topic_user or topic_creator role and ownership)
+// @Description Delete a topic by its ID (requires topic.access permission and full permission on the topic)
 // @Tags topics
 // @Accept json
 // @Produce json
@@ -276,28 +267,26 @@ func (h *TopicHandler) UpdateTopic(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/topics/{id} [delete]
 func (h *TopicHandler) DeleteTopic(c *gin.Context) {
-	userID := c.MustGet("user_id").(string)
 	id := c.Param("id")
 
 	// Check if user has permission to access topics
-	hasPermission, err := h.checkTopicPermission(userID)
+	hasPermission, err := h.checkTopicPermission(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
 	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic_user' or 'topic_creator' role to delete topics"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic.access' permission to delete topics"})
 		return
 	}
 
-	// Check ownership before deleting
+	// Check topic permission (full) before deleting
 	topic, err := h.topicService.GetTopicByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
 		return
 	}
-	if !h.checkTopicOwnership(c, topic) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You can only delete your own topics"})
+	if !authorizeTopicAccess(c, h.topicService, topic.ID, canManageAllTopics(c), models.TopicPermissionFull) {
 		return
 	}
 
@@ -309,6 +298,136 @@ func (h *TopicHandler) DeleteTopic(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Topic deleted successfully"})
 }
 
+// GetRemovedTopics godoc
+// @Summary Get removed topics
+// @Description Get topics removed by automation failures or locked Gemini accounts, with the removal reason and purge deadline (own topics, admin: all)
+// @Tags topics
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default: 1)" minimum(1)
+// @Param limit query int false "Number of items per page (default: 20, max: 100)" minimum(1) maximum(100)
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/topics/removed [get]
+func (h *TopicHandler) GetRemovedTopics(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+
+	// Check if user has permission to access topics
+	hasPermission, err := h.checkTopicPermission(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
+		return
+	}
+	if !hasPermission && !canManageAllTopics(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need 'topic.access' permission to access topics"})
+		return
+	}
+
+	page, pageSize := utils.ParsePaginationFromQuery(c.Query("page"), c.Query("limit"))
+
+	topics, removals, total, err := h.topicRemovalService.GetRemovedTopics(userID, canManageAllTopics(c), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get removed topics", "details": err.Error()})
+		return
+	}
+
+	responses := make([]models.RemovedTopicResponse, len(topics))
+	for i, topic := range topics {
+		responses[i] = models.RemovedTopicResponse{
+			Topic:   h.topicToResponse(topic),
+			Removal: removals[topic.ID],
+		}
+	}
+
+	paginationInfo := utils.CalculatePaginationInfo(int(total), page, pageSize)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":         responses,
+		"total":        total,
+		"page":         paginationInfo.Page,
+		"limit":        paginationInfo.PageSize,
+		"total_pages":  paginationInfo.TotalPages,
+		"has_next":     paginationInfo.HasNext,
+		"has_previous": paginationInfo.HasPrevious,
+	})
+}
+
+// RestoreTopic godoc
+// @Summary Restore a removed topic
+// @Description Restore a topic removed by an automation failure or a locked Gemini account, before it is purged (creator or admin)
+// @Tags topics
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Topic ID"
+// @Success 200 {object} models.TopicResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/topics/{id}/restore [post]
+func (h *TopicHandler) RestoreTopic(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+	id := c.Param("id")
+
+	topic, err := h.topicRemovalService.RestoreTopic(id, userID, canManageAllTopics(c))
+	if err != nil {
+		if errors.Is(err, services.ErrTopicNotRemoved) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Topic is not removed"})
+			return
+		}
+		if errors.Is(err, services.ErrTopicNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore topic", "details": err.Error()})
+		return
+	}
+
+	logrus.Infof("Topic %s restored by user %s", id, userID)
+	c.JSON(http.StatusOK, h.topicToResponse(topic))
+}
+
+// RestoreProject godoc
+// @Summary Restore a removed project
+// @Description Restore a project marked failed by an automation failure, before it is purged (topic creator or admin). Projects of a removed topic are restored with the topic.
+// @Tags topics
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Topic ID"
+// @Param project_id path string true "Project ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/topics/{id}/projects/{project_id}/restore [post]
+func (h *TopicHandler) RestoreProject(c *gin.Context) {
+	userID := c.MustGet("user_id").(string)
+	id := c.Param("id")
+	projectID := c.Param("project_id")
+
+	if err := h.topicRemovalService.RestoreProject(id, projectID, userID, canManageAllTopics(c)); err != nil {
+		if errors.Is(err, services.ErrTopicNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+			return
+		}
+		if errors.Is(err, services.ErrProjectNotRemoved) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Removed project not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore project", "details": err.Error()})
+		return
+	}
+
+	logrus.Infof("Project %s of topic %s restored by user %s", projectID, id, userID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Project restored successfully",
+		"topic_id":   id,
+		"project_id": projectID,
+	})
+}
+
 // SyncTopicWithGemini - TODO: Implement later
 // func (h *TopicHandler) SyncTopicWithGemini(c *gin.Context) {
 // 	// Implementation will be added later
@@ -333,5 +452,16 @@ func (h *TopicHandler) topicToResponse(topic *models.Topic) models.TopicResponse
 		response.LastSyncedAt = &lastSyncedAt
 	}
 
+	// Topic đã bị gỡ (soft delete)
+	response.RemovalState = topic.RemovalState
+	if topic.DeletedAt.Valid {
+		removedAt := topic.DeletedAt.Time.Format("2006-01-02T15:04:05Z07:00")
+		response.RemovedAt = &removedAt
+	}
+	if topic.PurgeAfter != nil {
+		purgeAfter := topic.PurgeAfter.Format("2006-01-02T15:04:05Z07:00")
+		response.PurgeAfter = &purgeAfter
+	}
+
 	return response
 }
@@ -84,3 +84,51 @@ func (m *BearerTokenMiddleware) BearerTokenAuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// OptionalBearerTokenAuthMiddleware sets user info in context when a valid JWT is present, otherwise continues without user.
+// Dùng cho route public (download file): token trong query không phải access token (vd: download token) thì để handler xử lý.
+func (m *BearerTokenMiddleware) OptionalBearerTokenAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// If user_id is already set (API key), skip authentication
+		if _, exists := c.Get("user_id"); exists {
+			c.Next()
+			return
+		}
+
+		authHeader := c.GetHeader("Authorization")
+		fromHeader := strings.HasPrefix(authHeader, "Bearer ")
+		tokenString := c.Query("token")
+		if fromHeader {
+			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+		}
+		if tokenString == "" {
+			c.Next()
+			return
+		}
+
+		tokenInfo, err := m.authService.ValidateToken(tokenString)
+		if err != nil {
+			if fromHeader {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		user, err := m.userRepo.GetByID(tokenInfo.UserID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		c.Set("is_admin", user.IsAdmin)
+		c.Set("token_info", tokenInfo)
+
+		c.Next()
+	}
+}
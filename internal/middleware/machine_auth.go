@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services"
+	"gorm.io/gorm"
+)
+
+const (
+	// MachineIDHeader and MachineSecretHeader carry machine credentials issued at registration
+	MachineIDHeader     = "X-Machine-ID"
+	MachineSecretHeader = "X-Machine-Secret"
+)
+
+// MachineAuthMiddleware authenticates machines (automation backend) using per-box secrets
+type MachineAuthMiddleware struct {
+	machineService *services.MachineService
+}
+
+func NewMachineAuthMiddleware(db *gorm.DB) *MachineAuthMiddleware {
+	boxRepo := repository.NewBoxRepository(db)
+	appRepo := repository.NewAppRepository(db)
+	userRepo := repository.NewUserRepository(db)
+
+	return &MachineAuthMiddleware{
+		machineService: services.NewMachineService(boxRepo, appRepo, userRepo),
+	}
+}
+
+// MachineAuth validates X-Machine-ID / X-Machine-Secret and sets machine info in context
+// Context keys: "machine_id" (string), "box" (*models.Box)
+func (m *MachineAuthMiddleware) MachineAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		machineID := c.GetHeader(MachineIDHeader)
+		secret := c.GetHeader(MachineSecretHeader)
+
+		box, err := m.machineService.AuthenticateMachine(machineID, secret)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("machine_id", box.MachineID)
+		c.Set("box", box)
+		c.Set("auth_type", "machine")
+
+		c.Next()
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// permissionsContextKey holds the lazily loaded permission set of the request user
+const permissionsContextKey = "permissions"
+
+// errPermissionsNotLoaded is returned when LoadPermissions did not run before a permission check
+var errPermissionsNotLoaded = errors.New("permissions not loaded for request")
+
+type PermissionMiddleware struct {
+	roleService *services.RoleService
+}
+
+func NewPermissionMiddleware(db *gorm.DB) *PermissionMiddleware {
+	// Create repositories
+	roleRepo := repository.NewRoleRepository(db)
+	userRepo := repository.NewUserRepository(db)
+
+	return &PermissionMiddleware{
+		roleService: services.NewRoleService(roleRepo, userRepo, nil),
+	}
+}
+
+// requestPermissions is the permission set of a user, loaded on the first check and reused for the rest of the request
+type requestPermissions struct {
+	once        sync.Once
+	load        func() (map[string]bool, error)
+	permissions map[string]bool
+	err         error
+}
+
+func (p *requestPermissions) get() (map[string]bool, error) {
+	p.once.Do(func() {
+		p.permissions, p.err = p.load()
+	})
+	return p.permissions, p.err
+}
+
+// LoadPermissions attaches the permission set of the authenticated user to the request.
+// Phải đặt sau middleware xác thực (API key / Bearer); permission chỉ được query khi có check đầu tiên.
+func (m *PermissionMiddleware) LoadPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, exists := c.Get("user"); exists {
+			if user, ok := value.(*models.User); ok {
+				c.Set(permissionsContextKey, &requestPermissions{
+					load: func() (map[string]bool, error) {
+						return m.roleService.GetUserPermissions(user)
+					},
+				})
+			}
+		}
+		c.Next()
+	}
+}
+
+// HasPermission checks if the request user has a permission (admin có mọi permission)
+func HasPermission(c *gin.Context, permission string) (bool, error) {
+	value, exists := c.Get(permissionsContextKey)
+	if !exists {
+		return false, errPermissionsNotLoaded
+	}
+	permissions, err := value.(*requestPermissions).get()
+	if err != nil {
+		return false, err
+	}
+	return permissions[permission], nil
+}
+
+// CheckPermission checks a permission and writes 403 (hoặc 500 khi lỗi DB) if the request user does not have it
+func CheckPermission(c *gin.Context, permission string) bool {
+	allowed, err := HasPermission(c, permission)
+	if err != nil {
+		logrus.Errorf("Failed to check permission %s: %v", permission, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied. You need '" + permission + "' permission"})
+		return false
+	}
+	return true
+}
+
+// RequirePermission aborts the request with 403 unless the user has the permission
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CheckPermission(c, permission) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -77,7 +77,7 @@ type AssignBoxRequest struct {
 	UserID string `json:"user_id" binding:"required"`
 }
 
-// UserWithRolesResponse represents the response for user profile with roles
+// UserWithRolesResponse represents the response for user profile with roles and permissions
 type UserWithRolesResponse struct {
 	ID          string     `json:"id"`
 	Username    string     `json:"username"`
@@ -88,5 +88,6 @@ type UserWithRolesResponse struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
-	Roles       []string   `json:"roles"` // List of role names
+	Roles       []string   `json:"roles"`       // List of role names
+	Permissions []string   `json:"permissions"` // Permission của các role (admin: mọi permission)
 }
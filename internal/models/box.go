@@ -6,11 +6,16 @@ import (
 
 // Box represents a machine/computer that belongs to a user
 type Box struct {
-	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	UserID    string    `json:"user_id" gorm:"not null;index;type:uuid"`
-	MachineID string    `json:"machine_id" gorm:"type:varchar(255);not null;unique;index"`
-	Name      string    `json:"name" gorm:"type:varchar(255);not null"`
-	IsOnline  bool      `json:"is_online" gorm:"default:false;index"` // Online/offline status
+	ID        string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID    string `json:"user_id" gorm:"not null;index;type:uuid"`
+	MachineID string `json:"machine_id" gorm:"type:varchar(255);not null;unique;index"`
+	Name      string `json:"name" gorm:"type:varchar(255);not null"`
+	IsOnline  bool   `json:"is_online" gorm:"default:false;index"` // Online/offline status
+
+	// Machine credentials: secret cấp lúc register, chỉ lưu SHA-256 hash (secret gốc chỉ trả về 1 lần)
+	SecretHash     string     `json:"-" gorm:"type:varchar(64)"`
+	SecretIssuedAt *time.Time `json:"secret_issued_at,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
@@ -81,6 +86,17 @@ type RegisterMachineResponse struct {
 	BoxID   string  `json:"box_id" example:"550e8400-e29b-41d4-a716-446655440000"`
 	UserID  *string `json:"user_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440001"`
 	Message string  `json:"message" example:"Machine registered successfully"`
+	// MachineSecret is only returned when a new machine is registered (machine cũ chưa có secret: owner hoặc admin cấp secret).
+	// Machine phải lưu lại và gửi kèm header X-Machine-ID / X-Machine-Secret khi gọi các API cho machine.
+	MachineSecret string `json:"machine_secret,omitempty" example:"3f6c1a0e..."`
+}
+
+// MachineSecretResponse represents the response when a machine secret is rotated
+type MachineSecretResponse struct {
+	BoxID         string `json:"box_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	MachineID     string `json:"machine_id" example:"PC-001"`
+	MachineSecret string `json:"machine_secret" example:"3f6c1a0e..."`
+	Message       string `json:"message" example:"Machine secret rotated successfully"`
 }
 
 // UpdateTunnelURLRequest represents the request to update tunnel URL
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+)
+
+// Download token purposes
+const (
+	DownloadTokenPurposeSigned = "signed" // Signed URL cấp cho automation backend / artifacts
+	DownloadTokenPurposeShare  = "share"  // Share link do user tạo cho file của mình
+)
+
+// DownloadToken is an issued share link token (jti của JWT trong ?token=); signed URL không có bản ghi (revoke qua RevokedDownloadToken).
+// Mỗi lần tải được kiểm tra với bản ghi này: revoke, hết hạn, số lượt tải tối đa và machine được bind.
+type DownloadToken struct {
+	ID            string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	FileID        string     `json:"file_id" gorm:"type:uuid;not null;index"`
+	UserID        string     `json:"user_id" gorm:"type:uuid;not null;index"` // Chủ file
+	Purpose       string     `json:"purpose" gorm:"type:varchar(20);not null;default:'signed';index" example:"share"`
+	MachineID     *string    `json:"machine_id,omitempty" gorm:"type:varchar(255)"` // Chỉ machine này tải được (X-Machine-ID / X-Machine-Secret)
+	MaxDownloads  *int       `json:"max_downloads,omitempty" example:"1"`           // nil = không giới hạn, 1 = dùng 1 lần
+	DownloadCount int        `json:"download_count" gorm:"not null;default:0"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null;index"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty" gorm:"index"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the DownloadToken model
+func (DownloadToken) TableName() string {
+	return "download_tokens"
+}
+
+// DownloadTokenOptions scopes a new download token
+type DownloadTokenOptions struct {
+	Purpose      string
+	TTL          time.Duration // 0 = FILE_DOWNLOAD_TOKEN_TTL_MINUTES
+	MaxDownloads *int
+	MachineID    string
+}
+
+// RevokedDownloadToken is the revocation list of signed download URLs (stateless, không có bản ghi DownloadToken).
+// Giữ tới ExpiresAt của token, sau đó token tự hết hạn và bản ghi được cleanup.
+type RevokedDownloadToken struct {
+	TokenID   string    `json:"token_id" gorm:"primaryKey;type:uuid"` // jti
+	FileID    string    `json:"file_id" gorm:"type:uuid;not null;index"`
+	RevokedBy string    `json:"revoked_by" gorm:"type:uuid"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	RevokedAt time.Time `json:"revoked_at" gorm:"not null"`
+}
+
+// TableName specifies the table name for the RevokedDownloadToken model
+func (RevokedDownloadToken) TableName() string {
+	return "revoked_download_tokens"
+}
+
+// RevokeDownloadTokenRequest represents the request to revoke a download token (signed URL hoặc share link) of a file
+type RevokeDownloadTokenRequest struct {
+	Token string `json:"token" binding:"required" example:"eyJhbGciOiJIUzI1NiIs..."` // Giá trị ?token= của URL
+}
+
+// CreateShareLinkRequest represents the request to create a share link for a file
+type CreateShareLinkRequest struct {
+	ExpiresInHours int    `json:"expires_in_hours,omitempty" binding:"omitempty,gt=0" example:"24"` // Default FILE_SHARE_LINK_TTL_HOURS, tối đa FILE_SHARE_LINK_MAX_TTL_HOURS
+	MaxDownloads   *int   `json:"max_downloads,omitempty" binding:"omitempty,gt=0" example:"5"`
+	SingleUse      bool   `json:"single_use,omitempty"` // = max_downloads 1
+	MachineID      string `json:"machine_id,omitempty"` // Optional: chỉ machine này tải được
+}
+
+// ShareLinkResponse represents a share link of a file
+type ShareLinkResponse struct {
+	DownloadToken
+	Active bool   `json:"active"`
+	URL    string `json:"url,omitempty"` // Chỉ trả về khi tạo (token không được lưu)
+}
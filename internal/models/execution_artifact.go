@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// ExecutionArtifact is an output file produced during a script execution
+type ExecutionArtifact struct {
+	FileID      string    `json:"file_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	FileName    string    `json:"file_name" example:"summary.docx"` // Tên file gốc do machine upload
+	OutputName  string    `json:"output_name,omitempty" example:"summary"`
+	MimeType    string    `json:"mime_type" example:"application/vnd.openxmlformats-officedocument.wordprocessingml.document"`
+	FileSize    int64     `json:"file_size" example:"20480"`
+	PromptID    *string   `json:"prompt_id,omitempty"`    // ScriptPrompt.ID tạo ra file, nil = output merge của project
+	PromptOrder *int      `json:"prompt_order,omitempty"` // Thứ tự prompt trong project
+	PromptText  string    `json:"prompt_text,omitempty"`  // Rút gọn
+	MachineID   string    `json:"machine_id,omitempty"`   // Machine đã upload
+	ZipPath     string    `json:"zip_path"`               // Đường dẫn trong bundle ZIP
+	DownloadURL string    `json:"download_url"`           // Signed URL (hết hạn sau 1 giờ)
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ExecutionArtifactProject groups the artifacts of a project in an execution
+type ExecutionArtifactProject struct {
+	ProjectID    string              `json:"project_id"`
+	Name         string              `json:"name"`
+	ProjectOrder *int                `json:"project_order,omitempty"` // Thứ tự trong execution
+	Status       string              `json:"status,omitempty"`        // Trạng thái project trong execution
+	Artifacts    []ExecutionArtifact `json:"artifacts"`
+}
+
+// ExecutionArtifactsResponse lists every artifact of a script execution (cũng là manifest.json của bundle ZIP)
+type ExecutionArtifactsResponse struct {
+	ExecutionID string                     `json:"execution_id"`
+	ScriptID    string                     `json:"script_id"`
+	TopicID     string                     `json:"topic_id"`
+	Status      string                     `json:"status"`
+	StartedAt   *time.Time                 `json:"started_at,omitempty"`
+	CompletedAt *time.Time                 `json:"completed_at,omitempty"`
+	Projects    []ExecutionArtifactProject `json:"projects"`
+	TotalFiles  int                        `json:"total_files"`
+	TotalSize   int64                      `json:"total_size"`
+	GeneratedAt time.Time                  `json:"generated_at"`
+}
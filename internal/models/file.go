@@ -16,10 +16,22 @@ type File struct {
 	MimeType     string `json:"mime_type" gorm:"type:varchar(100)"`
 	FileSize     int64  `json:"file_size" gorm:"type:bigint"`                // Size in bytes
 	FilePath     string `json:"file_path" gorm:"type:varchar(500);not null"` // Path on server storage
+	// Content-addressed blob (SHA-256), nil = file cũ lưu riêng tại FilePath
+	BlobHash *string `json:"blob_hash,omitempty" gorm:"type:varchar(64);index"`
+	// Tổ chức file: thư mục ảo (vd: "reports/2025", "" = gốc) và tags
+	Folder string      `json:"folder" gorm:"type:varchar(500);not null;default:'';index"`
+	Tags   StringArray `json:"tags" gorm:"type:jsonb;not null;default:'[]'"`
 	// Optional: để lưu mapping với prompt (khi chưa save script)
 	ProjectID    *string `json:"project_id,omitempty" gorm:"type:varchar(255);index"`     // Frontend project_id (timestamp)
 	TempPromptID *string `json:"temp_prompt_id,omitempty" gorm:"type:varchar(255);index"` // Temp prompt_id từ frontend
 
+	// Provenance: file do automation backend tạo ra (output của prompt/project trong 1 execution)
+	Source         string  `json:"source" gorm:"type:varchar(20);not null;default:'upload';index"` // upload, automation
+	ExecutionID    *string `json:"execution_id,omitempty" gorm:"type:uuid;index"`                  // Script execution tạo ra file
+	ScriptPromptID *string `json:"script_prompt_id,omitempty" gorm:"type:uuid;index"`              // ScriptPrompt.ID tạo ra file (nil = output merge của project)
+	OutputName     *string `json:"output_name,omitempty" gorm:"type:varchar(255);index"`           // Tên output khai báo trong script (prompt/project Filename, không có extension)
+	MachineID      *string `json:"machine_id,omitempty" gorm:"type:varchar(255)"`                  // Machine đã upload file
+
 	// Timestamps
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -33,22 +45,108 @@ func (File) TableName() string {
 	return "files"
 }
 
+// File sources
+const (
+	FileSourceUpload     = "upload"     // User upload
+	FileSourceAutomation = "automation" // Output do automation backend upload
+)
+
 // FileUploadRequest represents the request to upload a file
 type FileUploadRequest struct {
-	Category  string `json:"category,omitempty" form:"category" example:"knowledge"`
-	ProjectID string `json:"project_id,omitempty" form:"project_id"` // Optional: để cache files cho project
-	PromptID  string `json:"prompt_id,omitempty" form:"prompt_id"`   // Optional: để cache files cho prompt cụ thể (temp_id từ frontend)
+	Category  string   `json:"category,omitempty" form:"category" example:"knowledge"`
+	ProjectID string   `json:"project_id,omitempty" form:"project_id"` // Optional: để cache files cho project
+	PromptID  string   `json:"prompt_id,omitempty" form:"prompt_id"`   // Optional: để cache files cho prompt cụ thể (temp_id từ frontend)
+	Folder    string   `json:"folder,omitempty" form:"folder"`         // Optional: thư mục ảo
+	Tags      []string `json:"tags,omitempty" form:"tags"`             // Optional: tags (nhiều field tags hoặc phân cách bởi dấu phẩy)
+}
+
+// MachineOutputUploadRequest represents an output file pushed by the automation backend
+type MachineOutputUploadRequest struct {
+	ExecutionID string `form:"execution_id" binding:"required"` // Script execution đang chạy
+	ProjectID   string `form:"project_id" binding:"required"`   // Frontend project_id (timestamp)
+	PromptID    string `form:"prompt_id"`                       // ScriptPrompt.ID (prompt_id gửi cho automation), trống = output merge của project
+	OutputName  string `form:"output_name"`                     // Tên output khai báo (prompt/project Filename), mặc định lấy từ script
 }
 
 // FileResponse represents the response for file operations
 type FileResponse struct {
-	ID           string `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
-	UserID       string `json:"user_id" example:"550e8400-e29b-41d4-a716-446655440001"`
-	FileName     string `json:"file_name" example:"abc123.pdf"`
-	OriginalName string `json:"original_name" example:"document.pdf"`
-	MimeType     string `json:"mime_type" example:"application/pdf"`
-	FileSize     int64  `json:"file_size" example:"1024"`
-	DownloadURL  string `json:"download_url" example:"/api/v1/files/550e8400-e29b-41d4-a716-446655440000/download"`
-	CreatedAt    string `json:"created_at" example:"2025-01-21T10:00:00Z"`
-	UpdatedAt    string `json:"updated_at" example:"2025-01-21T10:00:00Z"`
+	ID           string   `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	UserID       string   `json:"user_id" example:"550e8400-e29b-41d4-a716-446655440001"`
+	FileName     string   `json:"file_name" example:"abc123.pdf"`
+	OriginalName string   `json:"original_name" example:"document.pdf"`
+	MimeType     string   `json:"mime_type" example:"application/pdf"`
+	FileSize     int64    `json:"file_size" example:"1024"`
+	BlobHash     *string  `json:"blob_hash,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"` // SHA-256 nội dung
+	Folder       string   `json:"folder" example:"reports/2025"`
+	Tags         []string `json:"tags" example:"reference,pdf"`
+	DownloadURL  string   `json:"download_url" example:"/api/v1/files/550e8400-e29b-41d4-a716-446655440000/download"`
+	// Provenance (file output của automation)
+	Source         string  `json:"source" example:"upload"`
+	ExecutionID    *string `json:"execution_id,omitempty"`
+	ProjectID      *string `json:"project_id,omitempty"`
+	ScriptPromptID *string `json:"script_prompt_id,omitempty"`
+	OutputName     *string `json:"output_name,omitempty"`
+	MachineID      *string `json:"machine_id,omitempty"`
+	CreatedAt      string  `json:"created_at" example:"2025-01-21T10:00:00Z"`
+	UpdatedAt      string  `json:"updated_at" example:"2025-01-21T10:00:00Z"`
+}
+
+// FileListFilter represents filters for listing a user's files
+type FileListFilter struct {
+	Folder    *string // nil = mọi thư mục, "" = thư mục gốc
+	Recursive bool    // Bao gồm thư mục con của Folder
+	Tag       string
+	Search    string // Tìm theo original_name (không phân biệt hoa thường)
+	Source    string // upload, automation
+	MimeType  string // vd: "application/pdf" hoặc "image/*"
+}
+
+// UpdateFileRequest represents the request to rename / move / tag a file (field nil = giữ nguyên)
+type UpdateFileRequest struct {
+	OriginalName     *string   `json:"original_name,omitempty" example:"report-final.pdf"`
+	Folder           *string   `json:"folder,omitempty" example:"reports/2025"`
+	Tags             *[]string `json:"tags,omitempty"`
+	UpdateReferences bool      `json:"update_references" example:"true"` // Đổi tên: cập nhật input_files của các prompt đang dùng tên cũ
+}
+
+// FileReference represents a script prompt using a file as input (theo tên file trong input_files)
+type FileReference struct {
+	ScriptID    string `json:"script_id"`
+	TopicID     string `json:"topic_id"`
+	ProjectID   string `json:"project_id"`
+	PromptID    string `json:"prompt_id"`
+	PromptOrder int    `json:"prompt_order"`
+	InputName   string `json:"input_name" example:"document.pdf"`
+	Mode        string `json:"mode" example:"file"` // file (cố định theo ID), latest (theo tên), legacy (prompt cũ chưa có input_file_refs)
+}
+
+// FileReferenceModeLegacy marks references from prompts without input_file_refs (resolve theo tên như trước)
+const FileReferenceModeLegacy = "legacy"
+
+// UpdateFileResponse represents the result of updating a file
+type UpdateFileResponse struct {
+	File              FileResponse    `json:"file"`
+	References        []FileReference `json:"references,omitempty"` // Prompt tham chiếu tên cũ
+	ReferencesUpdated bool            `json:"references_updated"`   // input_files đã được đổi sang tên mới
+	Warnings          []string        `json:"warnings,omitempty"`
+}
+
+// FileVersionResponse represents one version of a logical file (các file cùng original_name của user)
+type FileVersionResponse struct {
+	Version  int          `json:"version" example:"1"` // 1 = bản cũ nhất
+	IsLatest bool         `json:"is_latest"`           // Bản được prompt mode latest dùng
+	File     FileResponse `json:"file"`
+}
+
+// FileFolderResponse represents a virtual folder with its file count
+type FileFolderResponse struct {
+	Folder    string `json:"folder" example:"reports/2025"`
+	FileCount int64  `json:"file_count" example:"3"`
+	TotalSize int64  `json:"total_size" example:"1048576"`
+}
+
+// FileTagResponse represents a tag with its file count
+type FileTagResponse struct {
+	Tag       string `json:"tag" example:"reference"`
+	FileCount int64  `json:"file_count" example:"5"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// FileBlob is a unique file content stored once in the storage backend (content-addressed by SHA-256).
+// Nhiều File (upload trùng nội dung) cùng trỏ tới 1 blob qua File.BlobHash.
+type FileBlob struct {
+	Hash     string `json:"hash" gorm:"primaryKey;type:varchar(64)"` // SHA-256 hex của nội dung
+	Size     int64  `json:"size" gorm:"type:bigint;not null"`
+	MimeType string `json:"mime_type" gorm:"type:varchar(100)"`
+	Location string `json:"location" gorm:"type:varchar(500);not null"` // Storage location (path trên disk hoặc s3://bucket/key), File.FilePath = Location
+	RefCount int    `json:"ref_count" gorm:"not null;default:0"`        // Số File trỏ tới blob (GC đối chiếu lại với bảng files)
+
+	// Timestamps (UpdatedAt đổi mỗi lần tăng/giảm ref, GC chỉ xóa blob không đổi trong grace period)
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"index"`
+}
+
+// TableName specifies the table name for the FileBlob model
+func (FileBlob) TableName() string {
+	return "file_blobs"
+}
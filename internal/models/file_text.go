@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// File text extraction statuses
+const (
+	FileTextStatusPending     = "pending"     // Đang trích xuất (chỉ trong response, không lưu)
+	FileTextStatusCompleted   = "completed"   // Có text
+	FileTextStatusUnsupported = "unsupported" // Định dạng không hỗ trợ, file quá lớn hoặc không có text đọc được (PDF scan)
+	FileTextStatusFailed      = "failed"      // File hỏng / lỗi khi đọc
+)
+
+// FileText is the plain text extracted from an uploaded document (txt, md, docx, xlsx, pdf)
+type FileText struct {
+	FileID        string    `json:"file_id" gorm:"primaryKey;type:uuid"`
+	Status        string    `json:"status" gorm:"type:varchar(20);not null" example:"completed"`
+	Format        string    `json:"format,omitempty" gorm:"type:varchar(20)" example:"docx"`
+	Content       string    `json:"-" gorm:"type:text;not null;default:''"`  // FILE_TEXT_MAX_KB đầu tiên
+	Truncated     bool      `json:"truncated" gorm:"not null;default:false"` // Content bị cắt so với toàn bộ text
+	CharCount     int64     `json:"char_count" gorm:"not null;default:0"`    // Số ký tự của toàn bộ text
+	WordCount     int64     `json:"word_count" gorm:"not null;default:0"`
+	TokenEstimate int64     `json:"token_estimate" gorm:"not null;default:0"` // Ước lượng token (~4 ký tự / token)
+	Error         string    `json:"error,omitempty" gorm:"type:text"`
+	ExtractedAt   time.Time `json:"extracted_at"`
+
+	// Relationships
+	File File `json:"-" gorm:"foreignKey:FileID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+// TableName specifies the table name for the FileText model
+func (FileText) TableName() string {
+	return "file_texts"
+}
+
+// FilePreviewResponse represents the text preview of a file
+type FilePreviewResponse struct {
+	FileID        string     `json:"file_id"`
+	OriginalName  string     `json:"original_name"`
+	MimeType      string     `json:"mime_type"`
+	Status        string     `json:"status" example:"completed"` // pending, completed, unsupported, failed
+	Format        string     `json:"format,omitempty" example:"docx"`
+	Text          string     `json:"text"`      // max_kb KB đầu tiên
+	Truncated     bool       `json:"truncated"` // Text ngắn hơn toàn bộ nội dung
+	CharCount     int64      `json:"char_count"`
+	WordCount     int64      `json:"word_count"`
+	TokenEstimate int64      `json:"token_estimate"`
+	Error         string     `json:"error,omitempty"`
+	ExtractedAt   *time.Time `json:"extracted_at,omitempty"`
+}
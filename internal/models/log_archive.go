@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// LogArchive represents a compressed NDJSON file holding process logs removed by retention
+type LogArchive struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	FileName  string    `json:"file_name" gorm:"type:varchar(255);not null" example:"process_logs_20250121T103000Z_1.ndjson.gz"`
+	FilePath  string    `json:"-" gorm:"type:varchar(500);not null"`
+	LogCount  int       `json:"log_count" gorm:"not null" example:"5000"`
+	SizeBytes int64     `json:"size_bytes" gorm:"not null" example:"102400"`
+	MinSeq    int64     `json:"min_seq" example:"1"`
+	MaxSeq    int64     `json:"max_seq" example:"5000"`
+	FromTime  time.Time `json:"from_time"` // created_at của log cũ nhất trong archive
+	ToTime    time.Time `json:"to_time"`   // created_at của log mới nhất trong archive
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName specifies the table name for the LogArchive model
+func (LogArchive) TableName() string {
+	return "log_archives"
+}
+
+// LogRetentionRule is a retention tier: logs matching entity_type/status are kept for Days.
+// "*" matches any value; the most specific matching rule wins.
+type LogRetentionRule struct {
+	EntityType string `json:"entity_type" example:"*"`
+	Status     string `json:"status" example:"error"`
+	Days       int    `json:"days" example:"90"`
+}
+
+// Specificity returns how specific the rule is (2 = entity_type and status, 0 = catch-all)
+func (r LogRetentionRule) Specificity() int {
+	specificity := 0
+	if r.EntityType != "*" {
+		specificity++
+	}
+	if r.Status != "*" {
+		specificity++
+	}
+	return specificity
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+)
+
+// Default role names (tạo khi migrate, không xóa / đổi tên được)
+const (
+	RoleTopicCreator = "topic_creator"
+	RoleTopicUser    = "topic_user"
+	RoleAdmin        = "admin"
+)
+
+// Permission names (resource.action)
+const (
+	PermissionTopicCreate         = "topic.create"          // Tạo topic
+	PermissionTopicAccess         = "topic.access"          // Xem / dùng topic của mình hoặc được assign
+	PermissionTopicManage         = "topic.manage"          // Xem tất cả topic, quản lý assignment của mọi topic
+	PermissionScriptExecute       = "script.execute"        // Chạy script và Gemini automation
+	PermissionUserManage          = "user.manage"           // Tạo user, khóa user, reset mật khẩu
+	PermissionRoleManage          = "role.manage"           // CRUD role, gán role cho user
+	PermissionStorageQuotaManage  = "storage_quota.manage"  // Xem dung lượng và đặt quota
+	PermissionBoxView             = "box.view"              // Xem tất cả box / app
+	PermissionProcessLogManage    = "process_log.manage"    // Feed log toàn hệ thống, quarantine, archives, thống kê ingest
+	PermissionMachineManage       = "machine.manage"        // Rotate machine secret
+	PermissionGeminiAccountManage = "gemini_account.manage" // Setup / khóa / mở khóa Gemini account
+)
+
+// PermissionDefinition describes a built-in permission and the default roles seeded with it
+type PermissionDefinition struct {
+	Name         string
+	Description  string
+	DefaultRoles []string
+}
+
+// DefaultPermissions is the permission catalog seeded at startup.
+// Permission mới được gán cho DefaultRoles khi tạo lần đầu; quyền admin gỡ khỏi role sau đó không bị gán lại.
+var DefaultPermissions = []PermissionDefinition{
+	{PermissionTopicCreate, "Create topics", []string{RoleTopicCreator, RoleAdmin}},
+	{PermissionTopicAccess, "Access own and assigned topics", []string{RoleTopicCreator, RoleTopicUser, RoleAdmin}},
+	{PermissionTopicManage, "View all topics and manage assignments of any topic", []string{RoleAdmin}},
+	{PermissionScriptExecute, "Execute scripts and Gemini automation", []string{RoleTopicCreator, RoleTopicUser, RoleAdmin}},
+	{PermissionUserManage, "Register users, change user status and reset passwords", []string{RoleAdmin}},
+	{PermissionRoleManage, "Manage roles, their permissions and user roles", []string{RoleAdmin}},
+	{PermissionStorageQuotaManage, "View storage usage and manage storage quotas", []string{RoleAdmin}},
+	{PermissionBoxView, "View all boxes and apps", []string{RoleAdmin}},
+	{PermissionProcessLogManage, "Read all process logs, quarantine, archives and ingestion stats", []string{RoleAdmin}},
+	{PermissionMachineManage, "Rotate machine secrets", []string{RoleAdmin}},
+	{PermissionGeminiAccountManage, "Set up, lock and unlock Gemini accounts", []string{RoleAdmin}},
+}
+
+// IsDefaultRole checks if a role is created by the migration (code dựa vào tên role này)
+func IsDefaultRole(name string) bool {
+	return name == RoleTopicCreator || name == RoleTopicUser || name == RoleAdmin
+}
+
+// Permission is a named permission that can be granted to roles
+type Permission struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name        string    `json:"name" gorm:"type:varchar(100);not null;unique" example:"topic.create"`
+	Description string    `json:"description" gorm:"type:text" example:"Create topics"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for the Permission model
+func (Permission) TableName() string {
+	return "permissions"
+}
+
+// CreateRoleRequest represents the request to create a role with its permissions
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=100" example:"support"`
+	Description string   `json:"description,omitempty" example:"Support team"`
+	Permissions []string `json:"permissions,omitempty" example:"topic.manage,process_log.manage"`
+}
+
+// UpdateRoleRequest represents the request to update a role (field nil = giữ nguyên)
+type UpdateRoleRequest struct {
+	Name        *string   `json:"name,omitempty" binding:"omitempty,min=1,max=100" example:"support"` // Không đổi được tên role mặc định
+	Description *string   `json:"description,omitempty" example:"Support team"`
+	Permissions *[]string `json:"permissions,omitempty" example:"topic.manage"` // Thay toàn bộ permission của role
+}
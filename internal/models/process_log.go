@@ -9,6 +9,9 @@ type ProcessLog struct {
 	// Primary key
 	ID string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 
+	// Seq là số thứ tự tăng dần do DB cấp, dùng làm SSE event id (Last-Event-ID) để client reconnect không mất log
+	Seq int64 `json:"seq" gorm:"autoIncrement;not null;uniqueIndex" example:"1024"`
+
 	// Entity identification
 	EntityType string `json:"entity_type" gorm:"type:varchar(50);not null;index" example:"topic"` // "topic", "script", "automation"
 	EntityID   string `json:"entity_id" gorm:"type:uuid;not null;index" example:"550e8400-e29b-41d4-a716-446655440000"`
@@ -34,6 +37,41 @@ func (ProcessLog) TableName() string {
 	return "process_logs"
 }
 
+// QuarantinedProcessLog stores a log reported by a machine that failed verification
+// (machine không phải máy được dispatch, user không liên quan tới entity...).
+// Log bị cách ly không được broadcast và không gây side effect (xóa topic, mark project...) cho tới khi admin release.
+type QuarantinedProcessLog struct {
+	ID string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+
+	// Machine that reported the log (BoxID nil khi log đến từ queue với machine_id không xác định)
+	BoxID     *string `json:"box_id,omitempty" gorm:"type:uuid;index"`
+	MachineID string  `json:"machine_id" gorm:"type:varchar(255);not null;index"`
+
+	// Log as reported (untrusted, nên không dùng kiểu uuid)
+	EntityType string `json:"entity_type" gorm:"type:varchar(50);not null"`
+	EntityID   string `json:"entity_id" gorm:"type:varchar(255);not null"`
+	UserID     string `json:"user_id" gorm:"type:varchar(255);not null"`
+	Stage      string `json:"stage" gorm:"type:varchar(50);not null"`
+	Status     string `json:"status" gorm:"type:varchar(20);not null"`
+	Message    string `json:"message" gorm:"type:text;not null"`
+	Metadata   JSON   `json:"metadata,omitempty" gorm:"type:jsonb"`
+
+	// Verification result
+	Reason string `json:"reason" gorm:"type:text;not null"`
+
+	// Review
+	ReleasedAt    *time.Time `json:"released_at,omitempty" gorm:"index"`
+	ReleasedBy    *string    `json:"released_by,omitempty" gorm:"type:uuid"`
+	ReleasedLogID *string    `json:"released_log_id,omitempty" gorm:"type:uuid"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName specifies the table name for the QuarantinedProcessLog model
+func (QuarantinedProcessLog) TableName() string {
+	return "quarantined_process_logs"
+}
+
 // ProcessLogRequest represents the request to create a process log (from automation backend)
 type ProcessLogRequest struct {
 	EntityType string                 `json:"entity_type" binding:"required" example:"topic"`
@@ -49,6 +87,7 @@ type ProcessLogRequest struct {
 // ProcessLogResponse represents the response for process log operations
 type ProcessLogResponse struct {
 	ID         string `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Seq        int64  `json:"seq" example:"1024"`
 	EntityType string `json:"entity_type" example:"topic"`
 	EntityID   string `json:"entity_id" example:"550e8400-e29b-41d4-a716-446655440001"`
 	UserID     string `json:"user_id" example:"550e8400-e29b-41d4-a716-446655440001"`
@@ -60,4 +99,111 @@ type ProcessLogResponse struct {
 	CreatedAt  string `json:"created_at" example:"2025-01-21T10:30:00Z"`
 }
 
+// ProcessLogFilter represents server-side filters for log queries and streams (empty field = no filter)
+type ProcessLogFilter struct {
+	EntityType string `form:"entity_type" json:"entity_type,omitempty" example:"topic"`
+	MachineID  string `form:"machine_id" json:"machine_id,omitempty" example:"PC-001"`
+	Status     string `form:"status" json:"status,omitempty" example:"error"`
+	Stage      string `form:"stage" json:"stage,omitempty" example:"failed"`
+}
+
+// Matches reports whether the log satisfies the filter
+func (f *ProcessLogFilter) Matches(log *ProcessLog) bool {
+	if f == nil {
+		return true
+	}
+	if f.EntityType != "" && log.EntityType != f.EntityType {
+		return false
+	}
+	if f.MachineID != "" && log.MachineID != f.MachineID {
+		return false
+	}
+	if f.Status != "" && log.Status != f.Status {
+		return false
+	}
+	if f.Stage != "" && log.Stage != f.Stage {
+		return false
+	}
+	return true
+}
+
+// ProcessLogSearchFilter represents parsed filters for GET /process-logs/search
+type ProcessLogSearchFilter struct {
+	ProcessLogFilter
+
+	EntityID string
+	From     *time.Time // created_at >= From
+	To       *time.Time // created_at < To
+	Query    string     // Full-text search trên message
 
+	// Metadata JSONB path filters: path (vd: ["execution_id"] hoặc ["error", "code"]) → giá trị
+	Metadata []MetadataPathFilter
+}
+
+// MetadataPathFilter is an equality filter on a JSONB metadata path
+type MetadataPathFilter struct {
+	Path  []string
+	Value string
+}
+
+// ProcessLogSearchResponse represents a page of search results with cursor pagination
+type ProcessLogSearchResponse struct {
+	Data       []ProcessLogResponse `json:"data"`
+	NextCursor string               `json:"next_cursor,omitempty" example:"1024"`
+	HasMore    bool                 `json:"has_more" example:"true"`
+}
+
+// LogIngestionStats represents batching metrics of the process log queue consumer
+type LogIngestionStats struct {
+	ConsumerRunning     bool       `json:"consumer_running" example:"true"`
+	ConfiguredBatchSize int        `json:"configured_batch_size" example:"200"`
+	ConfiguredFlushMs   int64      `json:"configured_flush_interval_ms" example:"250"`
+	ConfiguredWorkers   int        `json:"configured_side_effect_workers" example:"4"`
+	BatchesFlushed      int64      `json:"batches_flushed" example:"1024"`
+	LogsIngested        int64      `json:"logs_ingested" example:"150000"`
+	LogsFailed          int64      `json:"logs_failed" example:"0"`
+	MessagesDropped     int64      `json:"messages_dropped" example:"3"` // Message không parse được hoặc có ID "unknown"
+	LogsQuarantined     int64      `json:"logs_quarantined" example:"2"` // Log không verify được machine / dispatch
+	LastBatchSize       int64      `json:"last_batch_size" example:"87"`
+	MaxBatchSize        int64      `json:"max_batch_size" example:"200"`
+	AverageBatchSize    float64    `json:"average_batch_size" example:"146.5"`
+	LastIngestionLagMs  int64      `json:"last_ingestion_lag_ms" example:"310"` // Từ lúc publish log cũ nhất trong batch đến lúc lưu DB
+	MaxIngestionLagMs   int64      `json:"max_ingestion_lag_ms" example:"2400"`
+	PendingSideEffects  int64      `json:"pending_side_effects" example:"0"`
+	LastFlushAt         *time.Time `json:"last_flush_at,omitempty"`
+}
+
+// LogStageHandlerInfo describes a handler subscribed to log stages
+type LogStageHandlerInfo struct {
+	Name       string   `json:"name" example:"topic.mark_synced"`
+	EntityType string   `json:"entity_type" example:"topic"`          // "*" = mọi entity type
+	Stage      string   `json:"stage" example:"completed"`            // "*" = mọi stage
+	Statuses   []string `json:"statuses,omitempty" example:"success"` // Rỗng = mọi status
+}
+
+// UnknownLogStage records a stage received without any registered handler
+type UnknownLogStage struct {
+	EntityType    string    `json:"entity_type" example:"topic"`
+	Stage         string    `json:"stage" example:"gem_updated"`
+	Count         int64     `json:"count" example:"12"`
+	FirstSeenAt   time.Time `json:"first_seen_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+	LastStatus    string    `json:"last_status" example:"info"`
+	LastMachineID string    `json:"last_machine_id,omitempty" example:"PC-001"`
+}
+
+// LogStagesResponse represents registered stage handlers and unknown stages seen by this instance
+type LogStagesResponse struct {
+	Handlers      []LogStageHandlerInfo `json:"handlers"`
+	UnknownStages []UnknownLogStage     `json:"unknown_stages"`
+}
+
+// ProcessLogEntitySummary summarizes the logs of one entity (execution/topic) in an export
+type ProcessLogEntitySummary struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   string    `json:"entity_id"`
+	LogCount   int64     `json:"log_count"`
+	ErrorCount int64     `json:"error_count"`
+	FirstLogAt time.Time `json:"first_log_at"`
+	LastLogAt  time.Time `json:"last_log_at"`
+}
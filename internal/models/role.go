@@ -12,7 +12,8 @@ type Role struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	// Relationships
-	Users []User `json:"users,omitempty" gorm:"many2many:user_roles;"`
+	Users       []User       `json:"users,omitempty" gorm:"many2many:user_roles;"`
+	Permissions []Permission `json:"permissions,omitempty" gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE"`
 }
 
 // TableName specifies the table name for the Role model
@@ -32,7 +33,8 @@ type RemoveRoleRequest struct {
 
 // UserRoleResponse represents a user with their roles
 type UserRoleResponse struct {
-	UserID   string   `json:"user_id"`
-	Username string   `json:"username"`
-	Roles    []string `json:"roles"` // List of role names
+	UserID      string   `json:"user_id"`
+	Username    string   `json:"username"`
+	Roles       []string `json:"roles"`       // List of role names
+	Permissions []string `json:"permissions"` // Permission của tất cả role (admin: mọi permission)
 }
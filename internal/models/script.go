@@ -61,6 +61,67 @@ func (sa *StringArray) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, sa)
 }
 
+// Prompt input file modes
+const (
+	PromptInputFileModeFile   = "file"   // Cố định theo file_id
+	PromptInputFileModeLatest = "latest" // File mới nhất của user có original_name = name (chọn rõ ràng)
+	PromptInputFileModeOutput = "output" // Output cùng tên do machine upload trong execution
+)
+
+// PromptInputFile is a stable reference from a prompt to one of its input files
+type PromptInputFile struct {
+	Name   string  `json:"name" example:"report.pdf"` // Tên hiển thị / gửi cho automation
+	FileID *string `json:"file_id,omitempty"`         // Bắt buộc khi mode = file
+	Mode   string  `json:"mode" example:"file" enums:"file,latest,output"`
+}
+
+// PromptInputFiles is a custom type for storing []PromptInputFile in JSONB column (nil = prompt cũ, resolve theo tên)
+type PromptInputFiles []PromptInputFile
+
+// Value implements driver.Valuer interface for GORM
+func (pf PromptInputFiles) Value() (driver.Value, error) {
+	if pf == nil {
+		return nil, nil
+	}
+	if len(pf) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(pf)
+}
+
+// Scan implements sql.Scanner interface for GORM
+func (pf *PromptInputFiles) Scan(value interface{}) error {
+	if value == nil {
+		*pf = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return nil
+	}
+
+	if len(bytes) == 0 {
+		*pf = nil
+		return nil
+	}
+	return json.Unmarshal(bytes, pf)
+}
+
+// Names returns the input file names in order (đồng bộ với ScriptPrompt.InputFiles)
+func (pf PromptInputFiles) Names() StringArray {
+	names := make(StringArray, 0, len(pf))
+	for _, ref := range pf {
+		names = append(names, ref.Name)
+	}
+	return names
+}
+
 // ScriptProject represents a project/node in a script
 // Composite primary key: (script_id, project_id) - project_id chỉ cần unique trong scope của một script
 type ScriptProject struct {
@@ -76,6 +137,10 @@ type ScriptProject struct {
 	CreatedAtDB     time.Time `json:"created_at_db" gorm:"default:now()"`                 // Timestamp khi lưu vào DB
 	UpdatedAt       time.Time `json:"updated_at"`
 
+	// Automation báo lỗi project: giữ lại đến PurgeAfter rồi purge job mới xóa (restore topic sẽ xóa đánh dấu này)
+	FailedAt   *time.Time `json:"failed_at,omitempty"`
+	PurgeAfter *time.Time `json:"purge_after,omitempty" gorm:"index"`
+
 	// Relationships
 	Script  Script         `json:"script,omitempty" gorm:"foreignKey:ScriptID;references:ID;constraint:OnDelete:CASCADE"`
 	Prompts []ScriptPrompt `json:"prompts,omitempty" gorm:"foreignKey:ProjectID;references:ProjectID;constraint:OnDelete:CASCADE;order:prompt_order"`
@@ -87,18 +152,19 @@ func (ScriptProject) TableName() string {
 
 // ScriptPrompt represents a prompt in a project
 type ScriptPrompt struct {
-	ID           string      `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	ScriptID     string      `json:"script_id" gorm:"not null;index;type:uuid"`               // Cần để reference đến ScriptProject composite key
-	ProjectID    string      `json:"project_id" gorm:"not null;index;type:varchar(255)"`      // Frontend project_id (timestamp), part of ScriptProject composite key
-	TempPromptID string      `json:"temp_prompt_id,omitempty" gorm:"type:varchar(255);index"` // prompt_id từ frontend để map với cache files
-	PromptText   string      `json:"text" gorm:"type:text;not null"`
-	Filename     string      `json:"filename,omitempty" gorm:"type:varchar(255)"` // Tên file output gắn với prompt
-	InputFiles   StringArray `json:"input_files,omitempty" gorm:"type:jsonb"`     // Danh sách file name dùng làm input cho prompt này
-	Exit         bool        `json:"exit" gorm:"default:false"`
-	Merge        bool        `json:"merge" gorm:"default:false"` // New field: Merge results
-	PromptOrder  int         `json:"prompt_order" gorm:"not null;default:0"`
-	CreatedAt    time.Time   `json:"created_at"`
-	UpdatedAt    time.Time   `json:"updated_at"`
+	ID            string           `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ScriptID      string           `json:"script_id" gorm:"not null;index;type:uuid"`               // Cần để reference đến ScriptProject composite key
+	ProjectID     string           `json:"project_id" gorm:"not null;index;type:varchar(255)"`      // Frontend project_id (timestamp), part of ScriptProject composite key
+	TempPromptID  string           `json:"temp_prompt_id,omitempty" gorm:"type:varchar(255);index"` // prompt_id từ frontend để map với cache files
+	PromptText    string           `json:"text" gorm:"type:text;not null"`
+	Filename      string           `json:"filename,omitempty" gorm:"type:varchar(255)"` // Tên file output gắn với prompt
+	InputFiles    StringArray      `json:"input_files,omitempty" gorm:"type:jsonb"`     // Danh sách file name dùng làm input cho prompt này
+	InputFileRefs PromptInputFiles `json:"input_file_refs,omitempty" gorm:"type:jsonb"` // Tham chiếu ổn định tương ứng với InputFiles (cùng thứ tự)
+	Exit          bool             `json:"exit" gorm:"default:false"`
+	Merge         bool             `json:"merge" gorm:"default:false"` // New field: Merge results
+	PromptOrder   int              `json:"prompt_order" gorm:"not null;default:0"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
 
 	// Relationships - Note: No foreign key constraint because composite key reference is complex
 	// We rely on application logic to maintain referential integrity
@@ -148,14 +214,15 @@ type ScriptProjectRequest struct {
 }
 
 type ScriptPromptRequest struct {
-	ID          string   `json:"id,omitempty"`        // UUID từ DB (nếu có = update, không có = create mới)
-	PromptID    string   `json:"prompt_id,omitempty"` // ID từ frontend để identify prompt khi upload file (temp_id)
-	Text        string   `json:"text" binding:"required"`
-	Filename    string   `json:"filename,omitempty"`
-	InputFiles  []string `json:"input_files,omitempty"` // File names (original_name) - sẽ được lấy từ cache nếu có prompt_id, nếu không thì dùng giá trị này
-	Exit        bool     `json:"exit"`
-	Merge       bool     `json:"merge"`
-	PromptOrder int      `json:"prompt_order"`
+	ID            string            `json:"id,omitempty"`        // UUID từ DB (nếu có = update, không có = create mới)
+	PromptID      string            `json:"prompt_id,omitempty"` // ID từ frontend để identify prompt khi upload file (temp_id)
+	Text          string            `json:"text" binding:"required"`
+	Filename      string            `json:"filename,omitempty"`
+	InputFiles    []string          `json:"input_files,omitempty"`     // File names (original_name) - sẽ được lấy từ cache nếu có prompt_id, nếu không thì dùng giá trị này
+	InputFileRefs []PromptInputFile `json:"input_file_refs,omitempty"` // Ưu tiên hơn input_files: tham chiếu theo file_id / latest / output
+	Exit          bool              `json:"exit"`
+	Merge         bool              `json:"merge"`
+	PromptOrder   int               `json:"prompt_order"`
 }
 
 type ScriptEdgeRequest struct {
@@ -190,13 +257,14 @@ type ScriptProjectResponse struct {
 }
 
 type ScriptPromptResponse struct {
-	ID          string   `json:"id"`
-	Text        string   `json:"text"`
-	Filename    string   `json:"filename,omitempty"`
-	InputFiles  []string `json:"input_files,omitempty"`
-	Exit        bool     `json:"exit"`
-	Merge       bool     `json:"merge"`
-	PromptOrder int      `json:"prompt_order"`
+	ID            string            `json:"id"`
+	Text          string            `json:"text"`
+	Filename      string            `json:"filename,omitempty"`
+	InputFiles    []string          `json:"input_files,omitempty"`
+	InputFileRefs []PromptInputFile `json:"input_file_refs,omitempty"`
+	Exit          bool              `json:"exit"`
+	Merge         bool              `json:"merge"`
+	PromptOrder   int               `json:"prompt_order"`
 }
 
 type ScriptEdgeResponse struct {
@@ -218,6 +286,7 @@ type ScriptExecution struct {
 	CurrentProjectID *string    `json:"current_project_id,omitempty" gorm:"type:varchar(255)"`
 	TunnelURL        string     `json:"tunnel_url,omitempty" gorm:"type:varchar(500)"` // TunnelURL từ launch response
 	DebugPort        int        `json:"debug_port,omitempty" gorm:"default:0"`         // DebugPort từ Chrome launch response
+	BoxID            *string    `json:"box_id,omitempty" gorm:"type:uuid;index"`       // Machine (box) được dispatch để chạy execution
 	StartedAt        *time.Time `json:"started_at,omitempty"`
 	CompletedAt      *time.Time `json:"completed_at,omitempty"`
 	ErrorMessage     string     `json:"error_message,omitempty" gorm:"type:text"`
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+// StorageQuota subject types
+const (
+	StorageQuotaSubjectUser = "user"
+	StorageQuotaSubjectRole = "role"
+)
+
+// StorageQuota is an admin override of file storage limits for a user or a role.
+// Field nil = kế thừa cấp dưới (user → role → mặc định env), 0 = không giới hạn.
+type StorageQuota struct {
+	ID          string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	SubjectType string `json:"subject_type" gorm:"type:varchar(20);not null;uniqueIndex:idx_storage_quota_subject" example:"user"` // user, role
+	SubjectID   string `json:"subject_id" gorm:"type:uuid;not null;uniqueIndex:idx_storage_quota_subject"`                         // User.ID hoặc Role.ID
+
+	MaxStorageBytes  *int64       `json:"max_storage_bytes,omitempty" gorm:"type:bigint" example:"10737418240"` // Tổng dung lượng file của user
+	MaxFileSizeBytes *int64       `json:"max_file_size_bytes,omitempty" gorm:"type:bigint" example:"524288000"` // Dung lượng tối đa 1 file
+	AllowedMimeTypes *StringArray `json:"allowed_mime_types,omitempty" gorm:"type:jsonb"`                       // vd: ["application/pdf", "image/*"], [] = mọi loại
+	Note             string       `json:"note,omitempty" gorm:"type:text"`
+
+	UpdatedBy string    `json:"updated_by,omitempty" gorm:"type:uuid"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for the StorageQuota model
+func (StorageQuota) TableName() string {
+	return "storage_quotas"
+}
+
+// StorageQuotaRequest represents the request to set a storage quota override (nil = kế thừa, 0 = không giới hạn)
+type StorageQuotaRequest struct {
+	MaxStorageBytes  *int64       `json:"max_storage_bytes,omitempty" example:"10737418240"`
+	MaxFileSizeBytes *int64       `json:"max_file_size_bytes,omitempty" example:"524288000"`
+	AllowedMimeTypes *StringArray `json:"allowed_mime_types,omitempty"`
+	Note             string       `json:"note,omitempty" example:"Khách hàng gói lớn"`
+}
+
+// EffectiveStorageQuota is the quota applied to a user after resolving user/role/default levels (0 = không giới hạn)
+type EffectiveStorageQuota struct {
+	MaxStorageBytes  int64    `json:"max_storage_bytes" example:"10737418240"`
+	MaxFileSizeBytes int64    `json:"max_file_size_bytes" example:"524288000"`
+	AllowedMimeTypes []string `json:"allowed_mime_types"` // Rỗng = mọi loại
+	// Nguồn của từng giới hạn: user, role, default
+	MaxStorageSource  string `json:"max_storage_source" example:"role"`
+	MaxFileSizeSource string `json:"max_file_size_source" example:"default"`
+	MimeTypesSource   string `json:"mime_types_source" example:"default"`
+}
+
+// StorageUsageResponse represents the storage usage of a user
+type StorageUsageResponse struct {
+	UserID         string                `json:"user_id"`
+	UsedBytes      int64                 `json:"used_bytes" example:"1048576"`
+	FileCount      int64                 `json:"file_count" example:"12"`
+	RemainingBytes *int64                `json:"remaining_bytes,omitempty" example:"10736369664"` // nil = không giới hạn
+	Quota          EffectiveStorageQuota `json:"quota"`
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Topic represents a logical topic/chủ đề that user creates.
@@ -24,6 +26,11 @@ type Topic struct {
 	SyncStatus   string     `json:"sync_status" gorm:"type:varchar(50);default:'pending';index" example:"synced"` // "pending", "synced", "failed"
 	SyncError    string     `json:"sync_error,omitempty" gorm:"type:text" example:"API returned status 404"`
 
+	// Removal (soft delete): topic bị gỡ do automation lỗi/account bị khóa được giữ lại đến PurgeAfter để có thể restore
+	RemovalState string         `json:"removal_state,omitempty" gorm:"type:varchar(20);index" example:"failed"` // "failed", "orphaned"
+	PurgeAfter   *time.Time     `json:"purge_after,omitempty" example:"2025-01-28T10:30:00Z"`
+	DeletedAt    gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index" swaggertype:"string"`
+
 	// Timestamps
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -37,6 +44,12 @@ func (Topic) TableName() string {
 	return "topics"
 }
 
+// Topic removal states
+const (
+	TopicRemovalStateFailed   = "failed"   // Automation báo lỗi
+	TopicRemovalStateOrphaned = "orphaned" // Gemini account của topic bị khóa
+)
+
 // CreateTopicRequest represents the request to create a new topic
 type CreateTopicRequest struct {
 	Name        string `json:"name" binding:"required" example:"Lịch sử"`
@@ -60,6 +73,9 @@ type TopicResponse struct {
 	LastSyncedAt  *string `json:"last_synced_at,omitempty" example:"2025-01-21T10:30:00Z"`
 	SyncStatus    string  `json:"sync_status" example:"synced"`
 	SyncError     string  `json:"sync_error,omitempty" example:""`
+	RemovalState  string  `json:"removal_state,omitempty" example:"failed"`
+	RemovedAt     *string `json:"removed_at,omitempty" example:"2025-01-21T10:30:00Z"`
+	PurgeAfter    *string `json:"purge_after,omitempty" example:"2025-01-28T10:30:00Z"`
 	CreatedAt     string  `json:"created_at" example:"2025-01-21T10:00:00Z"`
 	UpdatedAt     string  `json:"updated_at" example:"2025-01-21T10:00:00Z"`
 }
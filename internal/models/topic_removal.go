@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// TopicRemoval is the audit record of a topic removed automatically (soft delete), restored or purged
+type TopicRemoval struct {
+	ID            string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	TopicID       string `json:"topic_id" gorm:"type:uuid;not null;index"`
+	TopicName     string `json:"topic_name" gorm:"type:varchar(255)" example:"Lịch sử"`
+	UserProfileID string `json:"user_profile_id" gorm:"type:uuid;index"`
+
+	// Project bị gỡ (nil khi gỡ cả topic): khóa (script_id, project_id) của script_projects
+	ScriptID  *string `json:"script_id,omitempty" gorm:"type:uuid;index"`
+	ProjectID *string `json:"project_id,omitempty" gorm:"type:varchar(255);index" example:"1712345678901"`
+
+	// State: "failed" | "orphaned"
+	State string `json:"state" gorm:"type:varchar(20);not null" example:"failed"`
+
+	// Trigger: nguồn gây ra việc gỡ topic
+	TriggerType    string `json:"trigger_type" gorm:"type:varchar(50);not null;index" example:"automation_log"` // "automation_log", "gemini_account_locked"
+	Reason         string `json:"reason" gorm:"type:text" example:"automation gem_creating (failed)"`
+	TriggerDetails JSON   `json:"trigger_details,omitempty" gorm:"type:jsonb"` // Log (stage, status, machine_id, message, metadata) hoặc account bị khóa
+
+	RemovedAt  time.Time  `json:"removed_at" gorm:"not null"`
+	PurgeAfter time.Time  `json:"purge_after" gorm:"not null;index"`
+	RestoredAt *time.Time `json:"restored_at,omitempty"`
+	RestoredBy *string    `json:"restored_by,omitempty" gorm:"type:uuid"`
+	PurgedAt   *time.Time `json:"purged_at,omitempty"`
+}
+
+// TableName specifies the table name for the TopicRemoval model
+func (TopicRemoval) TableName() string {
+	return "topic_removals"
+}
+
+// TopicRemovalTriggerType values
+const (
+	TopicRemovalTriggerAutomationLog       = "automation_log"
+	TopicRemovalTriggerGeminiAccountLocked = "gemini_account_locked"
+)
+
+// RemovedTopicResponse represents a removed topic with its latest removal record
+type RemovedTopicResponse struct {
+	Topic   TopicResponse `json:"topic"`
+	Removal *TopicRemoval `json:"removal,omitempty"`
+}
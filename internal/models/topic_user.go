@@ -4,6 +4,46 @@ import (
 	"time"
 )
 
+// Topic permission types (TopicUser.PermissionType), mỗi quyền bao gồm quyền thấp hơn:
+//   - read: xem topic, script và log
+//   - write: + sửa topic/script, tạo project, chạy script và Gemini automation
+//   - full: + quản lý user được assign vào topic (assign, đổi quyền, gỡ), xóa topic
+const (
+	TopicPermissionRead  = "read"
+	TopicPermissionWrite = "write"
+	TopicPermissionFull  = "full"
+)
+
+// topicPermissionLevels orders the topic permission types (0 = không có quyền)
+var topicPermissionLevels = map[string]int{
+	TopicPermissionRead:  1,
+	TopicPermissionWrite: 2,
+	TopicPermissionFull:  3,
+}
+
+// IsValidTopicPermission checks if permission is a known topic permission type
+func IsValidTopicPermission(permission string) bool {
+	_, ok := topicPermissionLevels[permission]
+	return ok
+}
+
+// TopicPermissionAllows checks if a granted topic permission includes the required permission
+func TopicPermissionAllows(granted, required string) bool {
+	level, ok := topicPermissionLevels[granted]
+	return ok && level >= topicPermissionLevels[required]
+}
+
+// TopicPermissionsAtLeast returns the permission types that include the required permission (dùng cho query IN)
+func TopicPermissionsAtLeast(required string) []string {
+	permissions := make([]string, 0, len(topicPermissionLevels))
+	for _, permission := range []string{TopicPermissionRead, TopicPermissionWrite, TopicPermissionFull} {
+		if TopicPermissionAllows(permission, required) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
 // TopicUser represents the many-to-many relationship between topics and users
 // This allows admin to assign topics to users for access
 type TopicUser struct {
@@ -30,6 +70,11 @@ type AssignTopicRequest struct {
 	PermissionType string `json:"permission_type,omitempty" example:"read"` // 'read', 'write', 'full' (default: 'read')
 }
 
+// UpdateTopicPermissionRequest represents the request to change the permission of an existing topic assignment
+type UpdateTopicPermissionRequest struct {
+	PermissionType string `json:"permission_type" binding:"required,oneof=read write full" example:"write"`
+}
+
 // TopicUserResponse represents a user assigned to a topic
 type TopicUserResponse struct {
 	ID             string    `json:"id"`
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// UploadSession statuses
+const (
+	UploadSessionStatusUploading  = "uploading"
+	UploadSessionStatusCompleting = "completing" // Đã nhận đủ, đang lưu file
+	UploadSessionStatusCompleted  = "completed"
+)
+
+// UploadSession is a resumable (chunked) upload of a large file.
+// Client tạo session với tổng dung lượng, gửi từng chunk kèm offset (Upload-Offset), hỏi tiến độ khi mất kết nối, rồi complete.
+type UploadSession struct {
+	ID             string      `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID         string      `json:"user_id" gorm:"type:uuid;not null;index"`
+	FileName       string      `json:"file_name" gorm:"type:varchar(255);not null" example:"source.mp4"` // original_name của file sau khi complete
+	MimeType       string      `json:"mime_type" gorm:"type:varchar(255)" example:"video/mp4"`
+	TotalSize      int64       `json:"total_size" gorm:"not null" example:"1073741824"`
+	Offset         int64       `json:"offset" gorm:"column:upload_offset;not null;default:0" example:"8388608"` // Số byte đã nhận
+	ChecksumSHA256 string      `json:"checksum_sha256,omitempty" gorm:"type:varchar(64)"`                       // SHA-256 (hex) của cả file, kiểm tra khi complete
+	Folder         string      `json:"folder,omitempty" gorm:"type:varchar(500);not null;default:''"`
+	Tags           StringArray `json:"tags" gorm:"type:jsonb;not null;default:'[]'"`
+	ProjectID      string      `json:"project_id,omitempty" gorm:"type:varchar(255);not null;default:''"`
+	TempPromptID   string      `json:"prompt_id,omitempty" gorm:"type:varchar(255);not null;default:''"`
+	Status         string      `json:"status" gorm:"type:varchar(20);not null;default:'uploading';index" example:"uploading"` // uploading, completing, completed
+	FileID         *string     `json:"file_id,omitempty" gorm:"type:uuid"`                                                    // File tạo ra khi complete
+	ExpiresAt      time.Time   `json:"expires_at" gorm:"not null;index"`                                                      // Gia hạn mỗi lần nhận chunk
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// TableName specifies the table name for the UploadSession model
+func (UploadSession) TableName() string {
+	return "upload_sessions"
+}
+
+// CreateUploadSessionRequest represents the request to start a resumable upload
+type CreateUploadSessionRequest struct {
+	FileName       string   `json:"file_name" binding:"required" example:"source.mp4"`
+	TotalSize      int64    `json:"total_size" binding:"required,gt=0" example:"1073741824"`
+	MimeType       string   `json:"mime_type,omitempty" example:"video/mp4"`
+	ChecksumSHA256 string   `json:"checksum_sha256,omitempty"` // Optional: SHA-256 (hex) của cả file
+	Folder         string   `json:"folder,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	ProjectID      string   `json:"project_id,omitempty"` // Optional: stage file cho prompt như /files/upload
+	PromptID       string   `json:"prompt_id,omitempty"`
+}
+
+// UploadSessionResponse represents the state of a resumable upload
+type UploadSessionResponse struct {
+	UploadSession
+	UploadURL    string `json:"upload_url" example:"/api/v1/files/uploads/550e8400-e29b-41d4-a716-446655440000"`
+	MaxChunkSize int64  `json:"max_chunk_size" example:"67108864"` // Dung lượng tối đa của 1 chunk (PATCH)
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// UploadStaging kinds
+const (
+	UploadStagingKindPrompt    = "prompt"    // File upload cho input của prompt (project_id + temp_prompt_id), SaveScript consume
+	UploadStagingKindKnowledge = "knowledge" // File knowledge cho gem được tạo tiếp theo
+)
+
+// UploadStaging is a file uploaded but not yet attached to a script prompt / gem.
+// Thay cho cache in-memory: bền qua restart và dùng chung giữa các replica.
+type UploadStaging struct {
+	ID           string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID       string     `json:"user_id" gorm:"type:uuid;not null;index:idx_upload_stagings_lookup,priority:1"`
+	Kind         string     `json:"kind" gorm:"type:varchar(20);not null;index:idx_upload_stagings_lookup,priority:2" example:"prompt"` // prompt, knowledge
+	ProjectID    string     `json:"project_id,omitempty" gorm:"type:varchar(255);not null;default:'';index:idx_upload_stagings_lookup,priority:3"`
+	TempPromptID string     `json:"temp_prompt_id,omitempty" gorm:"type:varchar(255);not null;default:'';index:idx_upload_stagings_lookup,priority:4"`
+	FileID       string     `json:"file_id" gorm:"type:uuid;not null;index"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null;index"`
+	ConsumedAt   *time.Time `json:"consumed_at,omitempty" gorm:"index"` // nil = đang chờ
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for the UploadStaging model
+func (UploadStaging) TableName() string {
+	return "upload_stagings"
+}
@@ -3,11 +3,13 @@ package router
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
 	"github.com/onegreenvn/green-provider-services-backend/internal/handlers"
 	"github.com/onegreenvn/green-provider-services-backend/internal/middleware"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services/api_key"
 	"github.com/onegreenvn/green-provider-services-backend/internal/services/auth"
@@ -84,6 +86,8 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 	// Create middleware with services
 	bearerTokenMiddleware := middleware.NewBearerTokenMiddleware(authService, db)
 	apiKeyMiddleware := middleware.NewAPIKeyMiddleware(apiKeyService)
+	machineAuthMiddleware := middleware.NewMachineAuthMiddleware(db)
+	permissionMiddleware := middleware.NewPermissionMiddleware(db) // Permission của user theo role, load 1 lần mỗi request
 
 	// Get base URL from environment
 	baseURL := getEnv("BASE_URL", "")
@@ -95,7 +99,22 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 
 	// Create FileService first (needed by TopicService)
 	fileRepo := repository.NewFileRepository(db)
-	fileService := services.NewFileService(fileRepo, baseURL)
+	storageQuotaService := services.NewStorageQuotaService(repository.NewStorageQuotaRepository(db), userRepo, roleRepo, fileRepo)
+	fileService := services.NewFileService(fileRepo, repository.NewFileBlobRepository(db), repository.NewDownloadTokenRepository(db), repository.NewFileTextRepository(db), storageQuotaService, baseURL)
+	fileService.StartBlobGCJob(time.Hour) // Xóa blob không còn file nào tham chiếu (dedup theo SHA-256)
+	fileService.StartDownloadTokenCleanupJob(time.Hour) // Xóa download token / share link đã hết hạn
+	// Upload staging: file vừa upload chờ gắn vào prompt (SaveScript) / gem, lưu DB thay cho cache in-memory
+	scriptRepo := repository.NewScriptRepository(db)
+	fileManagementService := services.NewFileManagementService(fileService, fileRepo, scriptRepo)
+	uploadStagingService := services.NewUploadStagingService(
+		repository.NewUploadStagingRepository(db),
+		fileService,
+		fileManagementService,
+	)
+	uploadStagingService.StartCleanupJob(time.Hour) // Xóa upload bỏ dở (hết hạn, chưa gắn vào prompt)
+	// Resumable upload: xóa session chưa complete quá hạn (file .part) và session đã complete
+	resumableUploadService := services.NewResumableUploadService(repository.NewUploadSessionRepository(db), fileService, storageQuotaService)
+	resumableUploadService.StartCleanupJob(time.Hour)
 
 	// Create TopicService (needed by FileHandler để cache file IDs và TopicHandler)
 	topicUserRepo := repository.NewTopicUserRepository(db) // New: For topic assignments
@@ -104,12 +123,14 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 	chromeProfileService := services.NewChromeProfileService(userProfileRepo, appRepo, boxRepo, geminiAccountRepo, topicRepo)
 	logRepo := repository.NewProcessLogRepository(db)
 	processLogService := services.NewProcessLogService(logRepo, sseHub, rabbitMQService, db)
-	geminiAccountService := services.NewGeminiAccountService(geminiAccountRepo, appRepo, boxRepo, topicRepo, topicUserRepo)
-	topicService := services.NewTopicService(topicRepo, topicUserRepo, userProfileRepo, appRepo, boxRepo, chromeProfileService, processLogService, fileService, geminiAccountService)
+	// Topic removal: gỡ topic (soft delete) khi automation lỗi / account bị khóa, restore được trong grace period
+	topicRemovalService := services.NewTopicRemovalService(topicRepo, repository.NewTopicRemovalRepository(db))
+	topicRemovalService.StartPurgeJob(time.Hour)
+	geminiAccountService := services.NewGeminiAccountService(geminiAccountRepo, appRepo, boxRepo, topicRepo, topicUserRepo, topicRemovalService)
+	topicService := services.NewTopicService(topicRepo, topicUserRepo, userProfileRepo, appRepo, boxRepo, chromeProfileService, processLogService, fileService, geminiAccountService, uploadStagingService)
 	geminiService := services.NewGeminiService(userProfileRepo, appRepo, topicRepo, topicService, chromeProfileService)
 	
 	// Create ScriptService
-	scriptRepo := repository.NewScriptRepository(db)
 	scriptService := services.NewScriptService(
 		scriptRepo,
 		topicRepo,
@@ -118,6 +139,7 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 		chromeProfileService,
 		geminiAccountService,
 		fileService,
+		uploadStagingService,
 	)
 	
 	// Create ScriptExecutionService
@@ -131,22 +153,50 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 		baseURL,
 	)
 
+	// Output files của execution (machine upload) - artifacts browser/ZIP bundle
+	executionOutputService := services.NewExecutionOutputService(fileService, scriptRepo, topicRepo)
+
 	// Inject ScriptExecutionService into ProcessLogService
 	processLogService.SetScriptExecutionService(scriptExecutionService)
+	processLogService.SetTopicService(topicService)
 
 	// Start ProcessLogService RabbitMQ consumer (sau khi inject ScriptExecutionService)
 	if rabbitMQService != nil {
-		if err := processLogService.StartRabbitMQConsumer(); err != nil {
+		// Log ingestion batching: LOG_INGEST_BATCH_SIZE log/INSERT, tối đa LOG_INGEST_FLUSH_INTERVAL_MS chờ mỗi batch
+		logIngestConfig := services.LogIngestConfig{
+			BatchSize:         getEnvAsInt("LOG_INGEST_BATCH_SIZE", 200),
+			FlushInterval:     time.Duration(getEnvAsInt("LOG_INGEST_FLUSH_INTERVAL_MS", 250)) * time.Millisecond,
+			SideEffectWorkers: getEnvAsInt("LOG_INGEST_SIDE_EFFECT_WORKERS", 4),
+		}
+		if err := processLogService.StartRabbitMQConsumer(logIngestConfig); err != nil {
 			logrus.Warnf("[Router] Failed to start RabbitMQ log consumer: %v", err)
 		} else {
 			logrus.Info("[Router] ✅ RabbitMQ log consumer started (with ScriptExecutionService)")
 		}
 
-		// Start log cleanup service (cleanup every 6 hours, keep logs for 1 day)
+		// Fan-out SSE qua RabbitMQ để chạy nhiều replica sau load balancer
+		if getEnv("SSE_FANOUT_ENABLED", "true") == "true" {
+			sseExchange := getEnv("SSE_FANOUT_EXCHANGE", "process_logs_sse")
+			if err := sseHub.StartFanout(rabbitMQService, sseExchange); err != nil {
+				logrus.Warnf("[Router] Failed to start SSE fan-out, SSE delivery is local only: %v", err)
+			} else {
+				logrus.Infof("[Router] ✅ SSE fan-out started (exchange: %s)", sseExchange)
+			}
+		}
+
+		// Start log cleanup service (cleanup every 6 hours)
+		// LOG_RETENTION_POLICIES: tiered rules, ví dụ "*/error=90,*/warning=14,topic/*=7"; LOG_RETENTION_DAYS cho phần còn lại
 		logRetentionDays := getEnvAsInt("LOG_RETENTION_DAYS", 1)
+		retentionPolicy, err := services.ParseLogRetentionPolicy(getEnv("LOG_RETENTION_POLICIES", ""), logRetentionDays)
+		if err != nil {
+			logrus.Warnf("[Router] Invalid LOG_RETENTION_POLICIES, using defaults: %v", err)
+			retentionPolicy, _ = services.ParseLogRetentionPolicy("", logRetentionDays)
+		}
+		retentionPolicy.ArchiveEnabled = getEnv("LOG_ARCHIVE_ENABLED", "true") == "true"
+		retentionPolicy.ArchiveDir = getEnv("LOG_ARCHIVE_DIR", filepath.Join(getEnv("FILE_STORAGE_DIR", "./storage/files"), "log-archives"))
 		cleanupInterval := 6 * time.Hour
-		processLogService.StartLogCleanup(cleanupInterval, logRetentionDays)
-		logrus.Infof("[Router] Log cleanup service started (retention: %d days)", logRetentionDays)
+		processLogService.StartLogCleanup(cleanupInterval, retentionPolicy)
+		logrus.Infof("[Router] Log cleanup service started (policy: %s, archive: %v)", retentionPolicy, retentionPolicy.ArchiveEnabled)
 	}
 
 	// Create handlers with services
@@ -156,12 +206,13 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 	appProxyHandler := handlers.NewAppProxyHandler(db)
 	apiKeyHandler := handlers.NewAPIKeyHandler(db)
 	machineHandler := handlers.NewMachineHandler(db)
-	topicHandler := handlers.NewTopicHandler(topicService, roleService)
-	processLogHandler := handlers.NewProcessLogHandler(db, sseHub, rabbitMQService)
-	fileHandler := handlers.NewFileHandler(db, baseURL, scriptService)
+	topicHandler := handlers.NewTopicHandler(topicService, topicRemovalService)
+	processLogHandler := handlers.NewProcessLogHandler(db, sseHub, rabbitMQService, topicService)
+	fileHandler := handlers.NewFileHandler(db, fileService, storageQuotaService, resumableUploadService, fileManagementService, executionOutputService, scriptService)
 	geminiHandler := handlers.NewGeminiHandler(geminiService)
 	geminiAccountHandler := handlers.NewGeminiAccountHandler(geminiAccountService, topicService)
 	scriptHandler := handlers.NewScriptHandler(scriptService, scriptExecutionService, topicService)
+	executionHandler := handlers.NewExecutionHandler(executionOutputService, processLogService)
 
 	// Create admin handler with services
 	adminHandler := handlers.NewAdminHandler(authService, db, topicService, scriptService)
@@ -194,14 +245,18 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 			machines.GET("/:machine_id/frp-config", machineHandler.GetFrpConfigByMachineID)
 			machines.PUT("/:machine_id/tunnel-url", machineHandler.UpdateTunnelURLByMachineID)
 			machines.POST("/:machine_id/heartbeat", machineHandler.SendHeartbeat)
+			// Automation backend upload output của execution (machine credentials required)
+			machines.POST("/outputs", machineAuthMiddleware.MachineAuth(), fileHandler.UploadMachineOutput)
 		}
 
-		// File download route (public - supports token in query param)
-		api.GET("/files/:id/download", fileHandler.DownloadFile)
+		// File download route (public - chủ file đăng nhập hoặc download token / share link trong query param)
+		downloadAuth := []gin.HandlerFunc{apiKeyMiddleware.APIKeyAuthMiddleware(), bearerTokenMiddleware.OptionalBearerTokenAuthMiddleware()}
+		api.GET("/files/:id/download", append(downloadAuth, fileHandler.DownloadFile)...)
+		api.HEAD("/files/:id/download", append(downloadAuth, fileHandler.DownloadFile)...) // Kích thước / ETag trước khi tải theo Range
 
 		// Protected routes
 		protected := api.Group("")
-		protected.Use(apiKeyMiddleware.APIKeyAuthMiddleware(), bearerTokenMiddleware.BearerTokenAuthMiddleware())
+		protected.Use(apiKeyMiddleware.APIKeyAuthMiddleware(), bearerTokenMiddleware.BearerTokenAuthMiddleware(), permissionMiddleware.LoadPermissions())
 		{
 			// Auth protected routes
 			authProtected := protected.Group("/auth")
@@ -229,6 +284,7 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 				boxes.PUT("/:id", boxHandler.UpdateBox)
 				boxes.DELETE("/:id", boxHandler.DeleteBox)
 				boxes.GET("/:id/apps", boxHandler.GetAppsByBox)
+				boxes.POST("/:id/machine-secret", machineHandler.IssueMyMachineSecret)
 			}
 
 			// App Proxy routes - for direct platform operations
@@ -254,24 +310,32 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 			{
 				topics.POST("", topicHandler.CreateTopic)
 				topics.GET("", topicHandler.GetAllTopics)
+				topics.GET("/removed", topicHandler.GetRemovedTopics)
 				
 				// Script routes (1-1 với user + topic) - phải đặt trước /:id để tránh conflict
 				topics.POST("/:id/projects", scriptHandler.CreateProject) // New: Create project (and gem)
 				topics.POST("/:id/scripts", scriptHandler.SaveScript)
 				topics.GET("/:id/scripts", scriptHandler.GetScript)
 				topics.DELETE("/:id/scripts", scriptHandler.DeleteScript)
-				topics.POST("/:id/scripts/execute", scriptHandler.ExecuteScript)
+				topics.POST("/:id/scripts/execute", middleware.RequirePermission(models.PermissionScriptExecute), scriptHandler.ExecuteScript)
 				
 				topics.GET("/:id", topicHandler.GetTopicByID)
 				topics.PUT("/:id", topicHandler.UpdateTopic)
 				topics.DELETE("/:id", topicHandler.DeleteTopic)
+				topics.POST("/:id/restore", topicHandler.RestoreTopic)
+				topics.POST("/:id/projects/:project_id/restore", topicHandler.RestoreProject)
+				// Topic assignment management (topic.manage hoặc user có quyền full trên topic)
+				topics.GET("/:id/users", adminHandler.GetTopicAssignedUsers)
+				topics.POST("/:id/users", adminHandler.AssignTopicToUser)
+				topics.PUT("/:id/users/:user_id", adminHandler.UpdateTopicAssignmentPermission)
+				topics.DELETE("/:id/users/:user_id", adminHandler.RemoveTopicAssignment)
 				// topics.POST("/:id/sync", topicHandler.SyncTopicWithGemini) // TODO: Implement later
 			}
 
 			// Gemini routes
 			gemini := protected.Group("/gemini")
 			{
-				gemini.POST("/topics/:topic_id/generate-outline-and-upload", geminiHandler.GenerateOutlineAndUpload)
+				gemini.POST("/topics/:topic_id/generate-outline-and-upload", middleware.RequirePermission(models.PermissionScriptExecute), geminiHandler.GenerateOutlineAndUpload)
 				// Gemini Account management routes
 				geminiAccounts := gemini.Group("/accounts")
 				{
@@ -285,32 +349,62 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 				}
 			}
 
+			// Execution artifact routes (output files do machine upload)
+			executions := protected.Group("/executions")
+			{
+				executions.GET("/:id/artifacts", executionHandler.GetArtifacts)
+				executions.GET("/:id/artifacts.zip", executionHandler.DownloadArtifactsZip)
+			}
+
 			// File routes (upload and list require auth)
 			files := protected.Group("/files")
 			{
 				files.POST("/upload", fileHandler.UploadFile)
+				// Resumable (chunked) upload cho file lớn: tạo session → PATCH từng chunk → complete
+				files.POST("/uploads", fileHandler.CreateUploadSession)
+				files.HEAD("/uploads/:id", fileHandler.GetUploadSession) // Upload-Offset để resume
+				files.GET("/uploads/:id", fileHandler.GetUploadSession)
+				files.PATCH("/uploads/:id", fileHandler.UploadChunk)
+				files.POST("/uploads/:id/complete", fileHandler.CompleteUploadSession)
+				files.DELETE("/uploads/:id", fileHandler.AbortUploadSession)
 				files.GET("", fileHandler.GetMyFiles)
 				files.GET("/prompt", fileHandler.GetPromptFiles) // Get files for a specific prompt
+				files.GET("/usage", fileHandler.GetStorageUsage)  // Dung lượng đã dùng + quota
+				files.GET("/folders", fileHandler.GetFileFolders)
+				files.GET("/tags", fileHandler.GetFileTags)
+				files.GET("/:id/references", fileHandler.GetFileReferences) // Prompt dùng file làm input
+				files.GET("/:id/versions", fileHandler.GetFileVersions)     // Các bản cùng original_name
+				files.GET("/:id/preview", fileHandler.GetFilePreview)       // Text trích xuất + số ký tự / token
+				files.POST("/:id/share-links", fileHandler.CreateShareLink) // Link tải có hạn, giới hạn lượt tải, revoke được
+				files.GET("/:id/share-links", fileHandler.GetShareLinks)
+				files.DELETE("/:id/share-links/:link_id", fileHandler.RevokeShareLink)
+				files.POST("/:id/download-tokens/revoke", fileHandler.RevokeDownloadToken) // Revoke signed URL / share link theo token
+				files.PATCH("/:id", fileHandler.UpdateFile)                 // Đổi tên / thư mục / tags
+				files.DELETE("/:id", fileHandler.DeleteFile)
 				// Download endpoint moved to public routes (supports token in query param)
 			}
 
 			// Process Log routes
 			processLogs := api.Group("/process-logs")
 			{
-				// Public endpoint for automation backend to send logs
-				processLogs.POST("", processLogHandler.CreateLog)
+				// Endpoint for automation backend to send logs (machine credentials required)
+				processLogs.POST("", machineAuthMiddleware.MachineAuth(), processLogHandler.CreateLog)
 
 				// Protected routes
 				processLogsProtected := processLogs.Group("")
-				processLogsProtected.Use(apiKeyMiddleware.APIKeyAuthMiddleware(), bearerTokenMiddleware.BearerTokenAuthMiddleware())
+				processLogsProtected.Use(apiKeyMiddleware.APIKeyAuthMiddleware(), bearerTokenMiddleware.BearerTokenAuthMiddleware(), permissionMiddleware.LoadPermissions())
 				{
 					processLogsProtected.GET("", processLogHandler.GetLogsByUser)
+					processLogsProtected.GET("/stream", processLogHandler.StreamMyLogsSSE)
+					processLogsProtected.GET("/search", processLogHandler.SearchLogs)
+					processLogsProtected.GET("/export", processLogHandler.ExportLogs)
 					processLogsProtected.GET("/:entity_type/:entity_id", processLogHandler.GetLogsByEntity)
 					processLogsProtected.GET("/:entity_type/:entity_id/stream", processLogHandler.StreamLogsSSE)
+					processLogsProtected.GET("/:entity_type/:entity_id/export", processLogHandler.ExportEntityLogs)
 				}
 			}
 
-			// Admin routes (requires admin privileges)
+			// Admin routes (mỗi handler kiểm tra permission tương ứng, vd: user.manage, role.manage)
 			admin := protected.Group("/admin")
 			{
 				admin.POST("/register", adminHandler.Register)
@@ -319,20 +413,45 @@ func SetupRouter(db *gorm.DB, rabbitMQService *services.RabbitMQService, sseHub
 				admin.POST("/users/:id/reset-password", adminHandler.ResetPassword)
 				// Role management routes
 				admin.GET("/roles", adminHandler.GetAllRoles)
+				admin.POST("/roles", adminHandler.CreateRole)
+				admin.GET("/roles/:id", adminHandler.GetRole)
+				admin.PUT("/roles/:id", adminHandler.UpdateRole)
+				admin.DELETE("/roles/:id", adminHandler.DeleteRole)
+				admin.GET("/permissions", adminHandler.GetAllPermissions)
 				admin.GET("/users/:id/roles", adminHandler.GetUserRoles)
 				admin.POST("/users/:id/roles", adminHandler.AssignRoleToUser)
 				admin.DELETE("/users/:id/roles", adminHandler.RemoveRoleFromUser)
+				// Storage quota overrides
+				admin.GET("/storage-quotas", fileHandler.AdminListStorageQuotas)
+				admin.GET("/users/:id/storage-usage", fileHandler.AdminGetUserStorageUsage)
+				admin.PUT("/users/:id/storage-quota", fileHandler.AdminSetUserStorageQuota)
+				admin.DELETE("/users/:id/storage-quota", fileHandler.AdminDeleteUserStorageQuota)
+				admin.PUT("/roles/:id/storage-quota", fileHandler.AdminSetRoleStorageQuota)
+				admin.DELETE("/roles/:id/storage-quota", fileHandler.AdminDeleteRoleStorageQuota)
 				// Topic management routes
 				// IMPORTANT: More specific routes must come before less specific ones
 				admin.GET("/topics", adminHandler.GetAllTopics) // Must come before /topics/:id routes
 				// Topic assignment management routes
 				admin.POST("/topics/:id/assign", adminHandler.AssignTopicToUser)
 				admin.GET("/topics/:id/users", adminHandler.GetTopicAssignedUsers)
+				admin.PUT("/topics/:id/users/:user_id", adminHandler.UpdateTopicAssignmentPermission)
 				admin.DELETE("/topics/:id/users/:user_id", adminHandler.RemoveTopicAssignment)
 				// IMPORTANT: More specific routes must come before less specific ones
 				admin.GET("/boxes/status", adminHandler.AdminGetAllBoxesWithStatus)
 				admin.GET("/boxes", adminHandler.AdminGetAllBoxes)
 				admin.GET("/apps", adminHandler.AdminGetAllApps)
+
+				// Admin process log feed
+				admin.GET("/process-logs/stream", processLogHandler.StreamAllLogsSSE)
+				admin.GET("/process-logs/quarantine", processLogHandler.GetQuarantinedLogs)
+				admin.POST("/process-logs/quarantine/:id/release", processLogHandler.ReleaseQuarantinedLog)
+				admin.GET("/process-logs/archives", processLogHandler.GetLogArchives)
+				admin.GET("/process-logs/ingestion-stats", processLogHandler.GetIngestionStats)
+				admin.GET("/process-logs/stages", processLogHandler.GetLogStages)
+				admin.GET("/process-logs/archives/:id/download", processLogHandler.DownloadLogArchive)
+
+				// Machine credentials
+				admin.POST("/machines/:machine_id/secret", machineHandler.RotateMachineSecret)
 			}
 		}
 
@@ -0,0 +1,497 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrExecutionOutputTargetNotFound is returned when the execution/project/prompt of an output does not exist
+	ErrExecutionOutputTargetNotFound = errors.New("execution output target not found")
+	// ErrMachineNotDispatched is returned when a machine uploads an output for an execution it does not run
+	ErrMachineNotDispatched = errors.New("machine is not the machine dispatched for this execution")
+)
+
+// ExecutionOutputService stores output files produced by the automation backend during script executions
+// (output của prompt / output merge của project) vào FileService kèm provenance.
+type ExecutionOutputService struct {
+	fileService *FileService
+	scriptRepo  *repository.ScriptRepository
+	topicRepo   *repository.TopicRepository
+}
+
+// NewExecutionOutputService creates an execution output service
+func NewExecutionOutputService(fileService *FileService, scriptRepo *repository.ScriptRepository, topicRepo *repository.TopicRepository) *ExecutionOutputService {
+	return &ExecutionOutputService{
+		fileService: fileService,
+		scriptRepo:  scriptRepo,
+		topicRepo:   topicRepo,
+	}
+}
+
+// UploadMachineOutput stores an output pushed by a machine.
+// Machine phải là machine được dispatch cho execution, project/prompt phải thuộc script của execution.
+// File thuộc về user chạy execution.
+func (s *ExecutionOutputService) UploadMachineOutput(box *models.Box, fileHeader *multipart.FileHeader, req *models.MachineOutputUploadRequest) (*models.File, error) {
+	execution, err := s.scriptRepo.GetExecutionByID(req.ExecutionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: execution %s", ErrExecutionOutputTargetNotFound, req.ExecutionID)
+		}
+		return nil, fmt.Errorf("failed to get execution: %w", err)
+	}
+
+	if err := s.checkDispatchedMachine(box, execution); err != nil {
+		return nil, err
+	}
+
+	project, err := s.scriptRepo.GetProjectByScriptIDAndProjectID(execution.ScriptID, req.ProjectID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: project %s", ErrExecutionOutputTargetNotFound, req.ProjectID)
+		}
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	// Tên output mặc định theo script: prompt.Filename hoặc project.Filename (output merge)
+	outputName := req.OutputName
+	var promptID *string
+	if req.PromptID != "" {
+		prompt, err := s.scriptRepo.GetPromptByID(req.PromptID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: prompt %s", ErrExecutionOutputTargetNotFound, req.PromptID)
+			}
+			return nil, fmt.Errorf("failed to get prompt: %w", err)
+		}
+		if prompt.ScriptID != execution.ScriptID || prompt.ProjectID != project.ProjectID {
+			return nil, fmt.Errorf("%w: prompt %s does not belong to project %s", ErrExecutionOutputTargetNotFound, req.PromptID, req.ProjectID)
+		}
+		promptID = &prompt.ID
+		if outputName == "" {
+			outputName = prompt.Filename
+		}
+	} else if outputName == "" {
+		outputName = project.Filename
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer file.Close()
+
+	projectID := project.ProjectID
+	machineID := box.MachineID
+	fileModel := &models.File{
+		UserID:         execution.UserID,
+		OriginalName:   fileHeader.Filename,
+		MimeType:       fileHeader.Header.Get("Content-Type"),
+		Source:         models.FileSourceAutomation,
+		ExecutionID:    &execution.ID,
+		ProjectID:      &projectID,
+		ScriptPromptID: promptID,
+		MachineID:      &machineID,
+	}
+	if outputName != "" {
+		fileModel.OutputName = &outputName
+	}
+
+	if err := s.fileService.StoreFile(fileModel, file, fileHeader.Size); err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Stored output %s (%s, %d bytes) from machine %s for execution %s, project %s", fileModel.ID, fileModel.OriginalName, fileModel.FileSize, box.MachineID, execution.ID, projectID)
+	return fileModel, nil
+}
+
+// checkDispatchedMachine verifies the machine runs the execution:
+// box ghi trong execution, hoặc machine đang chạy Chrome profile của owner topic
+func (s *ExecutionOutputService) checkDispatchedMachine(box *models.Box, execution *models.ScriptExecution) error {
+	if execution.BoxID != nil && *execution.BoxID == box.ID {
+		return nil
+	}
+
+	topic, err := s.topicRepo.GetByID(execution.TopicID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to get topic: %w", err)
+	}
+	if err == nil && topic.UserProfile.CurrentMachineID != nil && *topic.UserProfile.CurrentMachineID == box.ID {
+		return nil
+	}
+
+	return ErrMachineNotDispatched
+}
+
+// ResolveInputFiles maps input file names of a prompt to files.
+// Ưu tiên output của cùng execution (theo tên file hoặc tên output khai báo, có/không extension),
+// sau đó file mới nhất cùng tên của user.
+func (s *ExecutionOutputService) ResolveInputFiles(userID, executionID string, fileNames []string) []*models.File {
+	if len(fileNames) == 0 {
+		return nil
+	}
+
+	outputMap := s.executionOutputMap(executionID)
+
+	var userFileMap map[string]*models.File
+	files := make([]*models.File, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		if output, found := outputMap[fileName]; found {
+			files = append(files, output)
+			continue
+		}
+
+		if userFileMap == nil {
+			userFiles, err := s.fileService.GetUserFiles(userID)
+			if err != nil {
+				logrus.Warnf("Failed to get user files for resolving input files: %v", err)
+			}
+			// Create map: original_name -> file (lấy file mới nhất nếu có nhiều cùng tên)
+			userFileMap = make(map[string]*models.File)
+			for _, file := range userFiles {
+				existing, exists := userFileMap[file.OriginalName]
+				if !exists || file.CreatedAt.After(existing.CreatedAt) {
+					userFileMap[file.OriginalName] = file
+				}
+			}
+		}
+		if file, found := userFileMap[fileName]; found {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// ResolvePromptInputFiles maps the input files of a prompt to files.
+// Prompt có input_file_refs: file → đúng file_id (của user), latest → file mới nhất cùng tên, output → output của execution.
+// Prompt cũ (input_file_refs = nil) resolve theo tên như ResolveInputFiles.
+func (s *ExecutionOutputService) ResolvePromptInputFiles(userID, executionID string, prompt *models.ScriptPrompt) []*models.File {
+	if prompt.InputFileRefs == nil {
+		return s.ResolveInputFiles(userID, executionID, prompt.InputFiles)
+	}
+	if len(prompt.InputFileRefs) == 0 {
+		return nil
+	}
+
+	var outputMap map[string]*models.File
+	files := make([]*models.File, 0, len(prompt.InputFileRefs))
+	for _, ref := range prompt.InputFileRefs {
+		switch ref.Mode {
+		case models.PromptInputFileModeFile:
+			if ref.FileID == nil {
+				continue
+			}
+			file, err := s.fileService.GetFileByID(*ref.FileID)
+			if err != nil || file.UserID != userID {
+				logrus.Warnf("Input file %s (%s) of prompt %s not found for user %s", *ref.FileID, ref.Name, prompt.ID, userID)
+				continue
+			}
+			files = append(files, file)
+		case models.PromptInputFileModeLatest:
+			file, err := s.fileService.GetLatestFileByName(userID, ref.Name)
+			if err != nil {
+				logrus.Warnf("Latest input file %q of prompt %s not found for user %s", ref.Name, prompt.ID, userID)
+				continue
+			}
+			files = append(files, file)
+		case models.PromptInputFileModeOutput:
+			if outputMap == nil {
+				outputMap = s.executionOutputMap(executionID)
+			}
+			if output, found := outputMap[ref.Name]; found {
+				files = append(files, output)
+			} else {
+				logrus.Warnf("Output %q used as input of prompt %s not found in execution %s", ref.Name, prompt.ID, executionID)
+			}
+		}
+	}
+	return files
+}
+
+// executionOutputMap indexes the outputs of an execution theo tên file, tên bỏ extension và tên output khai báo
+func (s *ExecutionOutputService) executionOutputMap(executionID string) map[string]*models.File {
+	outputMap := make(map[string]*models.File)
+	if executionID == "" {
+		return outputMap
+	}
+	outputs, err := s.fileService.GetExecutionOutputs(executionID)
+	if err != nil {
+		logrus.Warnf("Failed to get outputs of execution %s: %v", executionID, err)
+	}
+	// outputs theo thứ tự upload → output upload sau ghi đè output trước cùng tên
+	for _, output := range outputs {
+		outputMap[output.OriginalName] = output
+		outputMap[strings.TrimSuffix(output.OriginalName, filepath.Ext(output.OriginalName))] = output
+		if output.OutputName != nil && *output.OutputName != "" {
+			outputMap[*output.OutputName] = output
+		}
+	}
+	return outputMap
+}
+
+// artifactPromptTextMaxLen limits the prompt text included in artifact listings
+const artifactPromptTextMaxLen = 200
+
+// unsafeZipNameChars matches characters replaced in ZIP entry names
+var unsafeZipNameChars = regexp.MustCompile(`[\\/:*?"<>|\x00-\x1f]+`)
+
+// GetExecution retrieves a script execution (artifacts lookup)
+func (s *ExecutionOutputService) GetExecution(executionID string) (*models.ScriptExecution, error) {
+	execution, err := s.scriptRepo.GetExecutionByID(executionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: execution %s", ErrExecutionOutputTargetNotFound, executionID)
+		}
+		return nil, fmt.Errorf("failed to get execution: %w", err)
+	}
+	return execution, nil
+}
+
+// GetExecutionArtifacts lists the outputs of an execution grouped by project (thứ tự chạy), then prompt order.
+// Mỗi artifact có signed download URL và đường dẫn trong bundle ZIP.
+func (s *ExecutionOutputService) GetExecutionArtifacts(execution *models.ScriptExecution) (*models.ExecutionArtifactsResponse, error) {
+	files, err := s.fileService.GetExecutionOutputs(execution.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get execution outputs: %w", err)
+	}
+
+	projects, err := s.scriptRepo.GetProjectsByScriptID(execution.ScriptID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects: %w", err)
+	}
+	projectExecutions, err := s.scriptRepo.GetProjectExecutionsByExecutionID(execution.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project executions: %w", err)
+	}
+
+	// Group theo project: project của script + project đã bị xóa khỏi script nhưng vẫn có output
+	groups := make(map[string]*models.ExecutionArtifactProject)
+	var projectIDs []string
+	addGroup := func(projectID, name string) *models.ExecutionArtifactProject {
+		if group, ok := groups[projectID]; ok {
+			return group
+		}
+		group := &models.ExecutionArtifactProject{ProjectID: projectID, Name: name, Artifacts: []models.ExecutionArtifact{}}
+		groups[projectID] = group
+		projectIDs = append(projectIDs, projectID)
+		return group
+	}
+	for _, project := range projects {
+		addGroup(project.ProjectID, project.Name)
+	}
+	for _, projectExec := range projectExecutions {
+		group := addGroup(projectExec.ProjectID, projectExec.ProjectID)
+		order := projectExec.ProjectOrder
+		group.ProjectOrder = &order
+		group.Status = projectExec.Status
+	}
+
+	prompts := make(map[string]*models.ScriptPrompt)
+	loadedPrompts := make(map[string]bool)
+
+	response := &models.ExecutionArtifactsResponse{
+		ExecutionID: execution.ID,
+		ScriptID:    execution.ScriptID,
+		TopicID:     execution.TopicID,
+		Status:      execution.Status,
+		StartedAt:   execution.StartedAt,
+		CompletedAt: execution.CompletedAt,
+		GeneratedAt: time.Now(),
+	}
+
+	usedZipPaths := make(map[string]bool)
+	for _, file := range files {
+		projectID := ""
+		if file.ProjectID != nil {
+			projectID = *file.ProjectID
+		}
+		group := addGroup(projectID, projectID)
+
+		if !loadedPrompts[projectID] {
+			loadedPrompts[projectID] = true
+			projectPrompts, err := s.scriptRepo.GetPromptsByScriptIDAndProjectID(execution.ScriptID, projectID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get prompts: %w", err)
+			}
+			for _, prompt := range projectPrompts {
+				prompts[prompt.ID] = prompt
+			}
+		}
+
+		artifact := models.ExecutionArtifact{
+			FileID:    file.ID,
+			FileName:  file.OriginalName,
+			MimeType:  file.MimeType,
+			FileSize:  file.FileSize,
+			PromptID:  file.ScriptPromptID,
+			CreatedAt: file.CreatedAt,
+		}
+		if file.OutputName != nil {
+			artifact.OutputName = *file.OutputName
+		}
+		if file.MachineID != nil {
+			artifact.MachineID = *file.MachineID
+		}
+
+		entryName := "merge_" + file.OriginalName
+		if file.ScriptPromptID != nil {
+			entryName = file.OriginalName
+			if prompt, ok := prompts[*file.ScriptPromptID]; ok {
+				order := prompt.PromptOrder
+				artifact.PromptOrder = &order
+				artifact.PromptText = truncateRunes(prompt.PromptText, artifactPromptTextMaxLen)
+				entryName = fmt.Sprintf("%02d_%s", order+1, file.OriginalName)
+			}
+		}
+		artifact.ZipPath = uniqueZipPath(usedZipPaths, sanitizeZipName(group.Name), sanitizeZipName(entryName))
+
+		if downloadURL, err := s.fileService.GenerateSignedDownloadURL(file.ID); err == nil {
+			artifact.DownloadURL = downloadURL
+		} else {
+			logrus.Warnf("Failed to sign download URL for artifact %s: %v", file.ID, err)
+			artifact.DownloadURL = s.fileService.GetDownloadURL(file.ID)
+		}
+
+		group.Artifacts = append(group.Artifacts, artifact)
+		response.TotalFiles++
+		response.TotalSize += file.FileSize
+	}
+
+	// Thứ tự: project theo thứ tự chạy trong execution, project không chạy ở cuối
+	sort.SliceStable(projectIDs, func(i, j int) bool {
+		a, b := groups[projectIDs[i]].ProjectOrder, groups[projectIDs[j]].ProjectOrder
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return *a < *b
+	})
+	response.Projects = make([]models.ExecutionArtifactProject, 0, len(projectIDs))
+	for _, projectID := range projectIDs {
+		group := groups[projectID]
+		sort.SliceStable(group.Artifacts, func(i, j int) bool {
+			a, b := group.Artifacts[i].PromptOrder, group.Artifacts[j].PromptOrder
+			if a == nil || b == nil {
+				return a != nil // output merge sau output của prompt
+			}
+			return *a < *b
+		})
+		response.Projects = append(response.Projects, *group)
+	}
+
+	return response, nil
+}
+
+// WriteArtifactsZip streams a ZIP bundle: artifacts (theo ZipPath), manifest.json và logs/execution.ndjson.
+// File thiếu trên storage được bỏ qua và ghi vào manifest (missing_files) thay vì làm hỏng cả bundle.
+func (s *ExecutionOutputService) WriteArtifactsZip(w io.Writer, artifacts *models.ExecutionArtifactsResponse, writeLogs func(io.Writer) error) error {
+	zipWriter := zip.NewWriter(w)
+
+	var missing []string
+	for _, project := range artifacts.Projects {
+		for _, artifact := range project.Artifacts {
+			if err := s.writeZipArtifact(zipWriter, &artifact); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					logrus.Warnf("Artifact %s of execution %s is missing on storage", artifact.FileID, artifacts.ExecutionID)
+					missing = append(missing, artifact.ZipPath)
+					continue
+				}
+				return err
+			}
+		}
+	}
+
+	manifest := struct {
+		*models.ExecutionArtifactsResponse
+		MissingFiles []string `json:"missing_files,omitempty"`
+	}{artifacts, missing}
+	manifestWriter, err := zipWriter.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(manifestWriter)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	if writeLogs != nil {
+		logsWriter, err := zipWriter.Create("logs/execution.ndjson")
+		if err != nil {
+			return err
+		}
+		if err := writeLogs(logsWriter); err != nil {
+			return fmt.Errorf("failed to write execution logs: %w", err)
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+func (s *ExecutionOutputService) writeZipArtifact(zipWriter *zip.Writer, artifact *models.ExecutionArtifact) error {
+	_, f, err := s.fileService.DownloadFileByToken(artifact.FileID)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := &zip.FileHeader{
+		Name:     artifact.ZipPath,
+		Method:   zip.Deflate,
+		Modified: artifact.CreatedAt,
+	}
+	entry, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(entry, f); err != nil {
+		return fmt.Errorf("failed to write artifact %s: %w", artifact.FileID, err)
+	}
+	return nil
+}
+
+// sanitizeZipName makes a name safe as a ZIP path segment
+func sanitizeZipName(name string) string {
+	name = strings.TrimSpace(unsafeZipNameChars.ReplaceAllString(name, "_"))
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// uniqueZipPath joins dir/name, appending " (n)" before the extension when the path is taken
+func uniqueZipPath(used map[string]bool, dir, name string) string {
+	path := dir + "/" + name
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; used[path]; i++ {
+		path = fmt.Sprintf("%s/%s (%d)%s", dir, base, i, ext)
+	}
+	used[path] = true
+	return path
+}
+
+// truncateRunes shortens s to at most max runes
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "…"
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidDownloadToken is returned for a malformed, forged or unknown download token, or a token of another file
+	ErrInvalidDownloadToken = errors.New("invalid download token")
+	// ErrDownloadTokenRevoked is returned when the token is on the revocation list
+	ErrDownloadTokenRevoked = errors.New("download token has been revoked")
+	// ErrDownloadTokenExpired is returned when the token has expired
+	ErrDownloadTokenExpired = errors.New("download token has expired")
+	// ErrDownloadLimitReached is returned when a single-use / max-download-count token is used up
+	ErrDownloadLimitReached = errors.New("download limit of token reached")
+	// ErrDownloadTokenMachine is returned when the token is bound to a machine và request không xác thực đúng machine đó
+	ErrDownloadTokenMachine = errors.New("download token is bound to another machine")
+	// ErrInvalidShareLink is returned for invalid share link options
+	ErrInvalidShareLink = errors.New("invalid share link")
+	// ErrShareLinkNotFound is returned when a share link does not exist or is already revoked
+	ErrShareLinkNotFound = errors.New("share link not found")
+)
+
+const (
+	defaultDownloadTokenTTLMinutes = 60
+	defaultShareLinkTTLHours       = 24
+	defaultShareLinkMaxTTLHours    = 720 // 30 ngày
+	downloadTokenAudience          = "file-download"
+	downloadTokenIssuer            = "green-provider-services-backend"
+)
+
+// FileDownloadClaims represents JWT claims for file download token (ID = DownloadToken.ID với share link)
+type FileDownloadClaims struct {
+	FileID    string `json:"file_id"`
+	MachineID string `json:"machine_id,omitempty"`
+	Purpose   string `json:"purpose,omitempty"` // "signed" = không có bản ghi download_tokens, revoke qua revoked_download_tokens
+	jwt.RegisteredClaims
+}
+
+// downloadTokenConfig holds the signing key and lifetimes of download tokens
+type downloadTokenConfig struct {
+	key           []byte
+	ttl           time.Duration // Signed URL (automation, artifacts)
+	shareTTL      time.Duration // Share link không chỉ định expires_in_hours
+	shareMaxTTL   time.Duration
+	allowUnsigned bool
+}
+
+// newDownloadTokenConfig reads the download token config from env:
+// FILE_DOWNLOAD_TOKEN_SECRET: key ký download token, tách khỏi JWT_SECRET (chưa set thì derive từ JWT_SECRET).
+// FILE_DOWNLOAD_TOKEN_TTL_MINUTES (default 60): hạn của signed URL.
+// FILE_SHARE_LINK_TTL_HOURS (default 24) / FILE_SHARE_LINK_MAX_TTL_HOURS (default 720): hạn mặc định / tối đa của share link.
+// FILE_DOWNLOAD_ALLOW_UNSIGNED (default false): cho tải không cần token/đăng nhập (chỉ dùng khi chuyển đổi client cũ).
+func newDownloadTokenConfig() downloadTokenConfig {
+	key := []byte(getEnv("FILE_DOWNLOAD_TOKEN_SECRET", ""))
+	if len(key) == 0 {
+		jwtSecret := getEnv("JWT_SECRET", "default-secret-key-change-in-production")
+		// Derive key riêng: token đăng nhập và download token không dùng thay nhau được
+		mac := hmac.New(sha256.New, []byte(jwtSecret))
+		mac.Write([]byte(downloadTokenAudience))
+		key = mac.Sum(nil)
+		logrus.Warn("FILE_DOWNLOAD_TOKEN_SECRET not set, deriving file download token key from JWT_SECRET")
+	}
+
+	ttlMinutes := defaultDownloadTokenTTLMinutes
+	if value, err := strconv.Atoi(getEnv("FILE_DOWNLOAD_TOKEN_TTL_MINUTES", "")); err == nil && value > 0 {
+		ttlMinutes = value
+	}
+	shareHours := defaultShareLinkTTLHours
+	if value, err := strconv.Atoi(getEnv("FILE_SHARE_LINK_TTL_HOURS", "")); err == nil && value > 0 {
+		shareHours = value
+	}
+	shareMaxHours := defaultShareLinkMaxTTLHours
+	if value, err := strconv.Atoi(getEnv("FILE_SHARE_LINK_MAX_TTL_HOURS", "")); err == nil && value > 0 {
+		shareMaxHours = value
+	}
+	if shareHours > shareMaxHours {
+		shareHours = shareMaxHours
+	}
+	allowUnsigned, _ := strconv.ParseBool(getEnv("FILE_DOWNLOAD_ALLOW_UNSIGNED", "false"))
+
+	return downloadTokenConfig{
+		key:           key,
+		ttl:           time.Duration(ttlMinutes) * time.Minute,
+		shareTTL:      time.Duration(shareHours) * time.Hour,
+		shareMaxTTL:   time.Duration(shareMaxHours) * time.Hour,
+		allowUnsigned: allowUnsigned,
+	}
+}
+
+// AllowsUnsignedDownload reports whether files can be downloaded without token or login (FILE_DOWNLOAD_ALLOW_UNSIGNED)
+func (s *FileService) AllowsUnsignedDownload() bool {
+	return s.downloads.allowUnsigned
+}
+
+// IssueDownloadToken issues a download token of a file and returns it with the signed token string.
+// Signed URL (cấp lại mỗi lần liệt kê artifact / tải ZIP) không lưu DB nên record = nil và không giới hạn lượt tải;
+// revoke bằng jti (RevokeDownloadToken). Share link được lưu vào download_tokens để revoke và đếm lượt tải.
+func (s *FileService) IssueDownloadToken(file *models.File, opts models.DownloadTokenOptions) (*models.DownloadToken, string, error) {
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = s.downloads.ttl
+	}
+	purpose := opts.Purpose
+	if purpose == "" {
+		purpose = models.DownloadTokenPurposeSigned
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	tokenID := uuid.NewString()
+	var record *models.DownloadToken
+	if purpose != models.DownloadTokenPurposeSigned {
+		record = &models.DownloadToken{
+			FileID:       file.ID,
+			UserID:       file.UserID,
+			Purpose:      purpose,
+			MaxDownloads: opts.MaxDownloads,
+			ExpiresAt:    expiresAt,
+		}
+		if opts.MachineID != "" {
+			machineID := opts.MachineID
+			record.MachineID = &machineID
+		}
+		if err := s.tokenRepo.Create(record); err != nil {
+			return nil, "", fmt.Errorf("failed to create download token: %w", err)
+		}
+		tokenID = record.ID
+	}
+
+	claims := &FileDownloadClaims{
+		FileID:    file.ID,
+		MachineID: opts.MachineID,
+		Purpose:   purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    downloadTokenIssuer,
+			Audience:  jwt.ClaimStrings{downloadTokenAudience},
+			Subject:   file.ID,
+		},
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.downloads.key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return record, tokenString, nil
+}
+
+// GenerateSignedDownloadURL generates a signed download URL with token for automation backend.
+// Token hết hạn sau FILE_DOWNLOAD_TOKEN_TTL_MINUTES, không lưu DB (revoke được qua revocation list). File trên S3: endpoint download
+// kiểm tra token rồi redirect tới presigned URL.
+func (s *FileService) GenerateSignedDownloadURL(fileID string) (string, error) {
+	// Verify file exists
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return "", fmt.Errorf("file not found: %w", err)
+	}
+
+	_, tokenString, err := s.IssueDownloadToken(file, models.DownloadTokenOptions{Purpose: models.DownloadTokenPurposeSigned})
+	if err != nil {
+		return "", err
+	}
+	return s.signedDownloadURL(file.ID, tokenString), nil
+}
+
+func (s *FileService) signedDownloadURL(fileID, tokenString string) string {
+	return fmt.Sprintf("%s?token=%s", s.GetDownloadURL(fileID), tokenString)
+}
+
+// parseDownloadToken verifies the signature, audience and expiry of a download token of a file
+func (s *FileService) parseDownloadToken(tokenString, fileID string) (*FileDownloadClaims, error) {
+	claims := &FileDownloadClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return s.downloads.key, nil
+	}, jwt.WithAudience(downloadTokenAudience), jwt.WithIssuer(downloadTokenIssuer))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrDownloadTokenExpired
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDownloadToken, err)
+	}
+	if claims.ID == "" || claims.FileID != fileID {
+		return nil, ErrInvalidDownloadToken
+	}
+	return claims, nil
+}
+
+// AuthorizeDownloadToken validates a download token for a file (không tính lượt tải, xem ConsumeDownloadToken).
+// machineID là machine đã xác thực của request ("" nếu không có). Signed URL hợp lệ trả về record nil.
+func (s *FileService) AuthorizeDownloadToken(tokenString, fileID, machineID string) (*models.DownloadToken, error) {
+	claims, err := s.parseDownloadToken(tokenString, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Signed URL: kiểm tra chữ ký, hạn, machine trong claims và revocation list theo jti
+	if claims.Purpose == models.DownloadTokenPurposeSigned {
+		if claims.MachineID != "" && claims.MachineID != machineID {
+			return nil, ErrDownloadTokenMachine
+		}
+		revoked, err := s.tokenRepo.IsRevoked(claims.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check download token revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrDownloadTokenRevoked
+		}
+		return nil, nil
+	}
+
+	// Revocation list / lượt tải lưu trong download_tokens
+	record, err := s.tokenRepo.GetByID(claims.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidDownloadToken
+		}
+		return nil, fmt.Errorf("failed to get download token: %w", err)
+	}
+	now := time.Now()
+	switch {
+	case record.FileID != fileID:
+		return nil, ErrInvalidDownloadToken
+	case record.RevokedAt != nil:
+		return nil, ErrDownloadTokenRevoked
+	case !record.ExpiresAt.After(now):
+		return nil, ErrDownloadTokenExpired
+	case record.MachineID != nil && *record.MachineID != machineID:
+		return nil, ErrDownloadTokenMachine
+	case record.MaxDownloads != nil && record.DownloadCount >= *record.MaxDownloads:
+		return nil, ErrDownloadLimitReached
+	}
+	return record, nil
+}
+
+// ConsumeDownloadToken counts one download of an authorized token.
+// Gọi cho mọi request trả nội dung file (kể cả Range và redirect tới presigned URL), chỉ HEAD và 304 không tính lượt tải.
+func (s *FileService) ConsumeDownloadToken(record *models.DownloadToken) (*models.DownloadToken, error) {
+	consumed, err := s.tokenRepo.Consume(record.ID, time.Now())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Bị revoke / dùng hết lượt bởi request khác ngay trước đó
+			return nil, ErrDownloadLimitReached
+		}
+		return nil, fmt.Errorf("failed to record download: %w", err)
+	}
+	return consumed, nil
+}
+
+// CreateShareLink creates a share link for a file of the user
+func (s *FileService) CreateShareLink(file *models.File, req *models.CreateShareLinkRequest) (*models.ShareLinkResponse, error) {
+	ttl := s.downloads.shareTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	if ttl > s.downloads.shareMaxTTL {
+		return nil, fmt.Errorf("%w: expires_in_hours must be at most %d", ErrInvalidShareLink, int(s.downloads.shareMaxTTL.Hours()))
+	}
+
+	maxDownloads := req.MaxDownloads
+	if req.SingleUse {
+		if maxDownloads != nil && *maxDownloads != 1 {
+			return nil, fmt.Errorf("%w: single_use conflicts with max_downloads", ErrInvalidShareLink)
+		}
+		one := 1
+		maxDownloads = &one
+	}
+
+	record, tokenString, err := s.IssueDownloadToken(file, models.DownloadTokenOptions{
+		Purpose:      models.DownloadTokenPurposeShare,
+		TTL:          ttl,
+		MaxDownloads: maxDownloads,
+		MachineID:    strings.TrimSpace(req.MachineID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := shareLinkToResponse(record)
+	response.URL = s.signedDownloadURL(file.ID, tokenString)
+	return &response, nil
+}
+
+// ListShareLinks retrieves the share links of a file (kể cả đã revoke / hết hạn, chờ cleanup)
+func (s *FileService) ListShareLinks(file *models.File) ([]models.ShareLinkResponse, error) {
+	records, err := s.tokenRepo.GetByFileID(file.ID, models.DownloadTokenPurposeShare)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share links: %w", err)
+	}
+	responses := make([]models.ShareLinkResponse, 0, len(records))
+	for _, record := range records {
+		responses = append(responses, shareLinkToResponse(record))
+	}
+	return responses, nil
+}
+
+// RevokeShareLink adds a share link of a file to the revocation list
+func (s *FileService) RevokeShareLink(file *models.File, linkID string) error {
+	if err := s.tokenRepo.Revoke(linkID, file.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrShareLinkNotFound
+		}
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	return nil
+}
+
+// RevokeDownloadToken revokes a download token of a file given its token string (signed URL hoặc share link).
+// Signed URL được thêm jti vào revocation list tới khi token hết hạn. Token đã hết hạn / đã revoke thì không cần làm gì.
+func (s *FileService) RevokeDownloadToken(file *models.File, tokenString, revokedBy string) error {
+	claims, err := s.parseDownloadToken(tokenString, file.ID)
+	if err != nil {
+		if errors.Is(err, ErrDownloadTokenExpired) {
+			return nil
+		}
+		return err
+	}
+
+	if claims.Purpose != models.DownloadTokenPurposeSigned {
+		if err := s.tokenRepo.Revoke(claims.ID, file.ID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to revoke download token: %w", err)
+		}
+		return nil
+	}
+
+	revocation := &models.RevokedDownloadToken{
+		TokenID:   claims.ID,
+		FileID:    file.ID,
+		RevokedBy: revokedBy,
+		ExpiresAt: claims.ExpiresAt.Time,
+		RevokedAt: time.Now(),
+	}
+	if err := s.tokenRepo.AddRevocation(revocation); err != nil {
+		return fmt.Errorf("failed to revoke download token: %w", err)
+	}
+	logrus.Infof("Signed download token %s of file %s revoked by %s", claims.ID, file.ID, revokedBy)
+	return nil
+}
+
+func shareLinkToResponse(record *models.DownloadToken) models.ShareLinkResponse {
+	active := record.RevokedAt == nil && record.ExpiresAt.After(time.Now()) &&
+		(record.MaxDownloads == nil || record.DownloadCount < *record.MaxDownloads)
+	return models.ShareLinkResponse{DownloadToken: *record, Active: active}
+}
+
+// CleanupExpiredDownloadTokens deletes expired download tokens (token hết hạn không dùng được nữa, kể cả khi đã revoke)
+func (s *FileService) CleanupExpiredDownloadTokens() {
+	deleted, err := s.tokenRepo.DeleteExpiredBefore(time.Now())
+	if err != nil {
+		logrus.Errorf("Failed to delete expired download tokens: %v", err)
+		return
+	}
+	if deleted > 0 {
+		logrus.Infof("Download token cleanup: removed %d expired tokens", deleted)
+	}
+}
+
+// StartDownloadTokenCleanupJob periodically deletes expired download tokens
+func (s *FileService) StartDownloadTokenCleanupJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		s.CleanupExpiredDownloadTokens()
+		for range ticker.C {
+			s.CleanupExpiredDownloadTokens()
+		}
+	}()
+	logrus.Infof("Download token cleanup job started (interval: %v, signed URL ttl: %v)", interval, s.downloads.ttl)
+}
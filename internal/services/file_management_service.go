@@ -0,0 +1,260 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrFileReferenced is returned when deleting a file still used as input by script prompts
+	ErrFileReferenced = errors.New("file is referenced by script prompts")
+	// ErrInvalidFileMetadata is returned when name/folder/tags of a file are invalid
+	ErrInvalidFileMetadata = errors.New("invalid file metadata")
+)
+
+const (
+	maxFileTags      = 20
+	maxFileTagLength = 50
+)
+
+// FileManagementService handles rename / move / tag / delete of user files.
+// Prompt tham chiếu file qua input_file_refs: ghim theo file_id, hoặc mode latest (file mới nhất cùng tên),
+// nên đổi tên / xóa file phải kiểm tra các prompt đang dùng file đó.
+type FileManagementService struct {
+	fileService *FileService
+	fileRepo    *repository.FileRepository
+	scriptRepo  *repository.ScriptRepository
+}
+
+func NewFileManagementService(fileService *FileService, fileRepo *repository.FileRepository, scriptRepo *repository.ScriptRepository) *FileManagementService {
+	return &FileManagementService{
+		fileService: fileService,
+		fileRepo:    fileRepo,
+		scriptRepo:  scriptRepo,
+	}
+}
+
+// ListFiles retrieves a user's files matching the filter
+func (s *FileManagementService) ListFiles(userID string, filter models.FileListFilter) ([]*models.File, error) {
+	if filter.Folder != nil {
+		folder, err := normalizeFileFolder(*filter.Folder)
+		if err != nil {
+			return nil, err
+		}
+		filter.Folder = &folder
+	}
+	filter.Tag = strings.ToLower(strings.TrimSpace(filter.Tag))
+	filter.Search = strings.TrimSpace(filter.Search)
+	filter.MimeType = strings.ToLower(strings.TrimSpace(filter.MimeType))
+	return s.fileRepo.GetByUserIDWithFilter(userID, filter)
+}
+
+// ListFolders retrieves the virtual folders of a user
+func (s *FileManagementService) ListFolders(userID string) ([]*models.FileFolderResponse, error) {
+	return s.fileRepo.GetFoldersByUserID(userID)
+}
+
+// ListTags retrieves the tags used by a user's files
+func (s *FileManagementService) ListTags(userID string) ([]*models.FileTagResponse, error) {
+	return s.fileRepo.GetTagsByUserID(userID)
+}
+
+// GetReferences retrieves the script prompts resolving their input files to this file.
+// Tham chiếu theo tên chỉ tính khi file là bản mới nhất cùng tên; tham chiếu ghim theo ID luôn tính.
+func (s *FileManagementService) GetReferences(file *models.File) ([]*models.FileReference, error) {
+	references, err := s.scriptRepo.GetInputFileReferences(file.UserID, file.ID, file.OriginalName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file references: %w", err)
+	}
+
+	isLatest := true
+	latest, err := s.fileRepo.GetLatestByUserIDAndOriginalName(file.UserID, file.OriginalName)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get file by name: %w", err)
+	}
+	if latest != nil && latest.ID != file.ID {
+		isLatest = false
+	}
+
+	result := make([]*models.FileReference, 0, len(references))
+	for _, reference := range references {
+		if reference.Mode == models.PromptInputFileModeFile || isLatest {
+			result = append(result, reference)
+		}
+	}
+	return result, nil
+}
+
+// DeleteFile deletes a file of a user. File đang được prompt tham chiếu chỉ xóa được khi force = true.
+// Returns the references (kể cả khi bị từ chối) để client hiển thị.
+func (s *FileManagementService) DeleteFile(userID, fileID string, force bool) ([]*models.FileReference, error) {
+	file, err := s.fileService.GetFile(fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	references, err := s.GetReferences(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(references) > 0 && !force {
+		return references, fmt.Errorf("%w: %d prompts use %q as input", ErrFileReferenced, len(references), file.OriginalName)
+	}
+
+	if err := s.fileService.DeleteFile(file); err != nil {
+		return references, err
+	}
+	if len(references) > 0 {
+		logrus.Warnf("Deleted file %s (%s) still referenced by %d prompts", file.ID, file.OriginalName, len(references))
+	}
+	return references, nil
+}
+
+// UpdateFile renames, moves or tags a file of a user.
+// Đổi tên: prompt ghim theo ID giữ nguyên file; prompt theo tên được cập nhật sang tên mới nếu UpdateReferences,
+// nếu không thì trả về cảnh báo.
+func (s *FileManagementService) UpdateFile(userID, fileID string, req *models.UpdateFileRequest) (*models.File, *models.UpdateFileResponse, error) {
+	file, err := s.fileService.GetFile(fileID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &models.UpdateFileResponse{}
+	updates := make(map[string]interface{})
+	var rename *repository.FileRename
+
+	if req.Folder != nil {
+		folder, err := normalizeFileFolder(*req.Folder)
+		if err != nil {
+			return nil, nil, err
+		}
+		updates["folder"] = folder
+	}
+	if req.Tags != nil {
+		tags, err := normalizeFileTags(*req.Tags)
+		if err != nil {
+			return nil, nil, err
+		}
+		updates["tags"] = tags
+	}
+
+	if req.OriginalName != nil && strings.TrimSpace(*req.OriginalName) != file.OriginalName {
+		newName, err := normalizeFileName(*req.OriginalName)
+		if err != nil {
+			return nil, nil, err
+		}
+		updates["original_name"] = newName
+		rename = &repository.FileRename{OldName: file.OriginalName, NewName: newName}
+
+		references, err := s.GetReferences(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.References = derefFileReferences(references)
+
+		// Prompt ghim theo file_id vẫn dùng file này (chỉ đổi tên hiển thị); prompt theo tên cần cập nhật
+		seen := make(map[string]bool)
+		byName := 0
+		for _, reference := range references {
+			if reference.Mode == models.PromptInputFileModeFile {
+				continue
+			}
+			byName++
+			if !seen[reference.PromptID] {
+				seen[reference.PromptID] = true
+				rename.PromptIDs = append(rename.PromptIDs, reference.PromptID)
+			}
+		}
+		if byName > 0 && !req.UpdateReferences {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%d prompts use %q as latest input file; they will resolve to another file with that name or fail to find it. Set update_references to rename them.", byName, file.OriginalName))
+			rename.PromptIDs = nil
+		}
+
+		// Mode latest resolve theo file mới nhất cùng tên: file khác mới hơn tên newName sẽ được dùng thay file này
+		if existing, err := s.fileRepo.GetLatestByUserIDAndOriginalName(userID, newName); err == nil && existing.CreatedAt.After(file.CreatedAt) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("A newer file named %q exists; prompts using the latest file with this name resolve to the newer file.", newName))
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := s.fileRepo.UpdateMetadata(file.ID, updates, rename); err != nil {
+			return nil, nil, fmt.Errorf("failed to update file: %w", err)
+		}
+		result.ReferencesUpdated = rename != nil && len(rename.PromptIDs) > 0
+		if result.ReferencesUpdated {
+			logrus.Infof("Renamed file %s from %q to %q and updated %d prompts", file.ID, rename.OldName, rename.NewName, len(rename.PromptIDs))
+		}
+	}
+
+	updated, err := s.fileService.GetFile(file.ID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return updated, result, nil
+}
+
+// normalizeFileName validates a new original name (không chứa dấu phân cách thư mục)
+func normalizeFileName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return "", fmt.Errorf("%w: file name must not be empty or contain path separators", ErrInvalidFileMetadata)
+	}
+	if len(name) > 255 {
+		return "", fmt.Errorf("%w: file name must be at most 255 bytes", ErrInvalidFileMetadata)
+	}
+	return name, nil
+}
+
+// normalizeFileFolder cleans a virtual folder path ("/a//b/" → "a/b", "" hoặc "/" = thư mục gốc)
+func normalizeFileFolder(folder string) (string, error) {
+	folder = strings.TrimSpace(strings.ReplaceAll(folder, "\\", "/"))
+	if folder == "" || folder == "/" {
+		return "", nil
+	}
+	for _, segment := range strings.Split(folder, "/") {
+		if segment == ".." || segment == "." {
+			return "", fmt.Errorf("%w: folder must not contain . or .. segments", ErrInvalidFileMetadata)
+		}
+	}
+	folder = strings.Trim(path.Clean("/"+folder), "/")
+	if len(folder) > 500 {
+		return "", fmt.Errorf("%w: folder must be at most 500 bytes", ErrInvalidFileMetadata)
+	}
+	return folder, nil
+}
+
+// normalizeFileTags lowercases, trims and deduplicates tags
+func normalizeFileTags(tags []string) (models.StringArray, error) {
+	result := make(models.StringArray, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > maxFileTagLength {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidFileMetadata, tag, maxFileTagLength)
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxFileTags {
+		return nil, fmt.Errorf("%w: at most %d tags per file", ErrInvalidFileMetadata, maxFileTags)
+	}
+	return result, nil
+}
+
+func derefFileReferences(references []*models.FileReference) []models.FileReference {
+	result := make([]models.FileReference, 0, len(references))
+	for _, reference := range references {
+		result = append(result, *reference)
+	}
+	return result
+}
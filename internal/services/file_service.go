@@ -1,58 +1,89 @@
 package services
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services/storage"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type FileService struct {
-	fileRepo   *repository.FileRepository
-	baseURL    string
-	storageDir string
-	jwtSecret  []byte
+	fileRepo    *repository.FileRepository
+	blobRepo    *repository.FileBlobRepository
+	quotas      *StorageQuotaService // Quota / max file size / mime types áp dụng cho mọi file lưu qua StoreFile
+	baseURL     string
+	blobs       *storage.Resolver // Backend lưu nội dung file (local disk / S3), resolve theo File.FilePath
+	blobGCGrace time.Duration     // Blob không còn file nào tham chiếu được giữ thêm khoảng này trước khi xóa
+	tokenRepo   *repository.DownloadTokenRepository
+	downloads   downloadTokenConfig // Signed download URL / share link
+	textRepo    *repository.FileTextRepository
+	texts       *fileTextExtractor // Trích xuất text khi upload (preview, đếm ký tự / token)
 }
 
-// FileDownloadClaims represents JWT claims for file download token
-type FileDownloadClaims struct {
-	FileID string `json:"file_id"`
-	jwt.RegisteredClaims
-}
+// fileDownloadURLExpiry is the lifetime of presigned URLs (S3) returned once a download is authorized
+const fileDownloadURLExpiry = 15 * time.Minute
+
+const (
+	defaultFileBlobGCGraceHours = 24
+	fileBlobGCBatchSize         = 100
+)
 
-func NewFileService(fileRepo *repository.FileRepository, baseURL string) *FileService {
+// NewFileService creates a file service.
+// Blob GC grace period: FILE_BLOB_GC_GRACE_HOURS (default 24 giờ).
+// Download token / share link: xem newDownloadTokenConfig. Trích xuất text: xem newFileTextExtractor.
+func NewFileService(fileRepo *repository.FileRepository, blobRepo *repository.FileBlobRepository, tokenRepo *repository.DownloadTokenRepository, textRepo *repository.FileTextRepository, quotas *StorageQuotaService, baseURL string) *FileService {
 	// Default storage directory
-	storageDir := os.Getenv("FILE_STORAGE_DIR")
-	if storageDir == "" {
-		storageDir = "./storage/files"
-	}
+	storageDir := getEnv("FILE_STORAGE_DIR", "./storage/files")
 
 	// Create storage directory if it doesn't exist
 	if err := os.MkdirAll(storageDir, 0755); err != nil {
 		logrus.Warnf("Failed to create storage directory %s: %v", storageDir, err)
 	}
 
-	// Get JWT secret for signing download tokens
-	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
-	if len(jwtSecret) == 0 {
-		jwtSecret = []byte("default-secret-key-change-in-production")
-		logrus.Warn("JWT_SECRET not set, using default secret for file download tokens")
+	// Local disk luôn được cấu hình để đọc file cũ lưu trên disk
+	local := storage.NewFilesystemStore(storageDir)
+
+	// Backend nhận file mới: FILE_STORAGE_BACKEND (local | s3)
+	var primary storage.BlobStore = local
+	if backend := getEnv("FILE_STORAGE_BACKEND", storage.BackendLocal); backend != storage.BackendLocal {
+		store, err := storage.NewBlobStore(backend)
+		if err != nil {
+			logrus.Errorf("Failed to initialize %s file storage, falling back to local disk: %v", backend, err)
+		} else {
+			primary = store
+		}
+	}
+
+	graceHours := defaultFileBlobGCGraceHours
+	if value, err := strconv.Atoi(getEnv("FILE_BLOB_GC_GRACE_HOURS", "")); err == nil && value >= 0 {
+		graceHours = value
 	}
 
 	return &FileService{
-		fileRepo:   fileRepo,
-		baseURL:    baseURL,
-		storageDir: storageDir,
-		jwtSecret:  jwtSecret,
+		fileRepo:    fileRepo,
+		blobRepo:    blobRepo,
+		quotas:      quotas,
+		baseURL:     baseURL,
+		blobs:       storage.NewResolver(primary, local),
+		blobGCGrace: time.Duration(graceHours) * time.Hour,
+		tokenRepo:   tokenRepo,
+		downloads:   newDownloadTokenConfig(),
+		textRepo:    textRepo,
+		texts:       newFileTextExtractor(),
 	}
 }
 
@@ -65,49 +96,24 @@ func (s *FileService) UploadFile(userID string, fileHeader *multipart.FileHeader
 	}
 	defer file.Close()
 
-	// Generate unique filename
-	fileID := uuid.New().String()
-	ext := filepath.Ext(fileHeader.Filename)
-	fileName := fileID + ext
-	originalName := fileHeader.Filename
-
-	// Create user-specific directory
-	userDir := filepath.Join(s.storageDir, userID)
-	if err := os.MkdirAll(userDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create user directory: %w", err)
-	}
-
-	// Full file path
-	filePath := filepath.Join(userDir, fileName)
-
-	// Create destination file
-	dst, err := os.Create(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create destination file: %w", err)
-	}
-	defer dst.Close()
-
-	// Copy file content
-	fileSize, err := io.Copy(dst, file)
+	fileModel, err := newUploadedFile(userID, fileHeader.Filename, fileHeader.Header.Get("Content-Type"), req)
 	if err != nil {
-		os.Remove(filePath) // Clean up on error
-		return nil, fmt.Errorf("failed to save file: %w", err)
+		return nil, err
 	}
 
-	// Get MIME type
-	mimeType := fileHeader.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
+	if err := s.StoreFile(fileModel, file, fileHeader.Size); err != nil {
+		return nil, err
 	}
+	return fileModel, nil
+}
 
-	// Create file record in database
+// newUploadedFile builds the record of a file uploaded by a user (chưa lưu nội dung)
+func newUploadedFile(userID, originalName, mimeType string, req *models.FileUploadRequest) (*models.File, error) {
 	fileModel := &models.File{
 		UserID:       userID,
-		FileName:     fileName,
 		OriginalName: originalName,
 		MimeType:     mimeType,
-		FileSize:     fileSize,
-		FilePath:     filePath,
+		Source:       models.FileSourceUpload,
 	}
 	// Dùng pointer để GORM xử lý nullable đúng cách
 	if req.ProjectID != "" {
@@ -116,13 +122,267 @@ func (s *FileService) UploadFile(userID string, fileHeader *multipart.FileHeader
 	if req.PromptID != "" {
 		fileModel.TempPromptID = &req.PromptID
 	}
+	if req.Folder != "" {
+		folder, err := normalizeFileFolder(req.Folder)
+		if err != nil {
+			return nil, err
+		}
+		fileModel.Folder = folder
+	}
+	if len(req.Tags) > 0 {
+		tags, err := normalizeFileTags(req.Tags)
+		if err != nil {
+			return nil, err
+		}
+		fileModel.Tags = tags
+	}
+	return fileModel, nil
+}
 
-	if err := s.fileRepo.Create(fileModel); err != nil {
-		os.Remove(filePath) // Clean up on error
-		return nil, fmt.Errorf("failed to save file record: %w", err)
+// StoreFile stores content (deduplicated by SHA-256) and creates the file record.
+// fileModel cần có UserID, OriginalName; FileName/FilePath/FileSize/BlobHash được gán ở đây. size = -1 nếu chưa biết.
+// Nội dung được hash trong lúc stream vào file tạm; trùng hash với blob đã có thì chỉ tạo record trỏ tới blob đó.
+// Quota của user được kiểm tra trước và trong lúc stream (dừng ngay khi vượt giới hạn).
+func (s *FileService) StoreFile(fileModel *models.File, content io.Reader, size int64) error {
+	content, err := s.quotas.LimitUpload(fileModel.UserID, fileModel.OriginalName, &fileModel.MimeType, content, size)
+	if err != nil {
+		return err
 	}
 
-	return fileModel, nil
+	// Get MIME type
+	if fileModel.MimeType == "" {
+		fileModel.MimeType = "application/octet-stream"
+	}
+	if fileModel.Source == "" {
+		fileModel.Source = models.FileSourceUpload
+	}
+
+	// Stream vào file tạm + hash (cần hash trước khi biết blob đã tồn tại chưa)
+	tmp, err := os.CreateTemp("", "file-upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	written, err := io.Copy(tmp, io.TeeReader(content, hasher))
+	if err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("failed to save file: size mismatch: expected %d bytes, got %d", size, written)
+	}
+
+	// Key theo hash: blobs/{2 ký tự đầu}/{sha256}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	store := s.blobs.Primary()
+	key := "blobs/" + hash[:2] + "/" + hash
+	blob := &models.FileBlob{
+		Hash:     hash,
+		Size:     written,
+		MimeType: fileModel.MimeType,
+		Location: store.Location(key),
+	}
+
+	// FileName vẫn unique theo record (giữ extension gốc)
+	fileModel.FileName = uuid.New().String() + filepath.Ext(fileModel.OriginalName)
+
+	// Upload ngoài transaction (file lớn có thể mất vài phút), sau đó transaction ngắn chỉ tạo record / tăng ref_count.
+	// Blob đã có thì không upload lại.
+	stored := false
+	storeBlob := func() error {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read temp file: %w", err)
+		}
+		if _, err := store.Put(key, tmp, written, fileModel.MimeType); err != nil {
+			return fmt.Errorf("failed to store file content: %w", err)
+		}
+		stored = true
+		return nil
+	}
+
+	if _, err := s.blobRepo.GetByHash(hash); err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to check file blob: %w", err)
+		}
+		if err := storeBlob(); err != nil {
+			return err
+		}
+	}
+
+	reused, err := s.fileRepo.CreateWithBlob(fileModel, blob, stored)
+	if errors.Is(err, repository.ErrBlobNotStored) {
+		// Blob bị GC xóa sau khi kiểm tra: upload rồi tạo lại
+		if err := storeBlob(); err != nil {
+			return err
+		}
+		reused, err = s.fileRepo.CreateWithBlob(fileModel, blob, stored)
+	}
+	if err != nil {
+		if stored {
+			// Không xóa trực tiếp (upload song song có thể đang dùng cùng blob), để GC dọn
+			if releaseErr := s.blobRepo.ReleaseOrphan(blob); releaseErr != nil {
+				logrus.Warnf("Failed to record orphan blob %s: %v", hash, releaseErr)
+			}
+		}
+		return fmt.Errorf("failed to save file record: %w", err)
+	}
+
+	if reused {
+		logrus.Debugf("File %s (%s) deduplicated to existing blob %s", fileModel.ID, fileModel.OriginalName, hash)
+	}
+	s.extractTextAsync(fileModel)
+	return nil
+}
+
+// CollectUnreferencedBlobs deletes blobs no longer referenced by any file (sau grace period)
+func (s *FileService) CollectUnreferencedBlobs() {
+	if synced, err := s.blobRepo.SyncRefCounts(); err != nil {
+		logrus.Errorf("Failed to sync blob ref counts: %v", err)
+		return
+	} else if synced > 0 {
+		logrus.Infof("Synced ref_count of %d file blobs", synced)
+	}
+
+	before := time.Now().Add(-s.blobGCGrace)
+	collected := 0
+	var freed int64
+	for {
+		blobs, err := s.blobRepo.GetUnreferenced(before, fileBlobGCBatchSize)
+		if err != nil {
+			logrus.Errorf("Failed to get unreferenced file blobs: %v", err)
+			return
+		}
+
+		progress := false
+		for _, candidate := range blobs {
+			deleted, err := s.blobRepo.DeleteUnreferenced(candidate.Hash, before, func(blob *models.FileBlob) error {
+				store, key, err := s.blobs.Resolve(blob.Location)
+				if err != nil {
+					return err
+				}
+				return store.Delete(key)
+			})
+			if err != nil {
+				logrus.Errorf("Failed to delete file blob %s: %v", candidate.Hash, err)
+				continue
+			}
+			if deleted {
+				progress = true
+				collected++
+				freed += candidate.Size
+			}
+		}
+
+		if len(blobs) < fileBlobGCBatchSize || !progress {
+			break
+		}
+	}
+
+	if collected > 0 {
+		logrus.Infof("File blob GC completed: deleted %d blobs (%d bytes)", collected, freed)
+	}
+}
+
+// StartBlobGCJob periodically deletes unreferenced blobs
+func (s *FileService) StartBlobGCJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		s.CollectUnreferencedBlobs()
+		for range ticker.C {
+			s.CollectUnreferencedBlobs()
+		}
+	}()
+	logrus.Infof("File blob GC job started (interval: %v, grace period: %v)", interval, s.blobGCGrace)
+}
+
+// DeleteFile deletes a file record. Nội dung dedup (blob) được GC xóa khi không còn file nào tham chiếu,
+// file cũ lưu riêng (không có blob) thì xóa luôn trong storage.
+func (s *FileService) DeleteFile(file *models.File) error {
+	if err := s.fileRepo.Delete(file.ID); err != nil {
+		return fmt.Errorf("failed to delete file record: %w", err)
+	}
+	if file.BlobHash != nil {
+		return nil
+	}
+
+	store, key, err := s.blobs.Resolve(file.FilePath)
+	if err == nil {
+		err = store.Delete(key)
+	}
+	if err != nil {
+		logrus.Warnf("Deleted file record %s but failed to delete content %s: %v", file.ID, file.FilePath, err)
+	}
+	return nil
+}
+
+// OpenFileContent streams the content of a file from its storage backend
+func (s *FileService) OpenFileContent(file *models.File) (io.ReadCloser, error) {
+	store, key, err := s.blobs.Resolve(file.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	return store.Open(key)
+}
+
+// PresignedDownloadURL returns a presigned URL of the storage backend (S3), ok = false nếu backend không hỗ trợ (local disk)
+func (s *FileService) PresignedDownloadURL(file *models.File) (string, bool) {
+	store, key, err := s.blobs.Resolve(file.FilePath)
+	if err != nil {
+		return "", false
+	}
+	presignedURL, err := store.PresignGetURL(key, file.OriginalName, fileDownloadURLExpiry)
+	if err != nil {
+		if !errors.Is(err, storage.ErrPresignNotSupported) {
+			logrus.Warnf("Failed to presign download URL for file %s: %v", file.ID, err)
+		}
+		return "", false
+	}
+	return presignedURL, true
+}
+
+// GetExecutionOutputs retrieves the output files uploaded by machines for an execution
+func (s *FileService) GetExecutionOutputs(executionID string) ([]*models.File, error) {
+	return s.fileRepo.GetByExecutionID(executionID)
+}
+
+// GetFileByID retrieves a file by ID without ownership check
+func (s *FileService) GetFileByID(fileID string) (*models.File, error) {
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	return file, nil
+}
+
+// GetLatestFileByName retrieves the newest file of a user with the given original name
+func (s *FileService) GetLatestFileByName(userID, originalName string) (*models.File, error) {
+	file, err := s.fileRepo.GetLatestByUserIDAndOriginalName(userID, originalName)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	return file, nil
+}
+
+// GetFileVersions retrieves the version history of a file: các file cùng original_name của owner, bản cũ nhất = version 1
+func (s *FileService) GetFileVersions(file *models.File) ([]models.FileVersionResponse, error) {
+	files, err := s.fileRepo.GetVersionsByUserIDAndOriginalName(file.UserID, file.OriginalName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file versions: %w", err)
+	}
+
+	versions := make([]models.FileVersionResponse, 0, len(files))
+	for i, f := range files {
+		versions = append(versions, models.FileVersionResponse{
+			Version:  i + 1,
+			IsLatest: i == len(files)-1,
+			File:     s.FileToResponse(f),
+		})
+	}
+	return versions, nil
 }
 
 // GetFile retrieves a file by ID
@@ -141,14 +401,14 @@ func (s *FileService) GetFile(fileID string, userID string) (*models.File, error
 }
 
 // DownloadFile returns the file content for download (requires user authentication)
-func (s *FileService) DownloadFile(fileID string, userID string) (*models.File, *os.File, error) {
+func (s *FileService) DownloadFile(fileID string, userID string) (*models.File, io.ReadCloser, error) {
 	file, err := s.GetFile(fileID, userID)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// Open file from storage
-	f, err := os.Open(file.FilePath)
+	f, err := s.OpenFileContent(file)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open file: %w", err)
 	}
@@ -157,7 +417,7 @@ func (s *FileService) DownloadFile(fileID string, userID string) (*models.File,
 }
 
 // DownloadFileByToken returns the file content for download using token (no user check)
-func (s *FileService) DownloadFileByToken(fileID string) (*models.File, *os.File, error) {
+func (s *FileService) DownloadFileByToken(fileID string) (*models.File, io.ReadCloser, error) {
 	// Get file without user check (token already validated)
 	file, err := s.fileRepo.GetByID(fileID)
 	if err != nil {
@@ -165,7 +425,7 @@ func (s *FileService) DownloadFileByToken(fileID string) (*models.File, *os.File
 	}
 
 	// Open file from storage
-	f, err := os.Open(file.FilePath)
+	f, err := s.OpenFileContent(file)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open file: %w", err)
 	}
@@ -178,58 +438,6 @@ func (s *FileService) GetDownloadURL(fileID string) string {
 	return fmt.Sprintf("%s/api/v1/files/%s/download", strings.TrimSuffix(s.baseURL, "/"), fileID)
 }
 
-// GenerateSignedDownloadURL generates a signed download URL with token for automation backend
-// Token expires in 1 hour by default
-func (s *FileService) GenerateSignedDownloadURL(fileID string) (string, error) {
-	// Verify file exists
-	file, err := s.fileRepo.GetByID(fileID)
-	if err != nil {
-		return "", fmt.Errorf("file not found: %w", err)
-	}
-
-	// Create JWT token with file ID
-	claims := &FileDownloadClaims{
-		FileID: file.ID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)), // Token expires in 1 hour
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "green-provider-services-backend",
-			Subject:   file.ID,
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.jwtSecret)
-	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %w", err)
-	}
-
-	// Generate signed URL with token in query param
-	downloadURL := fmt.Sprintf("%s/api/v1/files/%s/download?token=%s", strings.TrimSuffix(s.baseURL, "/"), fileID, tokenString)
-	return downloadURL, nil
-}
-
-// ValidateDownloadToken validates a download token and returns the file ID
-func (s *FileService) ValidateDownloadToken(tokenString string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &FileDownloadClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.jwtSecret, nil
-	})
-
-	if err != nil {
-		return "", fmt.Errorf("invalid token: %w", err)
-	}
-
-	if claims, ok := token.Claims.(*FileDownloadClaims); ok && token.Valid {
-		return claims.FileID, nil
-	}
-
-	return "", fmt.Errorf("invalid token claims")
-}
-
 // GetUserFiles retrieves all files for a user
 func (s *FileService) GetUserFiles(userID string) ([]*models.File, error) {
 	return s.fileRepo.GetByUserID(userID)
@@ -253,14 +461,23 @@ func (s *FileService) ClearFilesProjectAndPrompt(userID, projectID, tempPromptID
 // FileToResponse converts File model to FileResponse
 func (s *FileService) FileToResponse(file *models.File) models.FileResponse {
 	return models.FileResponse{
-		ID:           file.ID,
-		UserID:       file.UserID,
-		FileName:     file.FileName,
-		OriginalName: file.OriginalName,
-		MimeType:     file.MimeType,
-		FileSize:     file.FileSize,
-		DownloadURL:  s.GetDownloadURL(file.ID),
-		CreatedAt:    file.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:    file.UpdatedAt.Format(time.RFC3339),
+		ID:             file.ID,
+		UserID:         file.UserID,
+		FileName:       file.FileName,
+		OriginalName:   file.OriginalName,
+		MimeType:       file.MimeType,
+		FileSize:       file.FileSize,
+		BlobHash:       file.BlobHash,
+		Folder:         file.Folder,
+		Tags:           append([]string{}, file.Tags...),
+		DownloadURL:    s.GetDownloadURL(file.ID),
+		Source:         file.Source,
+		ExecutionID:    file.ExecutionID,
+		ProjectID:      file.ProjectID,
+		ScriptPromptID: file.ScriptPromptID,
+		OutputName:     file.OutputName,
+		MachineID:      file.MachineID,
+		CreatedAt:      file.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      file.UpdatedAt.Format(time.RFC3339),
 	}
 }
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// FileStorageMigrationOptions configures MigrateFileStorage
+type FileStorageMigrationOptions struct {
+	BatchSize    int  // Số file đọc mỗi query (default 100)
+	DryRun       bool // Chỉ liệt kê file sẽ chuyển, không copy/update
+	DeleteSource bool // Xóa blob ở backend nguồn sau khi đã update File.FilePath
+}
+
+// FileStorageMigrationStats summarizes a migration run
+type FileStorageMigrationStats struct {
+	Scanned  int
+	Migrated int
+	Skipped  int // File không nằm ở backend nguồn (đã chuyển hoặc ở backend khác)
+	Failed   int
+	Bytes    int64
+}
+
+// MigrateFileStorage copies every blob and file stored in from to to and updates their location.
+// Từng blob/file: copy (stream) → update location → (tùy chọn) xóa ở nguồn; lỗi 1 file không dừng cả job,
+// chạy lại lệnh sẽ chỉ xử lý file còn ở backend nguồn.
+func MigrateFileStorage(fileRepo *repository.FileRepository, blobRepo *repository.FileBlobRepository, from, to storage.BlobStore, options FileStorageMigrationOptions) (*FileStorageMigrationStats, error) {
+	if from.Name() == to.Name() {
+		return nil, fmt.Errorf("source and destination backends are the same (%s)", from.Name())
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+
+	stats := &FileStorageMigrationStats{}
+	if err := migrateBlobs(blobRepo, from, to, options, stats); err != nil {
+		return stats, err
+	}
+
+	// File cũ (trước dedup) lưu riêng tại FilePath
+	afterID := ""
+	for {
+		files, err := fileRepo.GetBatchAfterID(afterID, options.BatchSize)
+		if err != nil {
+			return stats, fmt.Errorf("failed to list files: %w", err)
+		}
+		if len(files) == 0 {
+			break
+		}
+		afterID = files[len(files)-1].ID
+
+		for _, file := range files {
+			if file.BlobHash != nil {
+				continue // Đã chuyển cùng blob
+			}
+			stats.Scanned++
+			key, ok := from.KeyFromLocation(file.FilePath)
+			if !ok {
+				stats.Skipped++
+				continue
+			}
+			if options.DryRun {
+				logrus.Infof("[dry-run] Would migrate file %s (%s, %d bytes): %s -> %s", file.ID, file.OriginalName, file.FileSize, file.FilePath, to.Location(key))
+				stats.Migrated++
+				stats.Bytes += file.FileSize
+				continue
+			}
+
+			size, err := copyBlob(from, to, key, file.FileSize, file.MimeType)
+			if err != nil {
+				logrus.Errorf("Failed to migrate file %s (%s): %v", file.ID, file.FilePath, err)
+				stats.Failed++
+				continue
+			}
+			if err := fileRepo.UpdateFilePath(file.ID, to.Location(key)); err != nil {
+				logrus.Errorf("Failed to update path of file %s: %v", file.ID, err)
+				to.Delete(key) // Record vẫn trỏ về nguồn
+				stats.Failed++
+				continue
+			}
+			if options.DeleteSource {
+				if err := from.Delete(key); err != nil {
+					logrus.Warnf("Migrated file %s but failed to delete source %s: %v", file.ID, file.FilePath, err)
+				}
+			}
+
+			stats.Migrated++
+			stats.Bytes += size
+			logrus.Infof("Migrated file %s (%d bytes): %s -> %s", file.ID, size, file.FilePath, to.Location(key))
+		}
+	}
+
+	return stats, nil
+}
+
+// migrateBlobs moves content-addressed blobs, FilePath của mọi file trỏ tới blob được cập nhật cùng lúc
+func migrateBlobs(blobRepo *repository.FileBlobRepository, from, to storage.BlobStore, options FileStorageMigrationOptions, stats *FileStorageMigrationStats) error {
+	afterHash := ""
+	for {
+		blobs, err := blobRepo.GetBatchAfterHash(afterHash, options.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list file blobs: %w", err)
+		}
+		if len(blobs) == 0 {
+			return nil
+		}
+		afterHash = blobs[len(blobs)-1].Hash
+
+		for _, blob := range blobs {
+			stats.Scanned++
+			key, ok := from.KeyFromLocation(blob.Location)
+			if !ok {
+				stats.Skipped++
+				continue
+			}
+			if options.DryRun {
+				logrus.Infof("[dry-run] Would migrate blob %s (%d files, %d bytes): %s -> %s", blob.Hash, blob.RefCount, blob.Size, blob.Location, to.Location(key))
+				stats.Migrated++
+				stats.Bytes += blob.Size
+				continue
+			}
+
+			size, err := copyBlob(from, to, key, blob.Size, blob.MimeType)
+			if err != nil {
+				logrus.Errorf("Failed to migrate blob %s (%s): %v", blob.Hash, blob.Location, err)
+				stats.Failed++
+				continue
+			}
+			if err := blobRepo.UpdateLocation(blob.Hash, to.Location(key)); err != nil {
+				logrus.Errorf("Failed to update location of blob %s: %v", blob.Hash, err)
+				to.Delete(key) // Record vẫn trỏ về nguồn
+				stats.Failed++
+				continue
+			}
+			if options.DeleteSource {
+				if err := from.Delete(key); err != nil {
+					logrus.Warnf("Migrated blob %s but failed to delete source %s: %v", blob.Hash, blob.Location, err)
+				}
+			}
+
+			stats.Migrated++
+			stats.Bytes += size
+			logrus.Infof("Migrated blob %s (%d bytes): %s -> %s", blob.Hash, size, blob.Location, to.Location(key))
+		}
+	}
+}
+
+// copyBlob streams a blob from one backend to another (size từ DB, lệch size thì Put báo lỗi)
+func copyBlob(from, to storage.BlobStore, key string, size int64, contentType string) (int64, error) {
+	src, err := from.Open(key)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	return to.Put(key, src, size, contentType)
+}
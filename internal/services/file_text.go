@@ -0,0 +1,237 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/onegreenvn/green-provider-services-backend/internal/services/textextract"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultFileTextMaxKB        = 1024
+	defaultFileTextExtractMaxMB = 50
+	defaultFileTextWorkers      = 2
+	// DefaultFilePreviewKB is the preview size when max_kb is not given
+	DefaultFilePreviewKB = 16
+)
+
+// errFileContentUnavailable wraps storage errors (không lưu status failed cho lỗi tạm thời)
+var errFileContentUnavailable = errors.New("file content unavailable")
+
+// fileTextExtractor holds the text extraction config and the background workers
+type fileTextExtractor struct {
+	maxBytes    int   // Text lưu tối đa (FILE_TEXT_MAX_KB)
+	maxFileSize int64 // File lớn hơn không trích xuất (FILE_TEXT_EXTRACT_MAX_MB)
+	workers     chan struct{}
+	inflight    sync.Map // file ID → đang trích xuất
+}
+
+// newFileTextExtractor reads the text extraction config from env:
+// FILE_TEXT_MAX_KB (default 1024): dung lượng text lưu cho mỗi file (preview tối đa), đếm ký tự vẫn trên toàn bộ nội dung.
+// FILE_TEXT_EXTRACT_MAX_MB (default 50): file lớn hơn không trích xuất.
+// FILE_TEXT_EXTRACT_WORKERS (default 2): số file trích xuất song song sau khi upload.
+func newFileTextExtractor() *fileTextExtractor {
+	maxKB := defaultFileTextMaxKB
+	if value, err := strconv.Atoi(getEnv("FILE_TEXT_MAX_KB", "")); err == nil && value > 0 {
+		maxKB = value
+	}
+	maxMB := defaultFileTextExtractMaxMB
+	if value, err := strconv.Atoi(getEnv("FILE_TEXT_EXTRACT_MAX_MB", "")); err == nil && value > 0 {
+		maxMB = value
+	}
+	workers := defaultFileTextWorkers
+	if value, err := strconv.Atoi(getEnv("FILE_TEXT_EXTRACT_WORKERS", "")); err == nil && value > 0 {
+		workers = value
+	}
+
+	return &fileTextExtractor{
+		maxBytes:    maxKB * 1024,
+		maxFileSize: int64(maxMB) << 20,
+		workers:     make(chan struct{}, workers),
+	}
+}
+
+// MaxPreviewKB returns the maximum preview size (= text lưu cho mỗi file)
+func (s *FileService) MaxPreviewKB() int {
+	return s.texts.maxBytes / 1024
+}
+
+// extractTextAsync extracts the text of a newly stored file in background
+func (s *FileService) extractTextAsync(file *models.File) {
+	if textextract.DetectFormat(file.OriginalName, file.MimeType) == "" {
+		return
+	}
+	if _, running := s.texts.inflight.LoadOrStore(file.ID, struct{}{}); running {
+		return
+	}
+
+	snapshot := *file
+	go func() {
+		defer s.texts.inflight.Delete(snapshot.ID)
+		s.texts.workers <- struct{}{}
+		defer func() { <-s.texts.workers }()
+		// Panic khi xử lý file hỏng không được làm sập server
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				logrus.Errorf("Panic while extracting text of file %s (%s): %v\n%s", snapshot.ID, snapshot.OriginalName, recovered, debug.Stack())
+				s.markTextExtractionFailed(&snapshot, fmt.Sprintf("text extraction panicked: %v", recovered))
+			}
+		}()
+
+		if _, err := s.ExtractText(&snapshot); err != nil {
+			logrus.Warnf("Failed to extract text of file %s (%s): %v", snapshot.ID, snapshot.OriginalName, err)
+		}
+	}()
+}
+
+// markTextExtractionFailed stores a failed text extraction status of a file
+func (s *FileService) markTextExtractionFailed(file *models.File, reason string) {
+	record := &models.FileText{
+		FileID:      file.ID,
+		Format:      textextract.DetectFormat(file.OriginalName, file.MimeType),
+		Status:      models.FileTextStatusFailed,
+		Error:       reason,
+		ExtractedAt: time.Now(),
+	}
+	if err := s.textRepo.Upsert(record); err != nil {
+		logrus.Errorf("Failed to save failed text extraction of file %s: %v", file.ID, err)
+	}
+}
+
+// ExtractText extracts and stores the text of a file.
+// Định dạng không hỗ trợ trả về status unsupported (không lưu); lỗi đọc storage trả về error để thử lại sau.
+func (s *FileService) ExtractText(file *models.File) (*models.FileText, error) {
+	format := textextract.DetectFormat(file.OriginalName, file.MimeType)
+	record := &models.FileText{
+		FileID:      file.ID,
+		Format:      format,
+		ExtractedAt: time.Now(),
+	}
+	if format == "" {
+		record.Status = models.FileTextStatusUnsupported
+		record.Error = textextract.ErrUnsupported.Error()
+		return record, nil
+	}
+
+	if file.FileSize > s.texts.maxFileSize {
+		record.Status = models.FileTextStatusUnsupported
+		record.Error = fmt.Sprintf("file too large for text extraction (max %d MB)", s.texts.maxFileSize>>20)
+	} else {
+		result, err := s.extractFileText(file, format)
+		switch {
+		case err == nil:
+			record.Status = models.FileTextStatusCompleted
+			record.Content = result.Text
+			record.Truncated = result.Truncated
+			record.CharCount = result.CharCount
+			record.WordCount = result.WordCount
+			record.TokenEstimate = estimateTokens(result.CharCount)
+		case errors.Is(err, os.ErrNotExist), errors.Is(err, errFileContentUnavailable):
+			return nil, err
+		case errors.Is(err, textextract.ErrNoText):
+			record.Status = models.FileTextStatusUnsupported
+			record.Error = err.Error()
+		default:
+			record.Status = models.FileTextStatusFailed
+			record.Error = err.Error()
+		}
+	}
+
+	if err := s.textRepo.Upsert(record); err != nil {
+		return nil, fmt.Errorf("failed to save file text: %w", err)
+	}
+	return record, nil
+}
+
+// extractFileText reads the file content (spool ra file tạm nếu backend không hỗ trợ đọc ngẫu nhiên) and extracts its text
+func (s *FileService) extractFileText(file *models.File, format string) (*textextract.Result, error) {
+	content, err := s.OpenFileContent(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errFileContentUnavailable, err)
+	}
+	defer content.Close()
+
+	reader, ok := content.(io.ReaderAt)
+	size := file.FileSize
+	if !ok {
+		tmp, err := os.CreateTemp("", "file-text-*")
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to create temp file: %v", errFileContentUnavailable, err)
+		}
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
+		if size, err = io.Copy(tmp, io.LimitReader(content, s.texts.maxFileSize+1)); err != nil {
+			return nil, fmt.Errorf("%w: %v", errFileContentUnavailable, err)
+		}
+		reader = tmp
+	}
+
+	return textextract.Extract(reader, size, format, s.texts.maxBytes)
+}
+
+// GetFilePreview returns the first maxKB KB of the text of a file with its character / token counts.
+// File upload trước khi có trích xuất text được trích xuất ngay khi xem preview.
+func (s *FileService) GetFilePreview(file *models.File, maxKB int) (*models.FilePreviewResponse, error) {
+	response := &models.FilePreviewResponse{
+		FileID:       file.ID,
+		OriginalName: file.OriginalName,
+		MimeType:     file.MimeType,
+	}
+
+	record, err := s.textRepo.GetByFileID(file.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if _, running := s.texts.inflight.Load(file.ID); running {
+			response.Status = models.FileTextStatusPending
+			response.Format = textextract.DetectFormat(file.OriginalName, file.MimeType)
+			return response, nil
+		}
+		record, err = s.ExtractText(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	text := truncateUTF8(record.Content, maxKB*1024)
+	response.Status = record.Status
+	response.Format = record.Format
+	response.Text = text
+	response.Truncated = record.Truncated || len(text) < len(record.Content)
+	response.CharCount = record.CharCount
+	response.WordCount = record.WordCount
+	response.TokenEstimate = record.TokenEstimate
+	response.Error = record.Error
+	if record.Format != "" {
+		// Định dạng không hỗ trợ không được lưu
+		extractedAt := record.ExtractedAt
+		response.ExtractedAt = &extractedAt
+	}
+	return response, nil
+}
+
+// estimateTokens approximates the Gemini token count of a text (~4 ký tự / token, tiếng Việt thường nhiều token hơn)
+func estimateTokens(chars int64) int64 {
+	return (chars + 3) / 4
+}
+
+// truncateUTF8 cuts s to at most maxBytes bytes without splitting a character
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
@@ -16,11 +16,12 @@ import (
 )
 
 type GeminiAccountService struct {
-	geminiAccountRepo *repository.GeminiAccountRepository
-	appRepo           *repository.AppRepository
-	boxRepo           *repository.BoxRepository
-	topicRepo         *repository.TopicRepository
-	topicUserRepo     *repository.TopicUserRepository
+	geminiAccountRepo   *repository.GeminiAccountRepository
+	appRepo             *repository.AppRepository
+	boxRepo             *repository.BoxRepository
+	topicRepo           *repository.TopicRepository
+	topicUserRepo       *repository.TopicUserRepository
+	topicRemovalService *TopicRemovalService
 }
 
 func NewGeminiAccountService(
@@ -29,13 +30,15 @@ func NewGeminiAccountService(
 	boxRepo *repository.BoxRepository,
 	topicRepo *repository.TopicRepository,
 	topicUserRepo *repository.TopicUserRepository,
+	topicRemovalService *TopicRemovalService,
 ) *GeminiAccountService {
 	return &GeminiAccountService{
-		geminiAccountRepo: geminiAccountRepo,
-		appRepo:           appRepo,
-		boxRepo:           boxRepo,
-		topicRepo:         topicRepo,
-		topicUserRepo:     topicUserRepo,
+		geminiAccountRepo:   geminiAccountRepo,
+		appRepo:             appRepo,
+		boxRepo:             boxRepo,
+		topicRepo:           topicRepo,
+		topicUserRepo:       topicUserRepo,
+		topicRemovalService: topicRemovalService,
 	}
 }
 
@@ -282,7 +285,8 @@ func (s *GeminiAccountService) GetAvailableAccountForMachine(machineID string) (
 	return reloadedAccount, nil
 }
 
-// LockAccount locks a Gemini account and deletes all topics created with it
+// LockAccount locks a Gemini account and removes all topics created with it.
+// Topic được gỡ với state "orphaned" (soft delete, giữ nguyên assignments) và có thể restore trong grace period.
 func (s *GeminiAccountService) LockAccount(accountID string, reason string) (int, error) {
 	// Get account
 	account, err := s.geminiAccountRepo.GetByID(accountID)
@@ -300,42 +304,36 @@ func (s *GeminiAccountService) LockAccount(accountID string, reason string) (int
 		return 0, fmt.Errorf("failed to get topics for account: %w", err)
 	}
 
-	topicCount := len(topics)
-	topicIDs := make([]string, 0, topicCount)
-	for _, topic := range topics {
-		topicIDs = append(topicIDs, topic.ID)
-	}
-
-	// Delete topic assignments (topic_users)
-	if len(topicIDs) > 0 {
-		for _, topicID := range topicIDs {
-			// Get all assignments for this topic
-			topicUsers, err := s.topicUserRepo.GetByTopicID(topicID)
-			if err == nil {
-				for _, topicUser := range topicUsers {
-					if err := s.topicUserRepo.DeleteByID(topicUser.ID); err != nil {
-						logrus.Warnf("Failed to delete topic assignment %s: %v", topicUser.ID, err)
-					}
-				}
-			}
-		}
+	// Lock account
+	if err := s.geminiAccountRepo.LockAccount(accountID, reason); err != nil {
+		return 0, fmt.Errorf("failed to lock account: %w", err)
 	}
 
-	// Delete topics
+	// Remove topics (soft delete)
+	trigger := TopicRemovalTrigger{
+		Type:   models.TopicRemovalTriggerGeminiAccountLocked,
+		Reason: fmt.Sprintf("Gemini account %s locked: %s", account.Email, reason),
+		Details: map[string]interface{}{
+			"gemini_account_id": account.ID,
+			"email":             account.Email,
+			"lock_reason":       reason,
+		},
+	}
+	removedCount := 0
 	for _, topic := range topics {
-		if err := s.topicRepo.Delete(topic.ID); err != nil {
-			logrus.Warnf("Failed to delete topic %s: %v", topic.ID, err)
+		removal, err := s.topicRemovalService.RemoveTopic(topic.ID, models.TopicRemovalStateOrphaned, trigger)
+		if err != nil {
+			logrus.Warnf("Failed to remove topic %s: %v", topic.ID, err)
+			continue
+		}
+		if removal != nil {
+			removedCount++
 		}
 	}
 
-	// Lock account
-	if err := s.geminiAccountRepo.LockAccount(accountID, reason); err != nil {
-		return 0, fmt.Errorf("failed to lock account: %w", err)
-	}
-
-	logrus.Infof("Locked Gemini account %s and deleted %d topics", accountID, topicCount)
+	logrus.Infof("Locked Gemini account %s and removed %d topics", accountID, removedCount)
 
-	return topicCount, nil
+	return removedCount, nil
 }
 
 // UnlockAccount unlocks a Gemini account
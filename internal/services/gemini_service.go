@@ -3,6 +3,7 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -44,16 +45,15 @@ func (s *GeminiService) GenerateOutlineAndUpload(userID string, topicID string,
 		return nil, fmt.Errorf("topic not found: %w", err)
 	}
 
-	// Check if user has permission to access this topic (owner or assigned)
-	canAccess, accessType, err := s.topicService.CanUserAccessTopic(userID, topicID, false)
+	// Check if user has write permission on this topic (owner or assigned with write/full): chạy automation trên Gemini
+	accessType, err := s.topicService.AuthorizeTopic(userID, topicID, false, models.TopicPermissionWrite)
 	if err != nil {
-		logrus.Errorf("Failed to check topic access for user %s, topic %s: %v", userID, topicID, err)
+		logrus.Errorf("User %s can not run Gemini automation on topic %s: %v", userID, topicID, err)
+		if errors.Is(err, ErrTopicAccessDenied) || errors.Is(err, ErrTopicPermissionDenied) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to check topic access: %w", err)
 	}
-	if !canAccess {
-		logrus.Errorf("User %s does not have permission to access topic %s", userID, topicID)
-		return nil, fmt.Errorf("topic not found")
-	}
 
 	// Use topic owner's profile instead of current user's profile
 	// This ensures the profile has the correct Gemini account login
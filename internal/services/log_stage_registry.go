@@ -0,0 +1,282 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// LogStageWildcard matches any entity type, stage or status in a LogStagePattern
+const LogStageWildcard = "*"
+
+// maxUnknownLogStages bounds the number of distinct unknown stages kept in memory
+const maxUnknownLogStages = 500
+
+// LogStagePattern selects the logs a stage handler receives.
+// EntityType/Stage: giá trị cụ thể hoặc "*"; Statuses rỗng = mọi status.
+type LogStagePattern struct {
+	EntityType string
+	Stage      string
+	Statuses   []string
+}
+
+// Matches reports whether the log event matches the pattern
+func (p LogStagePattern) Matches(event *LogEvent) bool {
+	if p.EntityType != LogStageWildcard && p.EntityType != event.EntityType {
+		return false
+	}
+	if p.Stage != LogStageWildcard && p.Stage != event.Stage {
+		return false
+	}
+	if len(p.Statuses) == 0 {
+		return true
+	}
+	for _, status := range p.Statuses {
+		if status == event.Status {
+			return true
+		}
+	}
+	return false
+}
+
+// LogEvent is a log passed to stage handlers
+type LogEvent struct {
+	EntityType string
+	EntityID   string
+	UserID     string
+	MachineID  string
+	Stage      string
+	Status     string
+	Message    string
+	Metadata   map[string]interface{}
+}
+
+// newLogEvent creates a log event from a log request
+func newLogEvent(req *models.ProcessLogRequest) *LogEvent {
+	return &LogEvent{
+		EntityType: req.EntityType,
+		EntityID:   req.EntityID,
+		UserID:     req.UserID,
+		MachineID:  req.MachineID,
+		Stage:      req.Stage,
+		Status:     req.Status,
+		Message:    req.Message,
+		Metadata:   req.Metadata,
+	}
+}
+
+// DecodeMetadata decodes the log metadata into a typed struct (json tags)
+func (e *LogEvent) DecodeMetadata(target interface{}) error {
+	if len(e.Metadata) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(e.Metadata)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// LogStageHandler handles logs matching a pattern
+type LogStageHandler func(event *LogEvent) error
+
+type registeredLogStageHandler struct {
+	name    string
+	pattern LogStagePattern
+	handler LogStageHandler
+}
+
+// LogStageRegistry dispatches logs to the handlers subscribed to their (entity_type, stage, status).
+// Service khác đăng ký handler cho stage mới (vd: gem_updated, file_uploaded) qua ProcessLogService.StageRegistry(),
+// không cần sửa ProcessLogService. Stage không có handler nào được ghi nhận là unknown.
+type LogStageRegistry struct {
+	mu          sync.RWMutex
+	handlers    []registeredLogStageHandler
+	knownStages map[string]bool // "entity_type/stage" của các stage chỉ mang tính thông tin (không cần handler)
+	unknown     map[string]*models.UnknownLogStage
+}
+
+// NewLogStageRegistry creates an empty registry
+func NewLogStageRegistry() *LogStageRegistry {
+	return &LogStageRegistry{
+		knownStages: make(map[string]bool),
+		unknown:     make(map[string]*models.UnknownLogStage),
+	}
+}
+
+// Register subscribes a handler to a pattern. Handlers run in registration order.
+func (r *LogStageRegistry) Register(name string, pattern LogStagePattern, handler LogStageHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers = append(r.handlers, registeredLogStageHandler{name: name, pattern: pattern, handler: handler})
+	logrus.Debugf("[Log] Registered stage handler %s (%s/%s %v)", name, pattern.EntityType, pattern.Stage, pattern.Statuses)
+}
+
+// HandleLogStage registers a handler that receives metadata decoded into T
+func HandleLogStage[T any](r *LogStageRegistry, name string, pattern LogStagePattern, handler func(event *LogEvent, metadata *T) error) {
+	r.Register(name, pattern, func(event *LogEvent) error {
+		var metadata T
+		if err := event.DecodeMetadata(&metadata); err != nil {
+			return fmt.Errorf("invalid metadata: %w", err)
+		}
+		return handler(event, &metadata)
+	})
+}
+
+// RegisterKnownStages marks informational stages (no side effect) so they are not reported as unknown
+func (r *LogStageRegistry) RegisterKnownStages(entityType string, stages ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stage := range stages {
+		r.knownStages[entityType+"/"+stage] = true
+	}
+}
+
+// Dispatch runs every handler matching the event. Lỗi của 1 handler không chặn các handler khác.
+func (r *LogStageRegistry) Dispatch(event *LogEvent) {
+	r.mu.RLock()
+	var matched []registeredLogStageHandler
+	known := r.knownStages[event.EntityType+"/"+event.Stage] || r.knownStages[LogStageWildcard+"/"+event.Stage]
+	for _, h := range r.handlers {
+		if h.pattern.Matches(event) {
+			matched = append(matched, h)
+		}
+		// Stage có handler với status khác (vd: "completed" + "info") vẫn là stage đã biết
+		if (h.pattern.EntityType == LogStageWildcard || h.pattern.EntityType == event.EntityType) && h.pattern.Stage == event.Stage {
+			known = true
+		}
+	}
+	r.mu.RUnlock()
+
+	if len(matched) == 0 {
+		if !known {
+			r.recordUnknown(event)
+		}
+		return
+	}
+
+	for _, h := range matched {
+		if err := h.handler(event); err != nil {
+			logrus.Errorf("[Log] Stage handler %s failed for %s %s/%s (%s): %v", h.name, event.EntityType, event.EntityID, event.Stage, event.Status, err)
+		}
+	}
+}
+
+// recordUnknown records a stage no handler knows about
+func (r *LogStageRegistry) recordUnknown(event *LogEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := event.EntityType + "/" + event.Stage
+	now := time.Now()
+	if entry, ok := r.unknown[key]; ok {
+		entry.Count++
+		entry.LastSeenAt = now
+		entry.LastStatus = event.Status
+		entry.LastMachineID = event.MachineID
+		return
+	}
+	if len(r.unknown) >= maxUnknownLogStages {
+		return
+	}
+
+	r.unknown[key] = &models.UnknownLogStage{
+		EntityType:    event.EntityType,
+		Stage:         event.Stage,
+		Count:         1,
+		FirstSeenAt:   now,
+		LastSeenAt:    now,
+		LastStatus:    event.Status,
+		LastMachineID: event.MachineID,
+	}
+	logrus.Infof("[Log] Unknown log stage %s/%s (status: %s, machine: %s), no handler registered", event.EntityType, event.Stage, event.Status, event.MachineID)
+}
+
+// Handlers lists the registered handlers
+func (r *LogStageRegistry) Handlers() []models.LogStageHandlerInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]models.LogStageHandlerInfo, len(r.handlers))
+	for i, h := range r.handlers {
+		infos[i] = models.LogStageHandlerInfo{
+			Name:       h.name,
+			EntityType: h.pattern.EntityType,
+			Stage:      h.pattern.Stage,
+			Statuses:   h.pattern.Statuses,
+		}
+	}
+	return infos
+}
+
+// UnknownStages lists stages seen without any handler, most recent first
+func (r *LogStageRegistry) UnknownStages() []models.UnknownLogStage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stages := make([]models.UnknownLogStage, 0, len(r.unknown))
+	for _, entry := range r.unknown {
+		stages = append(stages, *entry)
+	}
+	sort.Slice(stages, func(i, j int) bool {
+		return stages[i].LastSeenAt.After(stages[j].LastSeenAt)
+	})
+	return stages
+}
+
+// LogMetadataString decodes a metadata value sent either as a JSON string or number
+// (ID dạng timestamp có thể được gửi dưới dạng số)
+type LogMetadataString string
+
+// UnmarshalJSON accepts strings, numbers and null
+func (s *LogMetadataString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = LogMetadataString(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err == nil {
+		*s = LogMetadataString(num.String())
+		return nil
+	}
+	// Kiểu khác (object/array/bool) bỏ qua như trước đây thay vì làm fail handler
+	return nil
+}
+
+// ProjectLogMetadata is the typed metadata of project-related automation logs
+type ProjectLogMetadata struct {
+	ProjectID      LogMetadataString `json:"project_id"`
+	ProjectIDCamel LogMetadataString `json:"projectID"`
+	Project        LogMetadataString `json:"project"`
+	GemName        LogMetadataString `json:"gemName"`
+	ExecutionID    LogMetadataString `json:"execution_id"`
+}
+
+// ResolveProjectID returns the project ID from the known keys: project_id, projectID, project,
+// hoặc tách từ gemName (format: {projectID}_{name}, projectID là timestamp > 10 chữ số)
+func (m *ProjectLogMetadata) ResolveProjectID() string {
+	for _, value := range []LogMetadataString{m.ProjectID, m.ProjectIDCamel, m.Project} {
+		if value != "" {
+			return string(value)
+		}
+	}
+	if idx := strings.LastIndex(string(m.GemName), "_"); idx > 0 {
+		potentialProjectID := string(m.GemName)[:idx]
+		if len(potentialProjectID) > 10 {
+			return potentialProjectID
+		}
+	}
+	return ""
+}
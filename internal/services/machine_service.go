@@ -1,6 +1,10 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
@@ -35,6 +39,8 @@ func (s *MachineService) RegisterMachine(machineID, name string) (*models.Regist
 	existingBox, err := s.boxRepo.GetByMachineID(machineID)
 	if err == nil {
 		// Machine already exists, return existing box info
+		// Endpoint không xác thực: không bao giờ cấp secret cho machine đã tồn tại (kể cả machine cũ chưa có secret,
+		// machine_id đoán được). Secret chỉ lấy qua admin rotate hoặc owner gọi IssueMachineSecretForOwner.
 		userID := existingBox.UserID
 		return &models.RegisterMachineResponse{
 			BoxID:   existingBox.ID,
@@ -78,17 +84,121 @@ func (s *MachineService) RegisterMachine(machineID, name string) (*models.Regist
 		}
 	}
 
+	// Issue machine secret together with the box
+	secret, secretHash, err := generateMachineSecret()
+	if err != nil {
+		return nil, err
+	}
+	issuedAt := time.Now()
+	box.SecretHash = secretHash
+	box.SecretIssuedAt = &issuedAt
+
 	if err := s.boxRepo.Create(box); err != nil {
 		return nil, fmt.Errorf("failed to create box: %w", err)
 	}
 
 	return &models.RegisterMachineResponse{
-		BoxID:   box.ID,
-		UserID:  &box.UserID,
-		Message: "Machine registered successfully",
+		BoxID:         box.ID,
+		UserID:        &box.UserID,
+		Message:       "Machine registered successfully",
+		MachineSecret: secret,
 	}, nil
 }
 
+// RotateMachineSecret issues a new secret for a machine, the old secret stops working immediately (admin)
+func (s *MachineService) RotateMachineSecret(machineID string) (*models.MachineSecretResponse, error) {
+	box, err := s.boxRepo.GetByMachineID(machineID)
+	if err != nil {
+		return nil, fmt.Errorf("machine not found: %w", err)
+	}
+
+	secret, err := s.issueMachineSecret(box.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Rotated machine secret for machine %s (box %s)", machineID, box.ID)
+
+	return &models.MachineSecretResponse{
+		BoxID:         box.ID,
+		MachineID:     box.MachineID,
+		MachineSecret: secret,
+		Message:       "Machine secret rotated successfully",
+	}, nil
+}
+
+// IssueMachineSecretForOwner issues a new secret for a box owned by the user (box owner lấy secret cho machine cũ chưa có secret).
+// The old secret, if any, stops working immediately.
+func (s *MachineService) IssueMachineSecretForOwner(userID, boxID string) (*models.MachineSecretResponse, error) {
+	box, err := s.boxRepo.GetByUserIDAndID(userID, boxID)
+	if err != nil {
+		return nil, fmt.Errorf("box not found: %w", err)
+	}
+
+	secret, err := s.issueMachineSecret(box.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Issued machine secret for machine %s (box %s) by owner %s", box.MachineID, box.ID, userID)
+
+	return &models.MachineSecretResponse{
+		BoxID:         box.ID,
+		MachineID:     box.MachineID,
+		MachineSecret: secret,
+		Message:       "Machine secret issued successfully",
+	}, nil
+}
+
+// AuthenticateMachine verifies machine credentials and returns the box
+func (s *MachineService) AuthenticateMachine(machineID, secret string) (*models.Box, error) {
+	if machineID == "" || secret == "" {
+		return nil, errors.New("machine credentials required")
+	}
+
+	box, err := s.boxRepo.GetByMachineID(machineID)
+	if err != nil {
+		return nil, errors.New("invalid machine credentials")
+	}
+	if box.SecretHash == "" {
+		return nil, errors.New("machine has no secret, the box owner or an admin must issue one")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashMachineSecret(secret)), []byte(box.SecretHash)) != 1 {
+		return nil, errors.New("invalid machine credentials")
+	}
+
+	return box, nil
+}
+
+// issueMachineSecret generates and stores a new secret for a box, returns the plain secret
+func (s *MachineService) issueMachineSecret(boxID string) (string, error) {
+	secret, secretHash, err := generateMachineSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := s.boxRepo.UpdateSecret(boxID, secretHash, time.Now()); err != nil {
+		return "", fmt.Errorf("failed to save machine secret: %w", err)
+	}
+	return secret, nil
+}
+
+// generateMachineSecret returns a random secret and its hash
+func generateMachineSecret() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate machine secret: %w", err)
+	}
+	secret := hex.EncodeToString(buf)
+	return secret, hashMachineSecret(secret), nil
+}
+
+// hashMachineSecret hashes a machine secret (secret là random 256-bit nên SHA-256 là đủ)
+func hashMachineSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
 // GetFrpConfigByMachineID gets FRP configuration for a machine
 func (s *MachineService) GetFrpConfigByMachineID(machineID string) (*models.RegisterAppResponse, error) {
 	// Get box by machine ID
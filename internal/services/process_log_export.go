@@ -0,0 +1,448 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+	"github.com/xuri/excelize/v2"
+)
+
+// LogExportFormat is the output format of a log export
+type LogExportFormat string
+
+const (
+	LogExportCSV    LogExportFormat = "csv"
+	LogExportNDJSON LogExportFormat = "ndjson"
+	LogExportXLSX   LogExportFormat = "xlsx"
+)
+
+const (
+	// logExportBatchSize is the number of logs loaded from DB per query, export không load hết vào memory
+	logExportBatchSize = 1000
+
+	// maxLogExportSheets limits per-entity sheets in XLSX; the remaining entities go into one "Other" sheet
+	maxLogExportSheets = 200
+
+	// maxLogExportSheetRows is below the Excel limit of 1,048,576 rows per sheet
+	maxLogExportSheetRows = 1000000
+)
+
+// ParseLogExportFormat parses the format query param (csv, ndjson, xlsx)
+func ParseLogExportFormat(value string) (LogExportFormat, error) {
+	switch format := LogExportFormat(strings.ToLower(strings.TrimSpace(value))); format {
+	case LogExportCSV, LogExportNDJSON, LogExportXLSX:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q (expected csv, ndjson or xlsx)", value)
+	}
+}
+
+// ContentType returns the MIME type of the format
+func (f LogExportFormat) ContentType() string {
+	switch f {
+	case LogExportNDJSON:
+		return "application/x-ndjson"
+	case LogExportXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// ExportLogs writes the logs matching filter to w, with the same access rules as SearchLogs
+func (s *ProcessLogService) ExportLogs(w io.Writer, format LogExportFormat, userID string, isAdmin bool, filter *models.ProcessLogSearchFilter) error {
+	scope, err := s.getAccessScope(userID, isAdmin)
+	if err != nil {
+		return err
+	}
+	return s.writeLogExport(w, format, filter, scope)
+}
+
+// ExportEntityLogs writes all logs of an entity (e.g. one script execution) to w.
+// Caller phải kiểm tra quyền truy cập entity trước (CanUserAccessEntity).
+func (s *ProcessLogService) ExportEntityLogs(w io.Writer, format LogExportFormat, entityType, entityID string) error {
+	filter := &models.ProcessLogSearchFilter{
+		ProcessLogFilter: models.ProcessLogFilter{EntityType: entityType},
+		EntityID:         entityID,
+	}
+	return s.writeLogExport(w, format, filter, nil)
+}
+
+// ExportExecutionLogs writes the logs of a script execution as NDJSON: log của execution
+// và log của topic có metadata execution_id trùng execution (automation gửi log theo topic.ID).
+// Caller phải kiểm tra quyền truy cập execution trước (CanUserAccessEntity).
+func (s *ProcessLogService) ExportExecutionLogs(w io.Writer, execution *models.ScriptExecution) error {
+	filters := []*models.ProcessLogSearchFilter{
+		{
+			ProcessLogFilter: models.ProcessLogFilter{EntityType: "script_execution"},
+			EntityID:         execution.ID,
+		},
+		{
+			ProcessLogFilter: models.ProcessLogFilter{EntityType: "topic"},
+			EntityID:         execution.TopicID,
+			Metadata:         []models.MetadataPathFilter{{Path: []string{"execution_id"}, Value: execution.ID}},
+		},
+	}
+	for _, filter := range filters {
+		if err := s.exportLogsNDJSON(w, filter, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ProcessLogService) writeLogExport(w io.Writer, format LogExportFormat, filter *models.ProcessLogSearchFilter, scope *repository.ProcessLogAccessScope) error {
+	switch format {
+	case LogExportCSV:
+		return s.exportLogsCSV(w, filter, scope)
+	case LogExportNDJSON:
+		return s.exportLogsNDJSON(w, filter, scope)
+	case LogExportXLSX:
+		return s.exportLogsXLSX(w, filter, scope)
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// forEachSearchLogBatch iterates over logs matching filter in ascending seq order, batch by batch
+func (s *ProcessLogService) forEachSearchLogBatch(filter *models.ProcessLogSearchFilter, scope *repository.ProcessLogAccessScope, fn func([]*models.ProcessLog) error) error {
+	var afterSeq int64
+	for {
+		logs, err := s.logRepo.SearchAfterSeq(filter, scope, afterSeq, logExportBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to load logs: %w", err)
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err := fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < logExportBatchSize {
+			return nil
+		}
+		afterSeq = logs[len(logs)-1].Seq
+	}
+}
+
+// flushExport pushes buffered data to the client after each batch (http.ResponseWriter implements Flush)
+func flushExport(w io.Writer) {
+	if flusher, ok := w.(interface{ Flush() }); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *ProcessLogService) exportLogsCSV(w io.Writer, filter *models.ProcessLogSearchFilter, scope *repository.ProcessLogAccessScope) error {
+	writer := csv.NewWriter(w)
+	header := []string{"seq", "created_at", "entity_type", "entity_id", "user_id", "machine_id", "stage", "status", "message", "metadata"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	return s.forEachSearchLogBatch(filter, scope, func(logs []*models.ProcessLog) error {
+		for _, log := range logs {
+			record := []string{
+				strconv.FormatInt(log.Seq, 10),
+				log.CreatedAt.UTC().Format(time.RFC3339Nano),
+				log.EntityType,
+				log.EntityID,
+				log.UserID,
+				log.MachineID,
+				escapeCSVFormula(log.Stage),
+				log.Status,
+				escapeCSVFormula(log.Message),
+				exportMetadata(log.Metadata),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		flushExport(w)
+		return nil
+	})
+}
+
+// exportMetadata formats metadata as a JSON string ("" when empty)
+func exportMetadata(metadata models.JSON) string {
+	if len(metadata) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// escapeCSVFormula prevents spreadsheet apps from evaluating cell values as formulas (CSV injection)
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (s *ProcessLogService) exportLogsNDJSON(w io.Writer, filter *models.ProcessLogSearchFilter, scope *repository.ProcessLogAccessScope) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	return s.forEachSearchLogBatch(filter, scope, func(logs []*models.ProcessLog) error {
+		for _, log := range logs {
+			if err := encoder.Encode(log); err != nil {
+				return err
+			}
+		}
+		if err := buffered.Flush(); err != nil {
+			return err
+		}
+		flushExport(w)
+		return nil
+	})
+}
+
+// exportLogsXLSX writes a workbook with a summary sheet (timings per entity) and one sheet per entity.
+// Dùng StreamWriter của excelize: row được ghi ra file tạm thay vì giữ trong memory.
+func (s *ProcessLogService) exportLogsXLSX(w io.Writer, filter *models.ProcessLogSearchFilter, scope *repository.ProcessLogAccessScope) error {
+	entities, err := s.logRepo.ListSearchEntities(filter, scope)
+	if err != nil {
+		return fmt.Errorf("failed to list log entities: %w", err)
+	}
+
+	f := excelize.NewFile()
+	defer func() {
+		if err := f.Close(); err != nil {
+			logrus.Warnf("Failed to clean up XLSX export: %v", err)
+		}
+	}()
+
+	timeStyle, err := f.NewStyle(&excelize.Style{NumFmt: 22}) // m/d/yy h:mm
+	if err != nil {
+		return err
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	// Summary sheet
+	const summarySheet = "Summary"
+	if err := f.SetSheetName("Sheet1", summarySheet); err != nil {
+		return err
+	}
+	summary, err := f.NewStreamWriter(summarySheet)
+	if err != nil {
+		return err
+	}
+	if err := summary.SetColWidth(1, 9, 20); err != nil {
+		return err
+	}
+	if err := summary.SetRow("A1", xlsxHeaderRow(headerStyle,
+		"Sheet", "Entity type", "Entity ID", "Logs", "Errors", "First log (UTC)", "Last log (UTC)", "Duration (s)", "Notes")); err != nil {
+		return err
+	}
+
+	sheetNames := make([]string, len(entities))
+	usedNames := map[string]bool{"summary": true, "other": true}
+	for i, entity := range entities {
+		if i < maxLogExportSheets {
+			sheetNames[i] = uniqueSheetName(xlsxEntitySheetName(entity), usedNames)
+		} else {
+			sheetNames[i] = "Other"
+		}
+		note := ""
+		if entity.LogCount > maxLogExportSheetRows {
+			note = fmt.Sprintf("Truncated to %d rows", maxLogExportSheetRows)
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		row := []interface{}{
+			sheetNames[i],
+			entity.EntityType,
+			entity.EntityID,
+			entity.LogCount,
+			entity.ErrorCount,
+			excelize.Cell{StyleID: timeStyle, Value: entity.FirstLogAt.UTC()},
+			excelize.Cell{StyleID: timeStyle, Value: entity.LastLogAt.UTC()},
+			entity.LastLogAt.Sub(entity.FirstLogAt).Seconds(),
+			note,
+		}
+		if err := summary.SetRow(cell, row); err != nil {
+			return err
+		}
+	}
+	if err := summary.Flush(); err != nil {
+		return err
+	}
+
+	// Per-entity sheets: mỗi lúc chỉ mở 1 StreamWriter, query từng entity theo seq tăng dần
+	var other *xlsxLogSheet
+	for i, entity := range entities {
+		entityFilter := *filter
+		entityFilter.EntityType = entity.EntityType
+		entityFilter.EntityID = entity.EntityID
+
+		sheet := other
+		if sheet == nil {
+			if _, err := f.NewSheet(sheetNames[i]); err != nil {
+				return err
+			}
+			sheet, err = newXLSXLogSheet(f, sheetNames[i], headerStyle, timeStyle, i >= maxLogExportSheets)
+			if err != nil {
+				return err
+			}
+			if i >= maxLogExportSheets {
+				other = sheet
+			}
+		} else {
+			// Mỗi entity trong sheet "Other" có mốc thời gian riêng
+			sheet.startEntity()
+		}
+
+		err := s.forEachSearchLogBatch(&entityFilter, scope, func(logs []*models.ProcessLog) error {
+			for _, log := range logs {
+				if err := sheet.writeLog(log); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if other == nil {
+			if err := sheet.stream.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if other != nil {
+		if err := other.stream.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return f.Write(w)
+}
+
+// xlsxLogSheet writes logs of one or more entities to a sheet, with elapsed/delta timings
+type xlsxLogSheet struct {
+	stream       *excelize.StreamWriter
+	timeStyle    int
+	withEntity   bool
+	row          int
+	firstLogTime time.Time
+	prevLogTime  time.Time
+}
+
+func newXLSXLogSheet(f *excelize.File, name string, headerStyle, timeStyle int, withEntity bool) (*xlsxLogSheet, error) {
+	stream, err := f.NewStreamWriter(name)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := []string{"Seq", "Time (UTC)", "Elapsed (s)", "Delta (s)", "Status", "Stage", "Machine", "Message", "Metadata"}
+	if withEntity {
+		headers = append([]string{"Entity type", "Entity ID"}, headers...)
+	}
+	// Message (cột áp chót) rộng hơn, các cột còn lại 14
+	if err := stream.SetColWidth(1, len(headers)-2, 14); err != nil {
+		return nil, err
+	}
+	if err := stream.SetColWidth(len(headers)-1, len(headers)-1, 80); err != nil {
+		return nil, err
+	}
+	if err := stream.SetColWidth(len(headers), len(headers), 40); err != nil {
+		return nil, err
+	}
+	if err := stream.SetRow("A1", xlsxHeaderRow(headerStyle, headers...)); err != nil {
+		return nil, err
+	}
+
+	return &xlsxLogSheet{stream: stream, timeStyle: timeStyle, withEntity: withEntity, row: 1}, nil
+}
+
+// startEntity resets timings when the next entity starts in the same sheet
+func (s *xlsxLogSheet) startEntity() {
+	s.firstLogTime = time.Time{}
+	s.prevLogTime = time.Time{}
+}
+
+func (s *xlsxLogSheet) writeLog(log *models.ProcessLog) error {
+	if s.row > maxLogExportSheetRows {
+		return nil
+	}
+	if s.firstLogTime.IsZero() {
+		s.firstLogTime = log.CreatedAt
+		s.prevLogTime = log.CreatedAt
+	}
+
+	row := []interface{}{
+		log.Seq,
+		excelize.Cell{StyleID: s.timeStyle, Value: log.CreatedAt.UTC()},
+		log.CreatedAt.Sub(s.firstLogTime).Seconds(),
+		log.CreatedAt.Sub(s.prevLogTime).Seconds(),
+		log.Status,
+		log.Stage,
+		log.MachineID,
+		log.Message,
+		exportMetadata(log.Metadata),
+	}
+	if s.withEntity {
+		row = append([]interface{}{log.EntityType, log.EntityID}, row...)
+	}
+	s.prevLogTime = log.CreatedAt
+
+	s.row++
+	cell, _ := excelize.CoordinatesToCellName(1, s.row)
+	return s.stream.SetRow(cell, row)
+}
+
+func xlsxHeaderRow(style int, headers ...string) []interface{} {
+	row := make([]interface{}, len(headers))
+	for i, header := range headers {
+		row[i] = excelize.Cell{StyleID: style, Value: header}
+	}
+	return row
+}
+
+// xlsxEntitySheetName builds a short sheet name (Excel limit 31 chars), e.g. "exec 1a2b3c4d"
+func xlsxEntitySheetName(entity *models.ProcessLogEntitySummary) string {
+	prefix := entity.EntityType
+	switch prefix {
+	case "script_execution":
+		prefix = "exec"
+	default:
+		if len(prefix) > 12 {
+			prefix = prefix[:12]
+		}
+	}
+	id := entity.EntityID
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	name := strings.NewReplacer(":", "_", "\\", "_", "/", "_", "?", "_", "*", "_", "[", "_", "]", "_").Replace(prefix + " " + id)
+	return strings.Trim(name, "'")
+}
+
+// uniqueSheetName appends a counter when a sheet name is already used (sheet names are case-insensitive)
+func uniqueSheetName(name string, used map[string]bool) string {
+	candidate := name
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)", name, i)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,528 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// LogIngestConfig configures batching of the process_logs queue consumer
+type LogIngestConfig struct {
+	// BatchSize: số log tối đa mỗi lần insert (multi-row INSERT)
+	BatchSize int
+	// FlushInterval: thời gian tối đa 1 log nằm chờ trong batch trước khi được insert
+	FlushInterval time.Duration
+	// SideEffectWorkers: số worker xử lý side effect (topic/execution), log cùng entity luôn vào cùng worker để giữ thứ tự
+	SideEffectWorkers int
+}
+
+// withDefaults fills zero values with sane defaults
+func (c LogIngestConfig) withDefaults() LogIngestConfig {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 200
+	}
+	if c.BatchSize > 1000 {
+		c.BatchSize = 1000
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 250 * time.Millisecond
+	}
+	if c.SideEffectWorkers <= 0 {
+		c.SideEffectWorkers = 4
+	}
+	return c
+}
+
+// sideEffectQueueSize is the buffer of each side effect worker; when full the consumer blocks (backpressure)
+const sideEffectQueueSize = 1000
+
+// logIngestRetryDelay is the wait before consuming again after a batch could not be saved (DB down)
+const logIngestRetryDelay = 2 * time.Second
+
+// logConsumerReconnectDelay is the wait between attempts to re-open the consumer after its channel closed
+const logConsumerReconnectDelay = 5 * time.Second
+
+// Độ dài tối đa các cột varchar của process_logs (log dài hơn bị cắt thay vì làm hỏng cả batch)
+const (
+	maxLogEntityTypeLen = 50
+	maxLogStageLen      = 50
+	maxLogStatusLen     = 20
+	maxLogMachineIDLen  = 255
+)
+
+// pendingLog is a queued log waiting to be inserted
+type pendingLog struct {
+	req        *models.ProcessLogRequest
+	log        *models.ProcessLog
+	enqueuedAt time.Time // Thời điểm publish (AMQP timestamp) hoặc lúc nhận nếu publisher không set
+}
+
+// logIngestMetrics counts batching activity (exposed to admins via GetIngestionStats)
+type logIngestMetrics struct {
+	batchesFlushed  atomic.Int64
+	logsIngested    atomic.Int64
+	logsFailed      atomic.Int64
+	messagesDropped atomic.Int64
+	logsQuarantined atomic.Int64
+	lastBatchSize   atomic.Int64
+	maxBatchSize    atomic.Int64
+	lastLagMs       atomic.Int64
+	maxLagMs        atomic.Int64
+	lastFlushAt     atomic.Int64 // Unix nano
+	pendingEffects  atomic.Int64
+	config          atomic.Pointer[LogIngestConfig]
+}
+
+// recordBatch updates metrics after a batch is flushed
+func (m *logIngestMetrics) recordBatch(size, failed int, oldest time.Time) {
+	now := time.Now()
+	m.batchesFlushed.Add(1)
+	m.logsIngested.Add(int64(size - failed))
+	m.logsFailed.Add(int64(failed))
+	m.lastBatchSize.Store(int64(size))
+	storeMax(&m.maxBatchSize, int64(size))
+
+	lagMs := now.Sub(oldest).Milliseconds()
+	m.lastLagMs.Store(lagMs)
+	storeMax(&m.maxLagMs, lagMs)
+	m.lastFlushAt.Store(now.UnixNano())
+}
+
+func storeMax(v *atomic.Int64, value int64) {
+	for {
+		current := v.Load()
+		if value <= current || v.CompareAndSwap(current, value) {
+			return
+		}
+	}
+}
+
+// GetIngestionStats returns batching metrics of the RabbitMQ log consumer
+func (s *ProcessLogService) GetIngestionStats() *models.LogIngestionStats {
+	m := s.ingestMetrics
+	stats := &models.LogIngestionStats{
+		BatchesFlushed:     m.batchesFlushed.Load(),
+		LogsIngested:       m.logsIngested.Load(),
+		LogsFailed:         m.logsFailed.Load(),
+		MessagesDropped:    m.messagesDropped.Load(),
+		LogsQuarantined:    m.logsQuarantined.Load(),
+		LastBatchSize:      m.lastBatchSize.Load(),
+		MaxBatchSize:       m.maxBatchSize.Load(),
+		LastIngestionLagMs: m.lastLagMs.Load(),
+		MaxIngestionLagMs:  m.maxLagMs.Load(),
+		PendingSideEffects: m.pendingEffects.Load(),
+	}
+	if stats.BatchesFlushed > 0 {
+		stats.AverageBatchSize = float64(stats.LogsIngested+stats.LogsFailed) / float64(stats.BatchesFlushed)
+	}
+	if config := m.config.Load(); config != nil {
+		stats.ConsumerRunning = true
+		stats.ConfiguredBatchSize = config.BatchSize
+		stats.ConfiguredFlushMs = config.FlushInterval.Milliseconds()
+		stats.ConfiguredWorkers = config.SideEffectWorkers
+	}
+	if lastFlush := m.lastFlushAt.Load(); lastFlush > 0 {
+		t := time.Unix(0, lastFlush)
+		stats.LastFlushAt = &t
+	}
+	return stats
+}
+
+// StartRabbitMQConsumer starts consuming logs from RabbitMQ queue.
+// Log được gom batch (multi-row INSERT) theo BatchSize/FlushInterval, ack sau khi batch đã lưu.
+// Prefetch giới hạn số message chưa ack nên khi DB chậm, RabbitMQ giữ lại message (backpressure).
+// Khi channel bị đóng (broker restart, lỗi channel), consumer tự mở lại channel cho tới khi StopRabbitMQConsumer.
+func (s *ProcessLogService) StartRabbitMQConsumer(config LogIngestConfig) error {
+	config = config.withDefaults()
+
+	channel, msgs, err := s.openLogConsumer(config)
+	if err != nil {
+		return err
+	}
+
+	// Side effect workers: log cùng entity luôn vào cùng worker → xử lý đúng thứ tự
+	workers := make([]chan *models.ProcessLogRequest, config.SideEffectWorkers)
+	for i := range workers {
+		workers[i] = make(chan *models.ProcessLogRequest, sideEffectQueueSize)
+		go s.runSideEffectWorker(workers[i])
+	}
+
+	s.ingestMetrics.config.Store(&config)
+	logrus.Infof("RabbitMQ consumer started for process_logs queue (batch size: %d, flush interval: %v, side effect workers: %d)",
+		config.BatchSize, config.FlushInterval, config.SideEffectWorkers)
+
+	go func() {
+		defer func() {
+			for _, worker := range workers {
+				close(worker)
+			}
+			s.ingestMetrics.config.Store(nil)
+		}()
+
+		for {
+			stopped := s.runLogBatcher(msgs, config, workers)
+			channel.Close()
+			if stopped {
+				return
+			}
+
+			// Channel đóng: mở lại consumer, message chưa ack đã được RabbitMQ trả về queue
+			for {
+				select {
+				case <-s.stopChan:
+					logrus.Info("RabbitMQ consumer stopped")
+					return
+				case <-time.After(logConsumerReconnectDelay):
+				}
+				channel, msgs, err = s.openLogConsumer(config)
+				if err == nil {
+					logrus.Info("RabbitMQ consumer re-established for process_logs queue")
+					break
+				}
+				logrus.Errorf("Failed to re-establish RabbitMQ consumer, retrying in %v: %v", logConsumerReconnectDelay, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// openLogConsumer opens a dedicated channel and starts consuming the process_logs queue
+func (s *ProcessLogService) openLogConsumer(config LogIngestConfig) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	// Dedicated channel: Qos và manual ack không ảnh hưởng các consumer khác trên channel chung
+	channel, err := s.rabbitMQ.OpenChannel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	// Declare queue
+	queueName := "process_logs"
+	_, err = channel.QueueDeclare(
+		queueName, // name
+		true,      // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		nil,       // arguments
+	)
+	if err != nil {
+		channel.Close()
+		return nil, nil, fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	// Tối đa 2 batch chưa ack
+	if err := channel.Qos(config.BatchSize*2, 0, false); err != nil {
+		channel.Close()
+		return nil, nil, fmt.Errorf("failed to set prefetch: %w", err)
+	}
+
+	// Consume messages
+	msgs, err := channel.Consume(
+		queueName, // queue
+		"",        // consumer
+		false,     // auto-ack (ack sau khi batch được lưu)
+		false,     // exclusive
+		false,     // no-local
+		false,     // no-wait
+		nil,       // args
+	)
+	if err != nil {
+		channel.Close()
+		return nil, nil, fmt.Errorf("failed to register consumer: %w", err)
+	}
+
+	return channel, msgs, nil
+}
+
+// runLogBatcher collects messages into batches and flushes them on size or interval.
+// Returns true if the consumer was stopped, false if the channel closed.
+func (s *ProcessLogService) runLogBatcher(msgs <-chan amqp.Delivery, config LogIngestConfig, workers []chan *models.ProcessLogRequest) bool {
+	ticker := time.NewTicker(config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*pendingLog, 0, config.BatchSize)
+	var lastDelivery *amqp.Delivery
+
+	flush := func() {
+		if lastDelivery == nil {
+			return
+		}
+		if !s.flushLogBatch(batch, workers) {
+			// Lỗi tạm thời (DB down, mất kết nối): trả message về queue và chờ trước khi nhận tiếp
+			if err := lastDelivery.Nack(true, true); err != nil {
+				logrus.Errorf("Failed to nack log batch: %v", err)
+			}
+			time.Sleep(logIngestRetryDelay)
+		} else if err := lastDelivery.Ack(true); err != nil {
+			logrus.Errorf("Failed to ack log batch: %v", err)
+		}
+		batch = batch[:0]
+		lastDelivery = nil
+	}
+
+	for {
+		select {
+		case <-s.stopChan:
+			flush()
+			logrus.Info("RabbitMQ consumer stopped")
+			return true
+		case <-ticker.C:
+			flush()
+		case msg, ok := <-msgs:
+			if !ok {
+				// Channel đã đóng nên không ack được: batch đang gom sẽ được RabbitMQ giao lại
+				batch = batch[:0]
+				lastDelivery = nil
+				logrus.Warn("RabbitMQ channel closed")
+				return false
+			}
+			delivery := msg
+			lastDelivery = &delivery
+
+			if pending := s.parseLogMessage(msg); pending != nil {
+				batch = append(batch, pending)
+			}
+			if len(batch) >= config.BatchSize {
+				flush()
+			}
+		}
+	}
+}
+
+// parseLogMessage parses a queued log, returns nil if the message must be dropped
+func (s *ProcessLogService) parseLogMessage(msg amqp.Delivery) *pendingLog {
+	var req models.ProcessLogRequest
+	if err := json.Unmarshal(msg.Body, &req); err != nil {
+		logrus.Errorf("Failed to process log message: failed to unmarshal log message: %v", err)
+		s.ingestMetrics.messagesDropped.Add(1)
+		return nil
+	}
+
+	// Validate UUIDs - skip logs with "unknown" values
+	if req.EntityID == "unknown" || req.UserID == "unknown" {
+		logrus.Warnf("Skipping log with unknown IDs: entity_id=%s, user_id=%s", req.EntityID, req.UserID)
+		s.ingestMetrics.messagesDropped.Add(1)
+		return nil
+	}
+
+	// Log không insert được (sai kiểu cột) bị bỏ ngay, không để làm hỏng cả batch
+	if reason := normalizeQueuedLog(&req); reason != "" {
+		logrus.Warnf("Skipping invalid log (%s): entity_type=%.50q, entity_id=%.64q, stage=%.50q", reason, req.EntityType, req.EntityID, req.Stage)
+		s.ingestMetrics.messagesDropped.Add(1)
+		return nil
+	}
+
+	now := time.Now()
+	enqueuedAt := now
+	if !msg.Timestamp.IsZero() && msg.Timestamp.Before(now) {
+		enqueuedAt = msg.Timestamp
+	}
+
+	return &pendingLog{
+		req:        &req,
+		log:        buildProcessLog(&req, now),
+		enqueuedAt: enqueuedAt,
+	}
+}
+
+// normalizeQueuedLog makes a queued log fit the process_logs columns.
+// Chuỗi quá dài bị cắt theo độ dài varchar, ký tự NUL (Postgres text không nhận) bị bỏ.
+// Returns a reason if the log cannot be stored at all (thiếu field, entity_id / user_id không phải uuid).
+func normalizeQueuedLog(req *models.ProcessLogRequest) string {
+	req.EntityType = truncateLogField(req.EntityType, maxLogEntityTypeLen)
+	req.MachineID = truncateLogField(req.MachineID, maxLogMachineIDLen)
+	req.Stage = truncateLogField(req.Stage, maxLogStageLen)
+	req.Status = truncateLogField(req.Status, maxLogStatusLen)
+	req.Message = strings.ToValidUTF8(strings.ReplaceAll(req.Message, "\x00", ""), "")
+
+	if req.EntityType == "" || req.Stage == "" || req.Status == "" {
+		return "missing entity_type, stage or status"
+	}
+	if _, err := uuid.Parse(req.EntityID); err != nil {
+		return "entity_id is not a uuid"
+	}
+	if _, err := uuid.Parse(req.UserID); err != nil {
+		return "user_id is not a uuid"
+	}
+	return ""
+}
+
+// truncateLogField removes NUL / invalid UTF-8 and cuts a value to at most max characters (varchar(n) đếm theo ký tự)
+func truncateLogField(value string, max int) string {
+	value = strings.ToValidUTF8(strings.ReplaceAll(value, "\x00", ""), "")
+	if utf8.RuneCountInString(value) <= max {
+		return value
+	}
+	return string([]rune(value)[:max])
+}
+
+// flushLogBatch verifies a batch, saves it, broadcasts it and queues side effects.
+// Log từ queue được verify như POST /process-logs; log không verify được bị quarantine (không lưu, không side effect).
+// Nếu insert cả batch lỗi thì insert từng log: log hỏng bị bỏ (batch vẫn được ack) để không chặn queue.
+// Returns false only on transient errors (DB unavailable, mất kết nối), the batch should then be retried.
+func (s *ProcessLogService) flushLogBatch(batch []*pendingLog, workers []chan *models.ProcessLogRequest) bool {
+	if len(batch) == 0 {
+		return true
+	}
+
+	verified, suspects, err := s.verifyQueuedLogs(batch)
+	if err != nil {
+		logrus.Errorf("Failed to verify log batch of %d: %v", len(batch), err)
+		return false
+	}
+
+	if len(verified) > 0 {
+		if err := s.saveLogBatch(verified, workers); err != nil {
+			logrus.Errorf("Failed to save log batch of %d, requeueing: %v", len(verified), err)
+			return false
+		}
+	}
+
+	// Quarantine sau khi lưu batch để batch retry không tạo bản quarantine trùng
+	for _, suspect := range suspects {
+		if _, err := s.quarantineLog(suspect.box, suspect.pending.req, suspect.reason); err != nil {
+			logrus.Errorf("Failed to quarantine queued log: %v", err)
+			continue
+		}
+		s.ingestMetrics.logsQuarantined.Add(1)
+	}
+	return true
+}
+
+// suspectLog is a queued log that failed source verification
+type suspectLog struct {
+	pending *pendingLog
+	box     *models.Box // nil nếu machine_id không xác định
+	reason  string
+}
+
+// verifyQueuedLogs runs the machine / dispatch verification on queued logs.
+// Chỉ đọc DB; returns an error if verification could not run, the batch should then be retried.
+func (s *ProcessLogService) verifyQueuedLogs(batch []*pendingLog) ([]*pendingLog, []suspectLog, error) {
+	verified := make([]*pendingLog, 0, len(batch))
+	var suspects []suspectLog
+	boxes := make(map[string]*models.Box)
+
+	for _, pending := range batch {
+		req := pending.req
+		if req.MachineID == "" {
+			suspects = append(suspects, suspectLog{pending: pending, reason: "missing machine_id"})
+			continue
+		}
+
+		box, cached := boxes[req.MachineID]
+		if !cached {
+			found, err := s.boxRepo.GetByMachineID(req.MachineID)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, fmt.Errorf("failed to get box: %w", err)
+			}
+			box = found
+			boxes[req.MachineID] = box
+		}
+		if box == nil {
+			suspects = append(suspects, suspectLog{pending: pending, reason: fmt.Sprintf("unknown machine %s", req.MachineID)})
+			continue
+		}
+
+		reason, err := s.verifyLogSource(box, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		if reason != "" {
+			suspects = append(suspects, suspectLog{pending: pending, box: box, reason: reason})
+			continue
+		}
+		verified = append(verified, pending)
+	}
+	return verified, suspects, nil
+}
+
+// saveLogBatch saves verified logs, broadcasts them and queues side effects.
+// Log không insert được vì dữ liệu bị bỏ (đếm vào logs_failed). Returns an error only if the batch could not be
+// saved at all because of a transient error (không log nào được lưu, batch retry không tạo log trùng).
+func (s *ProcessLogService) saveLogBatch(batch []*pendingLog, workers []chan *models.ProcessLogRequest) error {
+	logs := make([]*models.ProcessLog, len(batch))
+	oldest := batch[0].enqueuedAt
+	for i, pending := range batch {
+		logs[i] = pending.log
+		if pending.enqueuedAt.Before(oldest) {
+			oldest = pending.enqueuedAt
+		}
+	}
+
+	saved := make([]bool, len(batch))
+	failed := 0
+	if err := s.logRepo.CreateBatch(logs); err != nil {
+		logrus.Warnf("Failed to insert log batch of %d, retrying one by one: %v", len(batch), err)
+		resetBatchLogs(logs)
+		rowErrs, err := s.logRepo.CreateEach(logs)
+		if err != nil {
+			resetBatchLogs(logs)
+			return err
+		}
+		for i, rowErr := range rowErrs {
+			if rowErr != nil {
+				logrus.Errorf("Dropping log that cannot be saved (%s/%s, stage=%s): %v",
+					batch[i].req.EntityType, batch[i].req.EntityID, batch[i].req.Stage, rowErr)
+				failed++
+				continue
+			}
+			saved[i] = true
+		}
+	} else {
+		for i := range saved {
+			saved[i] = true
+		}
+	}
+
+	s.ingestMetrics.recordBatch(len(batch), failed, oldest)
+
+	for i, pending := range batch {
+		if !saved[i] {
+			continue
+		}
+		// Broadcast via SSE (theo thứ tự seq)
+		s.sseHub.BroadcastLog(pending.log)
+
+		worker := workers[entityWorkerIndex(pending.req.EntityType, pending.req.EntityID, len(workers))]
+		s.ingestMetrics.pendingEffects.Add(1)
+		worker <- pending.req
+	}
+	return nil
+}
+
+// resetBatchLogs clears values that may have been assigned by a rolled back insert
+func resetBatchLogs(logs []*models.ProcessLog) {
+	for _, log := range logs {
+		log.ID = ""
+		log.Seq = 0
+	}
+}
+
+// runSideEffectWorker applies side effects of logs in the order they were queued
+func (s *ProcessLogService) runSideEffectWorker(queue <-chan *models.ProcessLogRequest) {
+	for req := range queue {
+		s.applyLogSideEffects(req)
+		s.ingestMetrics.pendingEffects.Add(-1)
+	}
+}
+
+// entityWorkerIndex maps an entity to a side effect worker
+func entityWorkerIndex(entityType, entityID string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(entityType))
+	h.Write([]byte{':'})
+	h.Write([]byte(entityID))
+	return int(h.Sum32() % uint32(workers))
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// logRetentionBatchSize is the number of logs archived/deleted per batch (1 batch = 1 archive file)
+const logRetentionBatchSize = 5000
+
+// LogRetentionPolicy holds tiered retention rules and archival settings
+type LogRetentionPolicy struct {
+	// Rules sorted by specificity (most specific first), always ends with the catch-all "*/*" rule
+	Rules []models.LogRetentionRule
+
+	// ArchiveEnabled: ghi log hết hạn ra file NDJSON nén gzip trước khi xóa
+	ArchiveEnabled bool
+	ArchiveDir     string
+}
+
+// ParseLogRetentionPolicy parses retention rules from a spec like "*/error=90,*/warning=14,script_execution/*=30".
+// Format mỗi rule: <entity_type>/<status>=<days>, "*" là wildcard. defaultDays dùng cho "*/*" nếu spec không có.
+// Spec rỗng dùng mặc định: error giữ 90 ngày, warning 14 ngày, còn lại defaultDays.
+func ParseLogRetentionPolicy(spec string, defaultDays int) (*LogRetentionPolicy, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = "*/error=90,*/warning=14"
+	}
+
+	var rules []models.LogRetentionRule
+	hasCatchAll := false
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		pattern, daysStr, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid retention rule %q: missing '='", part)
+		}
+		entityType, status, ok := strings.Cut(strings.TrimSpace(pattern), "/")
+		if !ok || entityType == "" || status == "" {
+			return nil, fmt.Errorf("invalid retention rule %q: pattern must be <entity_type>/<status>", part)
+		}
+		days, err := strconv.Atoi(strings.TrimSpace(daysStr))
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("invalid retention rule %q: days must be a non-negative integer", part)
+		}
+
+		rule := models.LogRetentionRule{EntityType: entityType, Status: status, Days: days}
+		if rule.Specificity() == 0 {
+			hasCatchAll = true
+		}
+		rules = append(rules, rule)
+	}
+
+	if !hasCatchAll {
+		rules = append(rules, models.LogRetentionRule{EntityType: "*", Status: "*", Days: defaultDays})
+	}
+
+	// Most specific rule first (CASE WHEN lấy rule khớp đầu tiên)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Specificity() > rules[j].Specificity()
+	})
+
+	return &LogRetentionPolicy{Rules: rules}, nil
+}
+
+// String formats the policy for logging
+func (p *LogRetentionPolicy) String() string {
+	parts := make([]string, len(p.Rules))
+	for i, rule := range p.Rules {
+		parts[i] = fmt.Sprintf("%s/%s=%dd", rule.EntityType, rule.Status, rule.Days)
+	}
+	return strings.Join(parts, ",")
+}
+
+// cleanupOldLogs archives and deletes logs past their retention, batch by batch
+// Chỉ xóa log đã hết hạn, không ảnh hưởng đến log mới đang được tạo liên tục
+func (s *ProcessLogService) cleanupOldLogs() {
+	policy := s.retentionPolicy
+	if policy == nil {
+		return
+	}
+
+	now := time.Now()
+	totalDeleted := int64(0)
+	for {
+		logs, err := s.logRepo.GetExpiredLogs(policy.Rules, now, logRetentionBatchSize)
+		if err != nil {
+			logrus.Errorf("Failed to get expired logs: %v", err)
+			return
+		}
+		if len(logs) == 0 {
+			break
+		}
+
+		// Archive trước, chỉ xóa khi ghi archive thành công để không mất log
+		if policy.ArchiveEnabled {
+			if _, err := s.archiveLogs(logs, policy.ArchiveDir); err != nil {
+				logrus.Errorf("Failed to archive expired logs, skipping deletion: %v", err)
+				return
+			}
+		}
+
+		ids := make([]string, len(logs))
+		for i, log := range logs {
+			ids[i] = log.ID
+		}
+		deletedCount, err := s.logRepo.DeleteByIDs(ids)
+		if err != nil {
+			logrus.Errorf("Failed to delete expired logs: %v", err)
+			return
+		}
+		totalDeleted += deletedCount
+
+		if len(logs) < logRetentionBatchSize {
+			break
+		}
+	}
+
+	if totalDeleted > 0 {
+		logrus.Infof("Log cleanup completed: deleted %d expired log entries (policy: %s)", totalDeleted, policy)
+	} else {
+		logrus.Debugf("Log cleanup completed: no expired logs (policy: %s)", policy)
+	}
+}
+
+// archiveLogs writes logs to a gzip-compressed NDJSON file and records it in log_archives
+func (s *ProcessLogService) archiveLogs(logs []*models.ProcessLog, archiveDir string) (*models.LogArchive, error) {
+	now := time.Now().UTC()
+	dir := filepath.Join(archiveDir, now.Format("2006"), now.Format("01"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	fileName := fmt.Sprintf("process_logs_%s_%d-%d.ndjson.gz", now.Format("20060102T150405Z"), logs[0].Seq, logs[len(logs)-1].Seq)
+	filePath := filepath.Join(dir, fileName)
+
+	// Ghi ra file tạm rồi rename để không bao giờ có archive ghi dở
+	tmpPath := filePath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive file: %w", err)
+	}
+
+	gz := gzip.NewWriter(f)
+	encoder := json.NewEncoder(gz)
+	archive := &models.LogArchive{
+		FileName: fileName,
+		FilePath: filePath,
+		LogCount: len(logs),
+		MinSeq:   logs[0].Seq,
+		MaxSeq:   logs[len(logs)-1].Seq,
+		FromTime: logs[0].CreatedAt,
+		ToTime:   logs[0].CreatedAt,
+	}
+	for _, log := range logs {
+		if err := encoder.Encode(log); err != nil {
+			gz.Close()
+			f.Close()
+			os.Remove(tmpPath)
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+		if log.CreatedAt.Before(archive.FromTime) {
+			archive.FromTime = log.CreatedAt
+		}
+		if log.CreatedAt.After(archive.ToTime) {
+			archive.ToTime = log.CreatedAt
+		}
+	}
+
+	if err := gz.Close(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to close archive: %w", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to finalize archive: %w", err)
+	}
+
+	if info, err := os.Stat(filePath); err == nil {
+		archive.SizeBytes = info.Size()
+	}
+
+	if err := s.archiveRepo.Create(archive); err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("failed to save archive record: %w", err)
+	}
+
+	logrus.Infof("[Log] Archived %d logs (seq %d-%d) to %s", archive.LogCount, archive.MinSeq, archive.MaxSeq, filePath)
+	return archive, nil
+}
+
+// GetLogArchives retrieves log archives (admin)
+func (s *ProcessLogService) GetLogArchives(page, pageSize int) ([]*models.LogArchive, int64, error) {
+	return s.archiveRepo.GetPaginated(page, pageSize)
+}
+
+// OpenLogArchive opens an archive file for download (admin)
+func (s *ProcessLogService) OpenLogArchive(id string) (*models.LogArchive, *os.File, error) {
+	archive, err := s.archiveRepo.GetByID(id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("archive not found: %w", err)
+	}
+
+	f, err := os.Open(archive.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return archive, f, nil
+}
@@ -2,10 +2,11 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/sirupsen/logrus"
@@ -14,27 +15,45 @@ import (
 
 type ProcessLogService struct {
 	logRepo                *repository.ProcessLogRepository
+	quarantineRepo         *repository.QuarantinedProcessLogRepository // Log ingest không qua được verify
 	topicRepo              *repository.TopicRepository
-	scriptRepo             *repository.ScriptRepository // Để xóa project khi lỗi
+	topicUserRepo          *repository.TopicUserRepository // Để check quyền xem log theo topic
+	scriptRepo             *repository.ScriptRepository    // Để xóa project khi lỗi
+	boxRepo                *repository.BoxRepository       // Verify machine của log từ queue
 	sseHub                 *SSEHub
 	rabbitMQ               *RabbitMQService
 	db                     *gorm.DB
 	scriptExecutionService *ScriptExecutionService // Optional: injected later
+	topicService           *TopicService           // Quyền xem log theo topic, injected later
 	stopChan               chan bool
 	cleanupStopChan        chan bool
+	retentionPolicy        *LogRetentionPolicy // Set by StartLogCleanup
+	archiveRepo            *repository.LogArchiveRepository
+	ingestMetrics          *logIngestMetrics    // Batching metrics of the RabbitMQ consumer
+	stageRegistry          *LogStageRegistry    // Side effect handlers theo (entity_type, stage, status)
+	topicRemovalService    *TopicRemovalService // Gỡ topic (soft delete) khi automation báo lỗi
 }
 
 func NewProcessLogService(logRepo *repository.ProcessLogRepository, sseHub *SSEHub, rabbitMQ *RabbitMQService, db *gorm.DB) *ProcessLogService {
-	return &ProcessLogService{
+	s := &ProcessLogService{
 		logRepo:         logRepo,
+		quarantineRepo:  repository.NewQuarantinedProcessLogRepository(db),
+		archiveRepo:     repository.NewLogArchiveRepository(db),
 		topicRepo:       repository.NewTopicRepository(db),
+		topicUserRepo:   repository.NewTopicUserRepository(db),
 		scriptRepo:      repository.NewScriptRepository(db),
+		boxRepo:         repository.NewBoxRepository(db),
 		sseHub:          sseHub,
 		rabbitMQ:        rabbitMQ,
 		db:              db,
 		stopChan:        make(chan bool),
 		cleanupStopChan: make(chan bool),
+		ingestMetrics:   &logIngestMetrics{},
+		stageRegistry:   NewLogStageRegistry(),
 	}
+	s.topicRemovalService = NewTopicRemovalService(s.topicRepo, repository.NewTopicRemovalRepository(db))
+	s.registerDefaultStageHandlers()
+	return s
 }
 
 // SetScriptExecutionService sets the script execution service (injected after creation to avoid circular dependency)
@@ -42,60 +61,9 @@ func (s *ProcessLogService) SetScriptExecutionService(scriptExecutionService *Sc
 	s.scriptExecutionService = scriptExecutionService
 }
 
-// StartRabbitMQConsumer starts consuming logs from RabbitMQ queue
-func (s *ProcessLogService) StartRabbitMQConsumer() error {
-	// Declare queue
-	queueName := "process_logs"
-	_, err := s.rabbitMQ.channel.QueueDeclare(
-		queueName, // name
-		true,      // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare queue: %w", err)
-	}
-
-	// Consume messages
-	msgs, err := s.rabbitMQ.channel.Consume(
-		queueName, // queue
-		"",        // consumer
-		true,      // auto-ack
-		false,     // exclusive
-		false,     // no-local
-		false,     // no-wait
-		nil,       // args
-	)
-	if err != nil {
-		return fmt.Errorf("failed to register consumer: %w", err)
-	}
-
-	logrus.Info("RabbitMQ consumer started for process_logs queue")
-
-	// Process messages in goroutine
-	go func() {
-		for {
-			select {
-			case <-s.stopChan:
-				logrus.Info("RabbitMQ consumer stopped")
-				return
-			case msg, ok := <-msgs:
-				if !ok {
-					logrus.Warn("RabbitMQ channel closed")
-					return
-				}
-
-				// Process message
-				if err := s.processLogMessage(msg.Body); err != nil {
-					logrus.Errorf("Failed to process log message: %v", err)
-				}
-			}
-		}
-	}()
-
-	return nil
+// SetTopicService sets the topic service used for log access checks (injected after creation to avoid circular dependency)
+func (s *ProcessLogService) SetTopicService(topicService *TopicService) {
+	s.topicService = topicService
 }
 
 // StopRabbitMQConsumer stops the consumer
@@ -103,19 +71,25 @@ func (s *ProcessLogService) StopRabbitMQConsumer() {
 	close(s.stopChan)
 }
 
-// processLogMessage processes a log message from RabbitMQ
-func (s *ProcessLogService) processLogMessage(body []byte) error {
-	var req models.ProcessLogRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		return fmt.Errorf("failed to unmarshal log message: %w", err)
-	}
+// CreateLog creates a log entry (can be called directly or via RabbitMQ)
+func (s *ProcessLogService) CreateLog(req *models.ProcessLogRequest) (*models.ProcessLog, error) {
+	log := buildProcessLog(req, time.Now())
 
-	// Validate UUIDs - skip logs with "unknown" values
-	if req.EntityID == "unknown" || req.UserID == "unknown" {
-		logrus.Warnf("Skipping log with unknown IDs: entity_id=%s, user_id=%s", req.EntityID, req.UserID)
-		return nil // Skip this log instead of failing
+	// Save to database
+	if err := s.logRepo.Create(log); err != nil {
+		return nil, fmt.Errorf("failed to create log: %w", err)
 	}
 
+	// Broadcast via SSE
+	s.sseHub.BroadcastLog(log)
+
+	s.applyLogSideEffects(req)
+
+	return log, nil
+}
+
+// buildProcessLog converts a log request into a ProcessLog entry
+func buildProcessLog(req *models.ProcessLogRequest, createdAt time.Time) *models.ProcessLog {
 	// Convert metadata
 	var metadataJSON models.JSON
 	if req.Metadata != nil {
@@ -123,8 +97,7 @@ func (s *ProcessLogService) processLogMessage(body []byte) error {
 		json.Unmarshal(metadataBytes, &metadataJSON)
 	}
 
-	// Create log entry
-	log := &models.ProcessLog{
+	return &models.ProcessLog{
 		EntityType: req.EntityType,
 		EntityID:   req.EntityID,
 		UserID:     req.UserID,
@@ -133,224 +106,320 @@ func (s *ProcessLogService) processLogMessage(body []byte) error {
 		Status:     req.Status,
 		Message:    req.Message,
 		Metadata:   metadataJSON,
-		CreatedAt:  time.Now(),
+		CreatedAt:  createdAt,
 	}
+}
 
-	// Save to database
-	if err := s.logRepo.Create(log); err != nil {
-		return fmt.Errorf("failed to save log to database: %w", err)
+// applyLogSideEffects dispatches a log to the stage handlers (sync status, delete on failure...)
+func (s *ProcessLogService) applyLogSideEffects(req *models.ProcessLogRequest) {
+	s.stageRegistry.Dispatch(newLogEvent(req))
+}
+
+// StageRegistry returns the registry used to subscribe handlers to log stages
+func (s *ProcessLogService) StageRegistry() *LogStageRegistry {
+	return s.stageRegistry
+}
+
+// ErrMachineMismatch is returned when the machine_id in a log does not match the authenticated machine
+var ErrMachineMismatch = errors.New("machine_id does not match authenticated machine")
+
+// IngestMachineLog verifies a log reported by an authenticated machine (POST /process-logs).
+// Log hợp lệ được tạo như CreateLog; log không verify được bị cách ly (quarantine):
+// không lưu vào process_logs, không broadcast, không gây side effect (xóa topic, mark project...).
+// Returns either the created log or the quarantined record.
+func (s *ProcessLogService) IngestMachineLog(box *models.Box, req *models.ProcessLogRequest) (*models.ProcessLog, *models.QuarantinedProcessLog, error) {
+	// Machine chỉ được gửi log dưới tên của chính nó
+	if req.MachineID != "" && req.MachineID != box.MachineID {
+		return nil, nil, ErrMachineMismatch
 	}
+	req.MachineID = box.MachineID
 
-	// Broadcast via SSE
-	s.sseHub.BroadcastLog(log)
+	reason, err := s.verifyLogSource(box, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if reason != "" {
+		quarantined, err := s.quarantineLog(box, req, reason)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, quarantined, nil
+	}
+
+	log, err := s.CreateLog(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return log, nil, nil
+}
 
-	s.handleTopicLog(req.EntityType, req.EntityID, req.UserID, req.Stage, req.Status, req.Metadata)
+// verifyLogSource checks that the reporting machine is the one the entity was dispatched to
+// and that the user in the log is related to the entity.
+// Returns a non-empty reason if the log must be quarantined.
+func (s *ProcessLogService) verifyLogSource(box *models.Box, req *models.ProcessLogRequest) (string, error) {
+	if _, err := uuid.Parse(req.UserID); err != nil {
+		return "invalid user_id", nil
+	}
+	if !IsAuthorizableEntityType(req.EntityType) {
+		return fmt.Sprintf("unsupported entity_type %q, cannot verify dispatch", req.EntityType), nil
+	}
 
-	// Handle script execution logs
-	s.handleScriptExecutionLog(req.EntityType, req.EntityID, req.Stage, req.Status, req.Metadata)
+	// user_id trong body phải là người có quyền với entity (creator/assigned/người chạy execution)
+	related, err := s.CanUserAccessEntity(req.UserID, req.EntityType, req.EntityID, false)
+	if err != nil {
+		return "", err
+	}
+	if !related {
+		return "entity not found or user is not related to entity", nil
+	}
 
-	return nil
+	dispatchedBoxIDs, err := s.getDispatchedBoxIDs(req.EntityType, req.EntityID)
+	if err != nil {
+		return "", err
+	}
+	if len(dispatchedBoxIDs) == 0 {
+		return "no machine is currently dispatched for this entity", nil
+	}
+	for _, boxID := range dispatchedBoxIDs {
+		if boxID == box.ID {
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("machine %s is not the machine dispatched for this entity", box.MachineID), nil
 }
 
-// CreateLog creates a log entry (can be called directly or via RabbitMQ)
-func (s *ProcessLogService) CreateLog(req *models.ProcessLogRequest) (*models.ProcessLog, error) {
-	// Convert metadata
+// getDispatchedBoxIDs returns the boxes an entity is currently dispatched to
+// - script_execution: box ghi trong execution (theo execution.ID, hoặc các execution đang chạy của topic)
+// - mọi entity gắn với topic: machine đang chạy Chrome profile của owner (UserProfile.CurrentMachineID)
+func (s *ProcessLogService) getDispatchedBoxIDs(entityType, entityID string) ([]string, error) {
+	var boxIDs []string
+	topicID := entityID
+
+	if entityType == "script_execution" {
+		execution, err := s.scriptRepo.GetExecutionByID(entityID)
+		if err == nil {
+			topicID = execution.TopicID
+			if execution.BoxID != nil {
+				boxIDs = append(boxIDs, *execution.BoxID)
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to get execution: %w", err)
+		} else {
+			// entity_id là topic.ID (automation backend nhận X-Entity-ID = topic.ID)
+			executions, err := s.scriptRepo.GetRunningExecutionsByTopicID(entityID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get running executions: %w", err)
+			}
+			for _, execution := range executions {
+				if execution.BoxID != nil {
+					boxIDs = append(boxIDs, *execution.BoxID)
+				}
+			}
+		}
+	}
+
+	topic, err := s.topicRepo.GetByID(topicID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return boxIDs, nil
+		}
+		return nil, fmt.Errorf("failed to get topic: %w", err)
+	}
+	if topic.UserProfile.CurrentMachineID != nil {
+		boxIDs = append(boxIDs, *topic.UserProfile.CurrentMachineID)
+	}
+
+	return boxIDs, nil
+}
+
+// quarantineLog stores a log that failed verification (box nil nếu machine không xác định được)
+func (s *ProcessLogService) quarantineLog(box *models.Box, req *models.ProcessLogRequest, reason string) (*models.QuarantinedProcessLog, error) {
 	var metadataJSON models.JSON
 	if req.Metadata != nil {
 		metadataBytes, _ := json.Marshal(req.Metadata)
 		json.Unmarshal(metadataBytes, &metadataJSON)
 	}
 
-	// Create log entry
-	log := &models.ProcessLog{
+	quarantined := &models.QuarantinedProcessLog{
+		MachineID:  req.MachineID,
 		EntityType: req.EntityType,
 		EntityID:   req.EntityID,
 		UserID:     req.UserID,
-		MachineID:  req.MachineID,
 		Stage:      req.Stage,
 		Status:     req.Status,
 		Message:    req.Message,
 		Metadata:   metadataJSON,
+		Reason:     reason,
 		CreatedAt:  time.Now(),
 	}
-
-	// Save to database
-	if err := s.logRepo.Create(log); err != nil {
-		return nil, fmt.Errorf("failed to create log: %w", err)
+	if box != nil {
+		quarantined.BoxID = &box.ID
+		quarantined.MachineID = box.MachineID
 	}
 
-	// Broadcast via SSE
-	s.sseHub.BroadcastLog(log)
-
-	s.handleTopicLog(req.EntityType, req.EntityID, req.UserID, req.Stage, req.Status, req.Metadata)
+	if err := s.quarantineRepo.Create(quarantined); err != nil {
+		return nil, fmt.Errorf("failed to quarantine log: %w", err)
+	}
 
-	// Handle script execution logs
-	s.handleScriptExecutionLog(req.EntityType, req.EntityID, req.Stage, req.Status, req.Metadata)
+	logrus.Warnf("[Log] Quarantined log from machine %s (%s/%s, stage=%s): %s",
+		quarantined.MachineID, req.EntityType, req.EntityID, req.Stage, reason)
+	return quarantined, nil
+}
 
-	return log, nil
+// GetQuarantinedLogs retrieves quarantined logs for admin review
+func (s *ProcessLogService) GetQuarantinedLogs(page, pageSize int, pendingOnly bool) ([]*models.QuarantinedProcessLog, int64, error) {
+	return s.quarantineRepo.GetPaginated(page, pageSize, pendingOnly)
 }
 
-// updateTopicOnCompletion updates topic when automation backend reports completion
-func (s *ProcessLogService) updateTopicOnCompletion(topicID string, metadata map[string]interface{}) {
-	// Get topic
-	topic, err := s.topicRepo.GetByID(topicID)
+// ReleaseQuarantinedLog ingests a quarantined log after admin review (log is created with its side effects)
+func (s *ProcessLogService) ReleaseQuarantinedLog(id, adminUserID string) (*models.ProcessLog, error) {
+	quarantined, err := s.quarantineRepo.GetByID(id)
 	if err != nil {
-		logrus.Errorf("Failed to get topic %s for completion update: %v", topicID, err)
-		return
+		return nil, fmt.Errorf("quarantined log not found: %w", err)
 	}
-
-	// Update SyncStatus (topic is just a container now; gem info lives on ScriptProject)
-	topic.SyncStatus = "synced"
-	now := time.Now()
-	topic.LastSyncedAt = &now
-	topic.SyncError = ""
-
-	// Save to database
-	if err := s.topicRepo.Update(topic); err != nil {
-		logrus.Errorf("Failed to update topic %s on completion: %v", topicID, err)
-	} else {
-		logrus.Infof("Topic %s marked as synced after receiving completion log from automation backend", topicID)
+	if quarantined.ReleasedAt != nil {
+		return nil, repository.ErrQuarantinedLogReleased
 	}
-}
 
-// handleTopicLog xử lý log liên quan đến topic (thành công hoặc thất bại)
-// Nếu metadata có projectID hoặc gemName → đây là log của project, xóa project thay vì topic
-func (s *ProcessLogService) handleTopicLog(entityType, topicID, userID, stage, status string, metadata map[string]interface{}) {
-	if entityType != "topic" {
-		return
-	}
-
-	// Thành công → update sync status
-	if status == "success" && (stage == "completed" || stage == "create_gem_completed") {
-		s.updateTopicOnCompletion(topicID, metadata)
-		return
-	}
-
-	// Thất bại → xóa project nếu có projectID trong metadata hoặc gemName, nếu không thì xóa topic
-	if status == "failed" || status == "error" {
-		// Check nếu đây là log của project
-		var projectID string
-		if metadata != nil {
-			// Ưu tiên lấy từ metadata (automation backend gửi)
-			if pid, ok := metadata["projectID"].(string); ok {
-				projectID = pid
-			} else if pid, ok := metadata["project_id"].(string); ok {
-				projectID = pid
-			} else if gemName, ok := metadata["gemName"].(string); ok {
-				// Extract projectID từ gemName (format: {projectID}_{name})
-				// Tìm phần đầu tiên trước dấu "_" cuối cùng
-				if idx := strings.LastIndex(gemName, "_"); idx > 0 {
-					// Lấy phần đầu (projectID) - nhưng cần check xem có phải là projectID không
-					// ProjectID là timestamp (số), nên check xem phần đầu có phải là số không
-					potentialProjectID := gemName[:idx]
-					// Nếu là số (timestamp) thì đó là projectID
-					if len(potentialProjectID) > 10 { // Timestamp thường > 10 chữ số
-						projectID = potentialProjectID
-					}
-				}
-			}
-		}
+	req := &models.ProcessLogRequest{
+		EntityType: quarantined.EntityType,
+		EntityID:   quarantined.EntityID,
+		UserID:     quarantined.UserID,
+		MachineID:  quarantined.MachineID,
+		Stage:      quarantined.Stage,
+		Status:     quarantined.Status,
+		Message:    quarantined.Message,
+		Metadata:   quarantined.Metadata,
+	}
 
-		if projectID != "" {
-			// Đây là log của project → xóa project
-			// Tìm script bằng topicID và userID từ log
-			if userID != "" {
-				script, err := s.scriptRepo.GetByTopicIDAndUserID(topicID, userID)
-				if err == nil && script != nil {
-					if deleteErr := s.scriptRepo.DeleteProjectsByScriptIDAndProjectIDs(script.ID, []string{projectID}); deleteErr != nil {
-						logrus.Errorf("Failed to delete project %s after automation %s (%s): %v", projectID, stage, status, deleteErr)
-					} else {
-						logrus.Warnf("Deleted project %s due to automation %s (%s)", projectID, stage, status)
-					}
-				} else {
-					logrus.Warnf("Failed to find script for topic %s, user %s to delete project %s: %v", topicID, userID, projectID, err)
-				}
-			} else {
-				logrus.Warnf("Cannot delete project %s: userID is empty in log", projectID)
-			}
-		} else {
-			// Đây là log của topic (không phải project) → xóa topic (logic cũ)
-			if deleteErr := s.topicRepo.Delete(topicID); deleteErr != nil {
-				logrus.Errorf("Failed to delete topic %s after automation %s (%s): %v", topicID, stage, status, deleteErr)
-			} else {
-				logrus.Warnf("Deleted topic %s due to automation %s (%s)", topicID, stage, status)
-			}
+	// Claim + insert log trong cùng transaction, side effect chỉ chạy cho request claim thành công
+	log := buildProcessLog(req, time.Now())
+	if err := s.quarantineRepo.Release(id, adminUserID, log); err != nil {
+		if errors.Is(err, repository.ErrQuarantinedLogReleased) {
+			return nil, err
 		}
+		return nil, fmt.Errorf("failed to release log: %w", err)
 	}
+
+	s.sseHub.BroadcastLog(log)
+	s.applyLogSideEffects(req)
+
+	logrus.Infof("[Log] Quarantined log %s released by %s as log %s", id, adminUserID, log.ID)
+	return log, nil
 }
 
-// handleScriptExecutionLog xử lý log liên quan đến script execution
-// entityID ở đây là topic.ID (vì automation backend nhận X-Entity-ID = topic.ID)
-// Nếu metadata chứa execution_id → dùng trực tiếp để match đúng execution
-func (s *ProcessLogService) handleScriptExecutionLog(entityType, entityID, stage, status string, metadata map[string]interface{}) {
-	if entityType != "script_execution" {
-		return
+// IsAuthorizableEntityType reports whether logs of this entity type can be resolved to an owner and assignees
+func IsAuthorizableEntityType(entityType string) bool {
+	switch entityType {
+	case "topic", "gemini", "script_execution":
+		return true
 	}
+	return false
+}
 
-	// Handle project_completed log
-	if stage == "project_completed" && (status == "success" || status == "info") {
-		if s.scriptExecutionService == nil {
-			return
-		}
+// CanUserAccessEntity checks if a user can read logs (history, SSE, export) of an entity.
+//   - topic, gemini: entity_id là topic.ID → creator hoặc user được assign (quyền read trở lên)
+//   - script_execution: entity_id là topic.ID (automation backend nhận X-Entity-ID = topic.ID) hoặc execution.ID
+//     → người chạy execution, creator hoặc user được assign của topic
+//
+// Entity không tồn tại hoặc loại entity không hỗ trợ trả về false (handler trả 404), chỉ lỗi DB mới trả error.
+func (s *ProcessLogService) CanUserAccessEntity(userID, entityType, entityID string, isAdmin bool) (bool, error) {
+	if isAdmin {
+		return true, nil
+	}
+	if !IsAuthorizableEntityType(entityType) {
+		return false, nil
+	}
+	// entity_id là uuid, tránh lỗi "invalid input syntax for type uuid" từ Postgres
+	if _, err := uuid.Parse(entityID); err != nil {
+		return false, nil
+	}
 
-		var projectID, executionID string
-		if metadata != nil {
-			if pid, ok := metadata["project_id"].(string); ok {
-				projectID = pid
-			} else if pid, ok := metadata["project"].(string); ok {
-				projectID = pid
-			}
-			if eid, ok := metadata["execution_id"].(string); ok {
-				executionID = eid
+	topicID := entityID
+	if entityType == "script_execution" {
+		execution, err := s.scriptRepo.GetExecutionByID(entityID)
+		if err == nil {
+			if execution.UserID == userID {
+				return true, nil
 			}
+			topicID = execution.TopicID
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, fmt.Errorf("failed to get execution: %w", err)
 		}
+	}
 
-		if projectID == "" {
-			return
-		}
-
-		if executionID != "" {
-			if err := s.scriptExecutionService.MarkProjectCompleted(executionID, projectID); err != nil {
-				logrus.Errorf("[Log] Failed to mark project completed: %v", err)
-			}
-		} else {
-			if err := s.scriptExecutionService.MarkProjectCompletedByTopicID(entityID, projectID); err != nil {
-				logrus.Errorf("[Log] Failed to mark project completed: %v", err)
-			}
+	if s.topicService == nil {
+		return false, errors.New("topic service is not configured")
+	}
+	// Cùng rule với topic API: creator hoặc user được assign với quyền read trở lên
+	if _, err := s.topicService.AuthorizeTopic(userID, topicID, false, models.TopicPermissionRead); err != nil {
+		if errors.Is(err, ErrTopicAccessDenied) || errors.Is(err, ErrTopicPermissionDenied) {
+			return false, nil
 		}
-		return
+		return false, fmt.Errorf("failed to check topic access: %w", err)
 	}
+	return true, nil
+}
 
-	// Handle project_failed log
-	if stage == "project_failed" && (status == "failed" || status == "error") {
-		if s.scriptExecutionService == nil {
-			return
-		}
+// GetLogsByEntity retrieves logs for a specific entity
+func (s *ProcessLogService) GetLogsByEntity(entityType, entityID string, limit, offset int) ([]*models.ProcessLog, error) {
+	return s.logRepo.GetByEntity(entityType, entityID, limit, offset)
+}
 
-		var projectID, executionID string
-		if metadata != nil {
-			if pid, ok := metadata["project_id"].(string); ok {
-				projectID = pid
-			} else if pid, ok := metadata["project"].(string); ok {
-				projectID = pid
-			}
-			if eid, ok := metadata["execution_id"].(string); ok {
-				executionID = eid
-			}
-		}
+// GetLatestLogSeq returns the highest committed log seq (SSE stream bắt đầu từ đây khi không có Last-Event-ID)
+func (s *ProcessLogService) GetLatestLogSeq() (int64, error) {
+	return s.logRepo.GetLatestSeq()
+}
 
-		if projectID == "" {
-			return
-		}
+// GetLogsByEntityAfterSeq retrieves logs for an entity with seq greater than afterSeq (ascending, used for SSE backfill)
+func (s *ProcessLogService) GetLogsByEntityAfterSeq(entityType, entityID string, afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+	return s.logRepo.GetByEntityAfterSeq(entityType, entityID, afterSeq, limit)
+}
+
+// SearchLogs searches logs with structured filters and cursor pagination (cursor = seq của log cuối trang trước).
+// User thường chỉ thấy log của mình và log của topic mình sở hữu/được assign (giống CanUserAccessEntity).
+func (s *ProcessLogService) SearchLogs(userID string, isAdmin bool, filter *models.ProcessLogSearchFilter, cursor int64, limit int) ([]*models.ProcessLog, int64, bool, error) {
+	scope, err := s.getAccessScope(userID, isAdmin)
+	if err != nil {
+		return nil, 0, false, err
+	}
 
-		logrus.Warnf("[Log] Project %s failed (execution=%s)", projectID, executionID)
-		// TODO: Implement mark project as failed
+	// Lấy dư 1 bản ghi để biết còn trang sau hay không
+	logs, err := s.logRepo.Search(filter, scope, cursor, limit+1)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	hasMore := len(logs) > limit
+	if hasMore {
+		logs = logs[:limit]
 	}
+	var nextCursor int64
+	if hasMore && len(logs) > 0 {
+		nextCursor = logs[len(logs)-1].Seq
+	}
+	return logs, nextCursor, hasMore, nil
 }
 
-// GetLogsByEntity retrieves logs for a specific entity
-func (s *ProcessLogService) GetLogsByEntity(entityType, entityID string, limit, offset int) ([]*models.ProcessLog, error) {
-	return s.logRepo.GetByEntity(entityType, entityID, limit, offset)
+// getAccessScope returns the log access scope of a non-admin user (nil for admins = no restriction)
+func (s *ProcessLogService) getAccessScope(userID string, isAdmin bool) (*repository.ProcessLogAccessScope, error) {
+	if isAdmin {
+		return nil, nil
+	}
+	ownedTopics, err := s.topicRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owned topics: %w", err)
+	}
+	assignedTopicIDs, err := s.topicUserRepo.GetTopicIDsAssignedToUserWithPermission(userID, models.TopicPermissionsAtLeast(models.TopicPermissionRead))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assigned topics: %w", err)
+	}
+	topicIDs := assignedTopicIDs
+	for _, topic := range ownedTopics {
+		topicIDs = append(topicIDs, topic.ID)
+	}
+	return &repository.ProcessLogAccessScope{UserID: userID, TopicIDs: topicIDs}, nil
 }
 
 // GetLogsByUserID retrieves logs for a specific user
@@ -358,6 +427,16 @@ func (s *ProcessLogService) GetLogsByUserID(userID string, limit, offset int) ([
 	return s.logRepo.GetByUserID(userID, limit, offset)
 }
 
+// GetLogsByUserIDAfterSeq retrieves logs for a user with seq greater than afterSeq (ascending, used for SSE backfill)
+func (s *ProcessLogService) GetLogsByUserIDAfterSeq(userID string, afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+	return s.logRepo.GetByUserIDAfterSeq(userID, afterSeq, limit)
+}
+
+// GetLogsAfterSeq retrieves logs matching filter with seq greater than afterSeq (ascending, used for SSE backfill)
+func (s *ProcessLogService) GetLogsAfterSeq(filter *models.ProcessLogFilter, afterSeq int64, limit int) ([]*models.ProcessLog, error) {
+	return s.logRepo.GetAfterSeq(filter, afterSeq, limit)
+}
+
 // GetLatestLog retrieves the latest log for an entity
 func (s *ProcessLogService) GetLatestLog(entityType, entityID string) (*models.ProcessLog, error) {
 	return s.logRepo.GetLatestByEntity(entityType, entityID)
@@ -385,25 +464,28 @@ func (s *ProcessLogService) Log(entityType, entityID, userID, machineID, stage,
 	return err
 }
 
-// StartLogCleanup starts a background goroutine to periodically clean up old logs
-func (s *ProcessLogService) StartLogCleanup(interval time.Duration, retentionDays int) {
+// StartLogCleanup starts the tiered retention job: expired logs are archived (if enabled) then deleted.
+// See process_log_retention.go for policies and archival.
+func (s *ProcessLogService) StartLogCleanup(interval time.Duration, policy *LogRetentionPolicy) {
+	s.retentionPolicy = policy
+
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
 		// Run initial cleanup
-		s.cleanupOldLogs(retentionDays)
+		s.cleanupOldLogs()
 
 		for {
 			select {
 			case <-ticker.C:
-				s.cleanupOldLogs(retentionDays)
+				s.cleanupOldLogs()
 			case <-s.cleanupStopChan:
 				return
 			}
 		}
 	}()
-	logrus.Infof("Log cleanup service started (interval: %v, retention: %d days)", interval, retentionDays)
+	logrus.Infof("Log cleanup service started (interval: %v, policy: %s, archive: %v)", interval, policy, policy.ArchiveEnabled)
 }
 
 // StopLogCleanup stops the log cleanup service
@@ -413,19 +495,3 @@ func (s *ProcessLogService) StopLogCleanup() {
 	default:
 	}
 }
-
-// cleanupOldLogs deletes logs older than the specified number of days
-// Chỉ xóa log cũ, không ảnh hưởng đến log mới đang được tạo liên tục
-func (s *ProcessLogService) cleanupOldLogs(retentionDays int) {
-	deletedCount, err := s.logRepo.DeleteOldLogs(retentionDays)
-	if err != nil {
-		logrus.Errorf("Failed to cleanup old logs: %v", err)
-		return
-	}
-
-	if deletedCount > 0 {
-		logrus.Infof("Log cleanup completed: deleted %d log entries older than %d day(s)", deletedCount, retentionDays)
-	} else {
-		logrus.Debugf("Log cleanup completed: no logs to delete (all logs are within %d day(s))", retentionDays)
-	}
-}
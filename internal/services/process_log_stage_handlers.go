@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// registerDefaultStageHandlers registers the built-in side effects of automation logs.
+// Stage mới: đăng ký thêm handler qua StageRegistry() (vd: trong service sở hữu entity), không cần sửa file này.
+func (s *ProcessLogService) registerDefaultStageHandlers() {
+	registry := s.stageRegistry
+
+	// Stage chỉ mang tính thông tin (tiến trình), không có side effect
+	registry.RegisterKnownStages(LogStageWildcard, "chrome_launching", "chrome_launched", "gem_creating", "gem_created", "completed", "failed")
+
+	// Topic: automation hoàn tất → đánh dấu synced
+	HandleLogStage(registry, "topic.mark_synced",
+		LogStagePattern{EntityType: "topic", Stage: "completed", Statuses: []string{"success"}},
+		s.handleTopicCompleted)
+	HandleLogStage(registry, "topic.mark_synced",
+		LogStagePattern{EntityType: "topic", Stage: "create_gem_completed", Statuses: []string{"success"}},
+		s.handleTopicCompleted)
+
+	// Topic: thất bại ở bất kỳ stage nào → gỡ project (nếu log thuộc project) hoặc gỡ topic (soft delete, có thể restore)
+	HandleLogStage(registry, "topic.remove_on_failure",
+		LogStagePattern{EntityType: "topic", Stage: LogStageWildcard, Statuses: []string{"failed", "error"}},
+		s.handleTopicFailed)
+
+	// Script execution: cập nhật tiến độ project
+	HandleLogStage(registry, "script_execution.project_completed",
+		LogStagePattern{EntityType: "script_execution", Stage: "project_completed", Statuses: []string{"success", "info"}},
+		s.handleExecutionProjectCompleted)
+	HandleLogStage(registry, "script_execution.project_failed",
+		LogStagePattern{EntityType: "script_execution", Stage: "project_failed", Statuses: []string{"failed", "error"}},
+		s.handleExecutionProjectFailed)
+}
+
+// handleTopicCompleted updates topic when automation backend reports completion
+func (s *ProcessLogService) handleTopicCompleted(event *LogEvent, _ *ProjectLogMetadata) error {
+	topicID := event.EntityID
+
+	// Get topic
+	topic, err := s.topicRepo.GetByID(topicID)
+	if err != nil {
+		return fmt.Errorf("failed to get topic %s for completion update: %w", topicID, err)
+	}
+
+	// Update SyncStatus (topic is just a container now; gem info lives on ScriptProject)
+	topic.SyncStatus = "synced"
+	now := time.Now()
+	topic.LastSyncedAt = &now
+	topic.SyncError = ""
+
+	// Save to database
+	if err := s.topicRepo.Update(topic); err != nil {
+		return fmt.Errorf("failed to update topic %s on completion: %w", topicID, err)
+	}
+
+	logrus.Infof("Topic %s marked as synced after receiving completion log from automation backend", topicID)
+	return nil
+}
+
+// handleTopicFailed gỡ project (đánh dấu lỗi, purge sau grace period) nếu log thuộc project (metadata có project ID hoặc gemName),
+// nếu không thì gỡ topic với state "failed" (soft delete, restore được trong grace period)
+func (s *ProcessLogService) handleTopicFailed(event *LogEvent, metadata *ProjectLogMetadata) error {
+	topicID := event.EntityID
+
+	// Log đã gây ra việc gỡ topic / project được lưu vào audit
+	trigger := TopicRemovalTrigger{
+		Type:   models.TopicRemovalTriggerAutomationLog,
+		Reason: fmt.Sprintf("automation %s (%s): %s", event.Stage, event.Status, event.Message),
+		Details: map[string]interface{}{
+			"entity_type": event.EntityType,
+			"entity_id":   event.EntityID,
+			"user_id":     event.UserID,
+			"machine_id":  event.MachineID,
+			"stage":       event.Stage,
+			"status":      event.Status,
+			"message":     event.Message,
+			"metadata":    event.Metadata,
+		},
+	}
+
+	projectID := metadata.ResolveProjectID()
+	if projectID == "" {
+		// Đây là log của topic (không phải project) → gỡ topic
+		if _, err := s.topicRemovalService.RemoveTopic(topicID, models.TopicRemovalStateFailed, trigger); err != nil {
+			return fmt.Errorf("failed to remove topic %s after automation %s (%s): %w", topicID, event.Stage, event.Status, err)
+		}
+		return nil
+	}
+
+	// Đây là log của project → tìm script bằng topicID và userID từ log để gỡ project.
+	// Project chỉ bị đánh dấu lỗi, purge job xóa sau grace period (restore project / topic giữ lại project)
+	if event.UserID == "" {
+		logrus.Warnf("Cannot remove project %s: userID is empty in log", projectID)
+		return nil
+	}
+	script, err := s.scriptRepo.GetByTopicIDAndUserID(topicID, event.UserID)
+	if err != nil || script == nil {
+		logrus.Warnf("Failed to find script for topic %s, user %s to remove project %s: %v", topicID, event.UserID, projectID, err)
+		return nil
+	}
+	if _, err := s.topicRemovalService.RemoveProject(topicID, script.ID, projectID, trigger); err != nil {
+		return fmt.Errorf("failed to remove project %s after automation %s (%s): %w", projectID, event.Stage, event.Status, err)
+	}
+	logrus.Warnf("Project %s marked failed due to automation %s (%s), purged after grace period", projectID, event.Stage, event.Status)
+	return nil
+}
+
+// handleExecutionProjectCompleted marks a project of a script execution as completed.
+// entityID ở đây là topic.ID (vì automation backend nhận X-Entity-ID = topic.ID),
+// nếu metadata chứa execution_id → dùng trực tiếp để match đúng execution
+func (s *ProcessLogService) handleExecutionProjectCompleted(event *LogEvent, metadata *ProjectLogMetadata) error {
+	if s.scriptExecutionService == nil {
+		return nil
+	}
+
+	projectID := metadata.ResolveProjectID()
+	if projectID == "" {
+		return nil
+	}
+
+	if executionID := string(metadata.ExecutionID); executionID != "" {
+		return s.scriptExecutionService.MarkProjectCompleted(executionID, projectID)
+	}
+	return s.scriptExecutionService.MarkProjectCompletedByTopicID(event.EntityID, projectID)
+}
+
+// handleExecutionProjectFailed records a failed project of a script execution
+func (s *ProcessLogService) handleExecutionProjectFailed(event *LogEvent, metadata *ProjectLogMetadata) error {
+	if s.scriptExecutionService == nil {
+		return nil
+	}
+
+	projectID := metadata.ResolveProjectID()
+	if projectID == "" {
+		return nil
+	}
+
+	logrus.Warnf("[Log] Project %s failed (execution=%s)", projectID, metadata.ExecutionID)
+	// TODO: Implement mark project as failed
+	return nil
+}
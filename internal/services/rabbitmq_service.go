@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -13,6 +14,8 @@ import (
 type RabbitMQService struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
+	url     string
+	connMu  sync.Mutex
 }
 
 // GetChannel returns the RabbitMQ channel (for use by other services)
@@ -20,6 +23,23 @@ func (s *RabbitMQService) GetChannel() *amqp.Channel {
 	return s.channel
 }
 
+// OpenChannel opens a dedicated channel on the shared connection (for consumers that need their own channel).
+// Nếu connection đã đóng (broker restart) thì dial lại để consumer mở lại được channel.
+func (s *RabbitMQService) OpenChannel() (*amqp.Channel, error) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	if s.conn.IsClosed() {
+		conn, err := amqp.Dial(s.url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reconnect to RabbitMQ: %w", err)
+		}
+		s.conn = conn
+		log.Printf("RabbitMQ connection re-established")
+	}
+	return s.conn.Channel()
+}
+
 func NewRabbitMQService() (*RabbitMQService, error) {
 	// Get RabbitMQ connection details from environment
 	host := getEnv("RABBITMQ_HOST", "localhost")
@@ -62,6 +82,7 @@ func NewRabbitMQService() (*RabbitMQService, error) {
 	service := &RabbitMQService{
 		conn:    conn,
 		channel: channel,
+		url:     url,
 	}
 
 	log.Printf("RabbitMQ service initialized successfully")
@@ -103,6 +124,8 @@ func (s *RabbitMQService) Close() error {
 			log.Printf("Error closing channel: %v", err)
 		}
 	}
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
 	if s.conn != nil {
 		if err := s.conn.Close(); err != nil {
 			log.Printf("Error closing connection: %v", err)
@@ -0,0 +1,398 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUploadSessionNotFound is returned when the upload session does not exist or belongs to another user
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	// ErrUploadOffsetMismatch is returned when a chunk is sent with an offset khác offset hiện tại của session
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	// ErrUploadChecksumMismatch is returned when a chunk or the whole file does not match the given checksum
+	ErrUploadChecksumMismatch = errors.New("upload checksum mismatch")
+	// ErrUploadChunkTooLarge is returned when a chunk exceeds the max chunk size or the declared total size
+	ErrUploadChunkTooLarge = errors.New("upload chunk too large")
+	// ErrUploadIncomplete is returned when completing a session before all bytes were received
+	ErrUploadIncomplete = errors.New("upload incomplete")
+	// ErrUploadSessionClosed is returned when sending chunks to a completed or expired session
+	ErrUploadSessionClosed = errors.New("upload session closed")
+	// ErrUploadCompleting is returned while another request is storing the file of the session
+	ErrUploadCompleting = errors.New("upload session is being completed")
+	// ErrInvalidUploadChecksum is returned when a checksum value cannot be parsed
+	ErrInvalidUploadChecksum = errors.New("invalid upload checksum")
+)
+
+const (
+	defaultUploadSessionTTLHours = 24
+	defaultUploadChunkMaxMB      = 64
+	uploadSessionCleanupBatch    = 200
+)
+
+// ResumableUploadService handles chunked uploads of large files (tạo session, gửi chunk theo offset,
+// hỏi tiến độ, complete). Chunk được ghi nối vào file tạm trong UPLOAD_SESSION_DIR (cần dùng chung giữa các replica),
+// complete thì chuyển qua FileService.StoreFile như upload thường (dedup, quota).
+type ResumableUploadService struct {
+	sessionRepo  *repository.UploadSessionRepository
+	fileService  *FileService
+	quotas       *StorageQuotaService
+	dir          string
+	ttl          time.Duration
+	maxChunkSize int64
+}
+
+// NewResumableUploadService creates a resumable upload service.
+// UPLOAD_SESSION_DIR (default ./storage/upload-sessions), UPLOAD_SESSION_TTL_HOURS (default 24, tính từ chunk cuối),
+// UPLOAD_CHUNK_MAX_MB (default 64).
+func NewResumableUploadService(sessionRepo *repository.UploadSessionRepository, fileService *FileService, quotas *StorageQuotaService) *ResumableUploadService {
+	dir := getEnv("UPLOAD_SESSION_DIR", "./storage/upload-sessions")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logrus.Warnf("Failed to create upload session directory %s: %v", dir, err)
+	}
+
+	ttlHours := defaultUploadSessionTTLHours
+	if value, err := strconv.Atoi(getEnv("UPLOAD_SESSION_TTL_HOURS", "")); err == nil && value > 0 {
+		ttlHours = value
+	}
+	maxChunkMB := int64(defaultUploadChunkMaxMB)
+	if value, err := strconv.ParseInt(getEnv("UPLOAD_CHUNK_MAX_MB", ""), 10, 64); err == nil && value > 0 {
+		maxChunkMB = value
+	}
+
+	return &ResumableUploadService{
+		sessionRepo:  sessionRepo,
+		fileService:  fileService,
+		quotas:       quotas,
+		dir:          dir,
+		ttl:          time.Duration(ttlHours) * time.Hour,
+		maxChunkSize: maxChunkMB * 1024 * 1024,
+	}
+}
+
+// MaxChunkSize returns the max size of one chunk
+func (s *ResumableUploadService) MaxChunkSize() int64 {
+	return s.maxChunkSize
+}
+
+// CreateSession starts a resumable upload. Quota (dung lượng, loại file) được kiểm tra ngay với total_size.
+func (s *ResumableUploadService) CreateSession(userID string, req *models.CreateUploadSessionRequest) (*models.UploadSession, error) {
+	name, err := normalizeFileName(req.FileName)
+	if err != nil {
+		return nil, err
+	}
+	checksum := strings.ToLower(strings.TrimSpace(req.ChecksumSHA256))
+	if checksum != "" {
+		if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("%w: checksum_sha256 must be a hex encoded SHA-256", ErrInvalidUploadChecksum)
+		}
+	}
+
+	// Kiểm tra folder / tags trước khi nhận nội dung
+	uploadReq := &models.FileUploadRequest{Folder: req.Folder, Tags: req.Tags}
+	fileModel, err := newUploadedFile(userID, name, strings.TrimSpace(req.MimeType), uploadReq)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quotas.CheckUpload(userID, name, &fileModel.MimeType, req.TotalSize); err != nil {
+		return nil, err
+	}
+
+	session := &models.UploadSession{
+		UserID:         userID,
+		FileName:       name,
+		MimeType:       fileModel.MimeType,
+		TotalSize:      req.TotalSize,
+		ChecksumSHA256: checksum,
+		Folder:         fileModel.Folder,
+		Tags:           fileModel.Tags,
+		ProjectID:      req.ProjectID,
+		TempPromptID:   req.PromptID,
+		Status:         models.UploadSessionStatusUploading,
+		ExpiresAt:      time.Now().Add(s.ttl),
+	}
+	if session.Tags == nil {
+		session.Tags = models.StringArray{}
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+
+	part, err := os.OpenFile(s.partPath(session.ID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		_ = s.sessionRepo.Delete(session.ID)
+		return nil, fmt.Errorf("failed to create upload session file: %w", err)
+	}
+	part.Close()
+
+	logrus.Infof("Created upload session %s for user %s: %s (%d bytes)", session.ID, userID, name, req.TotalSize)
+	return session, nil
+}
+
+// GetSession retrieves an upload session of a user
+func (s *ResumableUploadService) GetSession(userID, sessionID string) (*models.UploadSession, error) {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, ErrUploadSessionNotFound
+	}
+	return session, nil
+}
+
+// AppendChunk writes a chunk at offset (phải bằng offset hiện tại của session).
+// checksum (optional) là "sha256 <base64>" theo header Upload-Checksum; sai checksum thì chunk bị bỏ, offset giữ nguyên.
+func (s *ResumableUploadService) AppendChunk(userID, sessionID string, offset int64, chunk io.Reader, checksum string) (*models.UploadSession, error) {
+	if _, err := s.GetSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+	expected, err := parseUploadChecksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sessionRepo.AppendChunk(sessionID, time.Now().Add(s.ttl), func(session *models.UploadSession) (int64, error) {
+		if session.Status != models.UploadSessionStatusUploading || time.Now().After(session.ExpiresAt) {
+			return 0, ErrUploadSessionClosed
+		}
+		if offset != session.Offset {
+			return 0, fmt.Errorf("%w: expected offset %d, got %d", ErrUploadOffsetMismatch, session.Offset, offset)
+		}
+
+		limit := session.TotalSize - session.Offset
+		if limit > s.maxChunkSize {
+			limit = s.maxChunkSize
+		}
+
+		part, err := os.OpenFile(s.partPath(session.ID), os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open upload session file: %w", err)
+		}
+		defer part.Close()
+		// Bỏ phần ghi dở của request trước bị ngắt (chưa được tính vào offset)
+		if err := part.Truncate(session.Offset); err != nil {
+			return 0, fmt.Errorf("failed to prepare upload session file: %w", err)
+		}
+		if _, err := part.Seek(session.Offset, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("failed to prepare upload session file: %w", err)
+		}
+
+		hasher := sha256.New()
+		written, err := io.Copy(part, io.TeeReader(io.LimitReader(chunk, limit+1), hasher))
+		if err == nil && written > limit {
+			err = fmt.Errorf("%w: at most %d bytes accepted at offset %d", ErrUploadChunkTooLarge, limit, session.Offset)
+		}
+		if err == nil && expected != nil && !bytes.Equal(hasher.Sum(nil), expected) {
+			err = ErrUploadChecksumMismatch
+		}
+		if err != nil {
+			if truncErr := part.Truncate(session.Offset); truncErr != nil {
+				logrus.Warnf("Failed to roll back chunk of upload session %s: %v", session.ID, truncErr)
+			}
+			return 0, err
+		}
+		return written, nil
+	})
+}
+
+// CompleteUpload creates the file from the received content (kiểm tra đủ dung lượng và checksum cả file).
+// Complete lại session đã complete trả về file đã tạo với created = false (client retry an toàn).
+func (s *ResumableUploadService) CompleteUpload(userID, sessionID string) (*models.File, bool, error) {
+	current, err := s.GetSession(userID, sessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	if current.Status == models.UploadSessionStatusCompleted && current.FileID != nil {
+		file, err := s.fileService.GetFile(*current.FileID, userID)
+		if err != nil {
+			return nil, false, err
+		}
+		return file, false, nil
+	}
+
+	// Claim session trong transaction ngắn, hash / lưu file nằm ngoài lock
+	session, err := s.sessionRepo.Claim(sessionID, time.Now().Add(s.ttl), func(session *models.UploadSession) error {
+		if session.Status == models.UploadSessionStatusCompleting {
+			return ErrUploadCompleting
+		}
+		if session.Status != models.UploadSessionStatusUploading {
+			return ErrUploadSessionClosed
+		}
+		if session.Offset != session.TotalSize {
+			return fmt.Errorf("%w: received %d of %d bytes", ErrUploadIncomplete, session.Offset, session.TotalSize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	fileModel, err := s.storeSessionFile(session)
+	if err != nil {
+		if releaseErr := s.sessionRepo.ReleaseClaim(session.ID); releaseErr != nil {
+			logrus.Warnf("Failed to release upload session %s after failed complete: %v", session.ID, releaseErr)
+		}
+		return nil, false, err
+	}
+
+	if err := s.sessionRepo.Finalize(session.ID, fileModel.ID, time.Now().Add(s.ttl)); err != nil {
+		// Session bị hủy trong lúc lưu file: bỏ file vừa tạo
+		if deleteErr := s.fileService.DeleteFile(fileModel); deleteErr != nil {
+			logrus.Warnf("Failed to delete file %s of aborted upload session %s: %v", fileModel.ID, session.ID, deleteErr)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, ErrUploadSessionNotFound
+		}
+		return nil, false, fmt.Errorf("failed to complete upload session: %w", err)
+	}
+
+	s.removePart(session.ID)
+	logrus.Infof("Completed upload session %s: file %s (%s, %d bytes)", session.ID, fileModel.ID, fileModel.OriginalName, fileModel.FileSize)
+	return fileModel, true, nil
+}
+
+// storeSessionFile verifies the checksum of a claimed session and stores its content as a file
+func (s *ResumableUploadService) storeSessionFile(session *models.UploadSession) (*models.File, error) {
+	part, err := os.Open(s.partPath(session.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload session file: %w", err)
+	}
+	defer part.Close()
+
+	if session.ChecksumSHA256 != "" {
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, part); err != nil {
+			return nil, fmt.Errorf("failed to read upload session file: %w", err)
+		}
+		if hex.EncodeToString(hasher.Sum(nil)) != session.ChecksumSHA256 {
+			return nil, fmt.Errorf("%w: content does not match checksum_sha256", ErrUploadChecksumMismatch)
+		}
+		if _, err := part.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to read upload session file: %w", err)
+		}
+	}
+
+	fileModel, err := newUploadedFile(session.UserID, session.FileName, session.MimeType, &models.FileUploadRequest{
+		ProjectID: session.ProjectID,
+		PromptID:  session.TempPromptID,
+		Folder:    session.Folder,
+		Tags:      session.Tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.fileService.StoreFile(fileModel, part, session.TotalSize); err != nil {
+		return nil, err
+	}
+	return fileModel, nil
+}
+
+// AbortSession cancels an upload session and deletes the received content
+func (s *ResumableUploadService) AbortSession(userID, sessionID string) error {
+	session, err := s.GetSession(userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.Status == models.UploadSessionStatusCompleting {
+		return ErrUploadCompleting
+	}
+	if err := s.sessionRepo.Delete(sessionID); err != nil {
+		return fmt.Errorf("failed to delete upload session: %w", err)
+	}
+	s.removePart(sessionID)
+	return nil
+}
+
+// CleanupExpiredSessions deletes expired sessions (upload bỏ dở và session đã complete quá TTL)
+func (s *ResumableUploadService) CleanupExpiredSessions() {
+	now := time.Now()
+	abandoned, completed := 0, 0
+	for {
+		sessions, err := s.sessionRepo.GetExpired(now, uploadSessionCleanupBatch)
+		if err != nil {
+			logrus.Errorf("Failed to get expired upload sessions: %v", err)
+			return
+		}
+
+		for _, session := range sessions {
+			if err := s.sessionRepo.Delete(session.ID); err != nil {
+				logrus.Errorf("Failed to delete expired upload session %s: %v", session.ID, err)
+				return
+			}
+			s.removePart(session.ID)
+			if session.Status == models.UploadSessionStatusCompleted {
+				completed++
+			} else {
+				abandoned++
+			}
+		}
+
+		if len(sessions) < uploadSessionCleanupBatch {
+			break
+		}
+	}
+
+	if abandoned > 0 || completed > 0 {
+		logrus.Infof("Upload session cleanup: removed %d incomplete and %d completed sessions", abandoned, completed)
+	}
+}
+
+// StartCleanupJob periodically deletes expired upload sessions
+func (s *ResumableUploadService) StartCleanupJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		s.CleanupExpiredSessions()
+		for range ticker.C {
+			s.CleanupExpiredSessions()
+		}
+	}()
+	logrus.Infof("Upload session cleanup job started (interval: %v, ttl: %v)", interval, s.ttl)
+}
+
+func (s *ResumableUploadService) partPath(sessionID string) string {
+	return filepath.Join(s.dir, sessionID+".part")
+}
+
+func (s *ResumableUploadService) removePart(sessionID string) {
+	if err := os.Remove(s.partPath(sessionID)); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("Failed to delete upload session file %s: %v", sessionID, err)
+	}
+}
+
+// parseUploadChecksum parses an Upload-Checksum header value ("sha256 <base64>", theo tus checksum extension)
+func parseUploadChecksum(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	algorithm, encoded, found := strings.Cut(value, " ")
+	if !found || !strings.EqualFold(algorithm, "sha256") {
+		return nil, fmt.Errorf("%w: expected \"sha256 <base64 digest>\"", ErrInvalidUploadChecksum)
+	}
+	digest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("%w: digest must be a base64 encoded SHA-256", ErrInvalidUploadChecksum)
+	}
+	return digest, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleNameExists    = errors.New("role name already exists")
+	ErrDefaultRole       = errors.New("default role can not be deleted or renamed")
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+// GetUserPermissions returns the permission names of a user (admin có mọi permission)
+func (s *RoleService) GetUserPermissions(user *models.User) (map[string]bool, error) {
+	permissions := make(map[string]bool)
+	if user.IsAdmin {
+		for _, definition := range models.DefaultPermissions {
+			permissions[definition.Name] = true
+		}
+		return permissions, nil
+	}
+
+	names, err := s.roleRepo.GetUserPermissionNames(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user permissions: %w", err)
+	}
+	for _, name := range names {
+		permissions[name] = true
+	}
+	return permissions, nil
+}
+
+// UserHasPermission checks if a user has a permission through one of their roles (admin có mọi permission)
+func (s *RoleService) UserHasPermission(user *models.User, permission string) (bool, error) {
+	permissions, err := s.GetUserPermissions(user)
+	if err != nil {
+		return false, err
+	}
+	return permissions[permission], nil
+}
+
+// GetAllPermissions returns all permissions that can be granted to roles
+func (s *RoleService) GetAllPermissions() ([]models.Permission, error) {
+	return s.roleRepo.GetAllPermissions()
+}
+
+// CreateRoleWithPermissions creates a new role with a permission set
+func (s *RoleService) CreateRoleWithPermissions(req *models.CreateRoleRequest) (*models.Role, error) {
+	name := strings.TrimSpace(req.Name)
+	exists, err := s.roleRepo.CheckNameExists(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check role existence: %w", err)
+	}
+	if exists {
+		return nil, fmt.Errorf("%w: %s", ErrRoleNameExists, name)
+	}
+
+	permissions, err := s.resolvePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &models.Role{
+		Name:        name,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := s.roleRepo.Create(role); err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+
+	logrus.Infof("Created role '%s' (ID: %s) with permissions %v", role.Name, role.ID, permissionNames(permissions))
+	return role, nil
+}
+
+// UpdateRole updates the name, description and/or permission set of a role.
+// Role mặc định (topic_creator, topic_user, admin) không đổi tên được vì code dựa vào tên.
+func (s *RoleService) UpdateRole(roleID string, req *models.UpdateRoleRequest) (*models.Role, error) {
+	role, err := s.getRole(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name != role.Name {
+			if models.IsDefaultRole(role.Name) {
+				return nil, ErrDefaultRole
+			}
+			exists, err := s.roleRepo.CheckNameExists(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check role existence: %w", err)
+			}
+			if exists {
+				return nil, fmt.Errorf("%w: %s", ErrRoleNameExists, name)
+			}
+			role.Name = name
+		}
+	}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+
+	var permissions []models.Permission
+	if req.Permissions != nil {
+		if permissions, err = s.resolvePermissions(*req.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.roleRepo.Update(role, permissions); err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+
+	logrus.Infof("Updated role '%s' (ID: %s), permissions %v", role.Name, role.ID, permissionNames(role.Permissions))
+	return role, nil
+}
+
+// DeleteRole deletes a role (gỡ role khỏi user); role mặc định không xóa được
+func (s *RoleService) DeleteRole(roleID string) error {
+	role, err := s.getRole(roleID)
+	if err != nil {
+		return err
+	}
+	if models.IsDefaultRole(role.Name) {
+		return ErrDefaultRole
+	}
+
+	if err := s.roleRepo.Delete(role.ID); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	logrus.Infof("Deleted role '%s' (ID: %s)", role.Name, role.ID)
+	return nil
+}
+
+// getRole retrieves a role with its permissions (ErrRoleNotFound nếu không tồn tại)
+func (s *RoleService) getRole(roleID string) (*models.Role, error) {
+	role, err := s.roleRepo.GetByID(roleID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	return role, nil
+}
+
+// resolvePermissions loads permissions by name, rejecting unknown names
+func (s *RoleService) resolvePermissions(names []string) ([]models.Permission, error) {
+	unique := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		unique = append(unique, name)
+	}
+
+	permissions, err := s.roleRepo.GetPermissionsByNames(unique)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	}
+	if len(permissions) != len(unique) {
+		found := make(map[string]bool, len(permissions))
+		for _, permission := range permissions {
+			found[permission.Name] = true
+		}
+		var unknown []string
+		for _, name := range unique {
+			if !found[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, strings.Join(unknown, ", "))
+	}
+	return permissions, nil
+}
+
+// permissionNames returns the sorted names of permissions
+func permissionNames(permissions []models.Permission) []string {
+	names := make([]string, len(permissions))
+	for i, permission := range permissions {
+		names[i] = permission.Name
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
@@ -82,7 +83,7 @@ func (s *RoleService) AssignRoleToUser(userID string, roleID string) error {
 	logrus.Infof("Assigned role '%s' (ID: %s) to user '%s'", role.Name, role.ID, user.Username)
 
 	// If role is topic_creator, create user profile
-	if role.Name == "topic_creator" && s.userProfileService != nil {
+	if role.Name == models.RoleTopicCreator && s.userProfileService != nil {
 		// Check if user already has a profile
 		existingProfile, err := s.userProfileService.GetByUserID(user.ID)
 		if err == nil && existingProfile != nil {
@@ -176,9 +177,20 @@ func (s *RoleService) GetUserRoleResponse(userID string) (*models.UserRoleRespon
 		roleNames[i] = role.Name
 	}
 
+	permissions, err := s.GetUserPermissions(user)
+	if err != nil {
+		return nil, err
+	}
+	permissionNames := make([]string, 0, len(permissions))
+	for name := range permissions {
+		permissionNames = append(permissionNames, name)
+	}
+	sort.Strings(permissionNames)
+
 	return &models.UserRoleResponse{
-		UserID:   user.ID,
-		Username: user.Username,
-		Roles:    roleNames,
+		UserID:      user.ID,
+		Username:    user.Username,
+		Roles:       roleNames,
+		Permissions: permissionNames,
 	}, nil
 }
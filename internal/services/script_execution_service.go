@@ -23,6 +23,7 @@ type ScriptExecutionService struct {
 	chromeProfileService *ChromeProfileService
 	rabbitMQ             *RabbitMQService
 	fileService          *FileService
+	outputService        *ExecutionOutputService // Resolve input files từ output của execution
 	baseURL              string
 	executionStopChan    chan bool // Stop channel cho execution worker (cũ)
 	projectStopChan      chan bool // Stop channel cho project worker (mới)
@@ -39,6 +40,10 @@ func NewScriptExecutionService(
 	baseURL string,
 ) *ScriptExecutionService {
 	logrus.Info("[ScriptExecutionService] Initializing service...")
+	var outputService *ExecutionOutputService
+	if fileService != nil {
+		outputService = NewExecutionOutputService(fileService, scriptRepo, topicRepo)
+	}
 	return &ScriptExecutionService{
 		scriptRepo:           scriptRepo,
 		topicRepo:            topicRepo,
@@ -46,6 +51,7 @@ func NewScriptExecutionService(
 		chromeProfileService: chromeProfileService,
 		rabbitMQ:             rabbitMQ,
 		fileService:          fileService,
+		outputService:        outputService,
 		baseURL:              baseURL,
 		executionStopChan:    make(chan bool),
 		projectStopChan:      make(chan bool),
@@ -471,6 +477,11 @@ func (s *ScriptExecutionService) processProjectMessage(msg amqp.Delivery) error
 
 		tunnelURL = launchResp.TunnelURL
 		execution.TunnelURL = tunnelURL
+		// Ghi lại machine được dispatch để verify log do machine gửi về
+		if launchResp.MachineID != "" {
+			boxID := launchResp.MachineID
+			execution.BoxID = &boxID
+		}
 		s.scriptRepo.UpdateExecution(execution)
 	} else {
 		tunnelURL = execution.TunnelURL
@@ -517,12 +528,12 @@ func (s *ScriptExecutionService) callAutomationBackendProjectAsync(
 	promptList := make([]map[string]interface{}, 0, len(prompts))
 	for _, prompt := range prompts {
 		// Convert file names thành download URLs
-		inputFilesURLs := s.convertFileNamesToURLs(execution.UserID, prompt.InputFiles)
+		inputFilesURLs := s.convertInputFilesToURLs(execution, prompt)
 
 		promptMap := map[string]interface{}{
 			"prompt":           prompt.PromptText,
 			"output":           prompt.Filename,   // Chỉ file name, không có extension
-			"input_files":      prompt.InputFiles, // File names từ previous executions
+			"input_files":      prompt.InputFiles, // File names từ previous executions / output của project trước
 			"input_files_urls": inputFilesURLs,    // URLs để download từ backend cloud
 			"prompt_id":        prompt.ID,
 		}
@@ -548,6 +559,8 @@ func (s *ScriptExecutionService) callAutomationBackendProjectAsync(
 	if project.Filename != "" {
 		requestBody["output_merge"] = project.Filename
 	}
+	// Machine upload output (prompt/merge) về server qua endpoint này (machine credentials)
+	requestBody["output_upload_url"] = fmt.Sprintf("%s/api/v1/machines/outputs", strings.TrimSuffix(s.baseURL, "/"))
 
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
@@ -838,6 +851,13 @@ func (s *ScriptExecutionService) executeScript(execution *models.ScriptExecution
 	tunnelURL := launchResp.TunnelURL
 	profileDirName := ownerProfile.ProfileDirName
 
+	// Ghi lại machine được dispatch để verify log do machine gửi về
+	if launchResp.MachineID != "" {
+		boxID := launchResp.MachineID
+		execution.BoxID = &boxID
+		s.scriptRepo.UpdateExecution(execution)
+	}
+
 	// Execute each project in order
 	for i, projectID := range executionOrder {
 		project := s.findProjectByID(script.Projects, projectID)
@@ -884,12 +904,12 @@ func (s *ScriptExecutionService) callAutomationBackendProject(
 	promptList := make([]map[string]interface{}, 0, len(prompts))
 	for _, prompt := range prompts {
 		// Convert file names thành download URLs
-		inputFilesURLs := s.convertFileNamesToURLs(execution.UserID, prompt.InputFiles)
+		inputFilesURLs := s.convertInputFilesToURLs(execution, prompt)
 
 		promptMap := map[string]interface{}{
 			"prompt":           prompt.PromptText,
 			"output":           prompt.Filename,   // Chỉ file name, không có extension
-			"input_files":      prompt.InputFiles, // File names từ previous executions
+			"input_files":      prompt.InputFiles, // File names từ previous executions / output của project trước
 			"input_files_urls": inputFilesURLs,    // URLs để download từ backend cloud
 			"prompt_id":        prompt.ID,
 		}
@@ -916,6 +936,8 @@ func (s *ScriptExecutionService) callAutomationBackendProject(
 	if project.Filename != "" {
 		requestBody["output_merge"] = project.Filename
 	}
+	// Machine upload output (prompt/merge) về server qua endpoint này (machine credentials)
+	requestBody["output_upload_url"] = fmt.Sprintf("%s/api/v1/machines/outputs", strings.TrimSuffix(s.baseURL, "/"))
 
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
@@ -1135,37 +1157,23 @@ func (s *ScriptExecutionService) isPermanentError(err error) bool {
 	return false
 }
 
-// convertFileNamesToURLs converts file names (original_name) to download URLs
-// Query files from user and match by original_name, then create download URLs
-func (s *ScriptExecutionService) convertFileNamesToURLs(userID string, fileNames []string) []string {
-	if len(fileNames) == 0 || s.fileService == nil {
+// convertInputFilesToURLs converts the input files of a prompt to download URLs
+// Prompt có input_file_refs resolve theo file_id / latest / output; prompt cũ ưu tiên output cùng execution rồi file cùng original_name
+func (s *ScriptExecutionService) convertInputFilesToURLs(execution *models.ScriptExecution, prompt *models.ScriptPrompt) []string {
+	if (len(prompt.InputFiles) == 0 && len(prompt.InputFileRefs) == 0) || s.outputService == nil {
 		return []string{}
 	}
 
-	// Get all user files
-	userFiles, err := s.fileService.GetUserFiles(userID)
-	if err != nil {
-		logrus.Warnf("Failed to get user files for converting to URLs: %v", err)
-		return []string{}
-	}
-
-	// Create map: original_name -> file (lấy file mới nhất nếu có nhiều cùng tên)
-	fileMap := make(map[string]*models.File)
-	for _, file := range userFiles {
-		existing, exists := fileMap[file.OriginalName]
-		if !exists || file.CreatedAt.After(existing.CreatedAt) {
-			fileMap[file.OriginalName] = file
-		}
-	}
+	files := s.outputService.ResolvePromptInputFiles(execution.UserID, execution.ID, prompt)
 
-	// Convert file names to URLs
-	urls := make([]string, 0, len(fileNames))
-	for _, fileName := range fileNames {
-		file, found := fileMap[fileName]
-		if !found {
-			continue
+	// Convert files to signed URLs (endpoint download yêu cầu token)
+	urls := make([]string, 0, len(files))
+	for _, file := range files {
+		downloadURL, err := s.fileService.GenerateSignedDownloadURL(file.ID)
+		if err != nil {
+			logrus.Warnf("Failed to sign download URL for input file %s of execution %s: %v", file.ID, execution.ID, err)
+			downloadURL = s.fileService.GetDownloadURL(file.ID)
 		}
-		downloadURL := fmt.Sprintf("%s/api/v1/files/%s/download", strings.TrimSuffix(s.baseURL, "/"), file.ID)
 		urls = append(urls, downloadURL)
 	}
 
@@ -3,13 +3,14 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
@@ -17,6 +18,13 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	// ErrInvalidPromptInputFile is returned when a prompt input_file_refs entry is invalid
+	ErrInvalidPromptInputFile = errors.New("invalid prompt input file")
+	// ErrUploadStagingConflict is returned when staged uploads of a prompt were consumed by a concurrent save
+	ErrUploadStagingConflict = errors.New("staged uploads conflict")
+)
+
 type ScriptService struct {
 	scriptRepo           *repository.ScriptRepository
 	topicRepo            *repository.TopicRepository
@@ -25,9 +33,8 @@ type ScriptService struct {
 	chromeProfileService *ChromeProfileService
 	geminiAccountService *GeminiAccountService
 	fileService          *FileService
+	uploadStaging        *UploadStagingService // File vừa upload chờ gắn vào prompt / gem (lưu DB)
 	baseURL              string
-	// In-memory cache để lưu file IDs vừa upload theo userID
-	recentUploadedFiles sync.Map // map[string][]string
 }
 
 func NewScriptService(
@@ -38,6 +45,7 @@ func NewScriptService(
 	chromeProfileService *ChromeProfileService,
 	geminiAccountService *GeminiAccountService,
 	fileService *FileService,
+	uploadStaging *UploadStagingService,
 ) *ScriptService {
 	// Get base URL from environment
 	baseURL := os.Getenv("BASE_URL")
@@ -58,6 +66,7 @@ func NewScriptService(
 		chromeProfileService: chromeProfileService,
 		geminiAccountService: geminiAccountService,
 		fileService:          fileService,
+		uploadStaging:        uploadStaging,
 		baseURL:              baseURL,
 	}
 }
@@ -200,6 +209,20 @@ func (s *ScriptService) SaveScript(topicID, userID string, req *models.SaveScrip
 	promptsToCreate := make([]*models.ScriptPrompt, 0)
 	promptsToUpdate := make([]*models.ScriptPrompt, 0)
 	allExistingPrompts := make([]*models.ScriptPrompt, 0) // Collect all existing prompts for deletion check
+	stagingIDs := make([]string, 0)                       // Upload đang stage được gắn vào prompt, consume cùng transaction lưu prompt
+
+	// Tên output của script (filename của prompt / output_name của project) để nhận diện input là output của bước trước
+	outputNames := make(map[string]bool)
+	for _, projectReq := range req.Projects {
+		if projectReq.OutputName != "" {
+			outputNames[projectReq.OutputName] = true
+		}
+		for _, promptReq := range projectReq.Prompts {
+			if promptReq.Filename != "" {
+				outputNames[promptReq.Filename] = true
+			}
+		}
+	}
 
 	for _, projectReq := range req.Projects {
 		project := projectIDMap[projectReq.ID]
@@ -219,25 +242,16 @@ func (s *ScriptService) SaveScript(topicID, userID string, req *models.SaveScrip
 		}
 
 		for order, promptReq := range projectReq.Prompts {
-			// Nếu có PromptID, lấy files từ cache; nếu không, dùng InputFiles từ request
-			inputFiles := promptReq.InputFiles
-			if promptReq.PromptID != "" {
-				// Lấy files từ cache dựa trên prompt_id (KHÔNG xóa để user vẫn có thể GET files sau đó)
-				fileIDs := s.GetUploadedFilesForPrompt(userID, project.ProjectID, promptReq.PromptID)
-				if len(fileIDs) > 0 {
-					// Convert file IDs thành file names (original_name) để gửi cho automation backend
-					fileNames := make([]string, 0, len(fileIDs))
-					for _, fileID := range fileIDs {
-						file, err := s.fileService.GetFile(fileID, userID)
-						if err != nil {
-							logrus.Warnf("Failed to get file %s for prompt: %v", fileID, err)
-							continue
-						}
-						fileNames = append(fileNames, file.OriginalName)
-					}
-					inputFiles = fileNames
-				}
+			// input_file_refs / input_files từ request, cộng file vừa upload cho prompt (staging) ghim theo ID
+			var existingRefs models.PromptInputFiles
+			if existingPrompt, exists := existingPromptMap[promptReq.ID]; exists && promptReq.ID != "" {
+				existingRefs = existingPrompt.InputFileRefs
+			}
+			inputFiles, inputFileRefs, consumed, err := s.resolvePromptInputFiles(userID, project.ProjectID, &promptReq, existingRefs, outputNames)
+			if err != nil {
+				return nil, err
 			}
+			stagingIDs = append(stagingIDs, consumed...)
 
 			if promptReq.ID != "" {
 				// Update existing prompt
@@ -246,6 +260,7 @@ func (s *ScriptService) SaveScript(topicID, userID string, req *models.SaveScrip
 					existingPrompt.PromptText = promptReq.Text
 					existingPrompt.Filename = promptReq.Filename
 					existingPrompt.InputFiles = inputFiles
+					existingPrompt.InputFileRefs = inputFileRefs
 					existingPrompt.Exit = promptReq.Exit
 					existingPrompt.Merge = promptReq.Merge
 					existingPrompt.PromptOrder = order
@@ -256,16 +271,17 @@ func (s *ScriptService) SaveScript(topicID, userID string, req *models.SaveScrip
 				} else {
 					// ID provided but not found - treat as new prompt
 					newPrompt := &models.ScriptPrompt{
-						ID:           promptReq.ID, // Use provided ID
-						ScriptID:     script.ID,
-						ProjectID:    project.ProjectID,
-						TempPromptID: promptReq.PromptID,
-						PromptText:   promptReq.Text,
-						Filename:     promptReq.Filename,
-						InputFiles:   inputFiles,
-						Exit:         promptReq.Exit,
-						Merge:        promptReq.Merge,
-						PromptOrder:  order,
+						ID:            promptReq.ID, // Use provided ID
+						ScriptID:      script.ID,
+						ProjectID:     project.ProjectID,
+						TempPromptID:  promptReq.PromptID,
+						PromptText:    promptReq.Text,
+						Filename:      promptReq.Filename,
+						InputFiles:    inputFiles,
+						InputFileRefs: inputFileRefs,
+						Exit:          promptReq.Exit,
+						Merge:         promptReq.Merge,
+						PromptOrder:   order,
 					}
 					promptsToCreate = append(promptsToCreate, newPrompt)
 					requestPromptIDs[promptReq.ID] = true
@@ -273,15 +289,16 @@ func (s *ScriptService) SaveScript(topicID, userID string, req *models.SaveScrip
 			} else {
 				// Create new prompt (no ID provided)
 				newPrompt := &models.ScriptPrompt{
-					ScriptID:     script.ID,
-					ProjectID:    project.ProjectID,
-					TempPromptID: promptReq.PromptID,
-					PromptText:   promptReq.Text,
-					Filename:     promptReq.Filename,
-					InputFiles:   inputFiles,
-					Exit:         promptReq.Exit,
-					Merge:        promptReq.Merge,
-					PromptOrder:  order,
+					ScriptID:      script.ID,
+					ProjectID:     project.ProjectID,
+					TempPromptID:  promptReq.PromptID,
+					PromptText:    promptReq.Text,
+					Filename:      promptReq.Filename,
+					InputFiles:    inputFiles,
+					InputFileRefs: inputFileRefs,
+					Exit:          promptReq.Exit,
+					Merge:         promptReq.Merge,
+					PromptOrder:   order,
 				}
 				promptsToCreate = append(promptsToCreate, newPrompt)
 			}
@@ -295,24 +312,13 @@ func (s *ScriptService) SaveScript(topicID, userID string, req *models.SaveScrip
 			promptsToDelete = append(promptsToDelete, existingPrompt.ID)
 		}
 	}
-	if len(promptsToDelete) > 0 {
-		if err := s.scriptRepo.DeletePromptsByIDs(promptsToDelete); err != nil {
-			logrus.Warnf("Failed to delete prompts: %v", err)
-		}
-	}
-
-	// Create new prompts
-	if len(promptsToCreate) > 0 {
-		if err := s.scriptRepo.CreatePrompts(promptsToCreate); err != nil {
-			return nil, fmt.Errorf("failed to create prompts: %w", err)
-		}
-	}
 
-	// Update existing prompts
-	for _, prompt := range promptsToUpdate {
-		if err := s.scriptRepo.UpdatePrompt(prompt); err != nil {
-			return nil, fmt.Errorf("failed to update prompt %s: %w", prompt.ID, err)
+	// Delete / create / update prompts và consume staged uploads trong 1 transaction
+	if err := s.scriptRepo.SavePrompts(promptsToDelete, promptsToCreate, promptsToUpdate, stagingIDs); err != nil {
+		if errors.Is(err, repository.ErrUploadStagingConsumed) {
+			return nil, fmt.Errorf("%w: uploaded files were attached by another save, reload the script and retry", ErrUploadStagingConflict)
 		}
+		return nil, fmt.Errorf("failed to save prompts: %w", err)
 	}
 
 	// Get existing edges for this script
@@ -394,7 +400,7 @@ func (s *ScriptService) SaveScript(topicID, userID string, req *models.SaveScrip
 
 	// Note: KHÔNG clear project_id và temp_prompt_id trong bảng files vì:
 	// 1. Files đã được map với prompt qua prompt.InputFiles
-	// 2. Cần giữ lại để GetUploadedFilesForPrompt có thể fallback từ DB khi cache rỗng
+	// 2. Cần giữ lại để GetUploadedFilesForPrompt có thể fallback từ DB khi không còn upload đang stage
 	// 3. Có thể cần để support việc edit/update prompt sau này
 	// 4. Không gây conflict vì mỗi file chỉ map với 1 prompt tại 1 thời điểm
 
@@ -507,14 +513,15 @@ func (s *ScriptService) CloneScript(sourceUserID, targetUserID, topicID string)
 		// Prepare prompts for this project
 		for _, pr := range p.Prompts {
 			newPrompt := &models.ScriptPrompt{
-				ScriptID:    targetScript.ID,
-				ProjectID:   p.ProjectID,
-				PromptText:  pr.PromptText,
-				Filename:    pr.Filename,
-				InputFiles:  pr.InputFiles,
-				Exit:        pr.Exit,
-				Merge:       pr.Merge, // Copy Merge field
-				PromptOrder: pr.PromptOrder,
+				ScriptID:      targetScript.ID,
+				ProjectID:     p.ProjectID,
+				PromptText:    pr.PromptText,
+				Filename:      pr.Filename,
+				InputFiles:    pr.InputFiles,
+				InputFileRefs: cloneInputFileRefs(pr.InputFileRefs),
+				Exit:          pr.Exit,
+				Merge:         pr.Merge, // Copy Merge field
+				PromptOrder:   pr.PromptOrder,
 			}
 			promptsToCreate = append(promptsToCreate, newPrompt)
 		}
@@ -556,6 +563,119 @@ func (s *ScriptService) CloneScript(sourceUserID, targetUserID, topicID string)
 	return nil
 }
 
+// resolvePromptInputFiles builds input_files + input_file_refs of a prompt when saving a script:
+// input_file_refs từ request → kiểm tra hợp lệ; chỉ có input_files (tên) → giữ ref cũ cùng tên,
+// nếu không thì resolve tên (xem resolveInputFileName). File vừa upload cho prompt (staging) được ghim theo ID,
+// thay ref cùng tên hoặc thêm vào cuối. Returns the staging IDs cần consume.
+func (s *ScriptService) resolvePromptInputFiles(userID, projectID string, req *models.ScriptPromptRequest, existing models.PromptInputFiles, outputNames map[string]bool) (models.StringArray, models.PromptInputFiles, []string, error) {
+	refs := make(models.PromptInputFiles, 0)
+
+	if len(req.InputFileRefs) > 0 {
+		for _, ref := range req.InputFileRefs {
+			ref.Name = strings.TrimSpace(ref.Name)
+			switch ref.Mode {
+			case models.PromptInputFileModeFile:
+				if ref.FileID == nil || *ref.FileID == "" {
+					return nil, nil, nil, fmt.Errorf("%w: file_id is required for mode %q", ErrInvalidPromptInputFile, ref.Mode)
+				}
+				file, err := s.fileService.GetFile(*ref.FileID, userID)
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("%w: file %s: %v", ErrInvalidPromptInputFile, *ref.FileID, err)
+				}
+				ref.Name = file.OriginalName
+			case models.PromptInputFileModeLatest, models.PromptInputFileModeOutput:
+				if ref.Name == "" {
+					return nil, nil, nil, fmt.Errorf("%w: name is required for mode %q", ErrInvalidPromptInputFile, ref.Mode)
+				}
+				ref.FileID = nil
+			default:
+				return nil, nil, nil, fmt.Errorf("%w: unknown mode %q (file, latest, output)", ErrInvalidPromptInputFile, ref.Mode)
+			}
+			refs = append(refs, ref)
+		}
+	} else {
+		// Frontend cũ chỉ gửi tên: giữ nguyên ref đã lưu cùng tên để không ghim lại sang bản upload mới hơn
+		existingByName := make(map[string]models.PromptInputFile)
+		for _, ref := range existing {
+			if _, ok := existingByName[ref.Name]; !ok {
+				existingByName[ref.Name] = ref
+			}
+		}
+		for _, name := range req.InputFiles {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if ref, ok := existingByName[name]; ok {
+				refs = append(refs, ref)
+				continue
+			}
+			refs = append(refs, s.resolveInputFileName(userID, name, outputNames))
+		}
+	}
+
+	if req.PromptID == "" || s.uploadStaging == nil {
+		return refs.Names(), refs, nil, nil
+	}
+	stagings, err := s.uploadStaging.GetPendingPromptFiles(userID, projectID, req.PromptID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stagingIDs := make([]string, 0, len(stagings))
+	for _, staging := range stagings {
+		stagingIDs = append(stagingIDs, staging.ID)
+		file, err := s.fileService.GetFile(staging.FileID, userID)
+		if err != nil {
+			logrus.Warnf("Failed to get staged file %s for prompt: %v", staging.FileID, err)
+			continue
+		}
+		id := file.ID
+		pinned := models.PromptInputFile{Name: file.OriginalName, FileID: &id, Mode: models.PromptInputFileModeFile}
+		replaced := false
+		for i := range refs {
+			if refs[i].Name == pinned.Name {
+				refs[i] = pinned
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			refs = append(refs, pinned)
+		}
+	}
+	return refs.Names(), refs, stagingIDs, nil
+}
+
+// resolveInputFileName converts an input file name to a reference:
+// output của script (so cả tên bỏ extension) → output, file của user → ghim bản mới nhất, còn lại → output
+func (s *ScriptService) resolveInputFileName(userID, name string, outputNames map[string]bool) models.PromptInputFile {
+	if outputNames[name] || outputNames[strings.TrimSuffix(name, path.Ext(name))] {
+		return models.PromptInputFile{Name: name, Mode: models.PromptInputFileModeOutput}
+	}
+	file, err := s.fileService.GetLatestFileByName(userID, name)
+	if err != nil {
+		logrus.Debugf("Input file %q of user %s not found, treating it as execution output", name, userID)
+		return models.PromptInputFile{Name: name, Mode: models.PromptInputFileModeOutput}
+	}
+	id := file.ID
+	return models.PromptInputFile{Name: file.OriginalName, FileID: &id, Mode: models.PromptInputFileModeFile}
+}
+
+// cloneInputFileRefs copies input file refs sang user khác: file ghim thuộc user nguồn nên chuyển thành latest theo tên
+func cloneInputFileRefs(refs models.PromptInputFiles) models.PromptInputFiles {
+	if refs == nil {
+		return nil
+	}
+	cloned := make(models.PromptInputFiles, 0, len(refs))
+	for _, ref := range refs {
+		if ref.Mode == models.PromptInputFileModeFile {
+			ref = models.PromptInputFile{Name: ref.Name, Mode: models.PromptInputFileModeLatest}
+		}
+		cloned = append(cloned, ref)
+	}
+	return cloned
+}
+
 // toScriptResponse converts Script model to ScriptResponse
 func (s *ScriptService) toScriptResponse(script *models.Script) *models.ScriptResponse {
 	projects := make([]models.ScriptProjectResponse, 0, len(script.Projects))
@@ -563,13 +683,14 @@ func (s *ScriptService) toScriptResponse(script *models.Script) *models.ScriptRe
 		prompts := make([]models.ScriptPromptResponse, 0, len(project.Prompts))
 		for _, prompt := range project.Prompts {
 			prompts = append(prompts, models.ScriptPromptResponse{
-				ID:          prompt.ID,
-				Text:        prompt.PromptText,
-				Filename:    prompt.Filename,
-				InputFiles:  prompt.InputFiles,
-				Exit:        prompt.Exit,
-				Merge:       prompt.Merge, // Map Merge to response
-				PromptOrder: prompt.PromptOrder,
+				ID:            prompt.ID,
+				Text:          prompt.PromptText,
+				Filename:      prompt.Filename,
+				InputFiles:    prompt.InputFiles,
+				InputFileRefs: prompt.InputFileRefs,
+				Exit:          prompt.Exit,
+				Merge:         prompt.Merge, // Map Merge to response
+				PromptOrder:   prompt.PromptOrder,
 			})
 		}
 
@@ -677,7 +798,7 @@ func (s *ScriptService) CreateProject(topicID, userID string, req *models.Create
 		launchReq := &LaunchChromeProfileRequest{
 			UserProfileID: userProfile.ID,
 			EnsureGmail:   true,
-			EntityType:    "topic", // Dùng "topic" để ProcessLogService.handleTopicLog có thể xử lý
+			EntityType:    "topic", // Dùng "topic" để stage handler của topic (process_log_stage_handlers.go) có thể xử lý
 			EntityID:      topicID, // Dùng topicID (UUID) thay vì script.ID
 			DebugPort:     debugPort,
 		}
@@ -829,88 +950,58 @@ func (s *ScriptService) triggerGemCreationForProject(userProfile *models.UserPro
 
 // Helper functions (copied from TopicService)
 
-// AddUploadedFiles lưu file IDs vừa upload vào cache
+// AddUploadedFiles stage file IDs vừa upload làm knowledge cho gem tạo tiếp theo
 func (s *ScriptService) AddUploadedFiles(userID string, fileIDs []string) {
-	if len(fileIDs) == 0 {
+	if s.uploadStaging == nil {
 		return
 	}
-
-	existing, _ := s.recentUploadedFiles.LoadOrStore(userID, []string{})
-	existingIDs := existing.([]string)
-
-	existingMap := make(map[string]bool)
-	for _, id := range existingIDs {
-		existingMap[id] = true
+	if err := s.uploadStaging.StageKnowledgeFiles(userID, fileIDs); err != nil {
+		logrus.Warnf("Failed to stage knowledge files for user %s: %v", userID, err)
 	}
-
-	newIDs := make([]string, 0, len(existingIDs)+len(fileIDs))
-	newIDs = append(newIDs, existingIDs...)
-
-	for _, id := range fileIDs {
-		if !existingMap[id] {
-			newIDs = append(newIDs, id)
-		}
-	}
-
-	s.recentUploadedFiles.Store(userID, newIDs)
 }
 
-// GetAndClearUploadedFiles lấy file IDs từ cache và xóa sau khi lấy
+// GetAndClearUploadedFiles lấy file IDs knowledge đang stage và đánh dấu đã dùng
 func (s *ScriptService) GetAndClearUploadedFiles(userID string) []string {
-	value, ok := s.recentUploadedFiles.LoadAndDelete(userID)
-	if !ok {
+	if s.uploadStaging == nil {
+		return []string{}
+	}
+	fileIDs, err := s.uploadStaging.ConsumeKnowledgeFiles(userID)
+	if err != nil {
+		logrus.Warnf("Failed to get staged knowledge files for user %s: %v", userID, err)
 		return []string{}
 	}
-
-	fileIDs := value.([]string)
 	return fileIDs
 }
 
-// AddUploadedFilesForPrompt lưu file IDs vừa upload vào cache và DB cho prompt cụ thể
-// Nếu đã có files trong cache, sẽ append thêm (không replace)
+// AddUploadedFilesForPrompt stage file IDs vừa upload cho prompt cụ thể, SaveScript sẽ gắn vào prompt
+// Nếu đã có files đang stage, sẽ append thêm (không replace)
 func (s *ScriptService) AddUploadedFilesForPrompt(userID, projectID, promptID string, fileIDs []string) {
-	if len(fileIDs) == 0 {
+	if s.uploadStaging == nil {
 		return
 	}
-
-	// 1. Lưu vào cache (in-memory)
-	cacheKey := fmt.Sprintf("%s_%s_%s", userID, projectID, promptID)
-
-	existing, _ := s.recentUploadedFiles.LoadOrStore(cacheKey, []string{})
-	existingIDs := existing.([]string)
-
-	existingMap := make(map[string]bool)
-	for _, id := range existingIDs {
-		existingMap[id] = true
+	if err := s.uploadStaging.StagePromptFiles(userID, projectID, promptID, fileIDs); err != nil {
+		logrus.Warnf("Failed to stage files for prompt %s of project %s: %v", promptID, projectID, err)
 	}
-
-	newIDs := make([]string, 0, len(existingIDs)+len(fileIDs))
-	newIDs = append(newIDs, existingIDs...)
-
-	for _, id := range fileIDs {
-		if !existingMap[id] {
-			newIDs = append(newIDs, id)
-		}
-	}
-
-	s.recentUploadedFiles.Store(cacheKey, newIDs)
-
-	// 2. Update files trong DB với project_id và temp_prompt_id (chỉ update những file mới)
 	// Note: Files đã được lưu với project_id và temp_prompt_id khi upload, không cần update lại
 }
 
-// GetUploadedFilesForPrompt lấy file IDs từ cache cho prompt (không xóa) - để user xem danh sách
-// Nếu cache rỗng, sẽ fallback lấy từ DB (bảng files với project_id và temp_prompt_id)
+// GetUploadedFilesForPrompt lấy file IDs đang stage cho prompt (không consume) - để user xem danh sách
+// Nếu không có, fallback lấy từ DB (bảng files với project_id và temp_prompt_id) - file đã gắn vào prompt trước đó
 func (s *ScriptService) GetUploadedFilesForPrompt(userID, projectID, promptID string) []string {
-	cacheKey := fmt.Sprintf("%s_%s_%s", userID, projectID, promptID)
-
-	value, ok := s.recentUploadedFiles.Load(cacheKey)
-	if ok {
-		fileIDs := value.([]string)
-		return fileIDs
+	if s.uploadStaging != nil {
+		stagings, err := s.uploadStaging.GetPendingPromptFiles(userID, projectID, promptID)
+		if err != nil {
+			logrus.Warnf("Failed to get staged prompt files: %v", err)
+		}
+		if len(stagings) > 0 {
+			fileIDs := make([]string, 0, len(stagings))
+			for _, staging := range stagings {
+				fileIDs = append(fileIDs, staging.FileID)
+			}
+			return fileIDs
+		}
 	}
 
-	// Cache rỗng → Fallback: Lấy từ DB (bảng files)
 	if s.fileService != nil {
 		files, err := s.fileService.GetFilesByProjectAndPrompt(userID, projectID, promptID)
 		if err != nil {
@@ -922,32 +1013,13 @@ func (s *ScriptService) GetUploadedFilesForPrompt(userID, projectID, promptID st
 		for _, file := range files {
 			fileIDs = append(fileIDs, file.ID)
 		}
-
-		// Nếu tìm thấy trong DB, restore vào cache để lần sau nhanh hơn
-		if len(fileIDs) > 0 {
-			s.recentUploadedFiles.Store(cacheKey, fileIDs)
-		}
-
 		return fileIDs
 	}
 
 	return []string{}
 }
 
-// GetAndClearUploadedFilesForPrompt lấy file IDs từ cache cho prompt và xóa sau khi lấy (dùng khi save script)
-func (s *ScriptService) GetAndClearUploadedFilesForPrompt(userID, projectID, promptID string) []string {
-	cacheKey := fmt.Sprintf("%s_%s_%s", userID, projectID, promptID)
-
-	value, ok := s.recentUploadedFiles.LoadAndDelete(cacheKey)
-	if !ok {
-		return []string{}
-	}
-
-	fileIDs := value.([]string)
-	return fileIDs
-}
-
-// getRecentUserFilesAsURLs lấy files vừa upload từ cache và convert thành download URLs
+// getRecentUserFilesAsURLs lấy files knowledge đang stage và convert thành download URLs
 func (s *ScriptService) getRecentUserFilesAsURLs(userID string) []string {
 	fileIDs := s.GetAndClearUploadedFiles(userID)
 
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+)
+
+// sseFanout publishes logs to a RabbitMQ fanout exchange so every API replica
+// receives them and delivers to its own SSE clients.
+type sseFanout struct {
+	channel  *amqp.Channel
+	exchange string
+	// amqp channel không an toàn khi publish đồng thời từ nhiều goroutine
+	publishMu sync.Mutex
+}
+
+// publish sends a log to the fanout exchange
+func (f *sseFanout) publish(log *models.ProcessLog) error {
+	body, err := json.Marshal(log)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log: %w", err)
+	}
+
+	f.publishMu.Lock()
+	defer f.publishMu.Unlock()
+
+	return f.channel.Publish(
+		f.exchange, // exchange
+		"",         // routing key (ignored by fanout)
+		false,      // mandatory
+		false,      // immediate
+		amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+			Timestamp:   time.Now(),
+		},
+	)
+}
+
+// StartFanout enables multi-replica SSE delivery through a RabbitMQ fanout exchange.
+// Mỗi replica có 1 queue exclusive/auto-delete riêng bind vào exchange, nên log ingest ở replica nào
+// cũng tới được client SSE đang kết nối ở mọi replica.
+// Nếu kết nối RabbitMQ bị đóng, hub tự quay về deliver local (single-instance behaviour).
+func (h *SSEHub) StartFanout(rabbitMQ *RabbitMQService, exchange string) error {
+	// Dedicated channels so SSE traffic does not interfere with the worker queues
+	publishChannel, err := rabbitMQ.OpenChannel()
+	if err != nil {
+		return fmt.Errorf("failed to open publish channel: %w", err)
+	}
+	consumeChannel, err := rabbitMQ.OpenChannel()
+	if err != nil {
+		publishChannel.Close()
+		return fmt.Errorf("failed to open consume channel: %w", err)
+	}
+
+	closeChannels := func() {
+		consumeChannel.Close()
+		publishChannel.Close()
+	}
+
+	err = consumeChannel.ExchangeDeclare(
+		exchange, // name
+		"fanout", // type
+		true,     // durable
+		false,    // auto-deleted
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	)
+	if err != nil {
+		closeChannels()
+		return fmt.Errorf("failed to declare exchange: %w", err)
+	}
+
+	// Server-named, exclusive queue: removed automatically when this replica disconnects
+	queue, err := consumeChannel.QueueDeclare(
+		"",    // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		closeChannels()
+		return fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	if err := consumeChannel.QueueBind(queue.Name, "", exchange, false, nil); err != nil {
+		closeChannels()
+		return fmt.Errorf("failed to bind queue: %w", err)
+	}
+
+	msgs, err := consumeChannel.Consume(
+		queue.Name, // queue
+		"",         // consumer
+		true,       // auto-ack
+		true,       // exclusive
+		false,      // no-local
+		false,      // no-wait
+		nil,        // args
+	)
+	if err != nil {
+		closeChannels()
+		return fmt.Errorf("failed to register consumer: %w", err)
+	}
+
+	fanout := &sseFanout{
+		channel:  publishChannel,
+		exchange: exchange,
+	}
+	h.fanout.Store(fanout)
+
+	go func() {
+		for msg := range msgs {
+			var log models.ProcessLog
+			if err := json.Unmarshal(msg.Body, &log); err != nil {
+				logrus.Errorf("[SSE] Failed to unmarshal fan-out log: %v", err)
+				continue
+			}
+			h.deliverLocal(&log)
+		}
+
+		// Consumer stopped (connection/channel closed): fall back to local delivery
+		h.fanout.CompareAndSwap(fanout, nil)
+		closeChannels()
+		logrus.Warn("[SSE] Fan-out consumer stopped, falling back to local delivery")
+	}()
+
+	logrus.Infof("[SSE] Fan-out enabled via exchange %s (queue: %s)", exchange, queue.Name)
+	return nil
+}
@@ -1,42 +1,81 @@
 package services
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// sseClientBufferSize is the per-client channel buffer size.
+	// The last slot is reserved for the "lagging" event.
+	sseClientBufferSize = 10
+
+	// SSEGlobalEntityType/SSEGlobalEntityID identify the global feed that receives every log (admin stream)
+	SSEGlobalEntityType = "global"
+	SSEGlobalEntityID   = "*"
+
+	// SSELaggingEvent is sent once when a client falls behind and messages would be dropped.
+	// Client nhận event này cần reconnect với Last-Event-ID để backfill từ DB.
+	SSELaggingEvent = "lagging"
+)
+
+// LogFilter decides whether a log is delivered to a client.
+// It runs in the broadcast path so it must be cheap (no DB calls).
+type LogFilter func(log *models.ProcessLog) bool
+
+// sseClient holds per-connection state
+type sseClient struct {
+	// filter is optional, nil means every log of the key is delivered
+	filter LogFilter
+	// lagging is set once the client channel overflowed; no further logs are queued for it
+	lagging atomic.Bool
+	// lastSeq is the seq of the last log queued to this client
+	lastSeq atomic.Int64
+}
+
 // SSEHub manages Server-Sent Events connections for real-time log streaming
 type SSEHub struct {
 	// Map of entity keys to channels
 	// Key format: "entity_type:entity_id" or "user:user_id"
-	clients map[string]map[chan []byte]bool
+	clients map[string]map[chan []byte]*sseClient
 	mu      sync.RWMutex
+
+	// fanout is set when logs are fanned out through RabbitMQ to all replicas (see sse_fanout.go)
+	fanout atomic.Pointer[sseFanout]
 }
 
 // NewSSEHub creates a new SSE hub
 func NewSSEHub() *SSEHub {
 	return &SSEHub{
-		clients: make(map[string]map[chan []byte]bool),
+		clients: make(map[string]map[chan []byte]*sseClient),
 	}
 }
 
 // RegisterClient registers a new SSE client for an entity
 func (h *SSEHub) RegisterClient(entityType, entityID string) chan []byte {
+	return h.RegisterFilteredClient(entityType, entityID, nil)
+}
+
+// RegisterFilteredClient registers a new SSE client that only receives logs matching filter
+func (h *SSEHub) RegisterFilteredClient(entityType, entityID string, filter LogFilter) chan []byte {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	key := fmt.Sprintf("%s:%s", entityType, entityID)
-	clientChan := make(chan []byte, 10) // Buffer size 10
+	clientChan := make(chan []byte, sseClientBufferSize)
 
 	if h.clients[key] == nil {
-		h.clients[key] = make(map[chan []byte]bool)
+		h.clients[key] = make(map[chan []byte]*sseClient)
 	}
-	h.clients[key][clientChan] = true
+	h.clients[key][clientChan] = &sseClient{filter: filter}
 
 	logrus.Infof("SSE client registered for %s (total clients: %d)", key, len(h.clients[key]))
 	return clientChan
@@ -61,54 +100,138 @@ func (h *SSEHub) UnregisterClient(entityType, entityID string, clientChan chan [
 	logrus.Infof("SSE client unregistered for %s (remaining clients: %d)", key, len(h.clients[key]))
 }
 
-// BroadcastLog broadcasts a log to all clients subscribed to the entity
+// BroadcastLog broadcasts a log to all clients subscribed to the entity.
+// Khi fan-out bật, log được publish lên exchange và mọi replica (kể cả replica này) deliver cho client local.
 func (h *SSEHub) BroadcastLog(log *models.ProcessLog) {
+	if fanout := h.fanout.Load(); fanout != nil {
+		err := fanout.publish(log)
+		if err == nil {
+			return
+		}
+		logrus.Warnf("[SSE] Failed to publish log to fan-out exchange, delivering locally only: %v", err)
+	}
+	h.deliverLocal(log)
+}
+
+// deliverLocal sends a log to the clients connected to this replica
+func (h *SSEHub) deliverLocal(log *models.ProcessLog) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	// Broadcast to entity-specific clients
 	entityKey := fmt.Sprintf("%s:%s", log.EntityType, log.EntityID)
-	clientsMap, exists := h.clients[entityKey]
-	if !exists {
-		clientsMap = nil
-	}
-	h.broadcastToKeyLocked(entityKey, log, clientsMap)
+	h.broadcastToKeyLocked(entityKey, log, h.clients[entityKey])
 
 	// Broadcast to user-specific clients
 	userKey := fmt.Sprintf("user:%s", log.UserID)
-	userClientsMap, userExists := h.clients[userKey]
-	if !userExists {
-		userClientsMap = nil
-	}
-	h.broadcastToKeyLocked(userKey, log, userClientsMap)
+	h.broadcastToKeyLocked(userKey, log, h.clients[userKey])
+
+	// Broadcast to global feed clients (admin stream)
+	globalKey := fmt.Sprintf("%s:%s", SSEGlobalEntityType, SSEGlobalEntityID)
+	h.broadcastToKeyLocked(globalKey, log, h.clients[globalKey])
 }
 
 // broadcastToKeyLocked broadcasts log to clients (assumes lock is already held)
-func (h *SSEHub) broadcastToKeyLocked(key string, log *models.ProcessLog, clients map[chan []byte]bool) {
+func (h *SSEHub) broadcastToKeyLocked(key string, log *models.ProcessLog, clients map[chan []byte]*sseClient) {
 	if len(clients) == 0 {
 		return
 	}
 
-	// Convert log to JSON
+	var message []byte
+
+	// Send to all clients (non-blocking)
+	for clientChan, client := range clients {
+		if client.filter != nil && !client.filter(log) {
+			continue
+		}
+		if message == nil {
+			var err error
+			message, err = FormatLogSSEMessage(log)
+			if err != nil {
+				logrus.Errorf("Failed to marshal log for SSE: %v", err)
+				return
+			}
+		}
+		if client.lagging.Load() {
+			// Client đã bị đánh dấu lagging, chờ client reconnect và backfill
+			continue
+		}
+
+		// Giữ lại slot cuối cho lagging event
+		if len(clientChan) < cap(clientChan)-1 {
+			select {
+			case clientChan <- message:
+				client.lastSeq.Store(log.Seq)
+				continue
+			default:
+			}
+		}
+
+		// Channel is full: mark client as lagging and tell it to resync instead of silently dropping
+		if client.lagging.CompareAndSwap(false, true) {
+			lagging := formatLaggingSSEMessage(client.lastSeq.Load())
+			select {
+			case clientChan <- lagging:
+			default:
+			}
+			logrus.Warnf("SSE client lagging, asked to resync: %s (last_event_id: %d)", key, client.lastSeq.Load())
+		}
+	}
+}
+
+// FormatLogSSEMessage formats a log as an SSE message with its seq as event id
+// Frontend EventSource cần event type để xử lý, id để gửi lại Last-Event-ID khi reconnect
+func FormatLogSSEMessage(log *models.ProcessLog) ([]byte, error) {
 	logJSON, err := json.Marshal(log)
 	if err != nil {
-		logrus.Errorf("Failed to marshal log for SSE: %v", err)
-		return
+		return nil, err
 	}
+	return []byte(fmt.Sprintf("id: %d\nevent: log\ndata: %s\n\n", log.Seq, string(logJSON))), nil
+}
 
-	// Format as SSE message with event type
-	// Frontend EventSource cần event type để xử lý
-	message := fmt.Sprintf("event: log\ndata: %s\n\n", string(logJSON))
+// formatLaggingSSEMessage formats the lagging event.
+// It carries no id field so the client's Last-Event-ID stays at the last delivered log.
+func formatLaggingSSEMessage(lastEventID int64) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"message":       "Client is lagging behind, reconnect with Last-Event-ID to resync",
+		"last_event_id": lastEventID,
+	})
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", SSELaggingEvent, string(data)))
+}
 
-	// Send to all clients (non-blocking)
-	for clientChan := range clients {
-		select {
-		case clientChan <- []byte(message):
-		default:
-			// Channel is full, skip this client
-			logrus.Warnf("SSE client channel full, skipping: %s", key)
-		}
+// IsLaggingSSEMessage reports whether the message is the lagging event
+func IsLaggingSSEMessage(message []byte) bool {
+	return bytes.HasPrefix(message, []byte("event: "+SSELaggingEvent+"\n"))
+}
+
+// ParseSSEEventID returns the event id of a log message formatted by FormatLogSSEMessage
+func ParseSSEEventID(message []byte) (int64, bool) {
+	if !bytes.HasPrefix(message, []byte("id: ")) {
+		return 0, false
+	}
+	line := message[len("id: "):]
+	if idx := bytes.IndexByte(line, '\n'); idx >= 0 {
+		line = line[:idx]
+	}
+	id, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// ParseSSELog decodes the log carried by a message formatted by FormatLogSSEMessage
+func ParseSSELog(message []byte) (*models.ProcessLog, bool) {
+	idx := bytes.Index(message, []byte("\ndata: "))
+	if idx < 0 {
+		return nil, false
+	}
+	data := bytes.TrimRight(message[idx+len("\ndata: "):], "\n")
+	var log models.ProcessLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, false
 	}
+	return &log, true
 }
 
 // GetClientCount returns the number of clients for a specific entity
@@ -136,6 +259,10 @@ func (h *SSEHub) SendHeartbeat(entityType, entityID string) {
 
 	heartbeat := fmt.Sprintf(": heartbeat %s\n\n", time.Now().Format(time.RFC3339))
 	for clientChan := range clients {
+		// Không dùng slot dành cho lagging event
+		if len(clientChan) >= cap(clientChan)-1 {
+			continue
+		}
 		select {
 		case clientChan <- []byte(heartbeat):
 		default:
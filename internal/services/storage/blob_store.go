@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Backend names (FILE_STORAGE_BACKEND)
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+var (
+	// ErrNotFound is returned when a blob does not exist (errors.Is(err, os.ErrNotExist) cũng đúng)
+	ErrNotFound = fmt.Errorf("blob not found: %w", os.ErrNotExist)
+	// ErrPresignNotSupported is returned by backends that cannot generate presigned URLs (local disk)
+	ErrPresignNotSupported = errors.New("presigned URLs are not supported by this storage backend")
+)
+
+// BlobStore stores file contents by key (vd: "{user_id}/{file_name}").
+// File.FilePath lưu Location(key) để biết file nằm ở backend nào (path trên disk hoặc s3://bucket/key),
+// nhờ đó file cũ trên disk vẫn đọc được khi đã chuyển sang S3.
+type BlobStore interface {
+	// Name returns the backend name (local, s3)
+	Name() string
+	// Put streams content to key. size = -1 nếu chưa biết. Returns the number of bytes written.
+	Put(key string, content io.Reader, size int64, contentType string) (int64, error)
+	// Open streams the content of key
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes key (không lỗi nếu key không tồn tại)
+	Delete(key string) error
+	// PresignGetURL returns a time-limited download URL, fileName is used for Content-Disposition
+	PresignGetURL(key, fileName string, expires time.Duration) (string, error)
+	// Location returns the value stored in File.FilePath for key
+	Location(key string) string
+	// KeyFromLocation parses a File.FilePath, ok = false nếu location không thuộc backend này
+	KeyFromLocation(location string) (key string, ok bool)
+}
+
+// NewBlobStoreFromEnv creates the backend selected by FILE_STORAGE_BACKEND (local | s3, default local)
+func NewBlobStoreFromEnv() (BlobStore, error) {
+	return NewBlobStore(getEnv("FILE_STORAGE_BACKEND", BackendLocal))
+}
+
+// NewBlobStore creates a backend by name, configured from environment variables
+func NewBlobStore(backend string) (BlobStore, error) {
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case BackendLocal, "":
+		return NewFilesystemStore(getEnv("FILE_STORAGE_DIR", "./storage/files")), nil
+	case BackendS3:
+		return NewS3Store(S3ConfigFromEnv())
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (expected local or s3)", backend)
+	}
+}
+
+// Resolver finds the backend holding a File.FilePath.
+// Backend đầu tiên là backend ghi file mới; các backend còn lại chỉ dùng để đọc/xóa file cũ.
+type Resolver struct {
+	stores []BlobStore
+}
+
+// NewResolver creates a resolver, primary receives new files
+func NewResolver(primary BlobStore, others ...BlobStore) *Resolver {
+	stores := []BlobStore{primary}
+	for _, store := range others {
+		if store != nil && store.Name() != primary.Name() {
+			stores = append(stores, store)
+		}
+	}
+	return &Resolver{stores: stores}
+}
+
+// Primary returns the backend receiving new files
+func (r *Resolver) Primary() BlobStore {
+	return r.stores[0]
+}
+
+// Resolve returns the backend and key of a File.FilePath
+func (r *Resolver) Resolve(location string) (BlobStore, string, error) {
+	for _, store := range r.stores {
+		if key, ok := store.KeyFromLocation(location); ok {
+			return store, key, nil
+		}
+	}
+	return nil, "", fmt.Errorf("no storage backend configured for %q", location)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists && value != "" {
+		return value
+	}
+	return defaultValue
+}
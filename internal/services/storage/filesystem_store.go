@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FilesystemStore stores blobs on local disk under a root directory (FILE_STORAGE_DIR)
+type FilesystemStore struct {
+	root string
+}
+
+// NewFilesystemStore creates a filesystem store (thư mục con được tạo khi ghi file)
+func NewFilesystemStore(root string) *FilesystemStore {
+	return &FilesystemStore{root: root}
+}
+
+func (s *FilesystemStore) Name() string {
+	return BackendLocal
+}
+
+// path returns the disk path of key, rejecting keys escaping the root
+func (s *FilesystemStore) path(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if cleaned == "." || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.root, cleaned), nil
+}
+
+// Put writes to a temp file then renames it, file dở dang không bao giờ xuất hiện ở key
+func (s *FilesystemStore) Put(key string, content io.Reader, size int64, contentType string) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create destination file: %w", err)
+	}
+	written, err := io.Copy(tmp, content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("size mismatch: expected %d bytes, got %d", size, written)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, fmt.Errorf("failed to save file: %w", err)
+	}
+	return written, nil
+}
+
+func (s *FilesystemStore) Open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return f, nil
+}
+
+func (s *FilesystemStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// PresignGetURL is not supported: file trên disk được stream qua API (signed JWT URL)
+func (s *FilesystemStore) PresignGetURL(key, fileName string, expires time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+// Location returns the disk path (giữ format FilePath cũ: {FILE_STORAGE_DIR}/{user_id}/{file_name})
+func (s *FilesystemStore) Location(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// KeyFromLocation accepts disk paths under the root directory
+func (s *FilesystemStore) KeyFromLocation(location string) (string, bool) {
+	if strings.Contains(location, "://") {
+		return "", false
+	}
+	rel, err := filepath.Rel(filepath.Clean(s.root), filepath.Clean(location))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
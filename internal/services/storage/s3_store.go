@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/utils"
+)
+
+const (
+	s3Service         = "s3"
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3AmzDateFormat   = "20060102T150405Z"
+	s3ShortDateFormat = "20060102"
+
+	// s3MaxPresignExpiry is the SigV4 limit for presigned URLs
+	s3MaxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// S3Config configures an S3-compatible backend (AWS S3, MinIO, R2, ...)
+type S3Config struct {
+	Endpoint        string // vd: https://s3.ap-southeast-1.amazonaws.com hoặc http://minio:9000
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Prefix          string // Prefix của key trong bucket (optional)
+	ForcePathStyle  bool   // endpoint/bucket/key thay vì bucket.endpoint/key (MinIO cần true)
+}
+
+// S3ConfigFromEnv reads S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY, S3_PREFIX, S3_FORCE_PATH_STYLE
+func S3ConfigFromEnv() S3Config {
+	region := getEnv("S3_REGION", "us-east-1")
+	return S3Config{
+		Endpoint:        getEnv("S3_ENDPOINT", fmt.Sprintf("https://s3.%s.amazonaws.com", region)),
+		Region:          region,
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		Prefix:          strings.Trim(os.Getenv("S3_PREFIX"), "/"),
+		ForcePathStyle:  getEnv("S3_FORCE_PATH_STYLE", "true") == "true",
+	}
+}
+
+// S3Store stores blobs in an S3-compatible bucket using the REST API signed with SigV4
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Store creates an S3 store
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Bucket == "" || config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("S3 storage requires S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+
+	return &S3Store{
+		config:   config,
+		endpoint: endpoint,
+		// Không set Timeout tổng: upload/download file lớn được stream
+		client: &http.Client{Transport: http.DefaultTransport},
+	}, nil
+}
+
+func (s *S3Store) Name() string {
+	return BackendS3
+}
+
+// objectKey adds the configured prefix
+func (s *S3Store) objectKey(key string) string {
+	key = strings.TrimPrefix(key, "/")
+	if s.config.Prefix == "" {
+		return key
+	}
+	return s.config.Prefix + "/" + key
+}
+
+// objectURL returns the URL of an object (path-style hoặc virtual-hosted-style)
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	path := "/" + s.objectKey(key)
+	if s.config.ForcePathStyle {
+		path = "/" + s.config.Bucket + path
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = s3EscapePath(path)
+	return &u
+}
+
+// Put uploads content with a single PUT request.
+// S3 cần Content-Length: khi chưa biết size, content được ghi ra file tạm trước.
+func (s *S3Store) Put(key string, content io.Reader, size int64, contentType string) (int64, error) {
+	if size < 0 {
+		tmp, err := os.CreateTemp("", "s3-upload-*")
+		if err != nil {
+			return 0, fmt.Errorf("failed to create temp file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if size, err = io.Copy(tmp, content); err != nil {
+			return 0, fmt.Errorf("failed to buffer upload: %w", err)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("failed to buffer upload: %w", err)
+		}
+		content = tmp
+	}
+
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key).String(), io.NopCloser(content))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signRequest(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload to S3: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, s3ResponseError("upload", key, resp)
+	}
+	return size, nil
+}
+
+func (s *S3Store) Open(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.signRequest(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from S3: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3ResponseError("download", key, resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Delete(key string) error {
+	req, err := http.NewRequest(http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	s.signRequest(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete from S3: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3ResponseError("delete", key, resp)
+	}
+	return nil
+}
+
+// PresignGetURL returns a SigV4 presigned GET URL (query string auth), tối đa 7 ngày
+func (s *S3Store) PresignGetURL(key, fileName string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > s3MaxPresignExpiry {
+		expires = s3MaxPresignExpiry
+	}
+	return s.presignGetURL(key, fileName, expires, time.Now().UTC()), nil
+}
+
+func (s *S3Store) presignGetURL(key, fileName string, expires time.Duration, now time.Time) string {
+	u := s.objectURL(key)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.config.AccessKeyID+"/"+s.credentialScope(now))
+	query.Set("X-Amz-Date", now.Format(s3AmzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if fileName != "" {
+		query.Set("response-content-disposition", utils.ContentDisposition("attachment", fileName))
+	}
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		s3CanonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signature(now, canonicalRequest))
+
+	u.RawQuery = s3CanonicalQuery(query)
+	return u.String()
+}
+
+// Location returns s3://{bucket}/{prefix/key}
+func (s *S3Store) Location(key string) string {
+	return "s3://" + s.config.Bucket + "/" + s.objectKey(key)
+}
+
+// KeyFromLocation accepts s3://{bucket}/{prefix/key} of the configured bucket
+func (s *S3Store) KeyFromLocation(location string) (string, bool) {
+	objectKey, ok := strings.CutPrefix(location, "s3://"+s.config.Bucket+"/")
+	if !ok {
+		return "", false
+	}
+	if s.config.Prefix == "" {
+		return objectKey, true
+	}
+	return strings.CutPrefix(objectKey, s.config.Prefix+"/")
+}
+
+// signRequest adds SigV4 Authorization header (payload không ký: UNSIGNED-PAYLOAD, để stream body)
+func (s *S3Store) signRequest(req *http.Request, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format(s3AmzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": s3UnsignedPayload,
+		"x-amz-date":           now.Format(s3AmzDateFormat),
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.config.AccessKeyID, s.credentialScope(now), signedHeaders, s.signature(now, canonicalRequest)))
+}
+
+func (s *S3Store) credentialScope(now time.Time) string {
+	return now.Format(s3ShortDateFormat) + "/" + s.config.Region + "/" + s3Service + "/aws4_request"
+}
+
+// signature computes the SigV4 signature of a canonical request
+func (s *S3Store) signature(now time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3AmzDateFormat),
+		s.credentialScope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), now.Format(s3ShortDateFormat))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape URI-encodes per SigV4 rules (chỉ giữ nguyên A-Z a-z 0-9 - _ . ~)
+func s3Escape(value string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(path string) string {
+	return s3Escape(path, true)
+}
+
+// s3CanonicalQuery encodes query params sorted by key
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3ResponseError builds an error from a non-success S3 response (body là XML error)
+func s3ResponseError(operation, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 %s of %s failed: %s: %s", operation, key, resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrStorageQuotaExceeded is returned when an upload would exceed the user's storage quota
+	ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+	// ErrFileTooLarge is returned when a file exceeds the maximum file size
+	ErrFileTooLarge = errors.New("file exceeds maximum file size")
+	// ErrMimeTypeNotAllowed is returned when the file type is not in the allowed mime types
+	ErrMimeTypeNotAllowed = errors.New("file type is not allowed")
+	// ErrStorageQuotaNotFound is returned when a user/role has no quota override
+	ErrStorageQuotaNotFound = errors.New("storage quota override not found")
+	// ErrStorageQuotaSubjectNotFound is returned when setting a quota for a user/role that does not exist
+	ErrStorageQuotaSubjectNotFound = errors.New("user or role not found")
+)
+
+// Nguồn của giới hạn trong EffectiveStorageQuota
+const (
+	storageQuotaSourceUser    = "user"
+	storageQuotaSourceRole    = "role"
+	storageQuotaSourceDefault = "default"
+)
+
+// uploadBodyOverhead is the slack allowed for multipart boundaries/headers when limiting request bodies
+const uploadBodyOverhead = 1 << 20 // 1 MB
+
+// StorageQuotaService resolves and enforces per-user file storage limits.
+// Thứ tự ưu tiên: override của user → override của role (role rộng nhất) → mặc định từ env.
+type StorageQuotaService struct {
+	quotaRepo *repository.StorageQuotaRepository
+	userRepo  *repository.UserRepository
+	roleRepo  *repository.RoleRepository
+	fileRepo  *repository.FileRepository
+	defaults  models.EffectiveStorageQuota
+}
+
+// NewStorageQuotaService creates a storage quota service.
+// Mặc định: FILE_QUOTA_DEFAULT_MB, FILE_MAX_FILE_SIZE_MB (0 = không giới hạn), FILE_ALLOWED_MIME_TYPES (phân cách bởi dấu phẩy, trống = mọi loại).
+func NewStorageQuotaService(quotaRepo *repository.StorageQuotaRepository, userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, fileRepo *repository.FileRepository) *StorageQuotaService {
+	defaults := models.EffectiveStorageQuota{
+		MaxStorageBytes:   envMegabytes("FILE_QUOTA_DEFAULT_MB"),
+		MaxFileSizeBytes:  envMegabytes("FILE_MAX_FILE_SIZE_MB"),
+		AllowedMimeTypes:  parseMimeTypeList(getEnv("FILE_ALLOWED_MIME_TYPES", "")),
+		MaxStorageSource:  storageQuotaSourceDefault,
+		MaxFileSizeSource: storageQuotaSourceDefault,
+		MimeTypesSource:   storageQuotaSourceDefault,
+	}
+
+	return &StorageQuotaService{
+		quotaRepo: quotaRepo,
+		userRepo:  userRepo,
+		roleRepo:  roleRepo,
+		fileRepo:  fileRepo,
+		defaults:  defaults,
+	}
+}
+
+// GetEffectiveQuota resolves the quota applied to a user
+func (s *StorageQuotaService) GetEffectiveQuota(userID string) (*models.EffectiveStorageQuota, error) {
+	quota := s.defaults
+	quota.AllowedMimeTypes = append([]string{}, s.defaults.AllowedMimeTypes...)
+
+	// Role: lấy giới hạn rộng nhất trong các role của user có override
+	roles, err := s.roleRepo.GetUserRoles(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	roleIDs := make([]string, 0, len(roles))
+	for _, role := range roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	roleQuotas, err := s.quotaRepo.GetBySubjects(models.StorageQuotaSubjectRole, roleIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role quotas: %w", err)
+	}
+	if len(roleQuotas) > 0 {
+		var maxStorage, maxFileSize *int64
+		var mimeTypes []string
+		mimeTypesSet, anyMimeType := false, false
+		for _, roleQuota := range roleQuotas {
+			maxStorage = widerLimit(maxStorage, roleQuota.MaxStorageBytes)
+			maxFileSize = widerLimit(maxFileSize, roleQuota.MaxFileSizeBytes)
+			if roleQuota.AllowedMimeTypes != nil {
+				mimeTypesSet = true
+				if len(*roleQuota.AllowedMimeTypes) == 0 {
+					anyMimeType = true
+				}
+				mimeTypes = append(mimeTypes, *roleQuota.AllowedMimeTypes...)
+			}
+		}
+		if maxStorage != nil {
+			quota.MaxStorageBytes, quota.MaxStorageSource = *maxStorage, storageQuotaSourceRole
+		}
+		if maxFileSize != nil {
+			quota.MaxFileSizeBytes, quota.MaxFileSizeSource = *maxFileSize, storageQuotaSourceRole
+		}
+		if mimeTypesSet {
+			if anyMimeType {
+				mimeTypes = []string{}
+			}
+			quota.AllowedMimeTypes, quota.MimeTypesSource = normalizeMimeTypes(mimeTypes), storageQuotaSourceRole
+		}
+	}
+
+	// User override
+	userQuota, err := s.quotaRepo.GetBySubject(models.StorageQuotaSubjectUser, userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get user quota: %w", err)
+	}
+	if userQuota != nil {
+		if userQuota.MaxStorageBytes != nil {
+			quota.MaxStorageBytes, quota.MaxStorageSource = *userQuota.MaxStorageBytes, storageQuotaSourceUser
+		}
+		if userQuota.MaxFileSizeBytes != nil {
+			quota.MaxFileSizeBytes, quota.MaxFileSizeSource = *userQuota.MaxFileSizeBytes, storageQuotaSourceUser
+		}
+		if userQuota.AllowedMimeTypes != nil {
+			quota.AllowedMimeTypes, quota.MimeTypesSource = normalizeMimeTypes(*userQuota.AllowedMimeTypes), storageQuotaSourceUser
+		}
+	}
+
+	return &quota, nil
+}
+
+// GetUsage returns the storage usage and effective quota of a user
+func (s *StorageQuotaService) GetUsage(userID string) (*models.StorageUsageResponse, error) {
+	quota, err := s.GetEffectiveQuota(userID)
+	if err != nil {
+		return nil, err
+	}
+	used, count, err := s.fileRepo.GetUsageByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+
+	usage := &models.StorageUsageResponse{
+		UserID:    userID,
+		UsedBytes: used,
+		FileCount: count,
+		Quota:     *quota,
+	}
+	if quota.MaxStorageBytes > 0 {
+		remaining := quota.MaxStorageBytes - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		usage.RemainingBytes = &remaining
+	}
+	return usage, nil
+}
+
+// UploadBodyLimit returns the maximum request body size for an upload request of a user (0 = không giới hạn).
+// Dùng để từ chối sớm request vượt quota trước khi đọc multipart body.
+func (s *StorageQuotaService) UploadBodyLimit(userID string) (int64, error) {
+	usage, err := s.GetUsage(userID)
+	if err != nil {
+		return 0, err
+	}
+	if usage.RemainingBytes == nil {
+		return 0, nil
+	}
+	if *usage.RemainingBytes == 0 {
+		return 0, fmt.Errorf("%w: used %d of %d bytes", ErrStorageQuotaExceeded, usage.UsedBytes, usage.Quota.MaxStorageBytes)
+	}
+	return *usage.RemainingBytes + uploadBodyOverhead, nil
+}
+
+// LimitUpload checks an upload against the user's quota and wraps content so that reading aborts
+// as soon as the quota or max file size is exceeded. size = -1 nếu chưa biết. mimeType có thể được suy ra từ extension.
+func (s *StorageQuotaService) LimitUpload(userID, fileName string, mimeType *string, content io.Reader, size int64) (io.Reader, error) {
+	usage, err := s.GetUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+	quota := usage.Quota
+
+	// Mime type: Content-Type không rõ thì suy ra từ extension
+	if *mimeType == "" || *mimeType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(fileName))); byExt != "" {
+			*mimeType = byExt
+		}
+	}
+	if !mimeTypeAllowed(*mimeType, quota.AllowedMimeTypes) {
+		return nil, fmt.Errorf("%w: %s (allowed: %s)", ErrMimeTypeNotAllowed, *mimeType, strings.Join(quota.AllowedMimeTypes, ", "))
+	}
+
+	// Giới hạn nhỏ nhất giữa max file size và dung lượng còn lại
+	var limit int64
+	var limitErr error
+	if quota.MaxFileSizeBytes > 0 {
+		limit = quota.MaxFileSizeBytes
+		limitErr = fmt.Errorf("%w: limit %d bytes", ErrFileTooLarge, quota.MaxFileSizeBytes)
+	}
+	if usage.RemainingBytes != nil && (limit == 0 || *usage.RemainingBytes < limit) {
+		limit = *usage.RemainingBytes
+		limitErr = fmt.Errorf("%w: used %d of %d bytes", ErrStorageQuotaExceeded, usage.UsedBytes, quota.MaxStorageBytes)
+	}
+	if limitErr == nil {
+		return content, nil
+	}
+	if limit <= 0 || (size >= 0 && size > limit) {
+		return nil, limitErr
+	}
+	return &quotaLimitedReader{reader: content, remaining: limit, err: limitErr}, nil
+}
+
+// CheckUpload validates an upload of a known size against the quota trước khi nhận nội dung (vd: resumable upload)
+func (s *StorageQuotaService) CheckUpload(userID, fileName string, mimeType *string, size int64) error {
+	_, err := s.LimitUpload(userID, fileName, mimeType, nil, size)
+	return err
+}
+
+// ListQuotas retrieves all quota overrides (subjectType trống = tất cả)
+func (s *StorageQuotaService) ListQuotas(subjectType string) ([]*models.StorageQuota, error) {
+	return s.quotaRepo.GetAll(subjectType)
+}
+
+// GetQuota retrieves the quota override of a user or role
+func (s *StorageQuotaService) GetQuota(subjectType, subjectID string) (*models.StorageQuota, error) {
+	quota, err := s.quotaRepo.GetBySubject(subjectType, subjectID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrStorageQuotaNotFound
+		}
+		return nil, err
+	}
+	return quota, nil
+}
+
+// SetQuota creates or replaces the quota override of a user or role
+func (s *StorageQuotaService) SetQuota(subjectType, subjectID string, req *models.StorageQuotaRequest, updatedBy string) (*models.StorageQuota, error) {
+	for name, value := range map[string]*int64{"max_storage_bytes": req.MaxStorageBytes, "max_file_size_bytes": req.MaxFileSizeBytes} {
+		if value != nil && *value < 0 {
+			return nil, fmt.Errorf("%s must be >= 0 (0 = unlimited)", name)
+		}
+	}
+
+	var err error
+	switch subjectType {
+	case models.StorageQuotaSubjectUser:
+		_, err = s.userRepo.GetByID(subjectID)
+	case models.StorageQuotaSubjectRole:
+		_, err = s.roleRepo.GetByID(subjectID)
+	default:
+		return nil, fmt.Errorf("invalid subject type %q", subjectType)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s %s", ErrStorageQuotaSubjectNotFound, subjectType, subjectID)
+		}
+		return nil, err
+	}
+
+	quota := &models.StorageQuota{
+		SubjectType:      subjectType,
+		SubjectID:        subjectID,
+		MaxStorageBytes:  req.MaxStorageBytes,
+		MaxFileSizeBytes: req.MaxFileSizeBytes,
+		Note:             req.Note,
+		UpdatedBy:        updatedBy,
+	}
+	if req.AllowedMimeTypes != nil {
+		mimeTypes := models.StringArray(normalizeMimeTypes(*req.AllowedMimeTypes))
+		quota.AllowedMimeTypes = &mimeTypes
+	}
+	if err := s.quotaRepo.Upsert(quota); err != nil {
+		return nil, fmt.Errorf("failed to save storage quota: %w", err)
+	}
+	return s.quotaRepo.GetBySubject(subjectType, subjectID)
+}
+
+// DeleteQuota removes the quota override of a user or role (quay về kế thừa)
+func (s *StorageQuotaService) DeleteQuota(subjectType, subjectID string) error {
+	if err := s.quotaRepo.DeleteBySubject(subjectType, subjectID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrStorageQuotaNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// quotaLimitedReader fails with err once more than remaining bytes are read (dừng stream ngay khi vượt giới hạn)
+type quotaLimitedReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+func (r *quotaLimitedReader) Read(p []byte) (int, error) {
+	// Đọc tối đa remaining + 1 byte để phát hiện vượt giới hạn
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return 0, r.err
+	}
+	return n, err
+}
+
+// widerLimit returns the more permissive of two limits (nil = chưa đặt, 0 = không giới hạn)
+func widerLimit(current, candidate *int64) *int64 {
+	switch {
+	case candidate == nil:
+		return current
+	case current == nil:
+		return candidate
+	case *current == 0 || *candidate == 0:
+		unlimited := int64(0)
+		return &unlimited
+	case *candidate > *current:
+		return candidate
+	default:
+		return current
+	}
+}
+
+// mimeTypeAllowed matches a mime type against allowed patterns (vd: "application/pdf", "image/*"), rỗng = mọi loại
+func mimeTypeAllowed(mimeType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(mimeType))
+	}
+	for _, pattern := range allowed {
+		if pattern == "*/*" || pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeMimeTypes lowercases, trims and deduplicates mime type patterns
+func normalizeMimeTypes(mimeTypes []string) []string {
+	result := make([]string, 0, len(mimeTypes))
+	seen := make(map[string]bool)
+	for _, mimeType := range mimeTypes {
+		mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+		if mimeType == "" || seen[mimeType] {
+			continue
+		}
+		seen[mimeType] = true
+		result = append(result, mimeType)
+	}
+	return result
+}
+
+// parseMimeTypeList parses a comma separated mime type list
+func parseMimeTypeList(value string) []string {
+	return normalizeMimeTypes(strings.Split(value, ","))
+}
+
+// envMegabytes reads a size in MB from env (không đặt / không hợp lệ = 0 = không giới hạn)
+func envMegabytes(key string) int64 {
+	value, err := strconv.ParseInt(getEnv(key, "0"), 10, 64)
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value << 20
+}
@@ -0,0 +1,153 @@
+// Package textextract extracts plain text from uploaded documents (txt/md/csv..., docx, xlsx, pdf)
+package textextract
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Supported formats
+const (
+	FormatText = "text"
+	FormatDocx = "docx"
+	FormatXlsx = "xlsx"
+	FormatPDF  = "pdf"
+)
+
+var (
+	// ErrUnsupported is returned for formats without text extraction
+	ErrUnsupported = errors.New("unsupported file format for text extraction")
+	// ErrNoText is returned when a document has no readable text (vd: PDF scan, font encoding không giải mã được)
+	ErrNoText = errors.New("no extractable text")
+)
+
+// Result is the extracted text of a document
+type Result struct {
+	Format    string
+	Text      string // Tối đa maxBytes đầu tiên (cắt theo ký tự UTF-8)
+	Truncated bool   // Text bị cắt so với toàn bộ nội dung
+	CharCount int64  // Số ký tự của toàn bộ nội dung
+	WordCount int64
+}
+
+// textExtensions are extensions read as plain text (UTF-8)
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".csv": true, ".tsv": true, ".json": true,
+	".xml": true, ".html": true, ".htm": true, ".yaml": true, ".yml": true, ".log": true, ".srt": true, ".vtt": true,
+}
+
+// DetectFormat returns the extraction format of a file by extension / mime type, "" nếu không hỗ trợ
+func DetectFormat(fileName, mimeType string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	switch {
+	case ext == ".docx" || mimeType == "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return FormatDocx
+	case ext == ".xlsx" || mimeType == "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+		return FormatXlsx
+	case ext == ".pdf" || mimeType == "application/pdf":
+		return FormatPDF
+	case textExtensions[ext] || strings.HasPrefix(mimeType, "text/") || mimeType == "application/json":
+		return FormatText
+	}
+	return ""
+}
+
+// Extract extracts the text of a document, keeping the first maxBytes bytes và đếm ký tự / từ trên toàn bộ nội dung.
+// File upload không tin cậy: panic của parser với file hỏng được trả về như lỗi.
+func Extract(r io.ReaderAt, size int64, format string, maxBytes int) (result *Result, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result = nil
+			err = fmt.Errorf("failed to extract %s text: malformed document: %v", format, recovered)
+		}
+	}()
+
+	w := newTextWriter(maxBytes)
+	switch format {
+	case FormatText:
+		err = extractPlainText(io.NewSectionReader(r, 0, size), w)
+	case FormatDocx:
+		err = extractDocx(r, size, w)
+	case FormatXlsx:
+		err = extractXlsx(io.NewSectionReader(r, 0, size), w)
+	case FormatPDF:
+		err = extractPDF(io.NewSectionReader(r, 0, size), size, w)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %s text: %w", format, err)
+	}
+
+	return &Result{
+		Format:    format,
+		Text:      w.text.String(),
+		Truncated: w.truncated,
+		CharCount: w.chars,
+		WordCount: w.words,
+	}, nil
+}
+
+// textWriter keeps the first maxBytes of text and counts characters / words of everything written
+type textWriter struct {
+	text      strings.Builder
+	maxBytes  int
+	truncated bool
+	chars     int64
+	words     int64
+	inWord    bool
+	newlines  int // Số "\n" liên tiếp ở cuối
+}
+
+func newTextWriter(maxBytes int) *textWriter {
+	return &textWriter{maxBytes: maxBytes}
+}
+
+func (w *textWriter) WriteRune(r rune) {
+	// Bỏ ký tự điều khiển (Postgres TEXT không nhận NUL), giữ xuống dòng / tab
+	if r == utf8.RuneError || (unicode.IsControl(r) && r != '\n' && r != '\t') || r == '\uFEFF' {
+		return
+	}
+
+	w.chars++
+	if r == '\n' {
+		w.newlines++
+	} else {
+		w.newlines = 0
+	}
+	if unicode.IsSpace(r) {
+		w.inWord = false
+	} else if !w.inWord {
+		w.inWord = true
+		w.words++
+	}
+
+	if w.truncated {
+		return
+	}
+	if w.text.Len()+utf8.RuneLen(r) > w.maxBytes {
+		w.truncated = true
+		return
+	}
+	w.text.WriteRune(r)
+}
+
+func (w *textWriter) WriteString(s string) {
+	for _, r := range s {
+		w.WriteRune(r)
+	}
+}
+
+// newline ends a line, bỏ qua dòng trống liên tiếp
+func (w *textWriter) newline() {
+	if w.chars == 0 || w.newlines >= 2 {
+		return
+	}
+	w.WriteRune('\n')
+}
@@ -0,0 +1,126 @@
+package textextract
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxUnzippedBytes limits the uncompressed XML read from docx / xlsx (chống zip bomb)
+const maxUnzippedBytes = 256 << 20
+
+func extractPlainText(r io.Reader, w *textWriter) error {
+	reader := bufio.NewReader(r)
+	for {
+		ch, _, err := reader.ReadRune()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		w.WriteRune(ch)
+	}
+}
+
+// extractDocx reads the paragraphs of word/document.xml (w:t = text, w:tab, w:br, hết w:p = xuống dòng)
+func extractDocx(r io.ReaderAt, size int64, w *textWriter) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid docx: %w", err)
+	}
+
+	var document *zip.File
+	for _, f := range archive.File {
+		if f.Name == "word/document.xml" {
+			document = f
+			break
+		}
+	}
+	if document == nil {
+		return errors.New("invalid docx: word/document.xml not found")
+	}
+
+	rc, err := document.Open()
+	if err != nil {
+		return fmt.Errorf("invalid docx: %w", err)
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(io.LimitReader(rc, maxUnzippedBytes))
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid docx: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				w.WriteRune('\t')
+			case "br", "cr":
+				w.WriteRune('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				w.newline()
+			}
+		case xml.CharData:
+			if inText {
+				w.WriteString(string(t))
+			}
+		}
+	}
+}
+
+// extractXlsx writes each sheet as "## <sheet>" followed by tab-separated rows
+func extractXlsx(r io.Reader, w *textWriter) error {
+	workbook, err := excelize.OpenReader(r, excelize.Options{UnzipSizeLimit: maxUnzippedBytes, UnzipXMLSizeLimit: maxUnzippedBytes})
+	if err != nil {
+		return fmt.Errorf("invalid xlsx: %w", err)
+	}
+	defer workbook.Close()
+
+	for _, sheet := range workbook.GetSheetList() {
+		rows, err := workbook.Rows(sheet)
+		if err != nil {
+			return fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+		}
+
+		w.newline()
+		w.WriteString("## " + sheet + "\n")
+		for rows.Next() {
+			columns, err := rows.Columns()
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+			}
+			line := strings.TrimRight(strings.Join(columns, "\t"), "\t")
+			if line == "" {
+				continue
+			}
+			w.WriteString(line)
+			w.WriteRune('\n')
+		}
+		if err := rows.Close(); err != nil {
+			return fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,451 @@
+package textextract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const (
+	maxPDFStreamBytes   = 64 << 20  // Dung lượng tối đa của 1 content stream sau khi giải nén
+	maxPDFInflatedBytes = 256 << 20 // Tổng dung lượng giải nén của cả file
+	pdfStreamDictWindow = 4096      // Đọc dictionary của stream trong khoảng này trước từ khóa "stream"
+	minPDFReadableRatio = 0.85      // Tỷ lệ ký tự đọc được tối thiểu, thấp hơn = font encoding không giải mã được
+)
+
+// pdfSkippedStreams are markers of stream dictionaries that never contain page text (ảnh, font, metadata...)
+var pdfSkippedStreams = [][]byte{
+	[]byte("/Image"), []byte("/Length1"), []byte("/Length2"), []byte("/Length3"), []byte("/ObjStm"),
+	[]byte("/XRef"), []byte("/Metadata"), []byte("/EmbeddedFile"), []byte("/CMap"),
+}
+
+// cp1252 maps the bytes 0x80-0x9F of WinAnsiEncoding (phần còn lại trùng Latin-1)
+var cp1252 = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ', 0x89: '‰',
+	0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•',
+	0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// extractPDF extracts the text shown by text operators (Tj, TJ, ', ") of uncompressed / FlateDecode content streams.
+// Best effort: PDF scan (chỉ có ảnh) hoặc font encoding riêng (CID / Identity-H) không giải mã được → ErrNoText.
+func extractPDF(r io.Reader, size int64, w *textWriter) error {
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+	header := data
+	if len(header) > 1024 {
+		header = header[:1024]
+	}
+	if !bytes.Contains(header, []byte("%PDF-")) {
+		return errors.New("invalid pdf: missing header")
+	}
+
+	parser := &pdfContentParser{}
+	inflatedTotal := 0
+	pos := 0
+	for {
+		index := bytes.Index(data[pos:], []byte("stream"))
+		if index < 0 {
+			break
+		}
+		start := pos + index
+		pos = start + len("stream")
+		if start >= 3 && string(data[start-3:start]) == "end" {
+			continue
+		}
+
+		// Từ khóa stream theo sau bởi CRLF hoặc LF
+		body := pos
+		if body < len(data) && data[body] == '\r' {
+			body++
+		}
+		if body >= len(data) || data[body] != '\n' {
+			continue
+		}
+		body++
+		end := bytes.Index(data[body:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := data[body : body+end]
+		pos = body + end + len("endstream")
+
+		dict := data[max(0, start-pdfStreamDictWindow):start]
+		if objIndex := bytes.LastIndex(dict, []byte(" obj")); objIndex >= 0 {
+			dict = dict[objIndex:]
+		}
+		if skipPDFStream(dict) {
+			continue
+		}
+
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			zr, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			// Stream hỏng vẫn dùng phần đã giải nén được
+			content, _ = io.ReadAll(io.LimitReader(zr, maxPDFStreamBytes))
+			zr.Close()
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue // DCT, LZW, ... không phải content stream có text
+		}
+
+		inflatedTotal += len(content)
+		if inflatedTotal > maxPDFInflatedBytes {
+			break
+		}
+		if bytes.Contains(content, []byte("BT")) {
+			parser.parse(content)
+		}
+	}
+
+	text := parser.out.String()
+	if !readablePDFText(text) {
+		return ErrNoText
+	}
+	w.WriteString(text)
+	return nil
+}
+
+func skipPDFStream(dict []byte) bool {
+	for _, marker := range pdfSkippedStreams {
+		if bytes.Contains(dict, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// readablePDFText reports whether the text has letters and mostly printable characters
+func readablePDFText(text string) bool {
+	total, readable, letters := 0, 0, 0
+	for _, r := range text {
+		total++
+		if unicode.IsLetter(r) {
+			letters++
+		}
+		if unicode.IsPrint(r) || r == '\n' || r == '\t' {
+			readable++
+		}
+	}
+	return letters > 0 && float64(readable) >= minPDFReadableRatio*float64(total)
+}
+
+// pdfContentParser interprets the text operators of content streams
+type pdfContentParser struct {
+	out      strings.Builder
+	last     rune // Ký tự cuối đã ghi (0 = chưa ghi gì)
+	operands []pdfOperand
+	lastY    *float64
+}
+
+type pdfOperand struct {
+	text   []byte       // String (literal / hex)
+	number *float64     // Number
+	array  []pdfOperand // Array (TJ)
+}
+
+func (p *pdfContentParser) parse(content []byte) {
+	pos := 0
+	for pos < len(content) {
+		c := content[pos]
+		switch {
+		case isPDFWhitespace(c):
+			pos++
+		case c == '%':
+			for pos < len(content) && content[pos] != '\n' && content[pos] != '\r' {
+				pos++
+			}
+		case c == '(':
+			text, next := readPDFLiteralString(content, pos)
+			p.operands = append(p.operands, pdfOperand{text: text})
+			pos = next
+		case c == '<' && pos+1 < len(content) && content[pos+1] == '<':
+			pos += 2 // Dictionary (vd: BDC marked content), bỏ qua
+		case c == '>' && pos+1 < len(content) && content[pos+1] == '>':
+			pos += 2
+		case c == '<':
+			text, next := readPDFHexString(content, pos)
+			p.operands = append(p.operands, pdfOperand{text: text})
+			pos = next
+		case c == '[':
+			array, next := p.readArray(content, pos+1)
+			p.operands = append(p.operands, pdfOperand{array: array})
+			pos = next
+		case c == '/':
+			_, next := readPDFToken(content, pos+1)
+			p.operands = append(p.operands, pdfOperand{})
+			pos = next
+		case c == ']' || c == ')' || c == '>' || c == '{' || c == '}':
+			pos++
+		default:
+			token, next := readPDFToken(content, pos)
+			if next == pos {
+				next++
+			}
+			pos = next
+			if number, err := strconv.ParseFloat(token, 64); err == nil {
+				p.operands = append(p.operands, pdfOperand{number: &number})
+				continue
+			}
+			if token == "BI" {
+				pos = skipPDFInlineImage(content, pos)
+			}
+			p.operator(token)
+			p.operands = p.operands[:0]
+		}
+	}
+}
+
+func (p *pdfContentParser) readArray(content []byte, pos int) ([]pdfOperand, int) {
+	var array []pdfOperand
+	for pos < len(content) {
+		c := content[pos]
+		switch {
+		case c == ']':
+			return array, pos + 1
+		case isPDFWhitespace(c):
+			pos++
+		case c == '(':
+			text, next := readPDFLiteralString(content, pos)
+			array = append(array, pdfOperand{text: text})
+			pos = next
+		case c == '<':
+			text, next := readPDFHexString(content, pos)
+			array = append(array, pdfOperand{text: text})
+			pos = next
+		default:
+			token, next := readPDFToken(content, pos)
+			if next == pos {
+				next++
+			}
+			if number, err := strconv.ParseFloat(token, 64); err == nil {
+				array = append(array, pdfOperand{number: &number})
+			}
+			pos = next
+		}
+	}
+	return array, pos
+}
+
+func (p *pdfContentParser) operator(op string) {
+	switch op {
+	case "Tj":
+		p.writeLastString()
+	case "'", "\"":
+		p.newline()
+		p.writeLastString()
+	case "TJ":
+		if len(p.operands) == 0 {
+			return
+		}
+		for _, item := range p.operands[len(p.operands)-1].array {
+			if item.text != nil {
+				p.write(decodePDFString(item.text))
+			} else if item.number != nil && *item.number < -200 {
+				// Khoảng cách lớn giữa 2 đoạn trong TJ = dấu cách
+				p.space()
+			}
+		}
+	case "T*":
+		p.newline()
+	case "Td", "TD":
+		if ty := p.number(0); ty != 0 {
+			p.newline()
+		} else {
+			p.space()
+		}
+	case "Tm":
+		y := p.number(0)
+		if p.lastY != nil && *p.lastY != y {
+			p.newline()
+		} else {
+			p.space()
+		}
+		p.lastY = &y
+	case "ET":
+		p.space()
+	}
+}
+
+// number returns the numeric operand at position fromEnd (0 = operand cuối)
+func (p *pdfContentParser) number(fromEnd int) float64 {
+	index := len(p.operands) - 1 - fromEnd
+	if index < 0 || p.operands[index].number == nil {
+		return 0
+	}
+	return *p.operands[index].number
+}
+
+func (p *pdfContentParser) writeLastString() {
+	for i := len(p.operands) - 1; i >= 0; i-- {
+		if p.operands[i].text != nil {
+			p.write(decodePDFString(p.operands[i].text))
+			return
+		}
+	}
+}
+
+func (p *pdfContentParser) write(text string) {
+	for _, r := range text {
+		p.out.WriteRune(r)
+		p.last = r
+	}
+}
+
+func (p *pdfContentParser) newline() {
+	if p.last == 0 || p.last == '\n' {
+		return
+	}
+	p.write("\n")
+}
+
+func (p *pdfContentParser) space() {
+	if p.last == 0 || p.last == ' ' || p.last == '\n' {
+		return
+	}
+	p.write(" ")
+}
+
+// decodePDFString decodes a text string: UTF-16BE (BOM FE FF) hoặc byte đơn theo WinAnsiEncoding
+func decodePDFString(text []byte) string {
+	if len(text) >= 2 && text[0] == 0xFE && text[1] == 0xFF {
+		units := make([]uint16, 0, (len(text)-2)/2)
+		for i := 2; i+1 < len(text); i += 2 {
+			units = append(units, uint16(text[i])<<8|uint16(text[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+
+	var b strings.Builder
+	for _, c := range text {
+		if r, ok := cp1252[c]; ok {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func readPDFToken(content []byte, pos int) (string, int) {
+	start := pos
+	for pos < len(content) && !isPDFWhitespace(content[pos]) && !isPDFDelimiter(content[pos]) {
+		pos++
+	}
+	return string(content[start:pos]), pos
+}
+
+// readPDFLiteralString reads "(...)" with escapes and balanced parentheses, pos trỏ vào "("
+func readPDFLiteralString(content []byte, pos int) ([]byte, int) {
+	var out []byte
+	depth := 0
+	for pos < len(content) {
+		c := content[pos]
+		switch {
+		case c == '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+			pos++
+		case c == ')':
+			depth--
+			pos++
+			if depth == 0 {
+				return out, pos
+			}
+			out = append(out, c)
+		case c == '\\' && pos+1 < len(content):
+			pos++
+			escaped := content[pos]
+			switch escaped {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				// Backslash + xuống dòng = nối dòng
+				if pos+1 < len(content) && content[pos+1] == '\n' {
+					pos++
+				}
+			case '\n':
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					value, digits := 0, 0
+					for digits < 3 && pos < len(content) && content[pos] >= '0' && content[pos] <= '7' {
+						value = value*8 + int(content[pos]-'0')
+						pos++
+						digits++
+					}
+					out = append(out, byte(value))
+					continue
+				}
+				out = append(out, escaped)
+			}
+			pos++
+		default:
+			out = append(out, c)
+			pos++
+		}
+	}
+	return out, pos
+}
+
+// readPDFHexString reads "<...>", pos trỏ vào "<"
+func readPDFHexString(content []byte, pos int) ([]byte, int) {
+	pos++
+	var digits []byte
+	for pos < len(content) && content[pos] != '>' {
+		if c := content[pos]; strings.IndexByte("0123456789abcdefABCDEF", c) >= 0 {
+			digits = append(digits, c)
+		}
+		pos++
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		value, _ := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		out = append(out, byte(value))
+	}
+	return out, pos + 1
+}
+
+// skipPDFInlineImage skips the data of an inline image (BI ... ID <data> EI)
+func skipPDFInlineImage(content []byte, pos int) int {
+	idIndex := bytes.Index(content[pos:], []byte("ID"))
+	if idIndex < 0 {
+		return len(content)
+	}
+	pos += idIndex + 2
+	for pos+2 < len(content) {
+		if isPDFWhitespace(content[pos]) && content[pos+1] == 'E' && content[pos+2] == 'I' &&
+			(pos+3 == len(content) || isPDFWhitespace(content[pos+3])) {
+			return pos + 3
+		}
+		pos++
+	}
+	return len(content)
+}
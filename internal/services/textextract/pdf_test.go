@@ -0,0 +1,84 @@
+package textextract
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// samplePDF is a minimal one-page PDF with an uncompressed content stream
+const samplePDF = "%PDF-1.4\n" +
+	"1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+	"2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n" +
+	"3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>\nendobj\n" +
+	"4 0 obj\n<< /Length 44 >>\nstream\nBT /F1 12 Tf 72 712 Td (Hello PDF world) Tj ET\nendstream\nendobj\n" +
+	"trailer\n<< /Root 1 0 R >>\n%%EOF\n"
+
+func TestExtractPDF(t *testing.T) {
+	result, err := Extract(strings.NewReader(samplePDF), int64(len(samplePDF)), FormatPDF, 1024)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if !strings.Contains(result.Text, "Hello PDF world") {
+		t.Errorf("Extract() text = %q, want it to contain %q", result.Text, "Hello PDF world")
+	}
+	if result.WordCount != 3 {
+		t.Errorf("Extract() word count = %d, want 3", result.WordCount)
+	}
+}
+
+func TestExtractPDFMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"garbage", "\x00\xff\x13garbage that is not a pdf at all"},
+		{"header only", "%PDF-1.7\n"},
+		{"stream without end", "%PDF-1.4\n4 0 obj\n<< /Length 20 >>\nstream\nBT (unterminated"},
+		{"broken flate stream", "%PDF-1.4\n4 0 obj\n<< /Filter /FlateDecode >>\nstream\n\x78\x9c\x00\x01garbage\nendstream\n"},
+		{"unbalanced operators", "%PDF-1.4\n4 0 obj\n<<>>\nstream\nBT ] ] [ <4 (( \\\nendstream\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Extract(strings.NewReader(tt.content), int64(len(tt.content)), FormatPDF, 1024); err == nil {
+				t.Error("Extract() error = nil, want an error for malformed pdf")
+			}
+		})
+	}
+}
+
+func TestExtractPDFTruncated(t *testing.T) {
+	// Mọi điểm cắt của file (upload bị ngắt giữa chừng) phải trả về kết quả hoặc lỗi, không panic
+	for size := 0; size < len(samplePDF); size++ {
+		func() {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					t.Fatalf("extractPDF() panicked on pdf truncated at %d bytes: %v", size, recovered)
+				}
+			}()
+			content := samplePDF[:size]
+			err := extractPDF(strings.NewReader(content), int64(size), newTextWriter(1024))
+			if err != nil && size > len("%PDF-1.4\n") && !errors.Is(err, ErrNoText) {
+				t.Errorf("extractPDF() truncated at %d bytes error = %v, want nil or ErrNoText", size, err)
+			}
+		}()
+	}
+}
+
+// panicReader simulates a parser bug on a malformed document
+type panicReader struct{}
+
+func (panicReader) ReadAt(p []byte, off int64) (int, error) {
+	panic("index out of range")
+}
+
+func TestExtractRecoversPanic(t *testing.T) {
+	result, err := Extract(panicReader{}, 128, FormatPDF, 1024)
+	if err == nil || result != nil {
+		t.Fatalf("Extract() = %v, %v, want a malformed document error", result, err)
+	}
+	if !strings.Contains(err.Error(), "malformed document") {
+		t.Errorf("Extract() error = %v, want malformed document error", err)
+	}
+}
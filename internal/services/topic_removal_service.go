@@ -0,0 +1,275 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// defaultTopicPurgeGraceDays is the number of days a removed topic is kept before being purged
+const defaultTopicPurgeGraceDays = 7
+
+// topicPurgeBatchSize is the number of topics purged per query
+const topicPurgeBatchSize = 100
+
+var (
+	// ErrTopicNotRemoved is returned when restoring a topic that is not removed
+	ErrTopicNotRemoved = errors.New("topic is not removed")
+	// ErrTopicNotFound is returned when the topic does not exist or is not visible to the user
+	ErrTopicNotFound = errors.New("topic not found")
+	// ErrProjectNotRemoved is returned when restoring a project that is not marked failed
+	ErrProjectNotRemoved = errors.New("project is not removed")
+)
+
+// TopicRemovalTrigger describes what caused a topic to be removed (lưu vào audit)
+type TopicRemovalTrigger struct {
+	Type    string // models.TopicRemovalTrigger*
+	Reason  string
+	Details map[string]interface{}
+}
+
+// TopicRemovalService removes topics safely: soft delete with a failed/orphaned state,
+// có thể restore trong grace period, sau đó mới purge (xóa hẳn cùng scripts/assignments).
+type TopicRemovalService struct {
+	topicRepo   *repository.TopicRepository
+	removalRepo *repository.TopicRemovalRepository
+	gracePeriod time.Duration
+}
+
+// NewTopicRemovalService creates a topic removal service.
+// Grace period: TOPIC_PURGE_GRACE_DAYS (default 7 ngày).
+func NewTopicRemovalService(topicRepo *repository.TopicRepository, removalRepo *repository.TopicRemovalRepository) *TopicRemovalService {
+	graceDays := defaultTopicPurgeGraceDays
+	if value, err := strconv.Atoi(getEnv("TOPIC_PURGE_GRACE_DAYS", "")); err == nil && value >= 0 {
+		graceDays = value
+	}
+
+	return &TopicRemovalService{
+		topicRepo:   topicRepo,
+		removalRepo: removalRepo,
+		gracePeriod: time.Duration(graceDays) * 24 * time.Hour,
+	}
+}
+
+// RemoveTopic soft-deletes a topic and records what triggered it.
+// Topic đã bị gỡ trước đó thì bỏ qua (không tạo thêm audit).
+func (s *TopicRemovalService) RemoveTopic(topicID, state string, trigger TopicRemovalTrigger) (*models.TopicRemoval, error) {
+	topic, err := s.topicRepo.GetByID(topicID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.Debugf("Topic %s not found or already removed, skipping removal (%s)", topicID, trigger.Reason)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get topic: %w", err)
+	}
+
+	var details models.JSON
+	if len(trigger.Details) > 0 {
+		details = models.JSON(trigger.Details)
+	}
+
+	now := time.Now()
+	removal := &models.TopicRemoval{
+		TopicID:        topic.ID,
+		TopicName:      topic.Name,
+		UserProfileID:  topic.UserProfileID,
+		State:          state,
+		TriggerType:    trigger.Type,
+		Reason:         trigger.Reason,
+		TriggerDetails: details,
+		RemovedAt:      now,
+		PurgeAfter:     now.Add(s.gracePeriod),
+	}
+	if err := s.removalRepo.RemoveTopic(removal, trigger.Reason); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to remove topic: %w", err)
+	}
+
+	logrus.Warnf("Topic %s (%s) removed as %s: %s, restorable until %s", topic.ID, topic.Name, state, trigger.Reason, removal.PurgeAfter.Format(time.RFC3339))
+	return removal, nil
+}
+
+// RestoreTopic restores a removed topic (creator or admin)
+func (s *TopicRemovalService) RestoreTopic(topicID, userID string, isAdmin bool) (*models.Topic, error) {
+	topic, err := s.topicRepo.GetRemovedByID(topicID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if _, activeErr := s.topicRepo.GetByID(topicID); activeErr == nil {
+				return nil, ErrTopicNotRemoved
+			}
+			return nil, ErrTopicNotFound
+		}
+		return nil, fmt.Errorf("failed to get topic: %w", err)
+	}
+
+	if !isAdmin && topic.UserProfile.UserID != userID {
+		// Không lộ thông tin topic của người khác
+		return nil, ErrTopicNotFound
+	}
+
+	if err := s.removalRepo.RestoreTopic(topicID, userID, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to restore topic: %w", err)
+	}
+
+	logrus.Infof("Topic %s (%s) restored by %s", topic.ID, topic.Name, userID)
+	return s.topicRepo.GetByID(topicID)
+}
+
+// GetRemovedTopics retrieves removed topics with their current removal record (own topics, admin: all)
+func (s *TopicRemovalService) GetRemovedTopics(userID string, isAdmin bool, page, pageSize int) ([]*models.Topic, map[string]*models.TopicRemoval, int64, error) {
+	ownerID := userID
+	if isAdmin {
+		ownerID = ""
+	}
+
+	topics, total, err := s.topicRepo.GetRemovedPaginated(ownerID, page, pageSize)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	topicIDs := make([]string, len(topics))
+	for i, topic := range topics {
+		topicIDs[i] = topic.ID
+	}
+	removals, err := s.removalRepo.GetOpenByTopicIDs(topicIDs)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return topics, removals, total, nil
+}
+
+// RemoveProject marks a project as failed and records what triggered it; project bị xóa bởi purge job sau grace period (như topic).
+// Project đã bị đánh dấu lỗi trước đó thì bỏ qua (không tạo thêm audit).
+func (s *TopicRemovalService) RemoveProject(topicID, scriptID, projectID string, trigger TopicRemovalTrigger) (*models.TopicRemoval, error) {
+	topic, err := s.topicRepo.GetByID(topicID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.Debugf("Topic %s not found or removed, skipping removal of project %s (%s)", topicID, projectID, trigger.Reason)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get topic: %w", err)
+	}
+
+	var details models.JSON
+	if len(trigger.Details) > 0 {
+		details = models.JSON(trigger.Details)
+	}
+
+	now := time.Now()
+	removal := &models.TopicRemoval{
+		TopicID:        topic.ID,
+		TopicName:      topic.Name,
+		UserProfileID:  topic.UserProfileID,
+		ScriptID:       &scriptID,
+		ProjectID:      &projectID,
+		State:          models.TopicRemovalStateFailed,
+		TriggerType:    trigger.Type,
+		Reason:         trigger.Reason,
+		TriggerDetails: details,
+		RemovedAt:      now,
+		PurgeAfter:     now.Add(s.gracePeriod),
+	}
+	if err := s.removalRepo.MarkProjectFailed(removal); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.Debugf("Project %s of script %s not found or already failed, skipping removal", projectID, scriptID)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to mark project failed: %w", err)
+	}
+
+	logrus.Warnf("Project %s of topic %s marked failed: %s, restorable until %s", projectID, topic.ID, trigger.Reason, removal.PurgeAfter.Format(time.RFC3339))
+	return removal, nil
+}
+
+// RestoreProject restores a failed project of an active topic before it is purged (creator or admin).
+// Project của topic đang bị gỡ được restore cùng topic (RestoreTopic).
+func (s *TopicRemovalService) RestoreProject(topicID, projectID, userID string, isAdmin bool) error {
+	topic, err := s.topicRepo.GetByID(topicID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTopicNotFound
+		}
+		return fmt.Errorf("failed to get topic: %w", err)
+	}
+
+	if !isAdmin && topic.UserProfile.UserID != userID {
+		// Không lộ thông tin topic của người khác
+		return ErrTopicNotFound
+	}
+
+	if err := s.removalRepo.RestoreProject(topicID, projectID, userID, time.Now()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProjectNotRemoved
+		}
+		return fmt.Errorf("failed to restore project: %w", err)
+	}
+
+	logrus.Infof("Project %s of topic %s restored by %s", projectID, topicID, userID)
+	return nil
+}
+
+// PurgeExpiredProjects permanently deletes failed projects whose grace period has ended
+func (s *TopicRemovalService) PurgeExpiredProjects() {
+	purged, err := s.removalRepo.PurgeFailedProjects(time.Now())
+	if err != nil {
+		logrus.Errorf("Failed to purge failed projects: %v", err)
+		return
+	}
+	if purged > 0 {
+		logrus.Infof("Project purge completed: purged %d failed projects", purged)
+	}
+}
+
+// PurgeExpiredTopics permanently deletes removed topics whose grace period has ended
+func (s *TopicRemovalService) PurgeExpiredTopics() {
+	purged := 0
+	for {
+		topics, err := s.topicRepo.GetExpiredRemoved(time.Now(), topicPurgeBatchSize)
+		if err != nil {
+			logrus.Errorf("Failed to get expired removed topics: %v", err)
+			return
+		}
+
+		for _, topic := range topics {
+			if err := s.removalRepo.PurgeTopic(topic.ID, time.Now()); err != nil {
+				logrus.Errorf("Failed to purge topic %s: %v", topic.ID, err)
+				return
+			}
+			purged++
+			logrus.Warnf("Purged topic %s (%s) removed as %s", topic.ID, topic.Name, topic.RemovalState)
+		}
+
+		if len(topics) < topicPurgeBatchSize {
+			break
+		}
+	}
+
+	if purged > 0 {
+		logrus.Infof("Topic purge completed: purged %d removed topics", purged)
+	}
+}
+
+// StartPurgeJob periodically purges expired removed topics and failed projects
+func (s *TopicRemovalService) StartPurgeJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		s.PurgeExpiredTopics()
+		s.PurgeExpiredProjects()
+		for range ticker.C {
+			s.PurgeExpiredTopics()
+			s.PurgeExpiredProjects()
+		}
+	}()
+	logrus.Infof("Topic purge job started (interval: %v, grace period: %v)", interval, s.gracePeriod)
+}
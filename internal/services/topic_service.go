@@ -3,18 +3,26 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
-	"sync"
 	"time"
 	"unicode"
 
 	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
 	"github.com/onegreenvn/green-provider-services-backend/internal/models"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTopicAccessDenied is returned when a user can not access a topic (không phải creator, không được assign)
+	ErrTopicAccessDenied = errors.New("topic not found")
+	// ErrTopicPermissionDenied is returned when the topic permission of a user is lower than required
+	ErrTopicPermissionDenied = errors.New("insufficient topic permission")
 )
 
 type TopicService struct {
@@ -28,12 +36,10 @@ type TopicService struct {
 	fileService          *FileService          // FileService để lấy files mới nhất của user
 	geminiAccountService *GeminiAccountService // For getting available Gemini account
 	baseURL              string                // Base URL để generate download URLs cho files
-	// In-memory cache để lưu file IDs vừa upload theo userID
-	// Key: userID, Value: []string (file IDs)
-	recentUploadedFiles sync.Map // map[string][]string
+	uploadStaging        *UploadStagingService // File knowledge vừa upload chờ tạo gem (lưu DB)
 }
 
-func NewTopicService(topicRepo *repository.TopicRepository, topicUserRepo *repository.TopicUserRepository, userProfileRepo *repository.UserProfileRepository, appRepo *repository.AppRepository, boxRepo *repository.BoxRepository, chromeProfileService *ChromeProfileService, processLogService *ProcessLogService, fileService *FileService, geminiAccountService *GeminiAccountService) *TopicService {
+func NewTopicService(topicRepo *repository.TopicRepository, topicUserRepo *repository.TopicUserRepository, userProfileRepo *repository.UserProfileRepository, appRepo *repository.AppRepository, boxRepo *repository.BoxRepository, chromeProfileService *ChromeProfileService, processLogService *ProcessLogService, fileService *FileService, geminiAccountService *GeminiAccountService, uploadStaging *UploadStagingService) *TopicService {
 	// Get base URL from environment
 	baseURL := os.Getenv("BASE_URL")
 	if baseURL == "" {
@@ -56,6 +62,7 @@ func NewTopicService(topicRepo *repository.TopicRepository, topicUserRepo *repos
 		fileService:          fileService,
 		geminiAccountService: geminiAccountService,
 		baseURL:              baseURL,
+		uploadStaging:        uploadStaging,
 	}
 }
 
@@ -166,51 +173,34 @@ func (s *TopicService) CreateTopic(userID string, req *models.CreateTopicRequest
 	return topic, nil
 }
 
-// AddUploadedFiles lưu file IDs vừa upload vào cache
+// AddUploadedFiles stage file IDs vừa upload làm knowledge cho gem tạo tiếp theo
 // Được gọi từ FileHandler sau khi upload thành công
 func (s *TopicService) AddUploadedFiles(userID string, fileIDs []string) {
-	if len(fileIDs) == 0 {
+	if s.uploadStaging == nil {
 		return
 	}
-
-	// Lấy file IDs hiện có (nếu có)
-	existing, _ := s.recentUploadedFiles.LoadOrStore(userID, []string{})
-	existingIDs := existing.([]string)
-
-	// Thêm file IDs mới vào (append, không duplicate)
-	existingMap := make(map[string]bool)
-	for _, id := range existingIDs {
-		existingMap[id] = true
+	if err := s.uploadStaging.StageKnowledgeFiles(userID, fileIDs); err != nil {
+		logrus.Warnf("Failed to stage knowledge files for user %s: %v", userID, err)
 	}
-
-	newIDs := make([]string, 0, len(existingIDs)+len(fileIDs))
-	newIDs = append(newIDs, existingIDs...)
-
-	for _, id := range fileIDs {
-		if !existingMap[id] {
-			newIDs = append(newIDs, id)
-		}
-	}
-
-	s.recentUploadedFiles.Store(userID, newIDs)
 }
 
-// GetAndClearUploadedFiles lấy file IDs từ cache và xóa sau khi lấy
+// GetAndClearUploadedFiles lấy file IDs knowledge đang stage và đánh dấu đã dùng
 // Được gọi khi tạo Gem để lấy chính xác files vừa upload
 func (s *TopicService) GetAndClearUploadedFiles(userID string) []string {
-	// Lấy file IDs từ cache
-	value, ok := s.recentUploadedFiles.LoadAndDelete(userID)
-	if !ok {
+	if s.uploadStaging == nil {
+		return []string{}
+	}
+	fileIDs, err := s.uploadStaging.ConsumeKnowledgeFiles(userID)
+	if err != nil {
+		logrus.Warnf("Failed to get staged knowledge files for user %s: %v", userID, err)
 		return []string{}
 	}
-
-	fileIDs := value.([]string)
 	return fileIDs
 }
 
-// getRecentUserFilesAsURLs lấy files vừa upload từ cache và convert thành download URLs
+// getRecentUserFilesAsURLs lấy files knowledge đang stage và convert thành download URLs
 func (s *TopicService) getRecentUserFilesAsURLs(userID string) []string {
-	// Lấy file IDs từ cache (chính xác files vừa upload)
+	// Lấy file IDs đang stage (chính xác files vừa upload)
 	fileIDs := s.GetAndClearUploadedFiles(userID)
 
 	if len(fileIDs) == 0 {
@@ -404,34 +394,67 @@ func (s *TopicService) GetAllTopicsByUserIDPaginated(userID string, page, pageSi
 	return s.topicRepo.GetByUserIDIncludingAssignedPaginated(userID, assignedTopicIDs, page, pageSize)
 }
 
-// CanUserAccessTopic checks if a user can access a topic (creator, assigned, or admin)
+// CanUserAccessTopic checks if a user can access a topic (creator, assigned, or admin) with at least read permission
 func (s *TopicService) CanUserAccessTopic(userID string, topicID string, isAdmin bool) (bool, string, error) {
+	permission, accessType, err := s.GetTopicPermission(userID, topicID, isAdmin)
+	if err != nil {
+		return false, "", err
+	}
+	return permission != "", accessType, nil
+}
+
+// GetTopicPermission returns the permission of a user on a topic and how the user accesses it:
+// admin và creator có quyền full, user được assign có TopicUser.PermissionType, "" nếu không có quyền.
+func (s *TopicService) GetTopicPermission(userID string, topicID string, isAdmin bool) (string, string, error) {
 	// Admin can access all topics
 	if isAdmin {
-		return true, "admin", nil
+		return models.TopicPermissionFull, "admin", nil
 	}
 
 	// Get topic
 	topic, err := s.topicRepo.GetByID(topicID)
 	if err != nil {
-		return false, "", fmt.Errorf("topic not found: %w", err)
+		return "", "", fmt.Errorf("topic not found: %w", err)
 	}
 
 	// Check if user is creator
 	if topic.UserProfile.UserID == userID {
-		return true, "creator", nil
+		return models.TopicPermissionFull, "creator", nil
 	}
 
 	// Check if user is assigned
-	isAssigned, err := s.topicUserRepo.IsUserAssigned(topicID, userID)
+	assignment, err := s.topicUserRepo.GetByTopicAndUser(topicID, userID)
 	if err != nil {
-		return false, "", fmt.Errorf("failed to check assignment: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("failed to check assignment: %w", err)
 	}
-	if isAssigned {
-		return true, "assigned", nil
+	if !models.IsValidTopicPermission(assignment.PermissionType) {
+		logrus.Warnf("Unknown permission type %q for user %s on topic %s", assignment.PermissionType, userID, topicID)
+		return "", "", nil
 	}
+	return assignment.PermissionType, "assigned", nil
+}
 
-	return false, "", nil
+// AuthorizeTopic checks that a user has at least the required permission on a topic.
+// Trả về ErrTopicAccessDenied nếu user không truy cập được topic (handler trả 404, không lộ topic tồn tại)
+// và ErrTopicPermissionDenied nếu quyền không đủ (403).
+func (s *TopicService) AuthorizeTopic(userID string, topicID string, isAdmin bool, required string) (string, error) {
+	permission, accessType, err := s.GetTopicPermission(userID, topicID, isAdmin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrTopicAccessDenied
+		}
+		return "", err
+	}
+	if permission == "" {
+		return "", ErrTopicAccessDenied
+	}
+	if !models.TopicPermissionAllows(permission, required) {
+		return accessType, fmt.Errorf("%w: %s permission required, user has %s", ErrTopicPermissionDenied, required, permission)
+	}
+	return accessType, nil
 }
 
 // GetTopicByID retrieves a topic by ID
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/onegreenvn/green-provider-services-backend/internal/database/repository"
+	"github.com/onegreenvn/green-provider-services-backend/internal/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUploadStagingTTLHours = 24
+	uploadStagingCleanupBatch    = 200
+)
+
+// UploadStagingService keeps uploaded files waiting to be attached to a script prompt (SaveScript)
+// hoặc làm knowledge cho gem tạo tiếp theo. Lưu trong DB (upload_stagings) thay vì sync.Map theo user,
+// nên không mất khi restart và dùng chung giữa các replica.
+type UploadStagingService struct {
+	stagingRepo    *repository.UploadStagingRepository
+	fileService    *FileService
+	manageService  *FileManagementService
+	ttl            time.Duration
+	deleteAbandons bool
+}
+
+// NewUploadStagingService creates an upload staging service.
+// UPLOAD_STAGING_TTL_HOURS (default 24): thời gian chờ trước khi upload bị coi là bỏ dở.
+// UPLOAD_STAGING_DELETE_ABANDONED (default true): xóa file của upload bỏ dở nếu không prompt nào dùng.
+func NewUploadStagingService(stagingRepo *repository.UploadStagingRepository, fileService *FileService, manageService *FileManagementService) *UploadStagingService {
+	ttlHours := defaultUploadStagingTTLHours
+	if value, err := strconv.Atoi(getEnv("UPLOAD_STAGING_TTL_HOURS", "")); err == nil && value > 0 {
+		ttlHours = value
+	}
+	deleteAbandons := true
+	if value, err := strconv.ParseBool(getEnv("UPLOAD_STAGING_DELETE_ABANDONED", "")); err == nil {
+		deleteAbandons = value
+	}
+
+	return &UploadStagingService{
+		stagingRepo:    stagingRepo,
+		fileService:    fileService,
+		manageService:  manageService,
+		ttl:            time.Duration(ttlHours) * time.Hour,
+		deleteAbandons: deleteAbandons,
+	}
+}
+
+// StagePromptFiles stages files uploaded for a prompt (project_id + temp prompt_id của frontend)
+func (s *UploadStagingService) StagePromptFiles(userID, projectID, tempPromptID string, fileIDs []string) error {
+	return s.stage(userID, models.UploadStagingKindPrompt, projectID, tempPromptID, fileIDs)
+}
+
+// StageKnowledgeFiles stages files uploaded as knowledge for the next gem of a user
+func (s *UploadStagingService) StageKnowledgeFiles(userID string, fileIDs []string) error {
+	return s.stage(userID, models.UploadStagingKindKnowledge, "", "", fileIDs)
+}
+
+func (s *UploadStagingService) stage(userID, kind, projectID, tempPromptID string, fileIDs []string) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+
+	expiresAt := time.Now().Add(s.ttl)
+	stagings := make([]*models.UploadStaging, 0, len(fileIDs))
+	for _, fileID := range fileIDs {
+		stagings = append(stagings, &models.UploadStaging{
+			UserID:       userID,
+			Kind:         kind,
+			ProjectID:    projectID,
+			TempPromptID: tempPromptID,
+			FileID:       fileID,
+			ExpiresAt:    expiresAt,
+		})
+	}
+	if err := s.stagingRepo.CreateBatch(stagings); err != nil {
+		return fmt.Errorf("failed to stage uploaded files: %w", err)
+	}
+	return nil
+}
+
+// GetPendingPromptFiles retrieves the staged uploads of a prompt chưa được SaveScript consume
+func (s *UploadStagingService) GetPendingPromptFiles(userID, projectID, tempPromptID string) ([]*models.UploadStaging, error) {
+	return s.stagingRepo.GetPending(userID, models.UploadStagingKindPrompt, projectID, tempPromptID)
+}
+
+// ConsumeKnowledgeFiles atomically takes the staged knowledge files of a user (dùng khi tạo gem)
+func (s *UploadStagingService) ConsumeKnowledgeFiles(userID string) ([]string, error) {
+	stagings, err := s.stagingRepo.ConsumePending(userID, models.UploadStagingKindKnowledge, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume staged knowledge files: %w", err)
+	}
+
+	// RETURNING không đảm bảo thứ tự → sắp theo thứ tự upload
+	sort.SliceStable(stagings, func(i, j int) bool {
+		return stagings[i].CreatedAt.Before(stagings[j].CreatedAt)
+	})
+	fileIDs := make([]string, 0, len(stagings))
+	for _, staging := range stagings {
+		fileIDs = append(fileIDs, staging.FileID)
+	}
+	return fileIDs, nil
+}
+
+// CleanupAbandoned removes expired staged uploads và file của chúng nếu không còn được dùng
+func (s *UploadStagingService) CleanupAbandoned() {
+	now := time.Now()
+	cleaned, deletedFiles := 0, 0
+	for {
+		stagings, err := s.stagingRepo.GetAbandoned(now, uploadStagingCleanupBatch)
+		if err != nil {
+			logrus.Errorf("Failed to get abandoned staged uploads: %v", err)
+			return
+		}
+
+		for _, staging := range stagings {
+			if s.deleteAbandons {
+				deleted, err := s.deleteAbandonedFile(staging)
+				if err != nil {
+					logrus.Warnf("Failed to delete file %s of abandoned staged upload %s: %v", staging.FileID, staging.ID, err)
+				} else if deleted {
+					deletedFiles++
+				}
+			}
+			if err := s.stagingRepo.Delete(staging.ID); err != nil {
+				logrus.Errorf("Failed to delete abandoned staged upload %s: %v", staging.ID, err)
+				return
+			}
+			cleaned++
+		}
+
+		if len(stagings) < uploadStagingCleanupBatch {
+			break
+		}
+	}
+
+	// Bản ghi đã consume chỉ giữ lại để tra cứu trong 1 TTL
+	consumed, err := s.stagingRepo.DeleteConsumedBefore(now.Add(-s.ttl))
+	if err != nil {
+		logrus.Errorf("Failed to delete consumed staged uploads: %v", err)
+	}
+
+	if cleaned > 0 || consumed > 0 {
+		logrus.Infof("Upload staging cleanup: removed %d abandoned (%d files deleted) and %d consumed staged uploads", cleaned, deletedFiles, consumed)
+	}
+}
+
+// deleteAbandonedFile deletes the file of an abandoned staged upload unless it is still used
+// (prompt tham chiếu, đang stage ở chỗ khác, hoặc là output của execution)
+func (s *UploadStagingService) deleteAbandonedFile(staging *models.UploadStaging) (bool, error) {
+	file, err := s.fileService.GetFile(staging.FileID, staging.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if file.ExecutionID != nil {
+		return false, nil
+	}
+
+	pending, err := s.stagingRepo.CountPendingByFileID(file.ID, staging.ID)
+	if err != nil {
+		return false, err
+	}
+	if pending > 0 {
+		return false, nil
+	}
+
+	references, err := s.manageService.GetReferences(file)
+	if err != nil {
+		return false, err
+	}
+	if len(references) > 0 {
+		return false, nil
+	}
+
+	if err := s.fileService.DeleteFile(file); err != nil {
+		return false, err
+	}
+	logrus.Infof("Deleted file %s (%s) of abandoned staged upload", file.ID, file.OriginalName)
+	return true, nil
+}
+
+// StartCleanupJob periodically removes abandoned staged uploads
+func (s *UploadStagingService) StartCleanupJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		s.CleanupAbandoned()
+		for range ticker.C {
+			s.CleanupAbandoned()
+		}
+	}()
+	logrus.Infof("Upload staging cleanup job started (interval: %v, ttl: %v, delete abandoned files: %v)", interval, s.ttl, s.deleteAbandons)
+}
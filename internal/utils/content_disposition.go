@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ContentDisposition builds a Content-Disposition header value (RFC 6266) for a file name.
+// Tên có ký tự ngoài ASCII (vd: tiếng Việt) được gửi qua filename* (UTF-8, RFC 5987),
+// kèm filename ASCII đã bỏ dấu cho client cũ.
+func ContentDisposition(disposition, fileName string) string {
+	fallback := asciiFileName(fileName)
+	value := disposition + `; filename="` + fallback + `"`
+	if fallback != fileName {
+		value += "; filename*=UTF-8''" + encodeRFC5987(fileName)
+	}
+	return value
+}
+
+// asciiFileName removes diacritics and replaces characters not allowed in a quoted filename
+func asciiFileName(fileName string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(fileName) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Dấu tách ra sau NFD
+		case r == 'đ':
+			b.WriteRune('d')
+		case r == 'Đ':
+			b.WriteRune('D')
+		case r == '"' || r == '\\' || r < 0x20 || r == 0x7f:
+			b.WriteRune('_')
+		case r > unicode.MaxASCII:
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// encodeRFC5987 percent-encodes a value for an ext-value (chỉ giữ attr-char)
+func encodeRFC5987(value string) string {
+	encoded := url.PathEscape(value)
+	// PathEscape giữ lại ":", "=", "@" (không thuộc attr-char)
+	return strings.NewReplacer(":", "%3A", "=", "%3D", "@", "%40").Replace(encoded)
+}